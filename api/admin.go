@@ -0,0 +1,223 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/models"
+	"chatroom/services"
+)
+
+// AdminController 管理员控制器
+type AdminController struct {
+	WSManager          *services.WebSocketManager
+	MessageService     *services.MessageService
+	MaintenanceService *services.MaintenanceService
+}
+
+// NewAdminController 创建管理员控制器
+func NewAdminController(wsManager *services.WebSocketManager, messageService *services.MessageService, maintenanceService *services.MaintenanceService) *AdminController {
+	return &AdminController{
+		WSManager:          wsManager,
+		MessageService:     messageService,
+		MaintenanceService: maintenanceService,
+	}
+}
+
+// DisconnectUser 强制断开用户的WebSocket连接（仅管理员），可选临时禁止重连
+func (c *AdminController) DisconnectUser(ctx *gin.Context) {
+	targetID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req models.DisconnectRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	// 先设置禁止重连，避免断开后客户端立即重连成功
+	if req.BanSeconds > 0 {
+		if err := c.WSManager.BanConnections(uint(targetID), time.Duration(req.BanSeconds)*time.Second); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "设置连接禁止失败"})
+			return
+		}
+	}
+
+	disconnected := c.WSManager.DisconnectUser(uint(targetID), req.Reason)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":      "用户已断开连接",
+		"disconnected": disconnected,
+		"ban_seconds":  req.BanSeconds,
+	})
+}
+
+// GetTopSenders 获取最近days天（1-7，默认1）发送消息最多的用户（仅管理员）
+func (c *AdminController) GetTopSenders(ctx *gin.Context) {
+	days, err := strconv.Atoi(ctx.DefaultQuery("days", "1"))
+	if err != nil || days < 1 || days > 7 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "days必须在1到7之间"})
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 50 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit必须在1到50之间"})
+		return
+	}
+
+	senders, err := c.MessageService.GetTopSenders(days, limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"days":    days,
+		"senders": senders,
+	})
+}
+
+// ReplayMessages 从Kafka重放指定会话主题在时间范围内的消息（仅管理员），用于事故后补投
+func (c *AdminController) ReplayMessages(ctx *gin.Context) {
+	kafka := c.WSManager.GetKafkaService()
+	if kafka == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kafka未启用"})
+		return
+	}
+
+	var req models.ReplayRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if !req.Confirm {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "重放会重新投递历史消息，请设置 confirm 为 true 确认"})
+		return
+	}
+
+	topic := kafka.BuildTopicName(req.Type, req.TargetID)
+	result, err := kafka.Replay(topic, req.From, req.To, req.Mode == "export")
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRange), errors.Is(err, services.ErrRangeTooLarge):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrReplayInProgress):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "重放失败: " + err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"result": result,
+	})
+}
+
+// GetMaintenance 获取当前维护模式状态（仅管理员）
+func (c *AdminController) GetMaintenance(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"maintenance": c.MaintenanceService.Status(),
+	})
+}
+
+// SetMaintenance 开启或关闭维护模式（仅管理员），开启期间非管理员请求返回503
+func (c *AdminController) SetMaintenance(ctx *gin.Context) {
+	var req models.MaintenanceRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	if !req.Enabled {
+		if err := c.MaintenanceService.Disable(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "关闭维护模式失败"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":     "维护模式已关闭",
+			"maintenance": models.MaintenanceStatus{},
+		})
+		return
+	}
+
+	status, err := c.MaintenanceService.Enable(req.Reason, req.RetryAfter)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "开启维护模式失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":     "维护模式已开启",
+		"maintenance": status,
+	})
+}
+
+// GetPausedTopics 获取本节点上暂停消费的Kafka主题（仅管理员）
+func (c *AdminController) GetPausedTopics(ctx *gin.Context) {
+	kafka := c.WSManager.GetKafkaService()
+	if kafka == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kafka未启用"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"topics": kafka.PausedTopics(),
+	})
+}
+
+// PauseTopic 暂停本节点对Kafka主题的消费（仅管理员），消息在Kafka中积压直到恢复
+func (c *AdminController) PauseTopic(ctx *gin.Context) {
+	c.setTopicPaused(ctx, true)
+}
+
+// ResumeTopic 恢复本节点对Kafka主题的消费（仅管理员）
+func (c *AdminController) ResumeTopic(ctx *gin.Context) {
+	c.setTopicPaused(ctx, false)
+}
+
+// setTopicPaused 暂停或恢复主题消费
+func (c *AdminController) setTopicPaused(ctx *gin.Context, paused bool) {
+	kafka := c.WSManager.GetKafkaService()
+	if kafka == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kafka未启用"})
+		return
+	}
+
+	var req models.KafkaTopicRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	var err error
+	message := "主题消费已恢复"
+	if paused {
+		err = kafka.PauseTopic(req.Topic)
+		message = "主题消费已暂停"
+	} else {
+		err = kafka.ResumeTopic(req.Topic)
+	}
+	if errors.Is(err, services.ErrTopicNotSubscribed) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"topic":   req.Topic,
+		"paused":  paused,
+	})
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -12,21 +13,117 @@ import (
 
 // AuthController 认证控制器
 type AuthController struct {
-	UserService *services.UserService
+	UserService    *services.UserService
+	SessionService *services.SessionService
 }
 
 // NewAuthController 创建认证控制器
-func NewAuthController(userService *services.UserService) *AuthController {
+func NewAuthController(userService *services.UserService, sessionService *services.SessionService) *AuthController {
 	return &AuthController{
-		UserService: userService,
+		UserService:    userService,
+		SessionService: sessionService,
 	}
 }
 
+// tokenPair 登录后签发的访问令牌和刷新令牌
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// issueToken 为登录设备创建会话并签发绑定该会话的访问令牌和刷新令牌
+func (c *AuthController) issueToken(ctx *gin.Context, user *models.User) (*tokenPair, error) {
+	session, err := c.SessionService.CreateSession(user.ID, ctx.Request.UserAgent(), ctx.ClientIP())
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := middleware.GenerateAccessToken(user.ID, user.Username, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, refreshID, err := middleware.GenerateRefreshToken(user.ID, user.Username, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SessionService.StoreRefreshToken(session.ID, refreshID); err != nil {
+		return nil, err
+	}
+	return &tokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌，访问令牌已过期时同样可用
+func (c *AuthController) Refresh(ctx *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	// 解析刷新令牌
+	claims, err := middleware.ParseToken(req.RefreshToken, middleware.TokenTypeRefresh)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": services.ErrInvalidRefreshToken.Error()})
+		return
+	}
+
+	// 校验刷新令牌仍是会话的当前令牌，且会话未被注销
+	if err := c.SessionService.ValidateRefreshToken(claims.UserID, claims.SessionID, claims.ID); err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "刷新令牌失败"})
+		return
+	}
+
+	// 生成新的访问令牌
+	token, err := middleware.GenerateAccessToken(claims.UserID, claims.Username, claims.SessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+		return
+	}
+	c.SessionService.Touch(claims.SessionID, ctx.ClientIP())
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_in": int(services.AccessTokenLifetime().Seconds()),
+	})
+}
+
+// Logout 退出登录：注销当前令牌所属的会话，访问令牌和刷新令牌立即失效
+func (c *AuthController) Logout(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 旧版本签发的令牌没有会话ID，无法单独作废
+	sessionID := ctx.GetString("sessionID")
+	if sessionID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "当前令牌不支持退出登录，请重新登录后再试"})
+		return
+	}
+
+	if err := c.SessionService.RevokeSession(userID.(uint), sessionID); err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "已退出登录",
+	})
+}
+
 // Register 用户注册
 func (c *AuthController) Register(ctx *gin.Context) {
 	var req struct {
 		Username string `json:"username" binding:"required,min=3,max=20"`
-		Password string `json:"password" binding:"required,min=6"`
+		Password string `json:"password" binding:"required"`
 		Email    string `json:"email" binding:"required,email"`
 	}
 
@@ -43,7 +140,7 @@ func (c *AuthController) Register(ctx *gin.Context) {
 	}
 
 	// 生成JWT令牌
-	token, err := middleware.GenerateToken(user.ID, user.Username)
+	tokens, err := c.issueToken(ctx, user)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
 		return
@@ -56,10 +153,12 @@ func (c *AuthController) Register(ctx *gin.Context) {
 			ID:       user.ID,
 			Username: user.Username,
 			Email:    user.Email,
-			Avatar:   user.Avatar,
+			Avatar:   services.AssetURL(user.Avatar),
 			Online:   true,
 		},
-		"token": token,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    int(services.AccessTokenLifetime().Seconds()),
 	})
 }
 
@@ -78,12 +177,16 @@ func (c *AuthController) Login(ctx *gin.Context) {
 	// 验证用户
 	user, err := c.UserService.Login(req.Username, req.Password)
 	if err != nil {
+		if errors.Is(err, services.ErrUserBanned) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	// 生成JWT令牌
-	token, err := middleware.GenerateToken(user.ID, user.Username)
+	tokens, err := c.issueToken(ctx, user)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
 		return
@@ -96,10 +199,12 @@ func (c *AuthController) Login(ctx *gin.Context) {
 			ID:       user.ID,
 			Username: user.Username,
 			Email:    user.Email,
-			Avatar:   user.Avatar,
+			Avatar:   services.AssetURL(user.Avatar),
 			Online:   true,
 		},
-		"token": token,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    int(services.AccessTokenLifetime().Seconds()),
 	})
 }
 
@@ -157,7 +262,7 @@ func (c *AuthController) UpdateProfile(ctx *gin.Context) {
 			ID:       user.ID,
 			Username: user.Username,
 			Email:    user.Email,
-			Avatar:   user.Avatar,
+			Avatar:   services.AssetURL(user.Avatar),
 			Online:   true,
 		},
 	})
@@ -174,7 +279,7 @@ func (c *AuthController) ChangePassword(ctx *gin.Context) {
 
 	var req struct {
 		OldPassword string `json:"old_password" binding:"required"`
-		NewPassword string `json:"new_password" binding:"required,min=6"`
+		NewPassword string `json:"new_password" binding:"required"`
 	}
 
 	if err := ctx.ShouldBindJSON(&req); err != nil {
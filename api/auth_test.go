@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+
+	"chatroom/config"
+	"chatroom/middleware"
+	"chatroom/services"
+)
+
+func TestRefreshToken(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	sessions := services.NewSessionService(db, rdb)
+	controller := NewAuthController(services.NewUserService(db, rdb), sessions)
+	alice := createUser(t, db, "alice")
+
+	session, err := sessions.CreateSession(alice.ID, "phone", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	refresh, tokenID, err := middleware.GenerateRefreshToken(alice.ID, alice.Username, session.ID)
+	if err != nil {
+		t.Fatalf("生成刷新令牌失败: %v", err)
+	}
+	if err := sessions.StoreRefreshToken(session.ID, tokenID); err != nil {
+		t.Fatalf("记录刷新令牌失败: %v", err)
+	}
+
+	// 刷新接口挂在认证中间件之后，请求不携带访问令牌
+	router := gin.New()
+	router.Use(middleware.JWTAuth(sessions))
+	router.POST("/api/refresh", controller.Refresh)
+	post := func(token string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(map[string]string{"refresh_token": token})
+		req := httptest.NewRequest(http.MethodPost, "/api/refresh", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(refresh)
+	if w.Code != http.StatusOK {
+		t.Fatalf("刷新状态码 = %d，期望 200: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Token     string `json:"token"`
+		ExpiresIn int    `json:"expires_in"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.ExpiresIn != int(services.AccessTokenLifetime().Seconds()) {
+		t.Fatalf("expires_in = %d，期望 %d", resp.ExpiresIn, int(services.AccessTokenLifetime().Seconds()))
+	}
+	claims, err := middleware.ParseToken(resp.Token, middleware.TokenTypeAccess)
+	if err != nil {
+		t.Fatalf("新令牌不是有效的访问令牌: %v", err)
+	}
+	if claims.UserID != alice.ID || claims.ID != session.ID {
+		t.Fatalf("新令牌 user_id = %d, jti = %q，期望 %d, %s", claims.UserID, claims.ID, alice.ID, session.ID)
+	}
+	// 刷新令牌可重复使用直到被替换或会话注销
+	if code := post(refresh).Code; code != http.StatusOK {
+		t.Fatalf("再次刷新状态码 = %d，期望 200", code)
+	}
+
+	// 访问令牌不能当作刷新令牌使用
+	if code := post(resp.Token).Code; code != http.StatusUnauthorized {
+		t.Fatalf("用访问令牌刷新状态码 = %d，期望 401", code)
+	}
+	if code := post("garbage").Code; code != http.StatusUnauthorized {
+		t.Fatalf("无效令牌刷新状态码 = %d，期望 401", code)
+	}
+
+	// 重新登录后旧的刷新令牌失效
+	if err := sessions.StoreRefreshToken(session.ID, "newer"); err != nil {
+		t.Fatalf("记录刷新令牌失败: %v", err)
+	}
+	if code := post(refresh).Code; code != http.StatusUnauthorized {
+		t.Fatalf("被替换的刷新令牌状态码 = %d，期望 401", code)
+	}
+
+	// 会话注销后刷新令牌失效
+	if err := sessions.StoreRefreshToken(session.ID, tokenID); err != nil {
+		t.Fatalf("记录刷新令牌失败: %v", err)
+	}
+	if err := sessions.RevokeSession(alice.ID, session.ID); err != nil {
+		t.Fatalf("注销会话失败: %v", err)
+	}
+	if code := post(refresh).Code; code != http.StatusUnauthorized {
+		t.Fatalf("已注销会话的刷新令牌状态码 = %d，期望 401", code)
+	}
+}
+
+func TestLogoutRevokesCurrentSession(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	sessions := services.NewSessionService(db, rdb)
+	controller := NewAuthController(services.NewUserService(db, rdb), sessions)
+	alice := createUser(t, db, "alice")
+
+	login := func(device string) (access, refresh string) {
+		t.Helper()
+		session, err := sessions.CreateSession(alice.ID, device, "10.0.0.1")
+		if err != nil {
+			t.Fatalf("创建会话失败: %v", err)
+		}
+		access, err = middleware.GenerateAccessToken(alice.ID, alice.Username, session.ID)
+		if err != nil {
+			t.Fatalf("生成访问令牌失败: %v", err)
+		}
+		refresh, tokenID, err := middleware.GenerateRefreshToken(alice.ID, alice.Username, session.ID)
+		if err != nil {
+			t.Fatalf("生成刷新令牌失败: %v", err)
+		}
+		if err := sessions.StoreRefreshToken(session.ID, tokenID); err != nil {
+			t.Fatalf("记录刷新令牌失败: %v", err)
+		}
+		return access, refresh
+	}
+	phoneAccess, phoneRefresh := login("phone")
+	laptopAccess, _ := login("laptop")
+
+	router := gin.New()
+	router.Use(middleware.JWTAuth(sessions))
+	router.POST("/api/logout", controller.Logout)
+	router.POST("/api/refresh", controller.Refresh)
+	router.GET("/api/sessions", NewSessionController(sessions).ListSessions)
+	request := func(method, path, token string, body interface{}) int {
+		var data []byte
+		if body != nil {
+			data, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request(http.MethodPost, "/api/logout", phoneAccess, nil); code != http.StatusOK {
+		t.Fatalf("退出登录状态码 = %d，期望 200", code)
+	}
+	// 退出后访问令牌和刷新令牌立即失效
+	if code := request(http.MethodGet, "/api/sessions", phoneAccess, nil); code != http.StatusUnauthorized {
+		t.Fatalf("退出后访问令牌请求状态码 = %d，期望 401", code)
+	}
+	if code := request(http.MethodPost, "/api/refresh", "", map[string]string{"refresh_token": phoneRefresh}); code != http.StatusUnauthorized {
+		t.Fatalf("退出后刷新状态码 = %d，期望 401", code)
+	}
+	if code := request(http.MethodPost, "/api/logout", phoneAccess, nil); code != http.StatusUnauthorized {
+		t.Fatalf("重复退出状态码 = %d，期望 401", code)
+	}
+	// 其他设备的会话不受影响
+	if code := request(http.MethodGet, "/api/sessions", laptopAccess, nil); code != http.StatusOK {
+		t.Fatalf("其他会话请求状态码 = %d，期望 200", code)
+	}
+
+	// 旧版本签发的令牌没有会话ID
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.JWTClaims{
+		UserID:   alice.ID,
+		Username: alice.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString([]byte(config.AppConfig.JWTSecret))
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	if code := request(http.MethodPost, "/api/logout", legacy, nil); code != http.StatusBadRequest {
+		t.Fatalf("旧令牌退出登录状态码 = %d，期望 400", code)
+	}
+}
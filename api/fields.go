@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// userFields GET /api/users/:id 允许通过 fields 选择的字段
+var userFields = []string{"id", "username", "email", "avatar", "online"}
+
+// groupFields GET /api/groups/:id 允许通过 fields 选择的字段
+var groupFields = []string{
+	"id", "name", "description", "avatar", "category", "is_public",
+	"join_policy", "post_policy", "history_visibility", "slow_mode_seconds", "folder",
+	"creator_id", "creator", "created_at", "member_count", "message_count", "last_message_at", "members",
+}
+
+// parseFields 解析逗号分隔的 fields 参数并按允许列表校验，参数为空时返回nil表示返回全部字段
+func parseFields(raw string, allowed []string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !containsField(allowed, field) {
+			return nil, fmt.Errorf("无效的字段: %s", field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// containsField 判断字段是否在列表中
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// shapeFields 只保留响应中请求的字段，fields为空时原样返回
+// 按JSON字段名裁剪，值为空而被省略的字段在结果中同样不出现
+func shapeFields(v interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return v, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	shaped := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			shaped[field] = value
+		}
+	}
+	return shaped, nil
+}
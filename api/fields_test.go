@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"chatroom/models"
+	"chatroom/services"
+)
+
+func TestFieldSelection(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	userService := services.NewUserService(db, rdb)
+	groupService := services.NewGroupService(db, userService)
+	users := NewUserController(userService)
+	groups := NewGroupController(groupService)
+	alice := createUser(t, db, "alice")
+	group, err := groupService.CreateGroup(alice.ID, models.GroupRequest{Name: "g"})
+	if err != nil {
+		t.Fatalf("创建群组失败: %v", err)
+	}
+	seedGroupActivity(t, db, rdb, group.ID)
+
+	// keys 返回响应中 key 对象的字段名
+	keys := func(code int, body []byte, key string) map[string]bool {
+		t.Helper()
+		if code != http.StatusOK {
+			t.Fatalf("状态码 = %d，期望 200: %s", code, body)
+		}
+		var resp map[string]map[string]json.RawMessage
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		got := make(map[string]bool)
+		for field := range resp[key] {
+			got[field] = true
+		}
+		return got
+	}
+
+	tests := []struct {
+		name   string
+		serve  func(query string) (int, []byte)
+		key    string
+		fields string
+		want   []string
+	}{
+		{"用户", func(query string) (int, []byte) {
+			w := serve(users.GetUserByID, http.MethodGet, "/users/:id", fmt.Sprintf("/users/%d%s", alice.ID, query), alice.ID, nil)
+			return w.Code, w.Body.Bytes()
+		}, "user", "id,%20username", []string{"id", "username"}},
+		{"群组", func(query string) (int, []byte) {
+			w := serve(groups.GetGroupByID, http.MethodGet, "/groups/:id", fmt.Sprintf("/groups/%d%s", group.ID, query), alice.ID, nil)
+			return w.Code, w.Body.Bytes()
+		}, "group", "name,members", []string{"name", "members"}},
+	}
+	for _, tt := range tests {
+		code, body := tt.serve("")
+		if all := keys(code, body, tt.key); len(all) <= len(tt.want) {
+			t.Fatalf("%s 未指定 fields 时字段 = %v，期望返回全部字段", tt.name, all)
+		}
+
+		code, body = tt.serve("?fields=" + tt.fields)
+		got := keys(code, body, tt.key)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s 选择 %q 后字段 = %v，期望 %v", tt.name, tt.fields, got, tt.want)
+		}
+		for _, field := range tt.want {
+			if !got[field] {
+				t.Errorf("%s 选择 %q 后缺少字段 %s", tt.name, tt.fields, field)
+			}
+		}
+
+		if code, _ := tt.serve("?fields=id,password"); code != http.StatusBadRequest {
+			t.Errorf("%s 请求不允许的字段状态码 = %d，期望 400", tt.name, code)
+		}
+	}
+}
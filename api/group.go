@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -38,16 +39,16 @@ func (c *GroupController) CreateGroup(ctx *gin.Context) {
 	}
 
 	// 创建群组
-	group, err := c.GroupService.CreateGroup(userID.(uint), req.Name, req.Description, req.Avatar)
+	group, err := c.GroupService.CreateGroup(userID.(uint), req)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	// 获取群组响应
 	groupResp, err := c.GroupService.GetGroupResponse(group.ID, true)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -59,6 +60,13 @@ func (c *GroupController) CreateGroup(ctx *gin.Context) {
 
 // GetGroupByID 根据ID获取群组
 func (c *GroupController) GetGroupByID(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
 	// 获取群组ID参数
 	groupIDStr := ctx.Param("id")
 	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
@@ -67,18 +75,37 @@ func (c *GroupController) GetGroupByID(ctx *gin.Context) {
 		return
 	}
 
+	// 只返回请求的字段，选择了 members 时同时加载成员信息
+	fields, err := parseFields(ctx.Query("fields"), groupFields)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 是否包含成员信息
-	includeMembers := ctx.DefaultQuery("include_members", "false") == "true"
+	includeMembers := ctx.DefaultQuery("include_members", "false") == "true" || containsField(fields, "members")
+
+	// 检查访问权限
+	if err := c.GroupService.CheckGroupAccess(uint(groupID), userID.(uint)); err != nil {
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
 	// 获取群组信息
 	groupResp, err := c.GroupService.GetGroupResponse(uint(groupID), includeMembers)
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	shaped, err := shapeFields(groupResp, fields)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"group": groupResp,
+		"group": shaped,
 	})
 }
 
@@ -92,9 +119,9 @@ func (c *GroupController) GetUserGroups(ctx *gin.Context) {
 	}
 
 	// 获取用户群组
-	groups, err := c.GroupService.GetUserGroups(userID.(uint))
+	groups, err := c.GroupService.GetUserGroups(userID.(uint), ctx.Query("category"), ctx.Query("folder"))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -127,16 +154,16 @@ func (c *GroupController) UpdateGroup(ctx *gin.Context) {
 	}
 
 	// 更新群组
-	group, err := c.GroupService.UpdateGroup(uint(groupID), userID.(uint), req.Name, req.Description, req.Avatar)
+	group, err := c.GroupService.UpdateGroup(uint(groupID), userID.(uint), req)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	// 获取群组响应
 	groupResp, err := c.GroupService.GetGroupResponse(group.ID, false)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -166,7 +193,7 @@ func (c *GroupController) JoinGroup(ctx *gin.Context) {
 	// 加入群组
 	err = c.GroupService.JoinGroup(uint(groupID), userID.(uint))
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -195,7 +222,7 @@ func (c *GroupController) LeaveGroup(ctx *gin.Context) {
 	// 离开群组
 	err = c.GroupService.LeaveGroup(uint(groupID), userID.(uint))
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -234,7 +261,7 @@ func (c *GroupController) SetGroupAdmin(ctx *gin.Context) {
 	// 设置管理员
 	err = c.GroupService.SetGroupAdmin(uint(groupID), userID.(uint), req.UserID, req.IsAdmin)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -263,7 +290,7 @@ func (c *GroupController) DisbandGroup(ctx *gin.Context) {
 	// 解散群组
 	err = c.GroupService.DisbandGroup(uint(groupID), userID.(uint))
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -274,6 +301,13 @@ func (c *GroupController) DisbandGroup(ctx *gin.Context) {
 
 // GetGroupMembers 获取群组成员
 func (c *GroupController) GetGroupMembers(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
 	// 获取群组ID参数
 	groupIDStr := ctx.Param("id")
 	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
@@ -282,10 +316,16 @@ func (c *GroupController) GetGroupMembers(ctx *gin.Context) {
 		return
 	}
 
+	// 检查访问权限
+	if err := c.GroupService.CheckGroupAccess(uint(groupID), userID.(uint)); err != nil {
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	// 获取群组成员
 	members, err := c.GroupService.GetGroupMembers(uint(groupID))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -304,9 +344,9 @@ func (c *GroupController) GetGroups(ctx *gin.Context) {
 	}
 
 	// 获取用户群组
-	groups, err := c.GroupService.GetUserGroups(userID.(uint))
+	groups, err := c.GroupService.GetUserGroups(userID.(uint), ctx.Query("category"), ctx.Query("folder"))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -315,6 +355,134 @@ func (c *GroupController) GetGroups(ctx *gin.Context) {
 	})
 }
 
+// SetFolder 设置群组所在的个人文件夹
+func (c *GroupController) SetFolder(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取群组ID参数
+	groupIDStr := ctx.Param("id")
+	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的群组ID"})
+		return
+	}
+
+	var req models.GroupFolderRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	if err := c.GroupService.SetMemberFolder(uint(groupID), userID.(uint), req.Folder); err != nil {
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "文件夹设置成功",
+		"folder":  req.Folder,
+	})
+}
+
+// GetWatchwords 获取群组关键词（仅管理员）
+func (c *GroupController) GetWatchwords(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取群组ID参数
+	groupID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的群组ID"})
+		return
+	}
+
+	words, err := c.GroupService.GetWatchwords(uint(groupID), userID.(uint))
+	if err != nil {
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"words": words,
+	})
+}
+
+// SetWatchwords 设置群组关键词（仅管理员），命中的消息会提醒群管理员
+func (c *GroupController) SetWatchwords(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取群组ID参数
+	groupID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的群组ID"})
+		return
+	}
+
+	var req models.WatchwordsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	words, err := c.GroupService.SetWatchwords(uint(groupID), userID.(uint), req.Words)
+	if err != nil {
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "关键词设置成功",
+		"words":   words,
+	})
+}
+
+// GetKeywordAlerts 获取群组的关键词提醒记录（仅管理员）
+func (c *GroupController) GetKeywordAlerts(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取群组ID参数
+	groupID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的群组ID"})
+		return
+	}
+
+	// 获取分页参数
+	limitStr := ctx.DefaultQuery("limit", "20")
+	offsetStr := ctx.DefaultQuery("offset", "0")
+	limit, _ := strconv.Atoi(limitStr)
+	offset, _ := strconv.Atoi(offsetStr)
+
+	alerts, err := c.GroupService.GetKeywordAlerts(uint(groupID), userID.(uint), limit, offset)
+	if err != nil {
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"alerts": alerts,
+	})
+}
+
 // DeleteGroup 删除群组
 func (c *GroupController) DeleteGroup(ctx *gin.Context) {
 	// 从上下文中获取用户ID
@@ -335,7 +503,7 @@ func (c *GroupController) DeleteGroup(ctx *gin.Context) {
 	// 删除群组（实际上是解散群组）
 	err = c.GroupService.DisbandGroup(uint(groupID), userID.(uint))
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -362,7 +530,8 @@ func (c *GroupController) AddMember(ctx *gin.Context) {
 	}
 
 	var req struct {
-		UserID uint `json:"user_id" binding:"required"`
+		UserID  uint   `json:"user_id" binding:"required_without=UserIDs"`
+		UserIDs []uint `json:"user_ids" binding:"omitempty,max=100"`
 	}
 
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -370,10 +539,27 @@ func (c *GroupController) AddMember(ctx *gin.Context) {
 		return
 	}
 
+	// 批量添加，逐个返回结果
+	if len(req.UserIDs) > 0 {
+		userIDs := req.UserIDs
+		if req.UserID != 0 {
+			userIDs = append(userIDs, req.UserID)
+		}
+		results, err := c.GroupService.AddMembers(uint(groupID), userID.(uint), userIDs)
+		if err != nil {
+			ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"results": results,
+		})
+		return
+	}
+
 	// 添加成员（需要检查权限）
 	err = c.GroupService.AddMember(uint(groupID), userID.(uint), req.UserID)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -410,7 +596,7 @@ func (c *GroupController) RemoveMember(ctx *gin.Context) {
 	// 移除成员（需要检查权限）
 	err = c.GroupService.RemoveMember(uint(groupID), userID.(uint), uint(targetUserID))
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -418,3 +604,144 @@ func (c *GroupController) RemoveMember(ctx *gin.Context) {
 		"message": "成员移除成功",
 	})
 }
+
+// groupErrorStatus 根据群组服务错误返回对应的HTTP状态码
+// 群组不存在返回404，无权限返回403，请求不合法返回400，其余视为服务器错误
+func groupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrGroupNotFound),
+		errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrInviteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrGroupForbidden),
+		errors.Is(err, services.ErrOperatorNotMember),
+		errors.Is(err, services.ErrNoAddPermission),
+		errors.Is(err, services.ErrNoRemovePermission),
+		errors.Is(err, services.ErrRemoveOwner),
+		errors.Is(err, services.ErrNoUpdatePermission),
+		errors.Is(err, services.ErrNoSetAdminPermission),
+		errors.Is(err, services.ErrNoDisbandPermission),
+		errors.Is(err, services.ErrJoinInviteOnly),
+		errors.Is(err, services.ErrDemoteOwner),
+		errors.Is(err, services.ErrNoInvitePermission),
+		errors.Is(err, services.ErrNotInvitee),
+		errors.Is(err, services.ErrNoWatchwordPermission):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrGroupNameExists),
+		errors.Is(err, services.ErrAlreadyMember),
+		errors.Is(err, services.ErrNotMember),
+		errors.Is(err, services.ErrTargetNotMember),
+		errors.Is(err, services.ErrOwnerCannotLeave),
+		errors.Is(err, services.ErrInvalidJoinPolicy),
+		errors.Is(err, services.ErrInvalidPostPolicy),
+		errors.Is(err, services.ErrInvalidHistoryVisibility),
+		errors.Is(err, services.ErrInviteTargetMissing),
+		errors.Is(err, services.ErrInvalidAvatarURL):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInviteNotPending),
+		errors.Is(err, services.ErrGroupFull):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// InviteMember 邀请用户入群
+func (c *GroupController) InviteMember(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取群组ID参数
+	groupIDStr := ctx.Param("id")
+	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的群组ID"})
+		return
+	}
+
+	var req models.GroupInviteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	invite, err := c.GroupService.InviteMember(uint(groupID), userID.(uint), req)
+	if err != nil {
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "邀请已发送",
+		"invite":  invite,
+	})
+}
+
+// GetInvites 获取当前用户待处理的入群邀请
+func (c *GroupController) GetInvites(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	invites, err := c.GroupService.GetPendingInvites(userID.(uint))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"invites": invites,
+	})
+}
+
+// AcceptInvite 接受入群邀请
+func (c *GroupController) AcceptInvite(ctx *gin.Context) {
+	c.respondInvite(ctx, true)
+}
+
+// RejectInvite 拒绝入群邀请
+func (c *GroupController) RejectInvite(ctx *gin.Context) {
+	c.respondInvite(ctx, false)
+}
+
+// respondInvite 处理入群邀请的接受或拒绝
+func (c *GroupController) respondInvite(ctx *gin.Context, accept bool) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取邀请ID参数
+	inviteID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的邀请ID"})
+		return
+	}
+
+	var invite *models.GroupInvite
+	message := "已加入群组"
+	if accept {
+		invite, err = c.GroupService.AcceptInvite(uint(inviteID), userID.(uint))
+	} else {
+		invite, err = c.GroupService.RejectInvite(uint(inviteID), userID.(uint))
+		message = "已拒绝邀请"
+	}
+	if err != nil {
+		ctx.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"invite":  invite,
+	})
+}
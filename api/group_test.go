@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/models"
+	"chatroom/services"
+)
+
+func TestGroupAccessStatus(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	groupService := services.NewGroupService(db, services.NewUserService(db, rdb))
+	controller := NewGroupController(groupService)
+
+	owner := createUser(t, db, "owner")
+	outsider := createUser(t, db, "outsider")
+	public, err := groupService.CreateGroup(owner.ID, models.GroupRequest{Name: "public"})
+	if err != nil {
+		t.Fatalf("创建群组失败: %v", err)
+	}
+	private, err := groupService.CreateGroup(owner.ID, models.GroupRequest{Name: "private"})
+	if err != nil {
+		t.Fatalf("创建群组失败: %v", err)
+	}
+	if err := db.Model(private).Update("is_public", false).Error; err != nil {
+		t.Fatalf("设置私有群组失败: %v", err)
+	}
+	seedGroupActivity(t, db, rdb, public.ID, private.ID)
+
+	endpoints := []struct {
+		name    string
+		handler func(id string, userID uint) int
+	}{
+		{"GetGroupByID", func(id string, userID uint) int {
+			return serve(controller.GetGroupByID, http.MethodGet, "/groups/:id", "/groups/"+id, userID, nil).Code
+		}},
+		{"GetGroupMembers", func(id string, userID uint) int {
+			return serve(controller.GetGroupMembers, http.MethodGet, "/groups/:id/members", "/groups/"+id+"/members", userID, nil).Code
+		}},
+	}
+	tests := []struct {
+		name   string
+		id     string
+		userID uint
+		want   int
+	}{
+		{"公开群组非成员可见", fmt.Sprint(public.ID), outsider.ID, http.StatusOK},
+		{"私有群组成员可见", fmt.Sprint(private.ID), owner.ID, http.StatusOK},
+		{"私有群组非成员禁止", fmt.Sprint(private.ID), outsider.ID, http.StatusForbidden},
+		{"群组不存在", "9999", owner.ID, http.StatusNotFound},
+		{"群组ID不合法", "abc", owner.ID, http.StatusBadRequest},
+		{"未认证", fmt.Sprint(public.ID), 0, http.StatusUnauthorized},
+	}
+	for _, ep := range endpoints {
+		for _, tt := range tests {
+			if got := ep.handler(tt.id, tt.userID); got != tt.want {
+				t.Errorf("%s %s: 状态码 = %d，期望 %d", ep.name, tt.name, got, tt.want)
+			}
+		}
+	}
+
+	// 数据库故障才返回500
+	if err := db.Migrator().DropTable(&models.GroupMember{}); err != nil {
+		t.Fatalf("删除成员表失败: %v", err)
+	}
+	for _, ep := range endpoints {
+		if got := ep.handler(fmt.Sprint(private.ID), outsider.ID); got != http.StatusInternalServerError {
+			t.Errorf("%s 数据库故障: 状态码 = %d，期望 500", ep.name, got)
+		}
+	}
+}
+
+func TestGroupErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{services.ErrGroupNotFound, http.StatusNotFound},
+		{services.ErrUserNotFound, http.StatusNotFound},
+		{services.ErrGroupForbidden, http.StatusForbidden},
+		{services.ErrNoUpdatePermission, http.StatusForbidden},
+		{services.ErrNoDisbandPermission, http.StatusForbidden},
+		{services.ErrGroupNameExists, http.StatusBadRequest},
+		{services.ErrOwnerCannotLeave, http.StatusBadRequest},
+		{services.ErrInviteNotFound, http.StatusNotFound},
+		{services.ErrNoInvitePermission, http.StatusForbidden},
+		{services.ErrNotInvitee, http.StatusForbidden},
+		{services.ErrInviteTargetMissing, http.StatusBadRequest},
+		{services.ErrInviteNotPending, http.StatusConflict},
+		{fmt.Errorf("查询失败: %w", services.ErrGroupNotFound), http.StatusNotFound},
+		{fmt.Errorf("连接断开"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := groupErrorStatus(tt.err); got != tt.want {
+			t.Errorf("groupErrorStatus(%v) = %d，期望 %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestAddMemberBatchResults(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	groupService := services.NewGroupService(db, services.NewUserService(db, rdb))
+	controller := NewGroupController(groupService)
+
+	owner := createUser(t, db, "owner")
+	bob := createUser(t, db, "bob")
+	carol := createUser(t, db, "carol")
+	group, err := groupService.CreateGroup(owner.ID, models.GroupRequest{Name: "g"})
+	if err != nil {
+		t.Fatalf("创建群组失败: %v", err)
+	}
+	path := fmt.Sprintf("/groups/%d/members", group.ID)
+	add := func(body interface{}) *httptest.ResponseRecorder {
+		return serve(controller.AddMember, http.MethodPost, "/groups/:id/members", path, owner.ID, body)
+	}
+
+	// 单个添加保持原有响应
+	if w := add(gin.H{"user_id": bob.ID}); w.Code != http.StatusOK {
+		t.Fatalf("单个添加状态码 = %d: %s", w.Code, w.Body)
+	}
+	if w := add(gin.H{"user_id": bob.ID}); w.Code != http.StatusBadRequest {
+		t.Fatalf("重复添加状态码 = %d，期望 400", w.Code)
+	}
+
+	// 批量添加部分失败时仍返回200和逐个结果
+	w := add(gin.H{"user_ids": []uint{bob.ID, carol.ID, 9999}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("批量添加状态码 = %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Results map[string]models.AddMemberResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	want := map[string]models.AddMemberResult{
+		fmt.Sprint(bob.ID):   models.AddMemberAlreadyMember,
+		fmt.Sprint(carol.ID): models.AddMemberAdded,
+		"9999":               models.AddMemberNotFound,
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("批量添加结果 = %v，期望 %v", resp.Results, want)
+	}
+	for id, result := range want {
+		if resp.Results[id] != result {
+			t.Errorf("用户 %s 的结果 = %q，期望 %q", id, resp.Results[id], result)
+		}
+	}
+}
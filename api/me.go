@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/services"
+)
+
+// MeController 当前用户聚合信息控制器
+type MeController struct {
+	UserService    *services.UserService
+	GroupService   *services.GroupService
+	MessageService *services.MessageService
+}
+
+// NewMeController 创建当前用户聚合信息控制器
+func NewMeController(userService *services.UserService, groupService *services.GroupService, messageService *services.MessageService) *MeController {
+	return &MeController{
+		UserService:    userService,
+		GroupService:   groupService,
+		MessageService: messageService,
+	}
+}
+
+// GetMe 获取当前用户的资料、群组列表和未读汇总（应用启动时一次性加载）
+func (c *MeController) GetMe(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	user, err := c.UserService.GetUserResponse(userID.(uint))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	groups, err := c.GroupService.GetUserGroups(userID.(uint), "", "")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	unread, err := c.MessageService.GetUnreadSummary(ctx.Request.Context(), userID.(uint))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"user":   user,
+		"groups": groups,
+		"unread": unread,
+	})
+}
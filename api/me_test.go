@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"chatroom/models"
+	"chatroom/services"
+)
+
+func TestGetMeAggregatesSections(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	userService := services.NewUserService(db, rdb)
+	groupService := services.NewGroupService(db, userService)
+	messageService := services.NewMessageService(db, rdb, userService, nil)
+	controller := NewMeController(userService, groupService, messageService)
+
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	group, err := groupService.CreateGroup(bob.ID, models.GroupRequest{Name: "g"})
+	if err != nil {
+		t.Fatalf("创建群组失败: %v", err)
+	}
+	if err := groupService.AddMember(group.ID, bob.ID, alice.ID); err != nil {
+		t.Fatalf("添加成员失败: %v", err)
+	}
+
+	// 群聊中 @alice 一次，私聊一条
+	messages := []models.Message{
+		{SenderID: bob.ID, GroupID: group.ID, Type: models.GroupMessage, Content: "@alice 你好"},
+		{SenderID: bob.ID, ReceiverID: alice.ID, Type: models.PrivateMessage, Content: "在吗"},
+	}
+	for i := range messages {
+		messages[i].CreatedAt = time.Now()
+		if err := messageService.ProcessMessage(&messages[i]); err != nil {
+			t.Fatalf("发送消息失败: %v", err)
+		}
+	}
+	seedGroupActivity(t, db, rdb, group.ID)
+
+	w := serve(controller.GetMe, http.MethodGet, "/me", "/me", alice.ID, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d，期望 200: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		User   *models.UserResponse   `json:"user"`
+		Groups []models.GroupResponse `json:"groups"`
+		Unread *models.UnreadSummary  `json:"unread"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.User == nil || resp.User.ID != alice.ID || resp.User.Username != "alice" {
+		t.Fatalf("user = %+v，期望 alice", resp.User)
+	}
+	if len(resp.Groups) != 1 || resp.Groups[0].ID != group.ID {
+		t.Fatalf("groups = %+v，期望包含群组 %d", resp.Groups, group.ID)
+	}
+	if resp.Unread == nil || resp.Unread.TotalUnread != 2 || resp.Unread.TotalMentions != 1 || len(resp.Unread.Conversations) != 2 {
+		t.Fatalf("unread = %+v，期望 2 条未读、1 次提及、2 个会话", resp.Unread)
+	}
+
+	if w := serve(controller.GetMe, http.MethodGet, "/me", "/me", 0, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("未认证状态码 = %d，期望 401", w.Code)
+	}
+}
@@ -1,12 +1,19 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"chatroom/config"
 	"chatroom/models"
 	"chatroom/services"
 )
@@ -40,6 +47,12 @@ func (c *MessageController) SendMessage(ctx *gin.Context) {
 		return
 	}
 
+	// 解析接收者
+	if err := c.MessageService.ResolveReceiver(&req); err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	// 创建消息
 	msg := &models.Message{
 		Content:    req.Content,
@@ -48,12 +61,13 @@ func (c *MessageController) SendMessage(ctx *gin.Context) {
 		ReceiverID: req.ReceiverID,
 		GroupID:    req.GroupID,
 		CreatedAt:  time.Now(),
+		SentFrom:   services.SentFrom(ctx.GetHeader(services.SentFromHeader), ctx.Request.UserAgent()),
 	}
 
 	// 处理消息
 	err := c.MessageService.ProcessMessage(msg)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -86,10 +100,16 @@ func (c *MessageController) GetPrivateMessages(ctx *gin.Context) {
 	limit, _ := strconv.Atoi(limitStr)
 	offset, _ := strconv.Atoi(offsetStr)
 
+	// 带 before_id 时按游标分页，返回 next_cursor 供加载更早的消息
+	if ctx.Query("before_id") != "" {
+		c.getMessagesBefore(ctx, userID.(uint), uint(otherUserID), false, limit)
+		return
+	}
+
 	// 获取消息
-	messages, err := c.MessageService.GetMessagesByUser(userID.(uint), uint(otherUserID), limit, offset)
+	messages, err := c.MessageService.GetMessagesByUser(ctx.Request.Context(), userID.(uint), uint(otherUserID), limit, offset)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -101,7 +121,7 @@ func (c *MessageController) GetPrivateMessages(ctx *gin.Context) {
 // GetGroupMessages 获取群聊消息
 func (c *MessageController) GetGroupMessages(ctx *gin.Context) {
 	// 从上下文中获取用户ID
-	_, exists := ctx.Get("userID")
+	userID, exists := ctx.Get("userID")
 	if !exists {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
 		return
@@ -121,10 +141,16 @@ func (c *MessageController) GetGroupMessages(ctx *gin.Context) {
 	limit, _ := strconv.Atoi(limitStr)
 	offset, _ := strconv.Atoi(offsetStr)
 
+	// 带 before_id 时按游标分页，返回 next_cursor 供加载更早的消息
+	if ctx.Query("before_id") != "" {
+		c.getMessagesBefore(ctx, userID.(uint), uint(groupID), true, limit)
+		return
+	}
+
 	// 获取消息
-	messages, err := c.MessageService.GetGroupMessages(uint(groupID), limit, offset)
+	messages, err := c.MessageService.GetGroupMessages(ctx.Request.Context(), userID.(uint), uint(groupID), limit, offset)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -143,12 +169,24 @@ func (c *MessageController) GetRecentChats(ctx *gin.Context) {
 	}
 
 	// 获取最近聊天
-	chats, err := c.MessageService.GetRecentChats(userID.(uint))
+	chats, err := c.MessageService.GetRecentChats(ctx.Request.Context(), userID.(uint))
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 按文件夹分组返回
+	if ctx.Query("group_by") == "folder" {
+		folders := make(map[string][]models.RecentChat)
+		for _, chat := range chats {
+			folders[chat.Folder] = append(folders[chat.Folder], chat)
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"folders": folders,
+		})
+		return
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"chats": chats,
 	})
@@ -164,8 +202,9 @@ func (c *MessageController) MarkAsRead(ctx *gin.Context) {
 	}
 
 	var req struct {
-		TargetID uint `json:"target_id" binding:"required"` // 对方用户ID或群组ID
-		IsGroup  bool `json:"is_group"`                     // 是否为群组
+		TargetID  uint `json:"target_id" binding:"required"` // 对方用户ID或群组ID
+		IsGroup   bool `json:"is_group"`                     // 是否为群组
+		MessageID uint `json:"message_id"`                   // 已读到的消息ID，为空时标记全部已读
 	}
 
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -174,7 +213,7 @@ func (c *MessageController) MarkAsRead(ctx *gin.Context) {
 	}
 
 	// 标记为已读
-	err := c.MessageService.MarkMessagesAsRead(userID.(uint), req.TargetID, req.IsGroup)
+	err := c.MessageService.MarkMessagesAsRead(userID.(uint), req.TargetID, req.IsGroup, req.MessageID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -215,23 +254,344 @@ func (c *MessageController) GetMessages(ctx *gin.Context) {
 	limit, _ := strconv.Atoi(limitStr)
 	offset, _ := strconv.Atoi(offsetStr)
 
+	if chatType != "private" && chatType != "group" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的聊天类型"})
+		return
+	}
+
+	// 指定了时间范围时按范围查询，缺省的一端按最大跨度补齐
+	if ctx.Query("from") != "" || ctx.Query("to") != "" {
+		from, to, err := parseTimeRange(ctx.Query("from"), ctx.Query("to"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		messages, err := c.MessageService.GetMessagesInRange(userID.(uint), uint(targetIDUint), chatType == "group", from, to, limit, offset)
+		if err != nil {
+			ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"messages": messages,
+		})
+		return
+	}
+
+	// 带 before_id 时按游标分页，返回 next_cursor 供加载更早的消息
+	if ctx.Query("before_id") != "" {
+		c.getMessagesBefore(ctx, userID.(uint), uint(targetIDUint), chatType == "group", limit)
+		return
+	}
+
 	var messages []models.MessageResponse
 	if chatType == "private" {
-		messages, err = c.MessageService.GetMessagesByUser(userID.(uint), uint(targetIDUint), limit, offset)
-	} else if chatType == "group" {
-		messages, err = c.MessageService.GetGroupMessages(uint(targetIDUint), limit, offset)
+		messages, err = c.MessageService.GetMessagesByUser(ctx.Request.Context(), userID.(uint), uint(targetIDUint), limit, offset)
 	} else {
+		messages, err = c.MessageService.GetGroupMessages(ctx.Request.Context(), userID.(uint), uint(targetIDUint), limit, offset)
+	}
+
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"messages": messages,
+	})
+}
+
+// SearchMessages 在会话中按关键词搜索消息
+func (c *MessageController) SearchMessages(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	chatType := ctx.Query("type") // private 或 group
+	if chatType != "private" && chatType != "group" {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的聊天类型"})
 		return
 	}
+	targetID, err := strconv.ParseUint(ctx.Query("target_id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的目标ID"})
+		return
+	}
 
+	// 获取分页参数
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(services.DefaultMessageSearchLimit)))
+	offset, _ := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	contextSize, err := strconv.Atoi(ctx.DefaultQuery("context", strconv.Itoa(services.DefaultMessageSearchContext)))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的context参数"})
+		return
+	}
+
+	hits, hasMore, err := c.MessageService.SearchMessages(ctx.Request.Context(), userID.(uint), uint(targetID), chatType == "group",
+		ctx.Query("q"), contextSize, limit, offset)
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"messages": messages,
+		"results":  hits,
+		"has_more": hasMore,
+	})
+}
+
+// getMessagesBefore 按 before_id 游标返回更早的消息，next_cursor 为下一页的 before_id，没有更早的消息时为null
+func (c *MessageController) getMessagesBefore(ctx *gin.Context, userID, targetID uint, isGroup bool, limit int) {
+	beforeID, err := strconv.ParseUint(ctx.Query("before_id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的before_id"})
+		return
+	}
+
+	var messages []models.MessageResponse
+	var nextCursor *uint
+	if isGroup {
+		messages, nextCursor, err = c.MessageService.GetGroupMessagesBefore(ctx.Request.Context(), userID, targetID, uint(beforeID), limit)
+	} else {
+		messages, nextCursor, err = c.MessageService.GetMessagesByUserBefore(ctx.Request.Context(), userID, targetID, uint(beforeID), limit)
+	}
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"messages":    messages,
+		"next_cursor": nextCursor,
+	})
+}
+
+// RecallMessage 撤回/删除消息
+func (c *MessageController) RecallMessage(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	messageID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	event, err := c.MessageService.RecallMessage(uint(messageID), userID.(uint))
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "消息已撤回",
+		"recall":  event,
+	})
+}
+
+// EditMessage 编辑消息
+func (c *MessageController) EditMessage(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	messageID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	var req models.MessageEditRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	msg, err := c.MessageService.EditMessage(uint(messageID), userID.(uint), req.Content)
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, msg)
+}
+
+// PinMessage 置顶消息
+func (c *MessageController) PinMessage(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	messageID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	pin, err := c.MessageService.PinMessage(uint(messageID), userID.(uint))
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "置顶成功",
+		"pin":     pin,
+	})
+}
+
+// UnpinMessage 取消置顶消息
+func (c *MessageController) UnpinMessage(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	messageID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	if err := c.MessageService.UnpinMessage(uint(messageID), userID.(uint)); err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "取消置顶成功",
+	})
+}
+
+// GetPinnedMessages 获取会话中的置顶消息
+func (c *MessageController) GetPinnedMessages(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取会话目标ID
+	targetID, err := strconv.ParseUint(ctx.Param("target"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的目标ID"})
+		return
+	}
+
+	chatType := ctx.DefaultQuery("type", "private") // private 或 group
+	if chatType != "private" && chatType != "group" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的聊天类型"})
+		return
+	}
+
+	pins, err := c.MessageService.ListPinned(userID.(uint), uint(targetID), chatType == "group")
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"pinned": pins,
+	})
+}
+
+// GetMessageReaders 获取群消息的已读成员详情
+func (c *MessageController) GetMessageReaders(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	messageID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	readers, err := c.MessageService.GetMessageReaders(uint(messageID), userID.(uint))
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"read_count": len(readers),
+		"readers":    readers,
+	})
+}
+
+// AddReaction 添加表情回应
+func (c *MessageController) AddReaction(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	messageID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	var req models.ReactionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	reactions, err := c.MessageService.AddReaction(uint(messageID), userID.(uint), req.Emoji)
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"reactions": reactions,
+	})
+}
+
+// RemoveReaction 取消表情回应
+func (c *MessageController) RemoveReaction(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	messageID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	reactions, err := c.MessageService.RemoveReaction(uint(messageID), userID.(uint), ctx.Param("emoji"))
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"reactions": reactions,
 	})
 }
 
@@ -243,3 +603,309 @@ func (c *MessageController) GetMessage(ctx *gin.Context) {
 		"message":    "获取单个消息功能待实现",
 	})
 }
+
+// GetTypingUsers 获取会话中正在输入的用户（供不使用WebSocket的轮询客户端）
+func (c *MessageController) GetTypingUsers(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取会话目标ID
+	targetID, err := strconv.ParseUint(ctx.Param("target"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的目标ID"})
+		return
+	}
+
+	chatType := ctx.DefaultQuery("type", "private") // private 或 group
+	if chatType != "private" && chatType != "group" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的聊天类型"})
+		return
+	}
+
+	typingUsers, err := c.MessageService.GetTypingUsers(userID.(uint), uint(targetID), chatType == "group")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"typing": typingUsers,
+	})
+}
+
+// GetDraft 获取当前用户在会话中的草稿
+func (c *MessageController) GetDraft(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取会话目标ID
+	targetID, err := strconv.ParseUint(ctx.Param("target"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的目标ID"})
+		return
+	}
+
+	chatType := ctx.DefaultQuery("type", "private") // private 或 group
+	if chatType != "private" && chatType != "group" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的聊天类型"})
+		return
+	}
+
+	draft, err := c.MessageService.GetDraft(userID.(uint), uint(targetID), chatType == "group")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"draft": draft,
+	})
+}
+
+// SaveDraft 保存当前用户在会话中的草稿，内容为空时清除草稿
+func (c *MessageController) SaveDraft(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取会话目标ID
+	targetID, err := strconv.ParseUint(ctx.Param("target"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的目标ID"})
+		return
+	}
+
+	chatType := ctx.DefaultQuery("type", "private") // private 或 group
+	if chatType != "private" && chatType != "group" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的聊天类型"})
+		return
+	}
+
+	var req models.DraftRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	draft, err := c.MessageService.SaveDraft(userID.(uint), uint(targetID), chatType == "group", req.Content)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "保存草稿失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"draft": draft,
+	})
+}
+
+// ClearHistory 为当前用户清空会话记录，对方和其他群成员不受影响
+func (c *MessageController) ClearHistory(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取会话目标ID
+	targetID, err := strconv.ParseUint(ctx.Param("target"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的目标ID"})
+		return
+	}
+
+	chatType := ctx.DefaultQuery("type", "private") // private 或 group
+	if chatType != "private" && chatType != "group" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的聊天类型"})
+		return
+	}
+
+	clearedBefore, err := c.MessageService.ClearHistory(userID.(uint), uint(targetID), chatType == "group")
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "会话记录已清空",
+		"cleared_before": clearedBefore,
+	})
+}
+
+// ExportConversation 以NDJSON流式导出会话消息，第一行为清单，之后每行一条消息（按时间顺序）
+func (c *MessageController) ExportConversation(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取会话目标ID
+	targetID, err := strconv.ParseUint(ctx.Param("target"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的目标ID"})
+		return
+	}
+
+	chatType := ctx.DefaultQuery("type", "private") // private 或 group
+	if chatType != "private" && chatType != "group" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的聊天类型"})
+		return
+	}
+
+	export, err := c.MessageService.NewConversationExport(userID.(uint), uint(targetID), chatType == "group")
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%d.ndjson", chatType, targetID))
+	ctx.Stream(func(w io.Writer) bool {
+		more, err := export.WriteNext(w)
+		if err != nil {
+			// 响应头已经发出，只能以错误行结束输出
+			log.Printf("导出会话失败: %v", err)
+			json.NewEncoder(w).Encode(gin.H{"type": "error", "error": "导出中断"})
+			return false
+		}
+		return more
+	})
+}
+
+// GetMyStats 获取当前用户的发送消息统计
+func (c *MessageController) GetMyStats(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	stats, err := c.MessageService.GetUserStats(userID.(uint))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"stats": stats,
+	})
+}
+
+// parseTimeRange 解析RFC3339格式的时间范围，to缺省为当前时间，from缺省为to之前的最大跨度
+func parseTimeRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	to := time.Now()
+	if toStr != "" {
+		t, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("无效的结束时间，应为RFC3339格式")
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -config.AppConfig.MessageRangeMaxDays)
+	if fromStr != "" {
+		t, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("无效的开始时间，应为RFC3339格式")
+		}
+		from = t
+	}
+	return from, to, nil
+}
+
+// PurgeMyMessages 删除自己发送的全部消息
+// 不带 confirm 参数时返回确认令牌和待删除的消息数，带上令牌再次请求才会执行删除
+func (c *MessageController) PurgeMyMessages(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	token := ctx.Query("confirm")
+	if token == "" {
+		confirmToken, count, err := c.MessageService.RequestPurgeToken(userID.(uint))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成确认令牌失败"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":       "删除后无法恢复，请在有效期内带上 confirm 参数再次请求",
+			"confirm_token": confirmToken,
+			"message_count": count,
+			"expires_in":    int(services.PurgeTokenTTL.Seconds()),
+		})
+		return
+	}
+
+	deleted, err := c.MessageService.PurgeOwnMessages(userID.(uint), token)
+	if err != nil {
+		ctx.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "消息已删除",
+		"deleted": deleted,
+	})
+}
+
+// messageErrorStatus 根据消息操作错误返回对应的HTTP状态码
+func messageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrMessageNotFound),
+		errors.Is(err, services.ErrReactionNotFound),
+		errors.Is(err, services.ErrGroupNotFound),
+		errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrReceiverRequired),
+		errors.Is(err, services.ErrInvalidRange),
+		errors.Is(err, services.ErrRangeTooLarge),
+		errors.Is(err, services.ErrContentTooLong),
+		errors.Is(err, services.ErrInvalidContent),
+		errors.Is(err, services.ErrSystemMessageSend),
+		errors.Is(err, services.ErrSystemMessageAction),
+		errors.Is(err, services.ErrInvalidPurgeToken),
+		errors.Is(err, services.ErrSearchQueryRequired),
+		errors.Is(err, services.ErrSearchQueryTooLong),
+		errors.Is(err, services.ErrPrivateSearchEncrypted),
+		errors.Is(err, models.ErrSelfMessage):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrNoRecallPermission),
+		errors.Is(err, services.ErrNoPinPermission),
+		errors.Is(err, services.ErrNotConversationUser),
+		errors.Is(err, services.ErrPostNotAllowed),
+		errors.Is(err, services.ErrUserMuted),
+		errors.Is(err, services.ErrUserBanned),
+		errors.Is(err, services.ErrMessagingNotAllowed),
+		errors.Is(err, services.ErrNotMessageSender),
+		errors.Is(err, services.ErrNotMessageAuthor),
+		errors.Is(err, services.ErrEditWindowExpired):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrMessageAlreadyGone),
+		errors.Is(err, services.ErrAlreadyPinned),
+		errors.Is(err, services.ErrNotPinned):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrSlowMode):
+		return http.StatusTooManyRequests
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/config"
+	"chatroom/models"
+	"chatroom/services"
+)
+
+func TestSendMessageByUsername(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	userService := services.NewUserService(db, rdb)
+	controller := NewMessageController(services.NewMessageService(db, rdb, userService, nil), userService)
+
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+
+	send := func(body gin.H) int {
+		return serve(controller.SendMessage, http.MethodPost, "/messages", "/messages", alice.ID, body).Code
+	}
+
+	if code := send(gin.H{"content": "hi", "type": models.PrivateMessage, "receiver_username": "bob"}); code != http.StatusOK {
+		t.Fatalf("按用户名发送状态码 = %d，期望 200", code)
+	}
+	var msg models.Message
+	if err := db.Last(&msg).Error; err != nil {
+		t.Fatalf("读取消息失败: %v", err)
+	}
+	if msg.ReceiverID != bob.ID || msg.SenderID != alice.ID {
+		t.Fatalf("保存的消息 = %+v，期望接收者为 bob", msg)
+	}
+
+	if code := send(gin.H{"content": "hi", "type": models.PrivateMessage, "receiver_username": "nobody"}); code != http.StatusNotFound {
+		t.Fatalf("用户名不存在状态码 = %d，期望 404", code)
+	}
+	if code := send(gin.H{"content": "hi", "type": models.PrivateMessage}); code != http.StatusBadRequest {
+		t.Fatalf("未指定接收者状态码 = %d，期望 400", code)
+	}
+}
+
+func TestSendMessageToSelfRejected(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	userService := services.NewUserService(db, rdb)
+	controller := NewMessageController(services.NewMessageService(db, rdb, userService, nil), userService)
+	alice := createUser(t, db, "alice")
+
+	for _, body := range []gin.H{
+		{"content": "hi", "type": models.PrivateMessage, "receiver_id": alice.ID},
+		{"content": "hi", "type": models.PrivateMessage, "receiver_username": "alice"},
+	} {
+		if w := serve(controller.SendMessage, http.MethodPost, "/messages", "/messages", alice.ID, body); w.Code != http.StatusBadRequest {
+			t.Fatalf("给自己发消息 %v 状态码 = %d，期望 400", body, w.Code)
+		}
+	}
+}
+
+func TestSendMessageContentLimit(t *testing.T) {
+	old := config.AppConfig.MessageMaxRunes
+	config.AppConfig.MessageMaxRunes = 5
+	t.Cleanup(func() { config.AppConfig.MessageMaxRunes = old })
+
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	userService := services.NewUserService(db, rdb)
+	controller := NewMessageController(services.NewMessageService(db, rdb, userService, nil), userService)
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+
+	send := func(content string) int {
+		body := gin.H{"content": content, "type": models.PrivateMessage, "receiver_id": bob.ID}
+		return serve(controller.SendMessage, http.MethodPost, "/messages", "/messages", alice.ID, body).Code
+	}
+
+	// 5个emoji共20字节，按字符计数未超出上限
+	if code := send(strings.Repeat("😀", 5)); code != http.StatusOK {
+		t.Fatalf("上限内的emoji消息状态码 = %d，期望 200", code)
+	}
+	if code := send(strings.Repeat("😀", 6)); code != http.StatusBadRequest {
+		t.Fatalf("超出上限的emoji消息状态码 = %d，期望 400", code)
+	}
+	if code := send("hello!"); code != http.StatusBadRequest {
+		t.Fatalf("超出上限的ASCII消息状态码 = %d，期望 400", code)
+	}
+}
+
+func TestEditMessageStatus(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	userService := services.NewUserService(db, rdb)
+	controller := NewMessageController(services.NewMessageService(db, rdb, userService, nil), userService)
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+
+	msg := models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Type: models.PrivateMessage, Content: "helo"}
+	if err := db.Create(&msg).Error; err != nil {
+		t.Fatalf("创建消息失败: %v", err)
+	}
+	edit := func(userID uint, id string, body gin.H) *httptest.ResponseRecorder {
+		return serve(controller.EditMessage, http.MethodPut, "/messages/:id", "/messages/"+id, userID, body)
+	}
+
+	w := edit(alice.ID, fmt.Sprint(msg.ID), gin.H{"content": "hello"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("编辑状态码 = %d，期望 200: %s", w.Code, w.Body.String())
+	}
+	var resp models.MessageResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Content != "hello" || resp.EditedAt == nil {
+		t.Fatalf("编辑响应 = %+v", resp)
+	}
+
+	tests := []struct {
+		name   string
+		userID uint
+		id     string
+		body   gin.H
+		want   int
+	}{
+		{"非作者编辑", bob.ID, fmt.Sprint(msg.ID), gin.H{"content": "x"}, http.StatusForbidden},
+		{"消息不存在", alice.ID, "9999", gin.H{"content": "x"}, http.StatusNotFound},
+		{"无效的消息ID", alice.ID, "abc", gin.H{"content": "x"}, http.StatusBadRequest},
+		{"缺少内容", alice.ID, fmt.Sprint(msg.ID), gin.H{}, http.StatusBadRequest},
+		{"未认证", 0, fmt.Sprint(msg.ID), gin.H{"content": "x"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if code := edit(tt.userID, tt.id, tt.body).Code; code != tt.want {
+			t.Errorf("%s 状态码 = %d，期望 %d", tt.name, code, tt.want)
+		}
+	}
+}
+
+func TestMessageHistoryBeforeID(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	userService := services.NewUserService(db, rdb)
+	controller := NewMessageController(services.NewMessageService(db, rdb, userService, nil), userService)
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+
+	var ids []uint
+	for i := 0; i < 3; i++ {
+		msg := models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Type: models.PrivateMessage, Content: fmt.Sprint(i)}
+		if err := db.Create(&msg).Error; err != nil {
+			t.Fatalf("创建消息失败: %v", err)
+		}
+		ids = append(ids, msg.ID)
+	}
+	get := func(query string) (int, []models.MessageResponse, *uint) {
+		path := fmt.Sprintf("/messages/private/%d?%s", bob.ID, query)
+		w := serve(controller.GetPrivateMessages, http.MethodGet, "/messages/private/:user_id", path, alice.ID, nil)
+		var resp struct {
+			Messages   []models.MessageResponse `json:"messages"`
+			NextCursor *uint                    `json:"next_cursor"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Messages, resp.NextCursor
+	}
+
+	code, messages, next := get(fmt.Sprintf("before_id=%d&limit=1", ids[2]))
+	if code != http.StatusOK || len(messages) != 1 || messages[0].ID != ids[1] || next == nil || *next != ids[1] {
+		t.Fatalf("游标分页 = %d, %+v, %v，期望消息 %d 且 next_cursor 为 %d", code, messages, next, ids[1], ids[1])
+	}
+	// 取完后 next_cursor 为 null
+	code, messages, next = get(fmt.Sprintf("before_id=%d&limit=5", *next))
+	if code != http.StatusOK || len(messages) != 1 || messages[0].ID != ids[0] || next != nil {
+		t.Fatalf("最后一页 = %d, %+v, %v，期望消息 %d 且 next_cursor 为空", code, messages, next, ids[0])
+	}
+	if code, _, _ := get("before_id=abc"); code != http.StatusBadRequest {
+		t.Fatalf("无效的before_id状态码 = %d，期望 400", code)
+	}
+	// 不带 before_id 时仍按偏移分页
+	if code, messages, _ := get("limit=2&offset=1"); code != http.StatusOK || len(messages) != 2 || messages[1].ID != ids[1] {
+		t.Fatalf("偏移分页 = %d, %+v", code, messages)
+	}
+}
+
+func TestSearchMessagesStatus(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	userService := services.NewUserService(db, rdb)
+	controller := NewMessageController(services.NewMessageService(db, rdb, userService, nil), userService)
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	group := models.Group{Name: "g", CreatorID: bob.ID}
+	if err := db.Create(&group).Error; err != nil {
+		t.Fatalf("创建群组失败: %v", err)
+	}
+	msg := models.Message{SenderID: bob.ID, ReceiverID: alice.ID, Type: models.PrivateMessage, Content: "see you at 5pm"}
+	if err := db.Create(&msg).Error; err != nil {
+		t.Fatalf("创建消息失败: %v", err)
+	}
+	search := func(query string) *httptest.ResponseRecorder {
+		return serve(controller.SearchMessages, http.MethodGet, "/messages/search", "/messages/search?"+query, alice.ID, nil)
+	}
+
+	w := search(fmt.Sprintf("type=private&target_id=%d&q=5pm", bob.ID))
+	var resp struct {
+		Results []models.MessageSearchHit `json:"results"`
+		HasMore bool                      `json:"has_more"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || len(resp.Results) != 1 || resp.Results[0].Message.ID != msg.ID || resp.HasMore {
+		t.Fatalf("搜索 = %d, %+v", w.Code, resp)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"无效的聊天类型", fmt.Sprintf("type=channel&target_id=%d&q=5pm", bob.ID), http.StatusBadRequest},
+		{"无效的目标ID", "type=private&target_id=abc&q=5pm", http.StatusBadRequest},
+		{"缺少关键词", fmt.Sprintf("type=private&target_id=%d", bob.ID), http.StatusBadRequest},
+		{"无效的context", fmt.Sprintf("type=private&target_id=%d&q=5pm&context=x", bob.ID), http.StatusBadRequest},
+		{"非群成员", fmt.Sprintf("type=group&target_id=%d&q=5pm", group.ID), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if code := search(tt.query).Code; code != tt.want {
+			t.Errorf("%s 状态码 = %d，期望 %d", tt.name, code, tt.want)
+		}
+	}
+}
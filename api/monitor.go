@@ -30,10 +30,16 @@ func (c *MonitorController) GetSystemStatus(ctx *gin.Context) {
 
 	// 获取Kafka指标
 	kafkaMetrics := c.KafkaService.GetMetrics()
+	slowMetrics := c.WSManager.GetSlowClientMetrics()
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"connections": c.WSManager.GetConnectionCount(),
 		"goroutines":  runtime.NumGoroutine(),
+		"websocket": gin.H{
+			"write_timeouts":   slowMetrics["write_timeouts"],
+			"slow_disconnects": slowMetrics["slow_disconnects"],
+			"slow_connections": slowMetrics["slow_connections"],
+		},
 		"memory": gin.H{
 			"alloc":      m.Alloc / 1024 / 1024,      // MB
 			"total_alloc": m.TotalAlloc / 1024 / 1024, // MB
@@ -41,9 +47,16 @@ func (c *MonitorController) GetSystemStatus(ctx *gin.Context) {
 			"num_gc":     m.NumGC,
 		},
 		"kafka": gin.H{
-			"messages_sent":     kafkaMetrics["messages_sent"],
-			"messages_received": kafkaMetrics["messages_received"],
-			"errors":            kafkaMetrics["errors"],
+			"available":           c.KafkaService.Available(),
+			"messages_sent":       kafkaMetrics["messages_sent"],
+			"messages_received":   kafkaMetrics["messages_received"],
+			"errors":              kafkaMetrics["errors"],
+			"topic_errors":        kafkaMetrics["topic_errors"],
+			"retried":             kafkaMetrics["retried"],
+			"dropped":             kafkaMetrics["dropped"],
+			"retry_pending":       kafkaMetrics["retry_pending"],
+			"skipped":             kafkaMetrics["skipped"],
+			"fallback_deliveries": kafkaMetrics["fallback_deliveries"],
 		},
 	})
 }
@@ -53,4 +66,33 @@ func (c *MonitorController) GetConnectionStats(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{
 		"connections": c.WSManager.GetConnectionCount(),
 	})
-}
\ No newline at end of file
+}
+
+// GetReadiness 就绪检查，Kafka不可用时服务降级为本节点直接投递，仍视为就绪
+func (c *MonitorController) GetReadiness(ctx *gin.Context) {
+	kafkaState := "disabled"
+	if c.KafkaService != nil {
+		kafkaState = "unavailable"
+		if c.KafkaService.Available() {
+			kafkaState = "available"
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":   "ready",
+		"kafka":    kafkaState,
+		"degraded": kafkaState == "unavailable",
+	})
+}
+
+// GetKafkaErrors 获取最近的Kafka错误（仅管理员）
+func (c *MonitorController) GetKafkaErrors(ctx *gin.Context) {
+	if c.KafkaService == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kafka未启用"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"errors": c.KafkaService.RecentErrors(),
+	})
+}
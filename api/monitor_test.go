@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"chatroom/services"
+)
+
+func TestReadinessReportsKafkaState(t *testing.T) {
+	tests := []struct {
+		name     string
+		kafka    *services.KafkaService
+		want     string
+		degraded bool
+	}{
+		{"未启用Kafka", nil, "disabled", false},
+		{"Kafka不可用", &services.KafkaService{}, "unavailable", true},
+	}
+	for _, tt := range tests {
+		controller := NewMonitorController(nil, tt.kafka)
+		w := serve(controller.GetReadiness, http.MethodGet, "/ready", "/ready", 0, nil)
+		// Kafka不可用时降级为直接投递，仍视为就绪
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s 状态码 = %d，期望 200", tt.name, w.Code)
+		}
+		var resp struct {
+			Kafka    string `json:"kafka"`
+			Degraded bool   `json:"degraded"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Kafka != tt.want || resp.Degraded != tt.degraded {
+			t.Errorf("%s 就绪状态 = %+v，期望 kafka=%s degraded=%v", tt.name, resp, tt.want, tt.degraded)
+		}
+	}
+}
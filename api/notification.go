@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/models"
+	"chatroom/services"
+)
+
+// NotificationController 通知偏好控制器
+type NotificationController struct {
+	NotificationService *services.NotificationService
+}
+
+// NewNotificationController 创建通知偏好控制器
+func NewNotificationController(notificationService *services.NotificationService) *NotificationController {
+	return &NotificationController{
+		NotificationService: notificationService,
+	}
+}
+
+// GetPrefs 获取当前用户的通知偏好
+func (c *NotificationController) GetPrefs(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	prefs, err := c.NotificationService.GetPrefs(userID.(uint))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"prefs": prefs,
+	})
+}
+
+// UpdatePrefs 更新当前用户的通知偏好
+func (c *NotificationController) UpdatePrefs(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	var req models.NotificationPrefsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	prefs, err := c.NotificationService.UpdatePrefs(userID.(uint), req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "通知偏好更新成功",
+		"prefs":   prefs,
+	})
+}
+
+// GetDND 获取当前用户的全局勿扰设置
+func (c *NotificationController) GetDND(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	dnd, err := c.NotificationService.GetDND(userID.(uint))
+	if err != nil {
+		ctx.JSON(dndErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"dnd": models.DoNotDisturbResponse{DoNotDisturb: *dnd, Active: services.DNDActive(dnd, time.Now())},
+	})
+}
+
+// UpdateDND 更新当前用户的全局勿扰设置
+func (c *NotificationController) UpdateDND(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	var req models.DoNotDisturbRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	dnd, err := c.NotificationService.UpdateDND(userID.(uint), req)
+	if err != nil {
+		ctx.JSON(dndErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "勿扰设置更新成功",
+		"dnd":     models.DoNotDisturbResponse{DoNotDisturb: *dnd, Active: services.DNDActive(dnd, time.Now())},
+	})
+}
+
+// dndErrorStatus 将勿扰设置错误映射为HTTP状态码
+func dndErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidDNDSchedule),
+		errors.Is(err, services.ErrInvalidDNDUntil):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"chatroom/models"
+	"chatroom/services"
+)
+
+func TestUpdateDNDStatus(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	controller := NewNotificationController(services.NewNotificationService(db, rdb))
+	alice := createUser(t, db, "alice")
+
+	tests := []struct {
+		name   string
+		userID uint
+		body   models.DoNotDisturbRequest
+		want   int
+	}{
+		{"开启全天勿扰", alice.ID, models.DoNotDisturbRequest{Enabled: true}, http.StatusOK},
+		{"时段只设置开始", alice.ID, models.DoNotDisturbRequest{Enabled: true, Start: "22:00"}, http.StatusBadRequest},
+		{"用户不存在", 9999, models.DoNotDisturbRequest{Enabled: true}, http.StatusNotFound},
+		{"未认证", 0, models.DoNotDisturbRequest{Enabled: true}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := serve(controller.UpdateDND, http.MethodPut, "/users/me/dnd", "/users/me/dnd", tt.userID, tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s 状态码 = %d，期望 %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	w := serve(controller.GetDND, http.MethodGet, "/users/me/dnd", "/users/me/dnd", alice.ID, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"active":true`) {
+		t.Fatalf("获取勿扰设置 = %d %s，期望生效中", w.Code, w.Body.String())
+	}
+}
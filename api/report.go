@@ -0,0 +1,130 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/models"
+	"chatroom/services"
+)
+
+// ReportController 举报控制器
+type ReportController struct {
+	ReportService *services.ReportService
+}
+
+// NewReportController 创建举报控制器
+func NewReportController(reportService *services.ReportService) *ReportController {
+	return &ReportController{
+		ReportService: reportService,
+	}
+}
+
+// FileReport 举报用户或消息
+func (c *ReportController) FileReport(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	var req models.ReportRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	report, err := c.ReportService.FileReport(userID.(uint), req)
+	if err != nil {
+		ctx.JSON(reportErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"message": "举报已提交",
+		"report":  report,
+	})
+}
+
+// ListReports 获取举报队列（仅管理员），默认只返回待处理的举报
+func (c *ReportController) ListReports(ctx *gin.Context) {
+	status := models.ReportStatus(ctx.DefaultQuery("status", string(models.ReportPending)))
+	if status == "all" {
+		status = ""
+	} else if status != models.ReportPending && status != models.ReportResolved {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的举报状态"})
+		return
+	}
+
+	// 获取分页参数
+	limitStr := ctx.DefaultQuery("limit", "20")
+	offsetStr := ctx.DefaultQuery("offset", "0")
+	limit, _ := strconv.Atoi(limitStr)
+	offset, _ := strconv.Atoi(offsetStr)
+
+	reports, err := c.ReportService.ListReports(status, limit, offset)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"reports": reports,
+	})
+}
+
+// ResolveReport 处理举报（仅管理员）：驳回、警告、禁言或封禁
+func (c *ReportController) ResolveReport(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	reportID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的举报ID"})
+		return
+	}
+
+	var req models.ResolveReportRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	report, err := c.ReportService.ResolveReport(uint(reportID), userID.(uint), req)
+	if err != nil {
+		ctx.JSON(reportErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "举报已处理",
+		"report":  report,
+	})
+}
+
+// reportErrorStatus 根据举报操作错误返回对应的HTTP状态码
+func reportErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrReportNotFound),
+		errors.Is(err, services.ErrMessageNotFound),
+		errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotConversationUser):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrReportSelf),
+		errors.Is(err, services.ErrAlreadyReported),
+		errors.Is(err, services.ErrReportResolved),
+		errors.Is(err, services.ErrInvalidReportAction):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
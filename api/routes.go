@@ -5,6 +5,7 @@ import (
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 
+	"chatroom/middleware"
 	"chatroom/services"
 )
 
@@ -14,15 +15,30 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB, rdb *redis.Client, wsManager *se
 	userService := services.NewUserService(db, rdb)
 	kafkaService := wsManager.GetKafkaService() // 可能为 nil
 	messageService := services.NewMessageService(db, rdb, userService, kafkaService)
+	messageService.SetDirectDelivery(wsManager.SendToUser)
 	groupService := services.NewGroupService(db, userService)
+	groupService.SetDisbandHook(wsManager.HandleGroupDisbanded)
+	groupService.SetMemberRemovedHook(wsManager.HandleMemberRemoved)
+	groupService.SetEventPublisher(messageService.PublishGroupEvent)
+	groupService.SetUserEventPublisher(messageService.PublishUserEvent)
+	notificationService := services.NewNotificationService(db, rdb)
+	sessionService := services.NewSessionService(db, rdb)
+	sessionService.SetRevokeHook(wsManager.DisconnectSession)
+	reportService := services.NewReportService(db, userService, messageService, sessionService)
 
 	// 创建控制器
-	authController := NewAuthController(userService)
+	authController := NewAuthController(userService, sessionService)
 	userController := NewUserController(userService)
 	messageController := NewMessageController(messageService, userService)
 	groupController := NewGroupController(groupService)
+	searchController := NewSearchController(groupService)
 	wsController := NewWebSocketController(db, rdb, userService, wsManager)
 	monitorController := NewMonitorController(wsManager, kafkaService)
+	notificationController := NewNotificationController(notificationService)
+	meController := NewMeController(userService, groupService, messageService)
+	sessionController := NewSessionController(sessionService)
+	reportController := NewReportController(reportService)
+	adminController := NewAdminController(wsManager, messageService, services.NewMaintenanceService(rdb))
 
 	// 公开路由
 	public := r.Group("/api")
@@ -30,21 +46,59 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB, rdb *redis.Client, wsManager *se
 		// 认证相关
 		public.POST("/register", authController.Register)
 		public.POST("/login", authController.Login)
+		public.POST("/refresh", authController.Refresh)
 	}
 
 	// 需要认证的路由
 	api := r.Group("/api")
 	{
 		// 用户相关
+		api.GET("/me", meController.GetMe)
 		api.GET("/users", userController.GetAllUsers)
 		api.GET("/users/:id", userController.GetUserByID)
 		api.PUT("/users/:id", userController.UpdateUser)
 		api.GET("/users/online", wsController.GetOnlineUsers)
+		api.GET("/users/me/notifications", notificationController.GetPrefs)
+		api.PUT("/users/me/notifications", notificationController.UpdatePrefs)
+		api.GET("/users/me/dnd", notificationController.GetDND)
+		api.PUT("/users/me/dnd", notificationController.UpdateDND)
+		api.GET("/users/me/stats", messageController.GetMyStats)
+		api.GET("/users/me/preferences", userController.GetPreferences)
+		api.PUT("/users/me/preferences", userController.UpdatePreferences)
+		api.DELETE("/users/me/messages", messageController.PurgeMyMessages)
+		api.GET("/users/me/privacy", userController.GetMessagePrivacy)
+		api.PUT("/users/me/privacy", userController.UpdateMessagePrivacy)
+
+		// 会话相关（登录设备）
+		api.POST("/logout", authController.Logout)
+		api.GET("/sessions", sessionController.ListSessions)
+		api.DELETE("/sessions/:id", sessionController.RevokeSession)
 
 		// 消息相关
 		api.GET("/messages", messageController.GetMessages)
 		api.POST("/messages", messageController.SendMessage)
+		api.POST("/messages/read", messageController.MarkAsRead)
+		api.GET("/messages/search", messageController.SearchMessages)
 		api.GET("/messages/:id", messageController.GetMessage)
+		api.PUT("/messages/:id", messageController.EditMessage)
+		api.DELETE("/messages/:id", messageController.RecallMessage)
+		api.POST("/messages/:id/pin", messageController.PinMessage)
+		api.DELETE("/messages/:id/pin", messageController.UnpinMessage)
+		api.GET("/messages/:id/readers", messageController.GetMessageReaders)
+		api.POST("/messages/:id/reactions", messageController.AddReaction)
+		api.DELETE("/messages/:id/reactions/:emoji", messageController.RemoveReaction)
+
+		// 会话相关
+		api.GET("/conversations", messageController.GetRecentChats)
+		api.GET("/conversations/:target/typing", messageController.GetTypingUsers)
+		api.GET("/conversations/:target/pinned", messageController.GetPinnedMessages)
+		api.GET("/conversations/:target/draft", messageController.GetDraft)
+		api.PUT("/conversations/:target/draft", messageController.SaveDraft)
+		api.GET("/conversations/:target/export", messageController.ExportConversation)
+		api.POST("/conversations/:target/clear", messageController.ClearHistory)
+
+		// 发起新会话时的搜索
+		api.GET("/search", searchController.SearchConversations)
 
 		// 群组相关
 		api.GET("/groups", groupController.GetGroups)
@@ -52,8 +106,35 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB, rdb *redis.Client, wsManager *se
 		api.GET("/groups/:id", groupController.GetGroupByID)
 		api.PUT("/groups/:id", groupController.UpdateGroup)
 		api.DELETE("/groups/:id", groupController.DeleteGroup)
+		api.GET("/groups/:id/members", groupController.GetGroupMembers)
 		api.POST("/groups/:id/members", groupController.AddMember)
+		api.POST("/groups/:id/invite", groupController.InviteMember)
 		api.DELETE("/groups/:id/members/:userId", groupController.RemoveMember)
+		api.PUT("/groups/:id/folder", groupController.SetFolder)
+		api.PUT("/groups/:id/admins", groupController.SetGroupAdmin)
+		api.GET("/groups/:id/watchwords", groupController.GetWatchwords)
+		api.PUT("/groups/:id/watchwords", groupController.SetWatchwords)
+		api.GET("/groups/:id/alerts", groupController.GetKeywordAlerts)
+
+		// 入群邀请相关
+		api.GET("/invites", groupController.GetInvites)
+		api.POST("/invites/:id/accept", groupController.AcceptInvite)
+		api.POST("/invites/:id/reject", groupController.RejectInvite)
+
+		// 举报相关
+		api.POST("/reports", reportController.FileReport)
+		api.GET("/reports", middleware.AdminOnly(), reportController.ListReports)
+		api.POST("/reports/:id/resolve", middleware.AdminOnly(), reportController.ResolveReport)
+
+		// 管理员相关
+		api.POST("/admin/users/:id/disconnect", middleware.AdminOnly(), adminController.DisconnectUser)
+		api.GET("/admin/stats/top-senders", middleware.AdminOnly(), adminController.GetTopSenders)
+		api.POST("/admin/replay", middleware.AdminOnly(), adminController.ReplayMessages)
+		api.GET("/admin/maintenance", middleware.AdminOnly(), adminController.GetMaintenance)
+		api.POST("/admin/maintenance", middleware.AdminOnly(), adminController.SetMaintenance)
+		api.GET("/admin/kafka/paused", middleware.AdminOnly(), adminController.GetPausedTopics)
+		api.POST("/admin/kafka/pause", middleware.AdminOnly(), adminController.PauseTopic)
+		api.POST("/admin/kafka/resume", middleware.AdminOnly(), adminController.ResumeTopic)
 
 		// WebSocket
 		api.GET("/ws", wsController.HandleWebSocket)
@@ -61,5 +142,7 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB, rdb *redis.Client, wsManager *se
 		// 监控相关
 		api.GET("/monitor/system", monitorController.GetSystemStatus)
 		api.GET("/monitor/connections", monitorController.GetConnectionStats)
+		api.GET("/monitor/ready", monitorController.GetReadiness)
+		api.GET("/monitor/kafka/errors", middleware.AdminOnly(), monitorController.GetKafkaErrors)
 	}
 }
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/services"
+)
+
+// SearchController 会话搜索控制器
+type SearchController struct {
+	GroupService *services.GroupService
+}
+
+// NewSearchController 创建会话搜索控制器
+func NewSearchController(groupService *services.GroupService) *SearchController {
+	return &SearchController{
+		GroupService: groupService,
+	}
+}
+
+// SearchConversations 按名称搜索可以发起会话的用户和群组
+func (c *SearchController) SearchConversations(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 获取查询参数
+	query := strings.TrimSpace(ctx.Query("q"))
+	if query == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "查询参数不能为空"})
+		return
+	}
+	limit, _ := strconv.Atoi(ctx.Query("limit"))
+
+	result, err := c.GroupService.SearchConversations(userID.(uint), query, limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
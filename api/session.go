@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/services"
+)
+
+// SessionController 登录会话控制器
+type SessionController struct {
+	SessionService *services.SessionService
+}
+
+// NewSessionController 创建登录会话控制器
+func NewSessionController(sessionService *services.SessionService) *SessionController {
+	return &SessionController{
+		SessionService: sessionService,
+	}
+}
+
+// ListSessions 获取当前用户的活跃会话（登录设备）
+func (c *SessionController) ListSessions(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	sessions, err := c.SessionService.ListSessions(userID.(uint), ctx.GetString("sessionID"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+	})
+}
+
+// RevokeSession 注销当前用户的某个会话，该会话的令牌随即失效并断开其WebSocket连接
+func (c *SessionController) RevokeSession(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	if err := c.SessionService.RevokeSession(userID.(uint), ctx.Param("id")); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "会话已注销",
+	})
+}
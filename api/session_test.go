@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/middleware"
+	"chatroom/services"
+)
+
+func TestRevokedSessionTokenRejected(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	sessions := services.NewSessionService(db, rdb)
+	controller := NewSessionController(sessions)
+	alice := createUser(t, db, "alice")
+
+	phone, err := sessions.CreateSession(alice.ID, "phone", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	laptop, err := sessions.CreateSession(alice.ID, "laptop", "10.0.0.2")
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	token := func(sessionID string) string {
+		token, err := middleware.GenerateAccessToken(alice.ID, alice.Username, sessionID)
+		if err != nil {
+			t.Fatalf("生成令牌失败: %v", err)
+		}
+		return token
+	}
+	phoneToken, laptopToken := token(phone.ID), token(laptop.ID)
+
+	router := gin.New()
+	router.Use(middleware.JWTAuth(sessions))
+	router.GET("/api/sessions", controller.ListSessions)
+	router.DELETE("/api/sessions/:id", controller.RevokeSession)
+	request := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request(http.MethodGet, "/api/sessions", phoneToken); code != http.StatusOK {
+		t.Fatalf("注销前请求状态码 = %d，期望 200", code)
+	}
+	// 在另一台设备上注销手机的会话
+	if code := request(http.MethodDelete, "/api/sessions/"+phone.ID, laptopToken); code != http.StatusOK {
+		t.Fatalf("注销会话状态码 = %d，期望 200", code)
+	}
+	if code := request(http.MethodGet, "/api/sessions", phoneToken); code != http.StatusUnauthorized {
+		t.Fatalf("已注销会话的令牌请求状态码 = %d，期望 401", code)
+	}
+	if code := request(http.MethodGet, "/api/sessions", laptopToken); code != http.StatusOK {
+		t.Fatalf("其他会话请求状态码 = %d，期望 200", code)
+	}
+	if code := request(http.MethodDelete, "/api/sessions/"+phone.ID, laptopToken); code != http.StatusNotFound {
+		t.Fatalf("重复注销状态码 = %d，期望 404", code)
+	}
+}
@@ -1,12 +1,16 @@
 package api
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 
+	"chatroom/config"
+	"chatroom/models"
 	"chatroom/services"
 )
 
@@ -45,6 +49,13 @@ func (c *UserController) GetUserByID(ctx *gin.Context) {
 		return
 	}
 
+	// 只返回请求的字段
+	fields, err := parseFields(ctx.Query("fields"), userFields)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 获取用户信息
 	userResp, err := c.UserService.GetUserResponse(uint(userID))
 	if err != nil {
@@ -52,8 +63,14 @@ func (c *UserController) GetUserByID(ctx *gin.Context) {
 		return
 	}
 
+	shaped, err := shapeFields(userResp, fields)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"user": userResp,
+		"user": shaped,
 	})
 }
 
@@ -110,10 +127,15 @@ func (c *UserController) UpdateUser(ctx *gin.Context) {
 	}
 
 	user, err := c.UserService.UpdateUser(uint(id), req.Username, req.Email, req.Avatar)
+	if errors.Is(err, services.ErrInvalidAvatarURL) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	user.Avatar = services.AssetURL(user.Avatar)
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"user": user,
@@ -125,3 +147,106 @@ func contains(s, substr string) bool {
 	s, substr = strings.ToLower(s), strings.ToLower(substr)
 	return strings.Contains(s, substr)
 }
+
+// GetMessagePrivacy 获取当前用户的私聊隐私设置
+func (c *UserController) GetMessagePrivacy(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	user, err := c.UserService.GetUserByID(userID.(uint))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message_privacy": user.MessagePrivacy,
+	})
+}
+
+// UpdateMessagePrivacy 设置谁可以向当前用户发起私聊
+func (c *UserController) UpdateMessagePrivacy(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	var req models.MessagePrivacyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	if err := c.UserService.SetMessagePrivacy(userID.(uint), req.MessagePrivacy); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新隐私设置失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":         "隐私设置更新成功",
+		"message_privacy": req.MessagePrivacy,
+	})
+}
+
+// GetPreferences 获取当前用户的偏好设置
+func (c *UserController) GetPreferences(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	prefs, err := c.UserService.GetPreferences(userID.(uint))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"preferences": prefs,
+	})
+}
+
+// UpdatePreferences 整体替换当前用户的偏好设置，请求体为任意JSON
+func (c *UserController) UpdatePreferences(ctx *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, exists := ctx.Get("userID")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	// 多读一个字节，用于判断是否超出大小限制
+	body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, int64(config.AppConfig.PreferencesMaxBytes)+1))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "读取请求失败"})
+		return
+	}
+
+	prefs, err := c.UserService.UpdatePreferences(userID.(uint), body)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrPreferencesTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, services.ErrInvalidPreferences):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrUserNotFound):
+			status = http.StatusNotFound
+		}
+		ctx.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":     "偏好设置已保存",
+		"preferences": prefs,
+	})
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"chatroom/config"
+	"chatroom/services"
+)
+
+func TestUpdatePreferencesStatus(t *testing.T) {
+	db := newTestDB(t)
+	rdb, _ := newTestRedis(t)
+	controller := NewUserController(services.NewUserService(db, rdb))
+	alice := createUser(t, db, "alice")
+	old := config.AppConfig.PreferencesMaxBytes
+	config.AppConfig.PreferencesMaxBytes = 64
+	t.Cleanup(func() { config.AppConfig.PreferencesMaxBytes = old })
+
+	put := func(body interface{}) int {
+		return serve(controller.UpdatePreferences, http.MethodPut, "/users/me/preferences", "/users/me/preferences", alice.ID, body).Code
+	}
+	if code := put(map[string]string{"theme": "dark"}); code != http.StatusOK {
+		t.Fatalf("保存偏好状态码 = %d，期望 200", code)
+	}
+	if code := put(map[string]string{"theme": strings.Repeat("x", 64)}); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("超出大小状态码 = %d，期望 413", code)
+	}
+
+	w := serve(controller.GetPreferences, http.MethodGet, "/users/me/preferences", "/users/me/preferences", alice.ID, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"theme":"dark"`) {
+		t.Fatalf("获取偏好 = %d %s", w.Code, w.Body.String())
+	}
+}
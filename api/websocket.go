@@ -7,6 +7,7 @@ import (
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 
+	"chatroom/config"
 	"chatroom/services"
 )
 
@@ -14,6 +15,7 @@ import (
 type WebSocketController struct {
 	UserService    *services.UserService
 	MessageService *services.MessageService
+	SessionService *services.SessionService
 	WSManager      *services.WebSocketManager
 }
 
@@ -26,10 +28,12 @@ func NewWebSocketController(
 ) *WebSocketController {
 	kafkaService := wsManager.GetKafkaService() // 可能为 nil
 	messageService := services.NewMessageService(db, rdb, userService, kafkaService)
+	messageService.SetDirectDelivery(wsManager.SendToUser)
 
 	return &WebSocketController{
 		UserService:    userService,
 		MessageService: messageService,
+		SessionService: services.NewSessionService(db, rdb),
 		WSManager:      wsManager,
 	}
 }
@@ -49,6 +53,12 @@ func (c *WebSocketController) HandleWebSocket(ctx *gin.Context) {
 		return
 	}
 
+	// 被管理员临时禁止连接的用户直接以关闭帧拒绝
+	if c.WSManager.IsConnectBanned(userID.(uint)) {
+		services.RejectWebSocket(ctx.Writer, ctx.Request, services.CloseForcedDisconnect, "连接已被临时禁止")
+		return
+	}
+
 	// 处理WebSocket连接
 	c.handleConnection(ctx, userID.(uint), username.(string))
 }
@@ -63,40 +73,62 @@ func (c *WebSocketController) handleConnection(ctx *gin.Context, userID uint, us
 	}
 
 	// 创建客户端
-	client := &services.Client{
-		ID:       userID,
-		Username: username,
-		Conn:     conn,
-		Send:     make(chan []byte, 256),
-	}
+	client := services.NewClient(userID, username, conn)
+	client.Codec = services.CodecFor(conn.Subprotocol())
+	client.SessionID = ctx.GetString("sessionID")
+	client.Device = services.SentFrom(ctx.Query("device"), ctx.Request.UserAgent())
+	c.SessionService.Touch(client.SessionID, ctx.ClientIP())
+
+	// 握手事件必须是客户端收到的第一条消息，因此在注册前放入发送队列
+	client.SendConnected(c.MessageService.LastAckedMessageID(userID))
 
 	// 注册客户端
 	if !c.WSManager.RegisterClient(client) {
-		conn.Close()
-		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务器已达到最大连接数"})
+		client.CloseWithError(services.CloseTooManyConnections, "服务器已达到最大连接数")
 		return
 	}
 
+	// 注册后即可收到实时消息，立即启动写协程消费发送队列，
+	// 否则下面查询群组、回填和未读数期间缓冲被占满，新连接会被当作慢客户端断开
+	go client.WritePump(c.WSManager)
+
+	// 服务器负载偏高时告知新连接，客户端据此降低发送频率
+	c.WSManager.SendBackpressureState(client)
+
 	// 订阅用户私聊频道
 	c.WSManager.SubscribeToUserChannel(userID)
 
-	// 获取用户所在的群组
-	groups, err := c.UserService.GetUserGroups(userID)
-	if err == nil {
-		// 订阅用户所在的所有群组频道
-		for _, group := range groups {
-			c.WSManager.SubscribeToGroupChannel(userID, group.ID)
+	// 默认订阅用户所在的所有群组频道；subscribe=none 时由客户端通过 subscribe_groups 自行声明
+	if ctx.Query("subscribe") != "none" {
+		groups, err := c.UserService.GetUserGroups(userID)
+		if err == nil {
+			for _, group := range groups {
+				c.WSManager.SubscribeToGroupChannel(client, group.ID)
+			}
 		}
 	}
 
-	// 启动读写协程
-	go client.WritePump()
+	// 回填最近活跃会话的消息，客户端无需额外请求即可渲染
+	if config.AppConfig.WSBackfillConversations > 0 {
+		if backfill, err := c.MessageService.BuildBackfill(ctx.Request.Context(), userID); err == nil {
+			c.WSManager.SendBackfill(client, backfill)
+		}
+	}
+
+	// 同步离线期间累积的未读数，客户端无需再请求REST接口刷新角标
+	c.WSManager.SendUnreadSync(client, c.MessageService)
+
+	// 启动读协程
 	go client.ReadPump(c.WSManager, c.MessageService)
 }
 
 // GetOnlineUsers 获取在线用户列表
 func (c *WebSocketController) GetOnlineUsers(ctx *gin.Context) {
-	onlineUsers := c.WSManager.GetOnlineUsers()
+	onlineUsers, err := c.UserService.GetOnlineUsers()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取在线用户失败"})
+		return
+	}
 	ctx.JSON(http.StatusOK, gin.H{
 		"users": onlineUsers,
 	})
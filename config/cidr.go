@@ -0,0 +1,53 @@
+package config
+
+import (
+	"log"
+	"net"
+	"strings"
+)
+
+// ParseCIDRs 解析逗号分隔的网段列表，单个IP视为只包含该地址的网段，忽略格式错误的项
+func ParseCIDRs(value string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				log.Printf("忽略格式错误的网段配置: %s", item)
+				continue
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			log.Printf("忽略格式错误的网段配置: %s", item)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// ContainsIP 判断IP是否属于任一网段
+func ContainsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"net"
 	"os"
 	"runtime"
 	"strconv"
@@ -16,13 +17,39 @@ var AppConfig struct {
 	Port           string
 	Mode           string // debug 或 release
 	JWTSecret      string
-	MaxConnections int // 最大WebSocket连接数
+	MaxConnections int    // 最大WebSocket连接数
+	AdminUserIDs   []uint // 可访问运维接口的管理员用户ID
+
+	// 可信代理的IP或网段，只有来自这些地址的请求才按 X-Forwarded-For / X-Real-IP 识别客户端IP，为空时不信任任何代理
+	TrustedProxies []string
+
+	// 访问令牌的有效分钟数，以及刷新令牌（即登录会话）的有效小时数
+	AccessTokenMinutes int
+	RefreshTokenHours  int
+
+	// 校验令牌过期时间、生效时间和签发时间时允许的时钟偏差秒数
+	JWTLeewaySeconds int
+
+	// 密码规则：最少字符数、至少包含的字符类别数（小写、大写、数字、符号），
+	// 以及泄露密码查询接口（k-匿名范围查询，如 https://api.pwnedpasswords.com/range/），为空时不检查
+	PasswordMinLength  int
+	PasswordMinClasses int
+	PasswordBreachAPI  string
+
+	// 单个HTTP请求的最长处理毫秒数，超时后取消下游的数据库和Redis调用，为0时不限制
+	RequestTimeoutMs int
+
+	// 头像等资源的CDN地址（如 "https://cdn.example.com/assets"），
+	// 设置后存储的相对路径在响应时拼接为CDN地址，为空时原样返回
+	AssetCDNBaseURL string
 
 	// Redis配置（仅用于缓存）
 	RedisAddr     string
 	RedisPassword string
 	RedisDB       int
 	RedisPoolSize int
+	// 所有Redis键的前缀（如 "prod:"），多个环境或应用共用同一个Redis实例时避免键冲突
+	RedisKeyPrefix string
 
 	// Kafka配置（用于消息队列）
 	KafkaBootstrapServers  []string
@@ -30,6 +57,12 @@ var AppConfig struct {
 	KafkaTopicPrefix       string
 	KafkaPartitions        int
 	KafkaReplicationFactor int
+	KafkaErrorBufferSize   int // 保留供排查的最近错误条数
+	KafkaFailureThreshold  int // 连续失败多少次后判定Kafka不可用并开始重连
+	// 消费者组没有已提交偏移量时的起始位置：earliest 从最早的消息开始，latest 只消费之后的新消息
+	KafkaOffsetReset string
+	// 按主题类型（status、private、group、global）区分的保留时间和清理策略，创建主题时使用
+	KafkaTopicPolicies map[string]KafkaTopicPolicy
 
 	// 数据库配置
 	DBConnectionString string
@@ -41,6 +74,85 @@ var AppConfig struct {
 
 	// 消息队列配置
 	ChannelBuffSize int
+
+	// 离线消息推送webhook地址，为空表示不推送
+	PushWebhook string
+
+	// WebSocket配置
+	// 每个连接发送缓冲区可容纳的消息数。缓冲越大越能承受群聊突发流量，
+	// 但每个连接占用的内存也越多；缓冲写满时连接会被视为慢客户端而断开
+	WSSendBufferSize int
+
+	// 定向投递时发送缓冲已满的最长等待毫秒数，短暂的突发不会导致断开，为0时立即断开
+	WSSendTimeoutMs int
+
+	// 大群和全员广播扇出时并发投递的协程数，为1时退化为顺序投递
+	WSFanoutWorkers int
+
+	// 负载信号的检查间隔秒数，为0时不向客户端推送 backpressure 事件；
+	// 以及视为满负载的Kafka消费积压消息数
+	BackpressureIntervalSeconds int
+	BackpressureKafkaLag        int
+
+	// 连接时回填的最近会话数、每个会话的消息数，以及回填内容的最大字节数
+	WSBackfillConversations int
+	WSBackfillMessages      int
+	WSBackfillMaxBytes      int
+
+	// 群组配置
+	// 解散群组时对群消息的处理方式：keep 保留、soft_delete 软删除、purge 物理删除
+	GroupDisbandMessages string
+
+	// 创建群组时发送的欢迎系统消息模板，{group} 替换为群名，为 off 时不发送
+	GroupWelcomeMessage string
+
+	// 群组成员数上限，为0时不限制
+	GroupMaxMembers int
+
+	// 最近聊天列表预刷新配置
+	// 刷新间隔秒数（为0时不启用）、活跃用户的统计窗口分钟数，以及每轮最多刷新的用户数
+	RecentChatsRefreshSeconds  int
+	RecentChatsActiveMinutes   int
+	RecentChatsRefreshMaxUsers int
+
+	// 历史消息配置
+	// 单次查询返回的最大消息条数，以及导出会话时的最大消息条数
+	MessageHistoryMaxLimit int
+	MessageExportMax       int
+
+	// 按时间范围查询消息时允许的最大跨度（天）
+	MessageRangeMaxDays int
+
+	// 单条消息内容的最大字符数（按Unicode码点计数，而不是字节）
+	MessageMaxRunes int
+
+	// 用户偏好设置JSON的最大字节数
+	PreferencesMaxBytes int
+
+	// 关键词提醒webhook地址，为空表示只通过WebSocket提醒群管理员
+	KeywordAlertWebhook string
+
+	// 邮件配置，SMTPAddr 为空时不发送邮件
+	SMTPAddr     string // 如 "smtp.example.com:587"
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// 离线超过多少分钟的用户收到未读消息邮件摘要，为0时不发送；以及检查并发送摘要的间隔分钟数
+	EmailDigestOfflineMinutes  int
+	EmailDigestIntervalMinutes int
+
+	// 消息加密配置
+	// 私聊消息内容的静态加密密钥（base64编码的16/24/32字节AES密钥），为空表示不加密
+	MessageEncryptionKey string
+
+	// 限流配置
+	RateLimitBuckets map[string]RateLimitBucket
+	RateLimitRoutes  []RateLimitRoute
+
+	// 免于限流的来源：网段列表和内部令牌（请求头 X-Internal-Token）
+	RateLimitExemptCIDRs []*net.IPNet
+	RateLimitExemptToken string
 }
 
 // LoadConfig 从环境变量加载配置
@@ -56,12 +168,65 @@ func LoadConfig() {
 	AppConfig.Mode = getEnv("MODE", "debug")
 	AppConfig.JWTSecret = getEnv("JWT_SECRET", "your-secret-key")
 
+	accessTokenMinutes, err := strconv.Atoi(getEnv("ACCESS_TOKEN_MINUTES", "15"))
+	if err != nil || accessTokenMinutes <= 0 {
+		accessTokenMinutes = 15
+	}
+	AppConfig.AccessTokenMinutes = accessTokenMinutes
+
+	refreshTokenHours, err := strconv.Atoi(getEnv("REFRESH_TOKEN_HOURS", "720"))
+	if err != nil || refreshTokenHours <= 0 {
+		refreshTokenHours = 720
+	}
+	AppConfig.RefreshTokenHours = refreshTokenHours
+
+	jwtLeeway, err := strconv.Atoi(getEnv("JWT_LEEWAY_SECONDS", "30"))
+	if err != nil || jwtLeeway < 0 {
+		jwtLeeway = 30
+	}
+	AppConfig.JWTLeewaySeconds = jwtLeeway
+
+	// 密码规则
+	passwordMinLength, err := strconv.Atoi(getEnv("PASSWORD_MIN_LENGTH", "8"))
+	if err != nil || passwordMinLength <= 0 {
+		passwordMinLength = 8
+	}
+	AppConfig.PasswordMinLength = passwordMinLength
+
+	passwordMinClasses, err := strconv.Atoi(getEnv("PASSWORD_MIN_CLASSES", "2"))
+	if err != nil || passwordMinClasses < 0 || passwordMinClasses > 4 {
+		passwordMinClasses = 2
+	}
+	AppConfig.PasswordMinClasses = passwordMinClasses
+	AppConfig.PasswordBreachAPI = getEnv("PASSWORD_BREACH_API", "")
+
+	// 管理员用户ID，逗号分隔
+	for _, item := range strings.Split(getEnv("ADMIN_USER_IDS", ""), ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(item), 10, 32)
+		if err != nil {
+			continue
+		}
+		AppConfig.AdminUserIDs = append(AppConfig.AdminUserIDs, uint(id))
+	}
+
+	// 可信代理，逗号分隔
+	AppConfig.TrustedProxies = nil
+	for _, ipNet := range ParseCIDRs(getEnv("TRUSTED_PROXIES", "")) {
+		AppConfig.TrustedProxies = append(AppConfig.TrustedProxies, ipNet.String())
+	}
+
 	maxConn, err := strconv.Atoi(getEnv("MAX_CONNECTIONS", "10000"))
 	if err != nil {
 		maxConn = 10000
 	}
 	AppConfig.MaxConnections = maxConn
 
+	requestTimeout, err := strconv.Atoi(getEnv("REQUEST_TIMEOUT_MS", "10000"))
+	if err != nil || requestTimeout < 0 {
+		requestTimeout = 10000
+	}
+	AppConfig.RequestTimeoutMs = requestTimeout
+
 	// Redis配置
 	AppConfig.RedisAddr = getEnv("REDIS_ADDR", "localhost:6379")
 	AppConfig.RedisPassword = getEnv("REDIS_PASSWORD", "")
@@ -77,6 +242,10 @@ func LoadConfig() {
 		redisPoolSize = runtime.NumCPU() * 10
 	}
 	AppConfig.RedisPoolSize = redisPoolSize
+	AppConfig.RedisKeyPrefix = getEnv("REDIS_KEY_PREFIX", "")
+
+	// 资源CDN配置
+	AppConfig.AssetCDNBaseURL = strings.TrimRight(getEnv("ASSET_CDN_BASE_URL", ""), "/")
 
 	// Kafka配置
 	kafkaServers := getEnv("KAFKA_BOOTSTRAP_SERVERS", "localhost:9092")
@@ -96,6 +265,23 @@ func LoadConfig() {
 	}
 	AppConfig.KafkaReplicationFactor = kafkaReplication
 
+	kafkaErrorBuffer, err := strconv.Atoi(getEnv("KAFKA_ERROR_BUFFER", "100"))
+	if err != nil || kafkaErrorBuffer <= 0 {
+		kafkaErrorBuffer = 100
+	}
+	AppConfig.KafkaErrorBufferSize = kafkaErrorBuffer
+
+	kafkaFailureThreshold, err := strconv.Atoi(getEnv("KAFKA_FAILURE_THRESHOLD", "5"))
+	if err != nil || kafkaFailureThreshold <= 0 {
+		kafkaFailureThreshold = 5
+	}
+	AppConfig.KafkaFailureThreshold = kafkaFailureThreshold
+
+	AppConfig.KafkaOffsetReset = strings.ToLower(getEnv("KAFKA_OFFSET_RESET", "latest"))
+	if AppConfig.KafkaOffsetReset != "earliest" {
+		AppConfig.KafkaOffsetReset = "latest"
+	}
+
 	// 数据库配置
 	AppConfig.DBConnectionString = getEnv("DB_CONNECTION_STRING", "root:password@tcp(127.0.0.1:3306)/chatroom?charset=utf8mb4&parseTime=True&loc=Local")
 
@@ -118,6 +304,56 @@ func LoadConfig() {
 	}
 	AppConfig.CacheExpiration = cacheExpiration
 
+	// 群组配置
+	AppConfig.GroupDisbandMessages = getEnv("GROUP_DISBAND_MESSAGES", "soft_delete")
+	AppConfig.GroupWelcomeMessage = getEnv("GROUP_WELCOME_MESSAGE", "欢迎加入{group}！")
+	if AppConfig.GroupWelcomeMessage == "off" {
+		AppConfig.GroupWelcomeMessage = ""
+	}
+	groupMaxMembers, err := strconv.Atoi(getEnv("GROUP_MAX_MEMBERS", "0"))
+	if err != nil || groupMaxMembers < 0 {
+		groupMaxMembers = 0
+	}
+	AppConfig.GroupMaxMembers = groupMaxMembers
+
+	// 最近聊天列表预刷新配置
+	recentChatsRefresh, err := strconv.Atoi(getEnv("RECENT_CHATS_REFRESH_SECONDS", "0"))
+	if err != nil || recentChatsRefresh < 0 {
+		recentChatsRefresh = 0
+	}
+	AppConfig.RecentChatsRefreshSeconds = recentChatsRefresh
+
+	recentChatsActive, err := strconv.Atoi(getEnv("RECENT_CHATS_ACTIVE_MINUTES", "30"))
+	if err != nil || recentChatsActive <= 0 {
+		recentChatsActive = 30
+	}
+	AppConfig.RecentChatsActiveMinutes = recentChatsActive
+
+	recentChatsMaxUsers, err := strconv.Atoi(getEnv("RECENT_CHATS_REFRESH_MAX_USERS", "500"))
+	if err != nil || recentChatsMaxUsers <= 0 {
+		recentChatsMaxUsers = 500
+	}
+	AppConfig.RecentChatsRefreshMaxUsers = recentChatsMaxUsers
+	AppConfig.KeywordAlertWebhook = getEnv("KEYWORD_ALERT_WEBHOOK", "")
+
+	// 邮件配置
+	AppConfig.SMTPAddr = getEnv("SMTP_ADDR", "")
+	AppConfig.SMTPUsername = getEnv("SMTP_USERNAME", "")
+	AppConfig.SMTPPassword = getEnv("SMTP_PASSWORD", "")
+	AppConfig.SMTPFrom = getEnv("SMTP_FROM", AppConfig.SMTPUsername)
+
+	digestOffline, err := strconv.Atoi(getEnv("EMAIL_DIGEST_OFFLINE_MINUTES", "0"))
+	if err != nil || digestOffline < 0 {
+		digestOffline = 0
+	}
+	AppConfig.EmailDigestOfflineMinutes = digestOffline
+
+	digestInterval, err := strconv.Atoi(getEnv("EMAIL_DIGEST_INTERVAL_MINUTES", "10"))
+	if err != nil || digestInterval <= 0 {
+		digestInterval = 10
+	}
+	AppConfig.EmailDigestIntervalMinutes = digestInterval
+
 	// 消息队列配置
 	channelBuff, err := strconv.Atoi(getEnv("CHANNEL_BUFFER_SIZE", "1000"))
 	if err != nil {
@@ -125,6 +361,98 @@ func LoadConfig() {
 	}
 	AppConfig.ChannelBuffSize = channelBuff
 
+	// 离线推送
+	AppConfig.PushWebhook = getEnv("PUSH_WEBHOOK", "")
+
+	// WebSocket配置
+	wsSendBuffer, err := strconv.Atoi(getEnv("WS_SEND_BUFFER", "256"))
+	if err != nil || wsSendBuffer <= 0 {
+		wsSendBuffer = 256
+	}
+	AppConfig.WSSendBufferSize = wsSendBuffer
+
+	wsSendTimeout, err := strconv.Atoi(getEnv("WS_SEND_TIMEOUT_MS", "50"))
+	if err != nil || wsSendTimeout < 0 {
+		wsSendTimeout = 50
+	}
+	AppConfig.WSSendTimeoutMs = wsSendTimeout
+
+	backpressureInterval, err := strconv.Atoi(getEnv("BACKPRESSURE_INTERVAL_SECONDS", "5"))
+	if err != nil || backpressureInterval < 0 {
+		backpressureInterval = 5
+	}
+	AppConfig.BackpressureIntervalSeconds = backpressureInterval
+
+	backpressureLag, err := strconv.Atoi(getEnv("BACKPRESSURE_KAFKA_LAG", "10000"))
+	if err != nil || backpressureLag <= 0 {
+		backpressureLag = 10000
+	}
+	AppConfig.BackpressureKafkaLag = backpressureLag
+
+	fanoutWorkers, err := strconv.Atoi(getEnv("WS_FANOUT_WORKERS", "8"))
+	if err != nil || fanoutWorkers <= 0 {
+		fanoutWorkers = 8
+	}
+	AppConfig.WSFanoutWorkers = fanoutWorkers
+
+	backfillConversations, err := strconv.Atoi(getEnv("WS_BACKFILL_CONVERSATIONS", "5"))
+	if err != nil || backfillConversations < 0 {
+		backfillConversations = 5
+	}
+	AppConfig.WSBackfillConversations = backfillConversations
+
+	backfillMessages, err := strconv.Atoi(getEnv("WS_BACKFILL_MESSAGES", "20"))
+	if err != nil || backfillMessages <= 0 {
+		backfillMessages = 20
+	}
+	AppConfig.WSBackfillMessages = backfillMessages
+
+	backfillMaxBytes, err := strconv.Atoi(getEnv("WS_BACKFILL_MAX_BYTES", "262144"))
+	if err != nil || backfillMaxBytes <= 0 {
+		backfillMaxBytes = 262144
+	}
+	AppConfig.WSBackfillMaxBytes = backfillMaxBytes
+
+	// 历史消息配置
+	historyMaxLimit, err := strconv.Atoi(getEnv("MESSAGE_HISTORY_MAX_LIMIT", "100"))
+	if err != nil || historyMaxLimit <= 0 {
+		historyMaxLimit = 100
+	}
+	AppConfig.MessageHistoryMaxLimit = historyMaxLimit
+
+	exportMax, err := strconv.Atoi(getEnv("MESSAGE_EXPORT_MAX", "100000"))
+	if err != nil || exportMax <= 0 {
+		exportMax = 100000
+	}
+	AppConfig.MessageExportMax = exportMax
+
+	rangeMaxDays, err := strconv.Atoi(getEnv("MESSAGE_RANGE_MAX_DAYS", "31"))
+	if err != nil || rangeMaxDays <= 0 {
+		rangeMaxDays = 31
+	}
+	AppConfig.MessageRangeMaxDays = rangeMaxDays
+
+	maxRunes, err := strconv.Atoi(getEnv("MESSAGE_MAX_RUNES", "4000"))
+	if err != nil || maxRunes <= 0 {
+		maxRunes = 4000
+	}
+	AppConfig.MessageMaxRunes = maxRunes
+
+	prefsMaxBytes, err := strconv.Atoi(getEnv("PREFERENCES_MAX_BYTES", "16384"))
+	if err != nil || prefsMaxBytes <= 0 {
+		prefsMaxBytes = 16384
+	}
+	AppConfig.PreferencesMaxBytes = prefsMaxBytes
+
+	// 消息加密配置
+	AppConfig.MessageEncryptionKey = getEnv("MESSAGE_ENCRYPTION_KEY", "")
+
+	// Kafka主题策略配置
+	loadKafkaTopicConfig()
+
+	// 限流配置
+	loadRateLimitConfig()
+
 	log.Println("配置加载完成")
 }
 
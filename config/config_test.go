@@ -0,0 +1,118 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWSSendBufferSize(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{"", 256},
+		{"1024", 1024},
+		{"0", 256},
+		{"-5", 256},
+		{"abc", 256},
+	}
+	for _, tt := range tests {
+		t.Setenv("WS_SEND_BUFFER", tt.env)
+		LoadConfig()
+		if AppConfig.WSSendBufferSize != tt.want {
+			t.Errorf("WS_SEND_BUFFER=%q: WSSendBufferSize = %d，期望 %d", tt.env, AppConfig.WSSendBufferSize, tt.want)
+		}
+	}
+}
+
+func TestGroupWelcomeMessage(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{"", "欢迎加入{group}！"},
+		{"Welcome to {group}!", "Welcome to {group}!"},
+		{"off", ""},
+	}
+	for _, tt := range tests {
+		t.Setenv("GROUP_WELCOME_MESSAGE", tt.env)
+		LoadConfig()
+		if AppConfig.GroupWelcomeMessage != tt.want {
+			t.Errorf("GROUP_WELCOME_MESSAGE=%q: GroupWelcomeMessage = %q，期望 %q", tt.env, AppConfig.GroupWelcomeMessage, tt.want)
+		}
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	tests := []struct {
+		env  string
+		want []string
+	}{
+		{"", nil},
+		{"10.0.0.1", []string{"10.0.0.1/32"}},
+		{"10.0.0.0/8, 192.168.1.1 ,::1", []string{"10.0.0.0/8", "192.168.1.1/32", "::1/128"}},
+		{"bogus,172.16.0.0/12,10.0.0.0/33", []string{"172.16.0.0/12"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("TRUSTED_PROXIES", tt.env)
+		LoadConfig()
+		got := AppConfig.TrustedProxies
+		if len(got) != len(tt.want) {
+			t.Errorf("TRUSTED_PROXIES=%q: TrustedProxies = %v，期望 %v", tt.env, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("TRUSTED_PROXIES=%q: TrustedProxies = %v，期望 %v", tt.env, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestKafkaOffsetReset(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{"", "latest"},
+		{"earliest", "earliest"},
+		{"EARLIEST", "earliest"},
+		{"latest", "latest"},
+		{"oldest", "latest"},
+	}
+	for _, tt := range tests {
+		t.Setenv("KAFKA_OFFSET_RESET", tt.env)
+		LoadConfig()
+		if AppConfig.KafkaOffsetReset != tt.want {
+			t.Errorf("KAFKA_OFFSET_RESET=%q: KafkaOffsetReset = %q，期望 %q", tt.env, AppConfig.KafkaOffsetReset, tt.want)
+		}
+	}
+}
+
+func TestKafkaTopicPolicies(t *testing.T) {
+	tests := []struct {
+		env       string
+		topicType string
+		want      KafkaTopicPolicy
+	}{
+		{"", "status", KafkaTopicPolicy{10 * time.Minute, "delete"}},
+		{"", "group", KafkaTopicPolicy{72 * time.Hour, "delete"}},
+		{"", "unknown", KafkaTopicPolicy{24 * time.Hour, "delete"}},
+		{"status=5m/COMPACT", "status", KafkaTopicPolicy{5 * time.Minute, "compact"}},
+		{"status=5m/compact", "group", KafkaTopicPolicy{72 * time.Hour, "delete"}},
+		// 格式错误或取值无效的项被忽略，保留内置默认值
+		{"group=bad/delete", "group", KafkaTopicPolicy{72 * time.Hour, "delete"}},
+		{"group=500ms/delete", "group", KafkaTopicPolicy{72 * time.Hour, "delete"}},
+		{"private=1h/purge", "private", KafkaTopicPolicy{72 * time.Hour, "delete"}},
+		{"private=1h", "private", KafkaTopicPolicy{72 * time.Hour, "delete"}},
+		{"default=2h/delete", "unknown", KafkaTopicPolicy{2 * time.Hour, "delete"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("KAFKA_TOPIC_POLICIES", tt.env)
+		LoadConfig()
+		if got := KafkaTopicPolicyFor(tt.topicType); got != tt.want {
+			t.Errorf("KAFKA_TOPIC_POLICIES=%q: %s 的策略 = %+v，期望 %+v", tt.env, tt.topicType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// KafkaTopicPolicy 某类Kafka主题创建时使用的保留时间和清理策略
+type KafkaTopicPolicy struct {
+	Retention     time.Duration
+	CleanupPolicy string // delete 或 compact
+}
+
+// KafkaTopicDefault 未单独配置的主题类型使用的策略名称
+const KafkaTopicDefault = "default"
+
+// defaultKafkaTopicPolicies 状态主题只需保留几分钟，聊天主题保留数天供回放消费者补读
+const defaultKafkaTopicPolicies = "default=24h/delete,status=10m/delete,private=72h/delete,group=72h/delete,global=24h/delete"
+
+// loadKafkaTopicConfig 加载主题策略配置
+// KAFKA_TOPIC_POLICIES 格式为 主题类型=保留时间/清理策略，如 status=10m/delete，未配置的类型使用内置默认值
+func loadKafkaTopicConfig() {
+	AppConfig.KafkaTopicPolicies = parseKafkaTopicPolicies(defaultKafkaTopicPolicies)
+	for topicType, policy := range parseKafkaTopicPolicies(getEnv("KAFKA_TOPIC_POLICIES", "")) {
+		AppConfig.KafkaTopicPolicies[topicType] = policy
+	}
+}
+
+// KafkaTopicPolicyFor 返回主题类型对应的策略，未配置时使用默认策略
+func KafkaTopicPolicyFor(topicType string) KafkaTopicPolicy {
+	if policy, ok := AppConfig.KafkaTopicPolicies[topicType]; ok {
+		return policy
+	}
+	return AppConfig.KafkaTopicPolicies[KafkaTopicDefault]
+}
+
+// parseKafkaTopicPolicies 解析主题策略配置，忽略格式错误或取值无效的项
+func parseKafkaTopicPolicies(value string) map[string]KafkaTopicPolicy {
+	policies := make(map[string]KafkaTopicPolicy)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		topicType, spec, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(topicType) == "" {
+			log.Printf("忽略格式错误的Kafka主题策略配置: %s", item)
+			continue
+		}
+		retentionStr, cleanup, ok := strings.Cut(spec, "/")
+		if !ok {
+			log.Printf("忽略格式错误的Kafka主题策略配置: %s", item)
+			continue
+		}
+		retention, err := time.ParseDuration(retentionStr)
+		if err != nil || retention < time.Second {
+			log.Printf("忽略保留时间无效的Kafka主题策略配置: %s", item)
+			continue
+		}
+		cleanup = strings.ToLower(strings.TrimSpace(cleanup))
+		if cleanup != "delete" && cleanup != "compact" {
+			log.Printf("忽略清理策略无效的Kafka主题策略配置: %s", item)
+			continue
+		}
+
+		policies[strings.TrimSpace(topicType)] = KafkaTopicPolicy{Retention: retention, CleanupPolicy: cleanup}
+	}
+	return policies
+}
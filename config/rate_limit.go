@@ -0,0 +1,103 @@
+package config
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitBucket 限流桶：在Window时间窗口内最多允许Limit次请求
+type RateLimitBucket struct {
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitRoute 路由前缀到限流桶的映射
+type RateLimitRoute struct {
+	Prefix string
+	Bucket string
+}
+
+// 内置限流桶名称
+const (
+	BucketAuth      = "auth"      // 登录注册，严格
+	BucketMessaging = "messaging" // 写操作（发送消息等），适中
+	BucketRead      = "read"      // 读操作，宽松
+	BucketWS        = "ws"        // WebSocket连接，严格
+)
+
+const (
+	defaultRateLimitBuckets = "auth=10/1m,messaging=60/1m,read=300/1m,ws=5/1m"
+	defaultRateLimitRoutes  = "/api/login=auth,/api/register=auth,/api/refresh=auth,/api/ws=ws"
+)
+
+// loadRateLimitConfig 加载限流配置
+// RATE_LIMIT_BUCKETS 格式为 名称=次数/窗口，如 auth=10/1m；RATE_LIMIT_ROUTES 格式为 前缀=桶名称
+// 未匹配任何前缀的请求，GET/HEAD 使用 read 桶，其他方法使用 messaging 桶
+func loadRateLimitConfig() {
+	AppConfig.RateLimitBuckets = parseRateLimitBuckets(defaultRateLimitBuckets)
+	for name, bucket := range parseRateLimitBuckets(getEnv("RATE_LIMIT_BUCKETS", "")) {
+		AppConfig.RateLimitBuckets[name] = bucket
+	}
+
+	AppConfig.RateLimitRoutes = parseRateLimitRoutes(getEnv("RATE_LIMIT_ROUTES", defaultRateLimitRoutes))
+
+	// 免限流名单，默认为空
+	AppConfig.RateLimitExemptCIDRs = ParseCIDRs(getEnv("RATE_LIMIT_EXEMPT_CIDRS", ""))
+	AppConfig.RateLimitExemptToken = getEnv("RATE_LIMIT_EXEMPT_TOKEN", "")
+}
+
+// parseRateLimitBuckets 解析限流桶配置，忽略格式错误的项
+func parseRateLimitBuckets(value string) map[string]RateLimitBucket {
+	buckets := make(map[string]RateLimitBucket)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, spec, ok := strings.Cut(item, "=")
+		if !ok {
+			log.Printf("忽略格式错误的限流桶配置: %s", item)
+			continue
+		}
+		limitStr, windowStr, ok := strings.Cut(spec, "/")
+		if !ok {
+			log.Printf("忽略格式错误的限流桶配置: %s", item)
+			continue
+		}
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			log.Printf("忽略格式错误的限流桶配置: %s", item)
+			continue
+		}
+		window, err := time.ParseDuration(windowStr)
+		if err != nil || window <= 0 {
+			log.Printf("忽略格式错误的限流桶配置: %s", item)
+			continue
+		}
+
+		buckets[strings.TrimSpace(name)] = RateLimitBucket{Limit: limit, Window: window}
+	}
+	return buckets
+}
+
+// parseRateLimitRoutes 解析路由前缀映射，忽略格式错误的项
+func parseRateLimitRoutes(value string) []RateLimitRoute {
+	var routes []RateLimitRoute
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		prefix, bucket, ok := strings.Cut(item, "=")
+		if !ok || prefix == "" || bucket == "" {
+			log.Printf("忽略格式错误的限流路由配置: %s", item)
+			continue
+		}
+		routes = append(routes, RateLimitRoute{Prefix: prefix, Bucket: bucket})
+	}
+	return routes
+}
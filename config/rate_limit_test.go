@@ -0,0 +1,48 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitBuckets(t *testing.T) {
+	got := parseRateLimitBuckets(" auth=3/30s, read=100/1m, bad, zero=0/1m, neg=5/-1s, nowindow=5, word=x/1m")
+	want := map[string]RateLimitBucket{
+		"auth": {Limit: 3, Window: 30 * time.Second},
+		"read": {Limit: 100, Window: time.Minute},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseRateLimitBuckets = %+v，期望 %+v", got, want)
+	}
+}
+
+func TestParseRateLimitRoutes(t *testing.T) {
+	got := parseRateLimitRoutes("/api/login=auth, =read, /api/x=, /api/ws=ws, junk")
+	want := []RateLimitRoute{
+		{Prefix: "/api/login", Bucket: "auth"},
+		{Prefix: "/api/ws", Bucket: "ws"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseRateLimitRoutes = %+v，期望 %+v", got, want)
+	}
+}
+
+func TestRateLimitBucketsOverrideDefaults(t *testing.T) {
+	t.Setenv("RATE_LIMIT_BUCKETS", "auth=2/10s,search=20/1m")
+	LoadConfig()
+
+	buckets := AppConfig.RateLimitBuckets
+	if buckets[BucketAuth] != (RateLimitBucket{Limit: 2, Window: 10 * time.Second}) {
+		t.Errorf("auth 桶 = %+v，期望被覆盖为 2/10s", buckets[BucketAuth])
+	}
+	if buckets["search"] != (RateLimitBucket{Limit: 20, Window: time.Minute}) {
+		t.Errorf("新增的 search 桶 = %+v", buckets["search"])
+	}
+	// 未覆盖的内置桶保留默认值
+	for _, name := range []string{BucketMessaging, BucketRead, BucketWS} {
+		if _, ok := buckets[name]; !ok {
+			t.Errorf("内置桶 %s 丢失", name)
+		}
+	}
+}
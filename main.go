@@ -34,7 +34,9 @@ func main() {
 	dsn := config.AppConfig.DBConnectionString
 	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
 		Logger:      logger.Default.LogMode(logger.Silent),
-		PrepareStmt: true, // 缓存预编译语句
+		PrepareStmt: true, // 缓存预编译语句，变长 IN 查询需经 services.chunkIDs 固定参数个数
+		// 将驱动错误转换为gorm错误（如重复键 gorm.ErrDuplicatedKey）
+		TranslateError: true,
 	})
 	if err != nil {
 		log.Fatalf("数据库连接失败: %v", err)
@@ -50,7 +52,7 @@ func main() {
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	// 自动迁移数据库表结构
-	err = db.AutoMigrate(&models.User{}, &models.Message{}, &models.Group{}, &models.GroupMember{})
+	err = db.AutoMigrate(&models.User{}, &models.Message{}, &models.Group{}, &models.GroupMember{}, &models.NotificationPrefs{}, &models.ConversationRead{}, &models.PinnedMessage{}, &models.MessageReaction{}, &models.OutboxMessage{}, &models.Session{}, &models.GroupWatchword{}, &models.KeywordAlert{}, &models.Report{}, &models.ConversationClear{}, &models.GroupInvite{}, &models.EmailDigest{})
 	if err != nil {
 		log.Fatalf("数据库迁移失败: %v", err)
 	}
@@ -85,9 +87,32 @@ func main() {
 	// 初始化消息服务
 	messageService := services.NewMessageService(db, rdb, userService, kafkaService)
 
+	// 将旧版未读计数迁移为已读位置
+	if err := messageService.MigrateUnreadCounters(); err != nil {
+		log.Printf("警告: 未读计数迁移失败: %v", err)
+	}
+
+	// 启动后台任务
+	workers := services.NewWorkers()
+	workers.Go("outbox-relay", messageService.RunOutboxRelay)
+	if config.AppConfig.RecentChatsRefreshSeconds > 0 {
+		workers.Go("recent-chats-refresh", messageService.RunRecentChatsRefresher)
+	}
+	if config.AppConfig.PushWebhook != "" {
+		workers.Go("deferred-pushes", messageService.RunDeferredPushes)
+	}
+	if mailer := services.NewMailer(); mailer != nil && config.AppConfig.EmailDigestOfflineMinutes > 0 {
+		digestService := services.NewEmailDigestService(db, messageService, services.NewNotificationService(db, rdb), mailer)
+		workers.Go("email-digest", digestService.Run)
+	}
+
 	// 初始化WebSocket管理器
 	wsManager := services.NewWebSocketManager(rdb, messageService, userService)
+	messageService.SetDirectDelivery(wsManager.SendToUser)
 	go wsManager.Run()
+	if config.AppConfig.BackpressureIntervalSeconds > 0 {
+		workers.Go("backpressure", wsManager.RunBackpressureMonitor)
+	}
 
 	// 创建Gin实例
 	if config.AppConfig.Mode == "release" {
@@ -95,6 +120,11 @@ func main() {
 	}
 	r := gin.Default()
 
+	// 只信任配置的代理转发的客户端IP，限流、会话记录等按真实客户端IP处理
+	if err := r.SetTrustedProxies(config.AppConfig.TrustedProxies); err != nil {
+		log.Fatalf("配置可信代理失败: %v", err)
+	}
+
 	// 配置CORS
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
@@ -107,8 +137,14 @@ func main() {
 	// 添加限流中间件
 	r.Use(middleware.RateLimiter(rdb))
 
+	// 请求超时中间件，超时后取消下游调用
+	r.Use(middleware.RequestTimeout())
+
 	// 使用JWT中间件
-	r.Use(middleware.JWTAuth())
+	r.Use(middleware.JWTAuth(services.NewSessionService(db, rdb)))
+
+	// 维护模式中间件，依赖JWT解析出的用户判断是否为管理员
+	r.Use(middleware.Maintenance(services.NewMaintenanceService(rdb)))
 
 	// 注册路由
 	api.RegisterRoutes(r, db, rdb, wsManager)
@@ -122,7 +158,10 @@ func main() {
 	<-quit
 	log.Println("正在关闭服务器...")
 
-	// 停止WebSocket管理器（会关闭Kafka连接）
+	// 先停止后台任务，再停止WebSocket管理器（会关闭Kafka连接）
+	if err := workers.Shutdown(5 * time.Second); err != nil {
+		log.Printf("警告: %v", err)
+	}
 	wsManager.Stop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
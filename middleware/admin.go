@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/config"
+)
+
+// AdminOnly 仅允许 ADMIN_USER_IDS 中配置的用户访问，需在JWT认证之后使用
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+			c.Abort()
+			return
+		}
+
+		if isAdmin(userID.(uint)) {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+		c.Abort()
+	}
+}
+
+// isAdmin 判断用户是否在 ADMIN_USER_IDS 中
+func isAdmin(userID uint) bool {
+	for _, adminID := range config.AppConfig.AdminUserIDs {
+		if adminID == userID {
+			return true
+		}
+	}
+	return false
+}
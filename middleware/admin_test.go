@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/config"
+)
+
+func TestAdminOnly(t *testing.T) {
+	old := config.AppConfig.AdminUserIDs
+	config.AppConfig.AdminUserIDs = []uint{1}
+	t.Cleanup(func() { config.AppConfig.AdminUserIDs = old })
+
+	request := func(userID uint) int {
+		router := gin.New()
+		router.GET("/api/monitor/kafka/errors", func(c *gin.Context) {
+			if userID > 0 {
+				c.Set("userID", userID)
+			}
+		}, AdminOnly(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/monitor/kafka/errors", nil))
+		return w.Code
+	}
+
+	tests := []struct {
+		name   string
+		userID uint
+		want   int
+	}{
+		{"管理员", 1, http.StatusOK},
+		{"普通用户", 2, http.StatusForbidden},
+		{"未认证", 0, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := request(tt.userID); got != tt.want {
+			t.Errorf("%s: 状态码 = %d，期望 %d", tt.name, got, tt.want)
+		}
+	}
+}
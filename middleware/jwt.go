@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
@@ -10,31 +12,100 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/websocket"
 
 	"chatroom/config"
+	"chatroom/services"
+)
+
+// 令牌类型，写入 type 声明
+const (
+	TokenTypeAccess  = "access"  // 访问令牌，用于调用接口和建立WebSocket连接
+	TokenTypeRefresh = "refresh" // 刷新令牌，只能用于 /api/refresh 换取新的访问令牌
 )
 
 // JWTClaims 自定义JWT声明
 type JWTClaims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	Type      string `json:"type,omitempty"` // 令牌类型，旧版本签发的令牌为空，按访问令牌处理
+	SessionID string `json:"sid,omitempty"`  // 刷新令牌所属的会话ID，访问令牌的会话ID在jti中
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 生成JWT令牌
-func GenerateToken(userID uint, username string) (string, error) {
-	// 设置JWT声明
-	claims := JWTClaims{
+// Valid 校验令牌的过期时间、生效时间和签发时间，允许 JWT_LEEWAY_SECONDS 的时钟偏差，
+// 避免签发节点与校验节点、客户端之间的轻微时钟差异导致令牌被误判为过期或尚未生效
+func (c JWTClaims) Valid() error {
+	leeway := time.Duration(config.AppConfig.JWTLeewaySeconds) * time.Second
+	now := jwt.TimeFunc()
+	vErr := new(jwt.ValidationError)
+
+	if !c.VerifyExpiresAt(now.Add(-leeway), false) {
+		vErr.Inner = fmt.Errorf("%s by %s", jwt.ErrTokenExpired, now.Sub(c.ExpiresAt.Time))
+		vErr.Errors |= jwt.ValidationErrorExpired
+	}
+	if !c.VerifyIssuedAt(now.Add(leeway), false) {
+		vErr.Inner = jwt.ErrTokenUsedBeforeIssued
+		vErr.Errors |= jwt.ValidationErrorIssuedAt
+	}
+	if !c.VerifyNotBefore(now.Add(leeway), false) {
+		vErr.Inner = jwt.ErrTokenNotValidYet
+		vErr.Errors |= jwt.ValidationErrorNotValidYet
+	}
+
+	if vErr.Errors == 0 {
+		return nil
+	}
+	return vErr
+}
+
+// GenerateAccessToken 生成访问令牌，sessionID写入jti用于会话注销
+func GenerateAccessToken(userID uint, username, sessionID string) (string, error) {
+	now := time.Now()
+	return signToken(JWTClaims{
 		UserID:   userID,
 		Username: username,
+		Type:     TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(services.AccessTokenLifetime())),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "chatroom",
+		},
+	})
+}
+
+// GenerateRefreshToken 生成刷新令牌，返回令牌及其随机ID，调用方需将ID记录到会话中
+func GenerateRefreshToken(userID uint, username, sessionID string) (string, string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	tokenID := hex.EncodeToString(buf)
+
+	now := time.Now()
+	token, err := signToken(JWTClaims{
+		UserID:    userID,
+		Username:  username,
+		Type:      TokenTypeRefresh,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 令牌有效期24小时
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(services.RefreshTokenLifetime())),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "chatroom",
 		},
+	})
+	if err != nil {
+		return "", "", err
 	}
+	return token, tokenID, nil
+}
 
+// signToken 签名JWT令牌
+func signToken(claims JWTClaims) (string, error) {
 	// 创建令牌
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -47,8 +118,8 @@ func GenerateToken(userID uint, username string) (string, error) {
 	return tokenString, nil
 }
 
-// ParseToken 解析JWT令牌
-func ParseToken(tokenString string) (*JWTClaims, error) {
+// ParseToken 解析JWT令牌并校验令牌类型，旧版本签发的没有类型的令牌视为访问令牌
+func ParseToken(tokenString, tokenType string) (*JWTClaims, error) {
 	// 解析令牌
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(config.AppConfig.JWTSecret), nil
@@ -59,15 +130,23 @@ func ParseToken(tokenString string) (*JWTClaims, error) {
 	}
 
 	// 验证令牌
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("无效的令牌")
 	}
 
-	return nil, errors.New("无效的令牌")
+	actual := claims.Type
+	if actual == "" {
+		actual = TokenTypeAccess
+	}
+	if actual != tokenType {
+		return nil, errors.New("令牌类型不匹配")
+	}
+	return claims, nil
 }
 
-// JWTAuth JWT认证中间件
-func JWTAuth() gin.HandlerFunc {
+// JWTAuth JWT认证中间件，已注销会话的令牌会被拒绝
+func JWTAuth(sessions *services.SessionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		fmt.Println(c.Request.Header.Get("Authorization"))
 		log.Printf("%s", c.Request.URL.Path)
@@ -80,42 +159,61 @@ func JWTAuth() gin.HandlerFunc {
 		// 获取Authorization头
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供认证令牌"})
-			c.Abort()
+			abortUnauthorized(c, "未提供认证令牌")
 			return
 		}
 
 		// 检查Bearer前缀
 		parts := strings.SplitN(authHeader, " ", 2)
 		if !(len(parts) == 2 && parts[0] == "Bearer") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "认证格式错误"})
-			c.Abort()
+			abortUnauthorized(c, "认证格式错误")
 			return
 		}
 
 		// 解析令牌
-		claims, err := ParseToken(parts[1])
+		claims, err := ParseToken(parts[1], TokenTypeAccess)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的令牌: " + err.Error()})
-			c.Abort()
+			abortUnauthorized(c, "无效的令牌: "+err.Error())
+			return
+		}
+
+		// 检查会话是否已被注销
+		if sessions.IsRevoked(claims.ID) {
+			abortUnauthorized(c, "会话已注销，请重新登录")
 			return
 		}
 
 		// 将用户信息存储在上下文中
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("sessionID", claims.ID)
 
 		c.Next()
 	}
 }
 
+// abortUnauthorized 认证失败时中止请求
+// WebSocket升级请求无法读取HTTP错误响应，改为升级后发送带错误码的关闭帧
+func abortUnauthorized(c *gin.Context, message string) {
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		services.RejectWebSocket(c.Writer, c.Request, services.CloseUnauthorized, message)
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+	c.Abort()
+}
+
 // skipAuth 判断是否跳过认证
 func skipAuth(path string) bool {
 	// 不需要认证的路径列表
 	noAuthPaths := []string{
 		"/api/login",
 		"/api/register",
-		"/api/monitor",
+		"/api/refresh", // 访问令牌过期后仍需能够刷新
+		"/api/monitor/system",
+		"/api/monitor/connections",
+		"/api/monitor/ready",
 	}
 
 	for _, p := range noAuthPaths {
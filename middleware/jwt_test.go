@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"chatroom/config"
+)
+
+// withLeeway 在测试期间设置时钟偏差容忍秒数
+func withLeeway(t *testing.T, seconds int) {
+	t.Helper()
+	old := config.AppConfig.JWTLeewaySeconds
+	config.AppConfig.JWTLeewaySeconds = seconds
+	t.Cleanup(func() { config.AppConfig.JWTLeewaySeconds = old })
+}
+
+func TestJWTClaimsValidLeeway(t *testing.T) {
+	withLeeway(t, 30)
+	now := time.Now()
+	at := func(d time.Duration) *jwt.NumericDate { return jwt.NewNumericDate(now.Add(d)) }
+
+	tests := []struct {
+		name    string
+		claims  jwt.RegisteredClaims
+		wantErr uint32
+	}{
+		{"未过期", jwt.RegisteredClaims{ExpiresAt: at(time.Minute), IssuedAt: at(-time.Minute)}, 0},
+		{"过期时间在偏差范围内", jwt.RegisteredClaims{ExpiresAt: at(-10 * time.Second)}, 0},
+		{"超过偏差范围后过期", jwt.RegisteredClaims{ExpiresAt: at(-time.Minute)}, jwt.ValidationErrorExpired},
+		{"生效时间略晚于当前时间", jwt.RegisteredClaims{NotBefore: at(10 * time.Second), ExpiresAt: at(time.Hour)}, 0},
+		{"生效时间超过偏差范围", jwt.RegisteredClaims{NotBefore: at(time.Minute), ExpiresAt: at(time.Hour)}, jwt.ValidationErrorNotValidYet},
+		{"签发时间略晚于当前时间", jwt.RegisteredClaims{IssuedAt: at(10 * time.Second), ExpiresAt: at(time.Hour)}, 0},
+		{"签发时间超过偏差范围", jwt.RegisteredClaims{IssuedAt: at(time.Minute), ExpiresAt: at(time.Hour)}, jwt.ValidationErrorIssuedAt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := JWTClaims{RegisteredClaims: tt.claims}.Valid()
+			if tt.wantErr == 0 {
+				if err != nil {
+					t.Fatalf("期望通过校验，得到 %v", err)
+				}
+				return
+			}
+			var vErr *jwt.ValidationError
+			if !errors.As(err, &vErr) || vErr.Errors&tt.wantErr == 0 {
+				t.Fatalf("期望校验错误 %b，得到 %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseTokenWithinLeeway(t *testing.T) {
+	withLeeway(t, 30)
+	now := time.Now()
+	claims := JWTClaims{
+		UserID:   1,
+		Username: "alice",
+		Type:     TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(-10 * time.Second)),
+			NotBefore: jwt.NewNumericDate(now.Add(10 * time.Second)),
+			IssuedAt:  jwt.NewNumericDate(now.Add(10 * time.Second)),
+		},
+	}
+	token, err := signToken(claims)
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	if _, err := ParseToken(token, TokenTypeAccess); err != nil {
+		t.Fatalf("偏差范围内的令牌应被接受: %v", err)
+	}
+
+	withLeeway(t, 0)
+	if _, err := ParseToken(token, TokenTypeAccess); err == nil {
+		t.Fatal("不允许偏差时已过期的令牌应被拒绝")
+	}
+}
+
+func TestParseTokenType(t *testing.T) {
+	access, err := GenerateAccessToken(1, "alice", "s1")
+	if err != nil {
+		t.Fatalf("生成访问令牌失败: %v", err)
+	}
+	refresh, tokenID, err := GenerateRefreshToken(1, "alice", "s1")
+	if err != nil {
+		t.Fatalf("生成刷新令牌失败: %v", err)
+	}
+	// 旧版本签发的令牌没有类型字段
+	legacy, err := signToken(JWTClaims{
+		UserID:   1,
+		Username: "alice",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType string
+		wantErr   bool
+	}{
+		{"访问令牌作为访问令牌", access, TokenTypeAccess, false},
+		{"访问令牌作为刷新令牌", access, TokenTypeRefresh, true},
+		{"刷新令牌作为刷新令牌", refresh, TokenTypeRefresh, false},
+		{"刷新令牌作为访问令牌", refresh, TokenTypeAccess, true},
+		{"旧令牌作为访问令牌", legacy, TokenTypeAccess, false},
+		{"旧令牌作为刷新令牌", legacy, TokenTypeRefresh, true},
+	}
+	for _, tt := range tests {
+		if _, err := ParseToken(tt.token, tt.tokenType); (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v，期望出错 %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	claims, err := ParseToken(refresh, TokenTypeRefresh)
+	if err != nil {
+		t.Fatalf("解析刷新令牌失败: %v", err)
+	}
+	if claims.SessionID != "s1" || claims.ID != tokenID {
+		t.Fatalf("刷新令牌 sid = %q, jti = %q，期望 s1, %s", claims.SessionID, claims.ID, tokenID)
+	}
+
+	// 刷新接口不需要访问令牌
+	if !skipAuth("/api/refresh") {
+		t.Fatal("/api/refresh 应跳过认证")
+	}
+}
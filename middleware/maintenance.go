@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/services"
+)
+
+// maintenanceExemptPaths 维护期间仍然放行的路径：登录和刷新供管理员获取令牌，监控供健康检查使用
+var maintenanceExemptPaths = []string{
+	"/api/login",
+	"/api/refresh",
+	"/api/monitor/",
+}
+
+// Maintenance 维护模式中间件，开启后对非管理员请求返回503和Retry-After，需在JWT认证之后使用
+// WebSocket握手同样被拒绝，已建立的连接不受影响，可以自然断开后再重连
+func Maintenance(maintenance *services.MaintenanceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := maintenance.Status()
+		if !status.Enabled || maintenanceExempt(c) {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", strconv.Itoa(status.RetryAfter))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":       "系统维护中，请稍后重试",
+			"reason":      status.Reason,
+			"retry_after": status.RetryAfter,
+		})
+		c.Abort()
+	}
+}
+
+// maintenanceExempt 判断请求在维护期间是否放行
+func maintenanceExempt(c *gin.Context) bool {
+	if userID, exists := c.Get("userID"); exists && isAdmin(userID.(uint)) {
+		return true
+	}
+
+	path := c.Request.URL.Path
+	for _, p := range maintenanceExemptPaths {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/config"
+	"chatroom/services"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	old := config.AppConfig.AdminUserIDs
+	config.AppConfig.AdminUserIDs = []uint{1}
+	t.Cleanup(func() { config.AppConfig.AdminUserIDs = old })
+
+	rdb, _ := newTestRedis(t)
+	maintenance := services.NewMaintenanceService(rdb)
+
+	request := func(path string, userID uint) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			if userID > 0 {
+				c.Set("userID", userID)
+			}
+		}, Maintenance(maintenance))
+		router.Any("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := request("/api/messages", 2); w.Code != http.StatusOK {
+		t.Fatalf("未开启维护时状态码 = %d，期望 200", w.Code)
+	}
+
+	if _, err := maintenance.Enable("升级数据库", 120); err != nil {
+		t.Fatalf("开启维护模式失败: %v", err)
+	}
+	tests := []struct {
+		name   string
+		path   string
+		userID uint
+		want   int
+	}{
+		{"普通用户", "/api/messages", 2, http.StatusServiceUnavailable},
+		{"新的WebSocket连接", "/api/ws", 2, http.StatusServiceUnavailable},
+		{"管理员", "/api/messages", 1, http.StatusOK},
+		{"登录", "/api/login", 0, http.StatusOK},
+		{"健康检查", "/api/monitor/ready", 0, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := request(tt.path, tt.userID)
+		if w.Code != tt.want {
+			t.Errorf("%s: 状态码 = %d，期望 %d", tt.name, w.Code, tt.want)
+		}
+		if tt.want == http.StatusServiceUnavailable && w.Header().Get("Retry-After") != "120" {
+			t.Errorf("%s: Retry-After = %q，期望 120", tt.name, w.Header().Get("Retry-After"))
+		}
+	}
+
+	if err := maintenance.Disable(); err != nil {
+		t.Fatalf("关闭维护模式失败: %v", err)
+	}
+	if w := request("/api/messages", 2); w.Code != http.StatusOK {
+		t.Fatalf("关闭维护后状态码 = %d，期望 200", w.Code)
+	}
+}
@@ -2,34 +2,88 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+
+	"chatroom/config"
+	"chatroom/services"
 )
 
-// RateLimiter 创建一个基于Redis的限流中间件
+// RateLimiter 创建一个基于Redis的限流中间件，按路由类别使用不同的限流桶
 func RateLimiter(rdb *redis.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 内部服务、健康检查等可信来源不计数
+		if rateLimitExempt(c) {
+			c.Next()
+			return
+		}
+
 		// 获取客户端IP
 		clientIP := c.ClientIP()
 
-		// 对于WebSocket连接，使用更宽松的限制
-		if c.Request.URL.Path == "/ws" {
-			// WebSocket连接每分钟限制5次
-			key := "rate_limit:ws:" + clientIP
-			handleRateLimit(c, rdb, key, 5, 60*time.Second)
+		name := bucketFor(c)
+		bucket, ok := config.AppConfig.RateLimitBuckets[name]
+		if !ok {
+			// 未配置的桶不限流
+			c.Next()
 			return
 		}
 
-		// 普通API请求每分钟限制60次
-		key := "rate_limit:api:" + clientIP
-		handleRateLimit(c, rdb, key, 60, 60*time.Second)
+		key := services.RedisKey("rate_limit:%s:%s", name, clientIP)
+		handleRateLimit(c, rdb, key, bucket.Limit, bucket.Window)
 	}
 }
 
+// InternalTokenHeader 内部服务携带免限流令牌的请求头
+const InternalTokenHeader = "X-Internal-Token"
+
+// rateLimitExempt 判断请求是否来自免限流名单
+// 请求携带的内部令牌与 RATE_LIMIT_EXEMPT_TOKEN 一致，或来源IP属于 RATE_LIMIT_EXEMPT_CIDRS 时免于限流
+// 来源IP与限流计数一致，只在请求来自 TRUSTED_PROXIES 时采用 X-Forwarded-For 中的地址
+func rateLimitExempt(c *gin.Context) bool {
+	if token := config.AppConfig.RateLimitExemptToken; token != "" {
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(InternalTokenHeader)), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	if len(config.AppConfig.RateLimitExemptCIDRs) == 0 {
+		return false
+	}
+	return config.ContainsIP(config.AppConfig.RateLimitExemptCIDRs, net.ParseIP(c.ClientIP()))
+}
+
+// bucketFor 根据请求选择限流桶
+// WebSocket升级请求按握手头识别，不依赖具体的注册路径；其余请求优先匹配注册的路由模板
+func bucketFor(c *gin.Context) string {
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		return config.BucketWS
+	}
+
+	path := c.FullPath()
+	if path == "" {
+		path = c.Request.URL.Path
+	}
+	for _, route := range config.AppConfig.RateLimitRoutes {
+		if strings.HasPrefix(path, route.Prefix) {
+			return route.Bucket
+		}
+	}
+
+	if method := c.Request.Method; method == http.MethodGet || method == http.MethodHead {
+		return config.BucketRead
+	}
+	return config.BucketMessaging
+}
+
 // handleRateLimit 处理限流逻辑
 func handleRateLimit(c *gin.Context, rdb *redis.Client, key string, limit int, duration time.Duration) {
 	ctx := context.Background()
@@ -51,11 +105,17 @@ func handleRateLimit(c *gin.Context, rdb *redis.Client, key string, limit int, d
 	}
 
 	// 设置响应头
+	remaining := limit - count
+	if remaining < 0 {
+		remaining = 0
+	}
 	c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
-	c.Header("X-RateLimit-Remaining", strconv.Itoa(limit-count))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
 
 	// 检查是否超过限制
 	if count > limit {
+		// 告知客户端窗口结束前还需等待的秒数
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(rdb.TTL(ctx, key).Val(), duration)))
 		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
 			"error": "请求过于频繁，请稍后再试",
 		})
@@ -64,3 +124,15 @@ func handleRateLimit(c *gin.Context, rdb *redis.Client, key string, limit int, d
 
 	c.Next()
 }
+
+// retryAfterSeconds 将计数键的剩余时间换算为 Retry-After 秒数（向上取整，至少1秒），无法获取时使用整个窗口
+func retryAfterSeconds(ttl, window time.Duration) int {
+	if ttl <= 0 {
+		ttl = window
+	}
+	seconds := int((ttl + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
@@ -0,0 +1,310 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/config"
+)
+
+// newRateLimitedRouter 创建挂载限流中间件的路由
+func newRateLimitedRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	rdb, _ := newTestRedis(t)
+	r := gin.New()
+	r.Use(RateLimiter(rdb))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/api/ws", ok)
+	r.GET("/api/messages", ok)
+	return r
+}
+
+func wsUpgradeRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	return req
+}
+
+func TestRateLimitWSBucketReturns429(t *testing.T) {
+	r := newRateLimitedRouter(t)
+	bucket := config.AppConfig.RateLimitBuckets[config.BucketWS]
+
+	for i := 0; i < bucket.Limit; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, wsUpgradeRequest())
+		if w.Code != http.StatusOK {
+			t.Fatalf("第%d次连接被拒绝: %d", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != strconv.Itoa(bucket.Limit) {
+			t.Fatalf("X-RateLimit-Limit = %q，期望 WS 桶的 %d", got, bucket.Limit)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, wsUpgradeRequest())
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("超过限制后返回 %d，期望 429", w.Code)
+	}
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 || retryAfter > int(bucket.Window/time.Second) {
+		t.Fatalf("Retry-After = %q，应为 1~%d 秒", w.Header().Get("Retry-After"), int(bucket.Window/time.Second))
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Fatalf("X-RateLimit-Remaining = %q，期望 0", got)
+	}
+
+	// 其他桶不受 WS 桶计数影响
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/messages", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("读请求被 WS 桶限流: %d", w.Code)
+	}
+}
+
+func TestRateLimitExemptToken(t *testing.T) {
+	old := config.AppConfig.RateLimitExemptToken
+	config.AppConfig.RateLimitExemptToken = "internal"
+	t.Cleanup(func() { config.AppConfig.RateLimitExemptToken = old })
+
+	r := newRateLimitedRouter(t)
+	bucket := config.AppConfig.RateLimitBuckets[config.BucketWS]
+	for i := 0; i <= bucket.Limit; i++ {
+		req := wsUpgradeRequest()
+		req.Header.Set(InternalTokenHeader, "internal")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("携带内部令牌的请求被限流: %d", w.Code)
+		}
+	}
+
+	// 令牌错误时照常限流
+	req := wsUpgradeRequest()
+	req.Header.Set(InternalTokenHeader, "wrong")
+	for i := 0; i < bucket.Limit; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("错误的内部令牌返回 %d，期望 429", w.Code)
+	}
+}
+
+func TestRateLimitExemptCIDRs(t *testing.T) {
+	old := config.AppConfig.RateLimitExemptCIDRs
+	config.AppConfig.RateLimitExemptCIDRs = config.ParseCIDRs("10.0.0.0/8, 192.168.1.5")
+	t.Cleanup(func() { config.AppConfig.RateLimitExemptCIDRs = old })
+
+	r := newRateLimitedRouter(t)
+	bucket := config.AppConfig.RateLimitBuckets[config.BucketWS]
+	from := func(addr string) int {
+		req := wsUpgradeRequest()
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 名单内的来源永不限流
+	for _, addr := range []string{"10.1.2.3:5000", "192.168.1.5:5000"} {
+		for i := 0; i <= bucket.Limit; i++ {
+			if code := from(addr); code != http.StatusOK {
+				t.Fatalf("免限流来源 %s 第%d次请求返回 %d", addr, i+1, code)
+			}
+		}
+	}
+
+	// 名单外的来源照常限流
+	for i := 0; i < bucket.Limit; i++ {
+		if code := from("192.168.1.6:5000"); code != http.StatusOK {
+			t.Fatalf("第%d次请求被拒绝: %d", i+1, code)
+		}
+	}
+	if code := from("192.168.1.6:5000"); code != http.StatusTooManyRequests {
+		t.Fatalf("名单外来源超过限制后返回 %d，期望 429", code)
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		ttl, window time.Duration
+		want        int
+	}{
+		{30 * time.Second, time.Minute, 30},
+		{1500 * time.Millisecond, time.Minute, 2},
+		{100 * time.Millisecond, time.Minute, 1},
+		{-1, time.Minute, 60},
+	}
+	for _, tt := range tests {
+		if got := retryAfterSeconds(tt.ttl, tt.window); got != tt.want {
+			t.Errorf("retryAfterSeconds(%v, %v) = %d，期望 %d", tt.ttl, tt.window, got, tt.want)
+		}
+	}
+}
+
+func TestBucketForRoute(t *testing.T) {
+	r := gin.New()
+	var got string
+	record := func(c *gin.Context) { got = bucketFor(c) }
+	r.POST("/api/login", record)
+	r.POST("/api/register", record)
+	r.GET("/api/ws", record)
+	r.GET("/api/messages/private/:id", record)
+	r.POST("/api/messages", record)
+
+	tests := []struct {
+		req  *http.Request
+		want string
+	}{
+		{httptest.NewRequest(http.MethodPost, "/api/login", nil), config.BucketAuth},
+		{httptest.NewRequest(http.MethodPost, "/api/register", nil), config.BucketAuth},
+		{wsUpgradeRequest(), config.BucketWS},
+		{httptest.NewRequest(http.MethodGet, "/api/messages/private/3", nil), config.BucketRead},
+		{httptest.NewRequest(http.MethodPost, "/api/messages", nil), config.BucketMessaging},
+	}
+	for _, tt := range tests {
+		got = ""
+		r.ServeHTTP(httptest.NewRecorder(), tt.req)
+		if got != tt.want {
+			t.Errorf("%s %s 使用限流桶 %q，期望 %q", tt.req.Method, tt.req.URL.Path, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitConfiguredBucket(t *testing.T) {
+	oldBuckets := config.AppConfig.RateLimitBuckets
+	t.Cleanup(func() { config.AppConfig.RateLimitBuckets = oldBuckets })
+	config.AppConfig.RateLimitBuckets = map[string]config.RateLimitBucket{
+		config.BucketAuth: {Limit: 2, Window: time.Minute},
+	}
+
+	rdb, _ := newTestRedis(t)
+	r := gin.New()
+	r.Use(RateLimiter(rdb))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/api/login", ok)
+	r.GET("/api/messages", ok)
+
+	codes := make([]int, 3)
+	for i := range codes {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/login", nil))
+		codes[i] = w.Code
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("登录请求状态码 = %v，期望第3次被限流", codes)
+	}
+
+	// 未配置的桶不限流
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/messages", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("未配置桶的请求被限流: %d", w.Code)
+		}
+	}
+}
+
+func TestRateLimitKeyPrefix(t *testing.T) {
+	oldPrefix := config.AppConfig.RedisKeyPrefix
+	t.Cleanup(func() { config.AppConfig.RedisKeyPrefix = oldPrefix })
+	config.AppConfig.RedisKeyPrefix = "staging:"
+
+	rdb, mr := newTestRedis(t)
+	r := gin.New()
+	r.Use(RateLimiter(rdb))
+	r.GET("/api/messages", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/messages", nil))
+
+	keys := mr.Keys()
+	if len(keys) == 0 {
+		t.Fatal("限流未写入Redis键")
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "staging:rate_limit:") {
+			t.Errorf("限流键 %q 缺少前缀", key)
+		}
+	}
+}
+
+func TestRateLimitBucketsByClientBehindTrustedProxy(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	r := gin.New()
+	// 与 main 中相同：只信任配置的代理转发的客户端IP
+	if err := r.SetTrustedProxies([]string{"10.0.0.1"}); err != nil {
+		t.Fatalf("配置可信代理失败: %v", err)
+	}
+	r.Use(RateLimiter(rdb))
+	r.GET("/api/ws", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	bucket := config.AppConfig.RateLimitBuckets[config.BucketWS]
+	connect := func(remoteAddr, forwardedFor string) int {
+		req := wsUpgradeRequest()
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 经可信代理转发的请求按真实客户端IP分别计数
+	for i := 0; i < bucket.Limit; i++ {
+		if code := connect("10.0.0.1:5000", "203.0.113.1"); code != http.StatusOK {
+			t.Fatalf("客户端1第%d次连接被拒绝: %d", i+1, code)
+		}
+	}
+	if code := connect("10.0.0.1:5000", "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("客户端1超过限制后返回 %d，期望 429", code)
+	}
+	if code := connect("10.0.0.1:5000", "203.0.113.2"); code != http.StatusOK {
+		t.Fatalf("同一代理后的其他客户端被限流: %d", code)
+	}
+
+	// 不可信来源伪造的 X-Forwarded-For 被忽略，按连接对端计数
+	for i := 0; i < bucket.Limit; i++ {
+		if code := connect("198.51.100.7:5000", fmt.Sprintf("203.0.113.%d", 10+i)); code != http.StatusOK {
+			t.Fatalf("第%d次连接被拒绝: %d", i+1, code)
+		}
+	}
+	if code := connect("198.51.100.7:5000", "203.0.113.99"); code != http.StatusTooManyRequests {
+		t.Fatalf("伪造 X-Forwarded-For 绕过了限流: %d", code)
+	}
+}
+
+func TestRateLimitExemptCIDRsIgnoreSpoofedForwardedFor(t *testing.T) {
+	old := config.AppConfig.RateLimitExemptCIDRs
+	config.AppConfig.RateLimitExemptCIDRs = config.ParseCIDRs("10.0.0.0/8")
+	t.Cleanup(func() { config.AppConfig.RateLimitExemptCIDRs = old })
+
+	rdb, _ := newTestRedis(t)
+	r := gin.New()
+	if err := r.SetTrustedProxies(nil); err != nil {
+		t.Fatalf("配置可信代理失败: %v", err)
+	}
+	r.Use(RateLimiter(rdb))
+	r.GET("/api/ws", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// 未配置可信代理时，声称来自免限流网段的请求照常限流
+	bucket := config.AppConfig.RateLimitBuckets[config.BucketWS]
+	var code int
+	for i := 0; i <= bucket.Limit; i++ {
+		req := wsUpgradeRequest()
+		req.RemoteAddr = "198.51.100.7:5000"
+		req.Header.Set("X-Forwarded-For", "10.1.2.3")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		code = w.Code
+	}
+	if code != http.StatusTooManyRequests {
+		t.Fatalf("伪造免限流来源返回 %d，期望 429", code)
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"chatroom/config"
+)
+
+// RequestTimeout 为请求上下文设置 REQUEST_TIMEOUT_MS 超时
+// 客户端断开或超时后，使用 ctx.Request.Context() 的数据库和Redis调用会被取消
+// WebSocket握手之后是长连接，不设置超时
+func RequestTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := time.Duration(config.AppConfig.RequestTimeoutMs) * time.Millisecond
+		if timeout <= 0 || websocket.IsWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
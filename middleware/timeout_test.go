@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"chatroom/config"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	old := config.AppConfig.RequestTimeoutMs
+	config.AppConfig.RequestTimeoutMs = 50
+	t.Cleanup(func() { config.AppConfig.RequestTimeoutMs = old })
+
+	var deadline time.Time
+	var hasDeadline bool
+	router := gin.New()
+	router.Use(RequestTimeout())
+	router.GET("/*path", func(c *gin.Context) {
+		deadline, hasDeadline = c.Request.Context().Deadline()
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/messages", nil))
+	if remaining := time.Until(deadline); !hasDeadline || remaining > 50*time.Millisecond {
+		t.Fatalf("请求上下文剩余时间 = %v, %v，期望不超过 50ms", remaining, hasDeadline)
+	}
+
+	// WebSocket 握手不设置超时
+	router.ServeHTTP(httptest.NewRecorder(), wsUpgradeRequest())
+	if hasDeadline {
+		t.Fatal("WebSocket 握手不应设置截止时间")
+	}
+
+	// 超时为0时不限制
+	config.AppConfig.RequestTimeoutMs = 0
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/messages", nil))
+	if hasDeadline {
+		t.Fatal("未配置超时时不应设置截止时间")
+	}
+}
@@ -2,44 +2,190 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// GroupJoinPolicy 入群策略
+type GroupJoinPolicy string
+
+const (
+	JoinOpen       GroupJoinPolicy = "open"        // 任何人可直接加入
+	JoinInviteOnly GroupJoinPolicy = "invite_only" // 仅能由管理员邀请加入
+)
+
+// Valid 判断入群策略是否合法
+func (p GroupJoinPolicy) Valid() bool {
+	return p == JoinOpen || p == JoinInviteOnly
+}
+
+// GroupPostPolicy 发言策略
+type GroupPostPolicy string
+
+const (
+	PostAll        GroupPostPolicy = "all"         // 所有成员可发言
+	PostAdminsOnly GroupPostPolicy = "admins_only" // 仅群主和管理员可发言
 )
 
+// Valid 判断发言策略是否合法
+func (p GroupPostPolicy) Valid() bool {
+	return p == PostAll || p == PostAdminsOnly
+}
+
+// GroupHistoryVisibility 新成员可见的历史消息范围
+type GroupHistoryVisibility string
+
+const (
+	HistoryAll       GroupHistoryVisibility = "all"        // 可查看入群前的全部历史消息
+	HistorySinceJoin GroupHistoryVisibility = "since_join" // 仅可查看入群后的消息
+)
+
+// Valid 判断历史消息可见范围是否合法
+func (v GroupHistoryVisibility) Valid() bool {
+	return v == HistoryAll || v == HistorySinceJoin
+}
+
 // Group 群组模型
 type Group struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	Name        string    `json:"name" gorm:"not null"`
-	Description string    `json:"description"`
-	Avatar      string    `json:"avatar"`
-	CreatorID   uint      `json:"creator_id" gorm:"not null"`
-	Creator     User      `json:"creator" gorm:"foreignKey:CreatorID"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Members     []User    `json:"members,omitempty" gorm:"many2many:group_members;"`
+	ID                uint                   `json:"id" gorm:"primaryKey"`
+	Name              string                 `json:"name" gorm:"not null"`
+	Description       string                 `json:"description"`
+	Avatar            string                 `json:"avatar"`
+	Category          string                 `json:"category" gorm:"size:32;index"` // 群组分类（如 work、friends、gaming），由管理员设置
+	IsPublic          bool                   `json:"is_public" gorm:"default:true"` // 公开群组任何人可查看，私有群组仅成员可查看
+	JoinPolicy        GroupJoinPolicy        `json:"join_policy" gorm:"size:16;default:open"`
+	PostPolicy        GroupPostPolicy        `json:"post_policy" gorm:"size:16;default:all"`
+	HistoryVisibility GroupHistoryVisibility `json:"history_visibility" gorm:"size:16;default:all"`
+	SlowModeSeconds   int                    `json:"slow_mode_seconds" gorm:"default:0"` // 慢速模式下普通成员两次发言的最小间隔，0表示关闭
+	CreatorID         uint                   `json:"creator_id" gorm:"not null"`
+	Creator           User                   `json:"creator" gorm:"foreignKey:CreatorID"`
+	CreatedAt         time.Time              `json:"created_at"`
+	UpdatedAt         time.Time              `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt         `json:"-" gorm:"index"` // 解散时间，软删除保留审计记录
+	Members           []User                 `json:"members,omitempty" gorm:"many2many:group_members;"`
 }
 
 // GroupMember 群组成员关联表
 type GroupMember struct {
-	GroupID   uint      `gorm:"primaryKey"`
-	UserID    uint      `gorm:"primaryKey"`
-	JoinedAt  time.Time `json:"joined_at"`
-	IsAdmin   bool      `json:"is_admin" gorm:"default:false"`
+	GroupID  uint      `gorm:"primaryKey"`
+	UserID   uint      `gorm:"primaryKey"`
+	JoinedAt time.Time `json:"joined_at"`
+	IsAdmin  bool      `json:"is_admin" gorm:"default:false"`
+	Folder   string    `json:"folder" gorm:"size:32"` // 用户自定义的个人文件夹，为空时使用群组分类
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"` // 移出/退出时间，重新加入时恢复该记录
 }
 
 // GroupResponse 群组响应模型
 type GroupResponse struct {
-	ID          uint           `json:"id"`
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	Avatar      string         `json:"avatar"`
-	CreatorID   uint           `json:"creator_id"`
-	CreatedAt   time.Time      `json:"created_at"`
-	MemberCount int            `json:"member_count"`
-	Members     []UserResponse `json:"members,omitempty"`
+	ID                uint                   `json:"id"`
+	Name              string                 `json:"name"`
+	Description       string                 `json:"description"`
+	Avatar            string                 `json:"avatar"`
+	Category          string                 `json:"category"`
+	IsPublic          bool                   `json:"is_public"`
+	JoinPolicy        GroupJoinPolicy        `json:"join_policy"`
+	PostPolicy        GroupPostPolicy        `json:"post_policy"`
+	HistoryVisibility GroupHistoryVisibility `json:"history_visibility"`
+	SlowModeSeconds   int                    `json:"slow_mode_seconds"`
+	Folder            string                 `json:"folder,omitempty"` // 当前用户的个人文件夹
+	CreatorID         uint                   `json:"creator_id"`
+	Creator           *UserResponse          `json:"creator,omitempty"` // 创建者账号已不存在时为空
+	CreatedAt         time.Time              `json:"created_at"`
+	MemberCount       int                    `json:"member_count"`
+	MessageCount      int64                  `json:"message_count"`             // 未撤回的消息数
+	LastMessageAt     *time.Time             `json:"last_message_at,omitempty"` // 最后一条消息的时间
+	Members           []UserResponse         `json:"members,omitempty"`
+}
+
+// GroupSearchResult 会话搜索中匹配的群组
+type GroupSearchResult struct {
+	ID         uint            `json:"id"`
+	Name       string          `json:"name"`
+	Avatar     string          `json:"avatar"`
+	IsPublic   bool            `json:"is_public"`
+	JoinPolicy GroupJoinPolicy `json:"join_policy"`
+	IsMember   bool            `json:"is_member"` // 为false时是可加入的公开群组
+}
+
+// ConversationSearchResult 发起新会话时按名称搜索的结果，两类结果分别按匹配程度排序
+type ConversationSearchResult struct {
+	Users  []UserResponse      `json:"users"`
+	Groups []GroupSearchResult `json:"groups"`
 }
 
 // GroupRequest 创建/更新群组请求模型
+// 策略字段为空（或未传）时，创建使用默认值，更新保持不变
 type GroupRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description"`
-	Avatar      string `json:"avatar"`
-}
\ No newline at end of file
+	Name              string                 `json:"name" binding:"required"`
+	Description       string                 `json:"description"`
+	Avatar            string                 `json:"avatar"`
+	Category          string                 `json:"category" binding:"max=32"`
+	IsPublic          *bool                  `json:"is_public"`
+	JoinPolicy        GroupJoinPolicy        `json:"join_policy"`
+	PostPolicy        GroupPostPolicy        `json:"post_policy"`
+	HistoryVisibility GroupHistoryVisibility `json:"history_visibility"`
+	SlowModeSeconds   *int                   `json:"slow_mode_seconds" binding:"omitempty,min=0,max=21600"` // 为0时关闭慢速模式
+}
+
+// AddMemberResult 批量添加成员时单个用户的结果
+type AddMemberResult string
+
+const (
+	AddMemberAdded         AddMemberResult = "added"          // 添加成功
+	AddMemberAlreadyMember AddMemberResult = "already_member" // 已经是群组成员
+	AddMemberNotFound      AddMemberResult = "not_found"      // 用户不存在
+	AddMemberGroupFull     AddMemberResult = "group_full"     // 群组成员已满
+	AddMemberUnauthorized  AddMemberResult = "unauthorized"   // 操作者没有添加权限
+	AddMemberFailed        AddMemberResult = "failed"         // 其他错误
+)
+
+// MemberRoleChangedEvent 成员角色变化事件
+type MemberRoleChangedEvent struct {
+	GroupID   uint `json:"group_id"`
+	UserID    uint `json:"user_id"`
+	IsAdmin   bool `json:"is_admin"`
+	ChangedBy uint `json:"changed_by"`
+}
+
+// GroupFolderRequest 设置个人文件夹请求模型
+type GroupFolderRequest struct {
+	Folder string `json:"folder" binding:"max=32"` // 为空表示移出个人文件夹
+}
+
+// GroupInviteStatus 入群邀请状态
+type GroupInviteStatus string
+
+const (
+	InvitePending  GroupInviteStatus = "pending"  // 等待被邀请人处理
+	InviteAccepted GroupInviteStatus = "accepted" // 已接受并入群
+	InviteRejected GroupInviteStatus = "rejected" // 已拒绝
+)
+
+// GroupInvite 入群邀请，被邀请人同意后才会加入群组
+type GroupInvite struct {
+	ID          uint              `json:"id" gorm:"primaryKey"`
+	GroupID     uint              `json:"group_id" gorm:"not null;index"`
+	InviterID   uint              `json:"inviter_id" gorm:"not null"`
+	InviteeID   uint              `json:"invitee_id" gorm:"not null;index"`
+	Status      GroupInviteStatus `json:"status" gorm:"size:16;not null;default:'pending'"`
+	CreatedAt   time.Time         `json:"created_at"`
+	RespondedAt *time.Time        `json:"responded_at,omitempty"`
+}
+
+// GroupInviteRequest 邀请入群请求模型，用户名和用户ID二选一
+type GroupInviteRequest struct {
+	Username string `json:"username" binding:"required_without=UserID"`
+	UserID   uint   `json:"user_id"`
+}
+
+// GroupInviteEvent 推送给被邀请人的 group_invite 事件
+type GroupInviteEvent struct {
+	InviteID        uint   `json:"invite_id"`
+	GroupID         uint   `json:"group_id"`
+	GroupName       string `json:"group_name"`
+	InviterID       uint   `json:"inviter_id"`
+	InviterUsername string `json:"inviter_username"`
+}
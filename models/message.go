@@ -1,7 +1,11 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // MessageType 消息类型
@@ -13,6 +17,19 @@ const (
 	SystemMessage  MessageType = "system"  // 系统消息
 )
 
+// ConversationID 生成私聊会话的唯一标识，与收发方向无关
+func ConversationID(a, b uint) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("private:%d:%d", a, b)
+}
+
+// GroupConversationID 生成群聊会话的唯一标识
+func GroupConversationID(groupID uint) string {
+	return fmt.Sprintf("group:%d", groupID)
+}
+
 // Message 消息模型
 type Message struct {
 	ID         uint        `json:"id" gorm:"primaryKey"`
@@ -23,36 +40,258 @@ type Message struct {
 	ReceiverID uint        `json:"receiver_id"`        // 接收者ID（用户ID或群组ID）
 	GroupID    uint        `json:"group_id,omitempty"` // 群组ID，私聊时为0
 	CreatedAt  time.Time   `json:"created_at"`
+	DeletedAt  *time.Time  `json:"deleted_at,omitempty" gorm:"index"` // 撤回/删除时间，为空表示未删除
+	DeletedBy  uint        `json:"deleted_by,omitempty"`              // 执行撤回/删除的用户ID
+	Nonce      string      `json:"-" gorm:"size:32"`                  // 内容加密随机数，为空表示明文存储
+	SentFrom   string      `json:"-" gorm:"size:32"`                  // 发送设备，仅返回给发送者本人
+	EditedAt   *time.Time  `json:"edited_at,omitempty"`               // 最后编辑时间，为空表示未编辑
+}
+
+// ErrSelfMessage 不能给自己发送私聊消息
+var ErrSelfMessage = errors.New("不能给自己发送私聊消息")
+
+// Validate 校验消息的收发关系
+func (m *Message) Validate() error {
+	if m.GroupID == 0 && m.ReceiverID == m.SenderID {
+		return ErrSelfMessage
+	}
+	return nil
+}
+
+// BeforeCreate 保存前校验，防止绕过服务层写入自己发给自己的私聊消息
+func (m *Message) BeforeCreate(tx *gorm.DB) error {
+	return m.Validate()
 }
 
 // MessageRequest 消息请求模型
+// 私聊时 receiver_id 与 receiver_username 二选一，receiver_id 优先
 type MessageRequest struct {
-	Content    string      `json:"content" binding:"required"`
-	Type       MessageType `json:"type" binding:"required"`
-	ReceiverID uint        `json:"receiver_id" binding:"required"`
-	GroupID    uint        `json:"group_id,omitempty"`
+	Content          string      `json:"content" binding:"required"`
+	Type             MessageType `json:"type" binding:"required"`
+	ReceiverID       uint        `json:"receiver_id"`
+	ReceiverUsername string      `json:"receiver_username,omitempty"`
+	GroupID          uint        `json:"group_id,omitempty"`
 }
 
 // MessageResponse 消息响应模型
 type MessageResponse struct {
-	ID         uint         `json:"id"`
-	Content    string       `json:"content"`
-	Type       MessageType  `json:"type"`
-	SenderID   uint         `json:"sender_id"`
-	Sender     UserResponse `json:"sender"`
-	ReceiverID uint         `json:"receiver_id,omitempty"`
-	GroupID    uint         `json:"group_id,omitempty"`
-	CreatedAt  time.Time    `json:"created_at"`
+	ID         uint              `json:"id"`
+	Content    string            `json:"content"`
+	Type       MessageType       `json:"type"`
+	SenderID   uint              `json:"sender_id"`
+	Sender     UserResponse      `json:"sender"`
+	ReceiverID uint              `json:"receiver_id,omitempty"`
+	GroupID    uint              `json:"group_id,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Reactions  []ReactionSummary `json:"reactions,omitempty"`
+	ReadCount  *int              `json:"read_count,omitempty"` // 群消息已读人数（聚合计数）
+	SentFrom   string            `json:"sent_from,omitempty"`  // 发送设备，仅在查看者是发送者时返回
+	EditedAt   *time.Time        `json:"edited_at,omitempty"`  // 最后编辑时间
+}
+
+// MessageSearchHit 消息搜索结果，附带命中消息前后的消息作为上下文
+type MessageSearchHit struct {
+	Message MessageResponse   `json:"message"`
+	Before  []MessageResponse `json:"before,omitempty"`
+	After   []MessageResponse `json:"after,omitempty"`
+}
+
+// MessageEditRequest 编辑消息请求模型
+type MessageEditRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// MessageEditedEvent 消息编辑事件，通知会话成员原地更新消息内容
+type MessageEditedEvent struct {
+	MessageID  uint        `json:"message_id"`
+	Type       MessageType `json:"type"`
+	SenderID   uint        `json:"sender_id"`
+	ReceiverID uint        `json:"receiver_id,omitempty"`
+	GroupID    uint        `json:"group_id,omitempty"`
+	Content    string      `json:"content"`
+	EditedAt   time.Time   `json:"edited_at"`
+}
+
+// MessageReaction 消息表情回应
+type MessageReaction struct {
+	MessageID uint      `json:"message_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	Emoji     string    `json:"emoji" gorm:"primaryKey;size:32"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionSummary 消息某个表情的回应汇总
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+// ReactionRequest 表情回应请求模型
+type ReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required,max=32"`
+}
+
+// ReactionUpdateEvent 表情回应变化事件
+type ReactionUpdateEvent struct {
+	MessageID  uint              `json:"message_id"`
+	ReceiverID uint              `json:"receiver_id,omitempty"`
+	GroupID    uint              `json:"group_id,omitempty"`
+	UserID     uint              `json:"user_id"`
+	Emoji      string            `json:"emoji"`
+	Added      bool              `json:"added"`
+	Reactions  []ReactionSummary `json:"reactions"`
+}
+
+// 消息撤回原因
+const (
+	RecallWithdrawn      = "withdrawn"        // 发送者自行撤回
+	RecallRemovedByAdmin = "removed_by_admin" // 被群管理员移除
+)
+
+// MessageRecallEvent 消息撤回事件
+type MessageRecallEvent struct {
+	MessageID  uint        `json:"message_id"`
+	Type       MessageType `json:"type"`
+	SenderID   uint        `json:"sender_id"`
+	ReceiverID uint        `json:"receiver_id,omitempty"`
+	GroupID    uint        `json:"group_id,omitempty"`
+	DeletedBy  uint        `json:"deleted_by"`
+	Reason     string      `json:"reason"`
+	DeletedAt  time.Time   `json:"deleted_at"`
+}
+
+// DeletedMessagePlaceholder 已撤回/删除消息的占位内容
+const DeletedMessagePlaceholder = "消息已撤回"
+
+// MessageDeletedEvent 消息删除事件，携带消息的墓碑，客户端可直接用其替换原消息
+type MessageDeletedEvent struct {
+	MessageRecallEvent
+	Content string `json:"content"` // 占位内容，固定为 DeletedMessagePlaceholder
+}
+
+// NewMessageDeletedEvent 根据撤回事件构建删除事件的墓碑
+func NewMessageDeletedEvent(recall MessageRecallEvent) MessageDeletedEvent {
+	return MessageDeletedEvent{MessageRecallEvent: recall, Content: DeletedMessagePlaceholder}
+}
+
+// MessageDeliveredEvent 私聊消息已推送到接收者连接的回执，通过 delivered 事件推送给发送者
+// 与已读位置无关，接收者任一设备收到即发送一次
+type MessageDeliveredEvent struct {
+	MessageID   uint      `json:"message_id"`
+	ReceiverID  uint      `json:"receiver_id"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+// MessagePurgeProgress 批量删除自己消息的进度，通过 messages_purge_progress 事件推送给本人
+type MessagePurgeProgress struct {
+	Deleted int  `json:"deleted"`
+	Total   int  `json:"total"`
+	Done    bool `json:"done"`
+}
+
+// PinnedMessage 会话中的置顶消息
+type PinnedMessage struct {
+	ConversationID string    `json:"conversation_id" gorm:"primaryKey;size:64"`
+	MessageID      uint      `json:"message_id" gorm:"primaryKey"`
+	PinnedBy       uint      `json:"pinned_by" gorm:"not null"`
+	PinnedAt       time.Time `json:"pinned_at"`
+}
+
+// PinnedMessageResponse 置顶消息响应模型
+type PinnedMessageResponse struct {
+	Message  MessageResponse `json:"message"`
+	PinnedBy uint            `json:"pinned_by"`
+	PinnedAt time.Time       `json:"pinned_at"`
+}
+
+// MessagePinEvent 消息置顶/取消置顶事件
+type MessagePinEvent struct {
+	MessageID  uint      `json:"message_id"`
+	ReceiverID uint      `json:"receiver_id,omitempty"`
+	GroupID    uint      `json:"group_id,omitempty"`
+	Pinned     bool      `json:"pinned"`
+	OperatorID uint      `json:"operator_id"`
+	At         time.Time `json:"at"`
+}
+
+// ConversationRead 用户在会话中的已读位置
+type ConversationRead struct {
+	UserID            uint      `json:"user_id" gorm:"primaryKey"`
+	ConversationID    string    `json:"conversation_id" gorm:"primaryKey;size:64"`
+	LastReadMessageID uint      `json:"last_read_message_id"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// ConversationClear 用户清空会话记录，仅影响该用户自己的视图
+type ConversationClear struct {
+	UserID         uint      `json:"user_id" gorm:"primaryKey"`
+	ConversationID string    `json:"conversation_id" gorm:"primaryKey;size:64"`
+	ClearedBefore  time.Time `json:"cleared_before"` // 早于等于该时间的消息对该用户不可见
 }
 
 // RecentChat 最近聊天模型
 type RecentChat struct {
-	TargetID      uint      `json:"target_id"`
-	Type          string    `json:"type"` // "private" or "group"
-	Name          string    `json:"name"`
-	Avatar        string    `json:"avatar"`
-	LastMessage   string    `json:"last_message"`
-	LastMessageAt time.Time `json:"last_message_at"`
-	UnreadCount   int       `json:"unread_count"`
-	Online        bool      `json:"online,omitempty"` // For private chats
+	TargetID              uint        `json:"target_id"`
+	Type                  string      `json:"type"` // "private" or "group"
+	Name                  string      `json:"name"`
+	Avatar                string      `json:"avatar"`
+	LastMessage           string      `json:"last_message"`
+	LastMessageAt         time.Time   `json:"last_message_at"`
+	LastMessageType       MessageType `json:"last_message_type"`
+	LastMessageSenderID   uint        `json:"last_message_sender_id,omitempty"`   // 系统消息没有发送者
+	LastMessageSenderName string      `json:"last_message_sender_name,omitempty"` // 用于列表中显示"发送者: 内容"
+	UnreadCount           int         `json:"unread_count"`
+	MentionCount          int         `json:"mention_count"`        // 未读消息中@我的数量（仅群聊）
+	LastReadID            uint        `json:"last_read_message_id"` // 最后已读消息ID，用于跳转到第一条未读消息
+	Online                bool        `json:"online,omitempty"`     // For private chats
+	Folder                string      `json:"folder,omitempty"`     // 群聊所在文件夹（个人文件夹优先，其次为群组分类）
+	Draft                 *Draft      `json:"draft,omitempty"`      // 当前用户在该会话中的草稿
+}
+
+// Draft 会话草稿，保存在服务端以便跨设备同步
+type Draft struct {
+	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DraftRequest 保存草稿请求模型
+type DraftRequest struct {
+	Content string `json:"content" binding:"max=4000"` // 为空表示清除草稿
+}
+
+// UnreadSummary 用户未读消息汇总
+type UnreadSummary struct {
+	TotalUnread   int          `json:"total_unread"`
+	TotalMentions int          `json:"total_mentions"`
+	Conversations []RecentChat `json:"conversations"` // 有未读消息的会话
+}
+
+// BackfillConversation 连接回填中的单个会话
+type BackfillConversation struct {
+	TargetID uint              `json:"target_id"`
+	Type     string            `json:"type"` // "private" or "group"
+	Messages []MessageResponse `json:"messages"`
+}
+
+// Backfill 连接建立后推送的最近会话消息
+type Backfill struct {
+	Conversations []BackfillConversation `json:"conversations"`
+	Truncated     bool                   `json:"truncated"` // 超出大小上限，部分会话未包含
+}
+
+// TypingUser 正在输入的用户
+type TypingUser struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// ExportManifest 会话导出的清单行，位于NDJSON输出的第一行
+type ExportManifest struct {
+	Type           string    `json:"type"` // 固定为 "manifest"
+	ConversationID string    `json:"conversation_id"`
+	Total          int64     `json:"total"`     // 导出开始时会话中的消息总数
+	Count          int64     `json:"count"`     // 实际导出的消息数
+	Truncated      bool      `json:"truncated"` // 是否因超过导出上限而截断
+	ExportedAt     time.Time `json:"exported_at"`
 }
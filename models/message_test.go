@@ -0,0 +1,61 @@
+package models
+
+import "testing"
+
+func TestConversationIDSymmetric(t *testing.T) {
+	tests := []struct {
+		a, b uint
+		want string
+	}{
+		{1, 2, "private:1:2"},
+		{2, 1, "private:1:2"},
+		{10, 3, "private:3:10"},
+		{7, 7, "private:7:7"},
+		{0, 5, "private:0:5"},
+	}
+	for _, tt := range tests {
+		if got := ConversationID(tt.a, tt.b); got != tt.want {
+			t.Errorf("ConversationID(%d, %d) = %q，期望 %q", tt.a, tt.b, got, tt.want)
+		}
+		if ConversationID(tt.a, tt.b) != ConversationID(tt.b, tt.a) {
+			t.Errorf("ConversationID(%d, %d) 与收发方向有关", tt.a, tt.b)
+		}
+	}
+}
+
+func TestConversationIDDistinctFromGroup(t *testing.T) {
+	seen := make(map[string]string)
+	add := func(id, desc string) {
+		if prev, ok := seen[id]; ok {
+			t.Fatalf("%s 与 %s 的会话ID相同: %q", desc, prev, id)
+		}
+		seen[id] = desc
+	}
+
+	for a := uint(1); a <= 5; a++ {
+		add(GroupConversationID(a), "群聊")
+		for b := a; b <= 5; b++ {
+			add(ConversationID(a, b), "私聊")
+		}
+	}
+	// 私聊 1:2 与 12 号群组、群组 1 与私聊等容易混淆的组合
+	add(GroupConversationID(12), "群聊12")
+	add(ConversationID(1, 12), "私聊1:12")
+	add(ConversationID(11, 2), "私聊2:11")
+}
+
+func TestMessageValidateSelfMessage(t *testing.T) {
+	tests := []struct {
+		msg  Message
+		want error
+	}{
+		{Message{SenderID: 1, ReceiverID: 2}, nil},
+		{Message{SenderID: 1, ReceiverID: 1}, ErrSelfMessage},
+		{Message{SenderID: 1, GroupID: 3}, nil},
+	}
+	for _, tt := range tests {
+		if got := tt.msg.Validate(); got != tt.want {
+			t.Errorf("Validate(%+v) = %v，期望 %v", tt.msg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+)
+
+// NotificationLevel 通知级别
+type NotificationLevel string
+
+const (
+	NotifyAll      NotificationLevel = "all"      // 所有消息都通知
+	NotifyMentions NotificationLevel = "mentions" // 仅@提及时通知
+	NotifyNone     NotificationLevel = "none"     // 不通知
+)
+
+// NotificationPrefs 用户通知偏好
+type NotificationPrefs struct {
+	UserID          uint              `json:"user_id" gorm:"primaryKey"`
+	Level           NotificationLevel `json:"level" gorm:"not null;default:'all'"`
+	QuietHoursStart string            `json:"quiet_hours_start"` // 免打扰开始时间，格式 HH:MM，为空表示不启用
+	QuietHoursEnd   string            `json:"quiet_hours_end"`   // 免打扰结束时间，格式 HH:MM
+	UpdatedAt       time.Time         `json:"updated_at"`
+}
+
+// NotificationPrefsRequest 更新通知偏好请求模型
+type NotificationPrefsRequest struct {
+	Level           NotificationLevel `json:"level" binding:"required,oneof=all mentions none"`
+	QuietHoursStart string            `json:"quiet_hours_start"`
+	QuietHoursEnd   string            `json:"quiet_hours_end"`
+}
+
+// DoNotDisturb 用户的全局勿扰设置，优先于通知偏好和免打扰时段，不影响应用内的消息投递
+// 设置了 start/end 时只在每天的该时段内生效，设置了 until 时到期后自动失效
+type DoNotDisturb struct {
+	Enabled bool       `json:"enabled" gorm:"not null;default:false"`
+	Start   string     `json:"start,omitempty" gorm:"size:5"` // 每日开始时间，格式 HH:MM，为空表示全天
+	End     string     `json:"end,omitempty" gorm:"size:5"`   // 每日结束时间，格式 HH:MM
+	Until   *time.Time `json:"until,omitempty"`               // 失效时间，为空表示一直有效
+}
+
+// DoNotDisturbRequest 更新全局勿扰请求模型
+type DoNotDisturbRequest struct {
+	Enabled bool       `json:"enabled"`
+	Start   string     `json:"start"`
+	End     string     `json:"end"`
+	Until   *time.Time `json:"until"`
+}
+
+// DoNotDisturbResponse 全局勿扰设置及当前是否生效
+type DoNotDisturbResponse struct {
+	DoNotDisturb
+	Active bool `json:"active"`
+}
+
+// EmailDigest 用户未读消息邮件摘要的发送位置，避免同一条消息重复发送
+type EmailDigest struct {
+	UserID        uint      `json:"user_id" gorm:"primaryKey"`
+	LastMessageID uint      `json:"last_message_id" gorm:"not null"` // 已处理到的最大消息ID
+	SentAt        time.Time `json:"sent_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// OutboxMessage 消息投递发件箱
+// 与消息在同一事务中写入，由后台中继发布到Kafka，保证保存成功的消息最终一定会被发布
+type OutboxMessage struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	MessageID uint       `json:"message_id" gorm:"index"`
+	Topic     string     `json:"topic" gorm:"size:255;not null"`
+	Key       string     `json:"key" gorm:"size:128"`
+	Payload   string     `json:"payload" gorm:"type:text;not null"` // 私聊消息在启用加密时保存密文，发布后清空
+	Nonce     string     `json:"-" gorm:"size:32"`                  // 负载加密随机数，为空表示明文存储
+	Attempts  int        `json:"attempts" gorm:"default:0"`
+	SentAt    *time.Time `json:"sent_at,omitempty" gorm:"index"` // 为空表示尚未发布
+	CreatedAt time.Time  `json:"created_at" gorm:"index"`
+}
+
+// TableName 发件箱表名
+func (OutboxMessage) TableName() string {
+	return "outbox"
+}
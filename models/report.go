@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+)
+
+// ReportStatus 举报处理状态
+type ReportStatus string
+
+const (
+	ReportPending  ReportStatus = "pending"  // 待处理
+	ReportResolved ReportStatus = "resolved" // 已处理
+)
+
+// ReportAction 举报处理动作
+type ReportAction string
+
+const (
+	ReportDismiss ReportAction = "dismiss" // 驳回，不做处罚
+	ReportWarn    ReportAction = "warn"    // 向被举报用户发送警告
+	ReportMute    ReportAction = "mute"    // 禁言一段时间
+	ReportBan     ReportAction = "ban"     // 封禁账号并注销其全部会话
+)
+
+// Report 用户举报（针对用户或其发送的某条消息）
+type Report struct {
+	ID           uint         `json:"id" gorm:"primaryKey"`
+	ReporterID   uint         `json:"reporter_id" gorm:"index"`
+	TargetUserID uint         `json:"target_user_id" gorm:"index"`
+	MessageID    uint         `json:"message_id,omitempty"` // 为0表示举报用户本身
+	Reason       string       `json:"reason" gorm:"size:500"`
+	Status       ReportStatus `json:"status" gorm:"size:16;index;default:pending"`
+	Action       ReportAction `json:"action,omitempty" gorm:"size:16"`
+	Note         string       `json:"note,omitempty" gorm:"size:500"` // 处理备注，警告时会发送给被举报用户
+	ResolvedBy   uint         `json:"resolved_by,omitempty"`
+	ResolvedAt   *time.Time   `json:"resolved_at,omitempty"`
+	CreatedAt    time.Time    `json:"created_at" gorm:"index"`
+}
+
+// ReportRequest 举报请求模型，指定 message_id 时被举报用户为消息发送者
+type ReportRequest struct {
+	TargetUserID uint   `json:"target_user_id" binding:"required_without=MessageID"`
+	MessageID    uint   `json:"message_id"`
+	Reason       string `json:"reason" binding:"required,max=500"`
+}
+
+// ResolveReportRequest 处理举报请求模型
+type ResolveReportRequest struct {
+	Action      ReportAction `json:"action" binding:"required,oneof=dismiss warn mute ban"`
+	MuteMinutes int          `json:"mute_minutes" binding:"omitempty,min=1,max=525600"` // 禁言时长，默认60分钟
+	Note        string       `json:"note" binding:"max=500"`
+}
+
+// ModerationWarningEvent 管理警告事件，推送给被举报用户
+type ModerationWarningEvent struct {
+	ReportID  uint   `json:"report_id"`
+	MessageID uint   `json:"message_id,omitempty"`
+	Note      string `json:"note"`
+}
+
+// DisconnectRequest 管理员强制断开用户连接请求模型，请求体可省略
+type DisconnectRequest struct {
+	Reason     string `json:"reason" binding:"max=100"`
+	BanSeconds int    `json:"ban_seconds" binding:"omitempty,min=1,max=604800"` // 断开后临时禁止重连的时长
+}
+
+// ReplayRequest 从Kafka重放会话消息的请求模型
+// mode 为 deliver 时重新投递给本节点上的订阅者，为 export 时只返回消息内容
+type ReplayRequest struct {
+	Type     string    `json:"type" binding:"required,oneof=private group"`
+	TargetID uint      `json:"target_id" binding:"required"` // 私聊为接收者用户ID，群聊为群组ID
+	From     time.Time `json:"from" binding:"required"`
+	To       time.Time `json:"to" binding:"required"`
+	Mode     string    `json:"mode" binding:"omitempty,oneof=deliver export"`
+	Confirm  bool      `json:"confirm"` // 必须为true，防止误操作
+}
+
+// MaintenanceRequest 管理员切换维护模式请求模型
+type MaintenanceRequest struct {
+	Enabled    bool   `json:"enabled"`
+	Reason     string `json:"reason" binding:"max=200"`
+	RetryAfter int    `json:"retry_after" binding:"omitempty,min=1,max=86400"` // 建议客户端重试的间隔秒数，默认300
+}
+
+// MaintenanceStatus 当前维护模式状态
+type MaintenanceStatus struct {
+	Enabled    bool      `json:"enabled"`
+	Reason     string    `json:"reason,omitempty"`
+	RetryAfter int       `json:"retry_after,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+}
+
+// KafkaTopicRequest 管理员暂停或恢复主题消费请求模型
+type KafkaTopicRequest struct {
+	Topic string `json:"topic" binding:"required"` // 完整主题名，如 chatroom-group-1
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Session 用户登录会话，ID与JWT令牌的jti一致
+type Session struct {
+	ID           string     `json:"id" gorm:"primaryKey;size:64"`
+	UserID       uint       `json:"user_id" gorm:"index;not null"`
+	Device       string     `json:"device" gorm:"size:255"` // 登录时的User-Agent
+	IP           string     `json:"ip" gorm:"size:64"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastActiveAt time.Time  `json:"last_active_at"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"index"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// SessionResponse 会话列表响应
+type SessionResponse struct {
+	ID           string    `json:"id"`
+	Device       string    `json:"device"`
+	IP           string    `json:"ip"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActiveAt time.Time `json:"last_active_at"`
+	Current      bool      `json:"current"` // 是否为发起请求的会话
+}
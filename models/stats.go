@@ -0,0 +1,14 @@
+package models
+
+// UserStats 用户发送消息统计
+type UserStats struct {
+	SentToday           int64 `json:"sent_today"`
+	SentThisWeek        int64 `json:"sent_this_week"`       // 最近7天（含今天）
+	ActiveConversations int64 `json:"active_conversations"` // 最近7天发送过消息的会话数
+}
+
+// TopSender 发送消息最多的用户
+type TopSender struct {
+	User  UserResponse `json:"user"`
+	Count int64        `json:"count"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -13,8 +14,32 @@ type User struct {
 	Avatar    string    `json:"avatar"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"` // 最后一次断开WebSocket连接的时间
+
+	// 管理处罚状态
+	MutedUntil *time.Time `json:"muted_until,omitempty"` // 禁言截止时间
+	BannedAt   *time.Time `json:"banned_at,omitempty"`   // 封禁时间，为空表示未封禁
+
+	// 隐私设置
+	MessagePrivacy MessagePrivacy `json:"message_privacy" gorm:"size:16;not null;default:'everyone'"` // 谁可以向我发起私聊
+
+	// 全局勿扰，开启时不发送任何推送和邮件通知，单独缓存
+	DoNotDisturb DoNotDisturb `json:"-" gorm:"embedded;embeddedPrefix:dnd_"`
+
+	// 客户端同步的偏好设置（主题、语言等），内容由客户端定义，单独缓存
+	Preferences json.RawMessage `json:"-" gorm:"type:json;serializer:json"`
 }
 
+// MessagePrivacy 私聊隐私策略
+type MessagePrivacy string
+
+const (
+	PrivacyEveryone MessagePrivacy = "everyone" // 所有人都可以发起私聊
+	PrivacyContacts MessagePrivacy = "contacts" // 仅联系人（同群成员，或我私聊过的用户）
+	PrivacyNobody   MessagePrivacy = "nobody"   // 不接受新的私聊，只能回复我私聊过的用户
+)
+
 // UserResponse 用户响应模型（不包含敏感信息）
 type UserResponse struct {
 	ID       uint   `json:"id"`
@@ -22,4 +47,9 @@ type UserResponse struct {
 	Email    string `json:"email"`
 	Avatar   string `json:"avatar"`
 	Online   bool   `json:"online"`
-}
\ No newline at end of file
+}
+
+// MessagePrivacyRequest 更新私聊隐私设置请求模型
+type MessagePrivacyRequest struct {
+	MessagePrivacy MessagePrivacy `json:"message_privacy" binding:"required,oneof=everyone contacts nobody"`
+}
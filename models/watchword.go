@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// GroupWatchword 群组关键词，消息命中时提醒群管理员（不拦截消息）
+type GroupWatchword struct {
+	GroupID   uint      `json:"group_id" gorm:"primaryKey"`
+	Word      string    `json:"word" gorm:"primaryKey;size:64"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// KeywordAlert 关键词提醒记录
+type KeywordAlert struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	GroupID   uint      `json:"group_id" gorm:"index"`
+	MessageID uint      `json:"message_id"`
+	SenderID  uint      `json:"sender_id"`
+	Words     string    `json:"words" gorm:"size:255"` // 命中的关键词，逗号分隔
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// WatchwordsRequest 设置群组关键词请求模型（整体替换）
+type WatchwordsRequest struct {
+	Words []string `json:"words" binding:"max=100,dive,min=1,max=64"`
+}
+
+// KeywordAlertEvent 关键词提醒事件，推送给群管理员并发送到webhook
+type KeywordAlertEvent struct {
+	AlertID   uint      `json:"alert_id"`
+	GroupID   uint      `json:"group_id"`
+	MessageID uint      `json:"message_id"`
+	SenderID  uint      `json:"sender_id"`
+	Words     []string  `json:"words"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
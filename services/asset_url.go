@@ -0,0 +1,17 @@
+package services
+
+import (
+	"strings"
+
+	"chatroom/config"
+)
+
+// AssetURL 将存储的资源路径转换为对外地址
+// 配置了 ASSET_CDN_BASE_URL 时相对路径拼接到CDN地址下，完整URL和空值原样返回
+func AssetURL(path string) string {
+	base := config.AppConfig.AssetCDNBaseURL
+	if base == "" || path == "" || strings.HasPrefix(path, "//") || strings.Contains(path, "://") {
+		return path
+	}
+	return base + "/" + strings.TrimLeft(path, "/")
+}
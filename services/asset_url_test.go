@@ -0,0 +1,75 @@
+package services
+
+import (
+	"testing"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// withAssetCDN 在测试期间设置资源CDN地址
+func withAssetCDN(t *testing.T, base string) {
+	t.Helper()
+	old := config.AppConfig.AssetCDNBaseURL
+	config.AppConfig.AssetCDNBaseURL = base
+	t.Cleanup(func() { config.AppConfig.AssetCDNBaseURL = old })
+}
+
+func TestAssetURL(t *testing.T) {
+	withAssetCDN(t, "https://cdn.example.com/assets")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"avatars/1.png", "https://cdn.example.com/assets/avatars/1.png"},
+		{"/avatars/1.png", "https://cdn.example.com/assets/avatars/1.png"},
+		{"https://other.example.com/a.png", "https://other.example.com/a.png"},
+		{"//other.example.com/a.png", "//other.example.com/a.png"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := AssetURL(tt.path); got != tt.want {
+			t.Errorf("AssetURL(%q) = %q，期望 %q", tt.path, got, tt.want)
+		}
+	}
+
+	withAssetCDN(t, "")
+	if got := AssetURL("avatars/1.png"); got != "avatars/1.png" {
+		t.Fatalf("未配置CDN时 = %q，期望原样返回", got)
+	}
+}
+
+func TestResponsesRewriteAssetURLs(t *testing.T) {
+	withAssetCDN(t, "https://cdn.example.com")
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	group := env.createGroup(t, "g", alice)
+	env.db.Model(&models.User{}).Where("id = ?", alice.ID).Update("avatar", "avatars/alice.png")
+	env.db.Model(&models.Group{}).Where("id = ?", group.ID).Update("avatar", "groups/g.png")
+
+	user, err := env.users.GetUserResponse(alice.ID)
+	if err != nil {
+		t.Fatalf("获取用户失败: %v", err)
+	}
+	if want := "https://cdn.example.com/avatars/alice.png"; user.Avatar != want {
+		t.Fatalf("用户头像 = %q，期望 %q", user.Avatar, want)
+	}
+	response, err := env.groups.GetGroupResponse(group.ID, true)
+	if err != nil {
+		t.Fatalf("获取群组失败: %v", err)
+	}
+	if want := "https://cdn.example.com/groups/g.png"; response.Avatar != want {
+		t.Fatalf("群组头像 = %q，期望 %q", response.Avatar, want)
+	}
+	if len(response.Members) != 1 || response.Members[0].Avatar != user.Avatar {
+		t.Fatalf("成员头像 = %+v，期望 %q", response.Members, user.Avatar)
+	}
+
+	// 数据库中仍保存相对路径
+	var stored models.User
+	env.db.First(&stored, alice.ID)
+	if stored.Avatar != "avatars/alice.png" {
+		t.Fatalf("存储的头像 = %q，期望保持相对路径", stored.Avatar)
+	}
+}
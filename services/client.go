@@ -3,19 +3,41 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 
+	"chatroom/config"
 	"chatroom/models"
 )
 
+const (
+	// writeWait 写操作超时时间
+	writeWait = 10 * time.Second
+
+	// pongWait 等待pong的超时时间，超时后读协程退出并清除在线状态
+	pongWait = 60 * time.Second
+
+	// pingPeriod 发送ping的间隔，必须小于pongWait
+	pingPeriod = 30 * time.Second
+
+	// slowWriteThreshold 单次写入超过该时间即视为慢连接，写入恢复正常后解除
+	slowWriteThreshold = 2 * time.Second
+
+	// cleanupInterval 兜底清理过期连接的间隔
+	cleanupInterval = 5 * time.Minute
+)
+
 // Upgrader WebSocket升级器
 var Upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    wsSubprotocols(),
 	CheckOrigin: func(r *http.Request) bool {
 		return true // 允许所有跨域请求
 	},
@@ -23,55 +45,204 @@ var Upgrader = websocket.Upgrader{
 
 // Client 表示一个WebSocket客户端
 type Client struct {
-	ID       uint
-	Username string
-	Conn     *websocket.Conn
-	Send     chan []byte
+	ID        uint
+	Username  string
+	SessionID string // 建立连接所用令牌的会话ID
+	Device    string // 连接时声明的发送设备，写入该连接发送的消息
+	Conn      WSConn
+	Codec     WSCodec // 握手时协商的消息编码
+	Send      chan []byte
+
+	slow bool // 当前是否为慢连接，仅由写协程读写
+
+	groups map[uint]struct{} // 已订阅的群组频道，受WebSocketManager.mu保护
+
+	activeConversation string // 客户端当前打开的会话ID，为空表示没有，受WebSocketManager.mu保护
+
+	// sendMu 保护发送通道的关闭：投递方持读锁发送，注销时持写锁关闭
+	// 扇出在锁外并发投递，客户端可能在投递途中被注销
+	sendMu sync.RWMutex
+	closed bool
+
+	// 发送通道关闭后写协程发出的关闭码和原因，受sendMu保护，零值表示正常关闭
+	closeCode   int
+	closeReason string
+}
+
+// NewClient 创建一个WebSocket客户端，发送缓冲区大小由 WS_SEND_BUFFER 配置
+func NewClient(id uint, username string, conn WSConn) *Client {
+	return &Client{
+		ID:       id,
+		Username: username,
+		Conn:     conn,
+		Codec:    jsonCodec{},
+		Send:     make(chan []byte, config.AppConfig.WSSendBufferSize),
+		groups:   make(map[uint]struct{}),
+	}
+}
+
+// trySend 非阻塞地放入发送队列，发送通道已关闭或缓冲已满时返回false
+func (c *Client) trySend(message []byte) bool {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendWithin 放入发送队列，缓冲已满时最多等待 wait，期间写协程腾出空间即可送达
+// 等待期间持有读锁，注销关闭通道最多被推迟 wait
+func (c *Client) sendWithin(message []byte, wait time.Duration) bool {
+	if wait <= 0 {
+		return c.trySend(message)
+	}
+
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Send <- message:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case c.Send <- message:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// closeSendWith 关闭发送通道并记录关闭码，写协程发完缓冲中的消息后在关闭帧中告知客户端
+// 已关闭时不覆盖先前记录的关闭码
+func (c *Client) closeSendWith(code int, reason string) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		c.closeCode = code
+		c.closeReason = reason
+		close(c.Send)
+	}
+}
+
+// closeStatus 返回发送通道关闭时记录的关闭码和原因
+func (c *Client) closeStatus() (int, string) {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+
+	return c.closeCode, c.closeReason
 }
 
 // WritePump 将消息从通道发送到WebSocket连接
-func (c *Client) WritePump() {
-	ticker := time.NewTicker(30 * time.Second)
+func (c *Client) WritePump(wsManager *WebSocketManager) {
+	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
+		wsManager.setClientSlow(c, false)
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				// 通道已关闭
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// 通道已关闭，按注销时记录的关闭码告知客户端是否应重连
+				code, reason := c.closeStatus()
+				if code == websocket.CloseNormalClosure {
+					c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""))
+				} else {
+					closeWithError(c.Conn, code, reason)
+				}
 				return
 			}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// 添加队列中的消息
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.Send)
-			}
-
-			if err := w.Close(); err != nil {
+			start := time.Now()
+			if err := c.writeMessages(message); err != nil {
+				c.handleWriteError(wsManager, err)
 				return
 			}
+			wsManager.setClientSlow(c, time.Since(start) > slowWriteThreshold)
 		case <-ticker.C:
-			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.handleWriteError(wsManager, err)
 				return
 			}
 		}
 	}
 }
 
+// writeMessages 按协商的编码写出消息及队列中已积压的消息
+// 可合并的编码以换行分隔写入同一帧，否则每条消息单独一帧；无法编码的消息丢弃
+func (c *Client) writeMessages(message []byte) error {
+	n := len(c.Send)
+	if !c.Codec.Batchable() {
+		for i := 0; ; i++ {
+			if err := c.writeFrame(message); err != nil {
+				return err
+			}
+			if i >= n {
+				return nil
+			}
+			message = <-c.Send
+		}
+	}
+
+	w, err := c.Conn.NextWriter(c.Codec.FrameType())
+	if err != nil {
+		return err
+	}
+	frame, _ := c.Codec.Encode(message)
+	w.Write(frame)
+
+	// 添加队列中的消息
+	for i := 0; i < n; i++ {
+		frame, _ := c.Codec.Encode(<-c.Send)
+		w.Write([]byte{'\n'})
+		w.Write(frame)
+	}
+	return w.Close()
+}
+
+// writeFrame 编码单条消息并写为一帧
+func (c *Client) writeFrame(message []byte) error {
+	frame, err := c.Codec.Encode(message)
+	if err != nil {
+		log.Printf("编码消息失败: %s (ID: %d): %v", c.Username, c.ID, err)
+		return nil
+	}
+	return c.Conn.WriteMessage(c.Codec.FrameType(), frame)
+}
+
+// handleWriteError 处理写入失败，写超时计入慢客户端断开并记录原因
+func (c *Client) handleWriteError(wsManager *WebSocketManager, err error) {
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return
+	}
+
+	wsManager.recordWriteTimeout()
+	log.Printf("客户端写入超时，断开连接: %s (ID: %d), 发送缓冲积压: %d", c.Username, c.ID, len(c.Send))
+	// 写超时后连接状态已损坏，关闭帧多半无法送达，仍尽力告知原因
+	closeWithError(c.Conn, CloseSlowClient, "写入超时")
+}
+
 // ReadPump 从WebSocket连接读取消息
 func (c *Client) ReadPump(wsManager *WebSocketManager, messageService *MessageService) {
 	defer func() {
@@ -80,20 +251,25 @@ func (c *Client) ReadPump(wsManager *WebSocketManager, messageService *MessageSe
 	}()
 
 	c.Conn.SetReadLimit(512 * 1024) // 512KB
-	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
 
 	for {
-		_, message, err := c.Conn.ReadMessage()
+		frameType, data, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("错误: %v", err)
 			}
 			break
 		}
+		message, err := c.Codec.Decode(frameType, data)
+		if err != nil {
+			log.Printf("解码消息失败: %v", err)
+			continue
+		}
 
 		// 处理接收到的消息
 		go c.handleReceivedMessage(message, wsManager, messageService)
@@ -102,8 +278,8 @@ func (c *Client) ReadPump(wsManager *WebSocketManager, messageService *MessageSe
 
 // handleReceivedMessage 处理接收到的消息
 func (c *Client) handleReceivedMessage(message []byte, wsManager *WebSocketManager, messageService *MessageService) {
-	var wsMsg WebSocketMessage
-	if err := json.Unmarshal(message, &wsMsg); err != nil {
+	wsMsg, err := parseWSMessage(message)
+	if err != nil {
 		log.Printf("解析消息失败: %v", err)
 		return
 	}
@@ -132,7 +308,27 @@ func (c *Client) handleReceivedMessage(message []byte, wsManager *WebSocketManag
 		}
 
 		// 处理typing通知
-		c.handleTypingNotification(ctx, typingData.ReceiverID, typingData.GroupID, wsManager)
+		c.handleTypingNotification(ctx, typingData.ReceiverID, typingData.GroupID, wsManager, messageService)
+
+	case "unread_sync":
+		// 客户端主动请求同步未读数
+		wsManager.SendUnreadSync(c, messageService)
+
+	case "active_conversation":
+		var req ActiveConversationRequest
+		if err := json.Unmarshal(wsMsg.Content, &req); err != nil {
+			log.Printf("解析当前会话失败: %v", err)
+			return
+		}
+		wsManager.SetActiveConversation(c, req.conversationID(c.ID))
+
+	case "subscribe_groups", "unsubscribe_groups":
+		var req GroupSubscriptionRequest
+		if err := json.Unmarshal(wsMsg.Content, &req); err != nil {
+			log.Printf("解析群组订阅请求失败: %v", err)
+			return
+		}
+		c.handleGroupSubscription(wsMsg.Type == "subscribe_groups", req.GroupIDs, wsManager, messageService)
 
 	default:
 		log.Printf("未知消息类型: %s", wsMsg.Type)
@@ -141,6 +337,13 @@ func (c *Client) handleReceivedMessage(message []byte, wsManager *WebSocketManag
 
 // handleChatMessage 处理聊天消息
 func (c *Client) handleChatMessage(ctx context.Context, msgReq models.MessageRequest, wsManager *WebSocketManager, messageService *MessageService) {
+	// 解析接收者
+	if err := messageService.ResolveReceiver(&msgReq); err != nil {
+		log.Printf("解析消息接收者失败: %v", err)
+		c.SendError(http.StatusBadRequest, err.Error())
+		return
+	}
+
 	msg := &models.Message{
 		Content:    msgReq.Content,
 		Type:       msgReq.Type,
@@ -148,17 +351,43 @@ func (c *Client) handleChatMessage(ctx context.Context, msgReq models.MessageReq
 		ReceiverID: msgReq.ReceiverID,
 		GroupID:    msgReq.GroupID,
 		CreatedAt:  time.Now(),
+		SentFrom:   c.Device,
+	}
+	if err := msg.Validate(); err != nil {
+		log.Printf("消息校验失败: %v", err)
+		c.SendError(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := ValidateContent(msg.Content); err != nil {
+		c.SendError(http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg.Type == models.SystemMessage {
+		c.SendError(http.StatusBadRequest, ErrSystemMessageSend.Error())
+		return
 	}
 
 	go func() {
 		if err := messageService.ProcessMessage(msg); err != nil {
 			log.Printf("处理消息失败: %v", err)
+			code := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, ErrMessagingNotAllowed),
+				errors.Is(err, ErrNotConversationUser),
+				errors.Is(err, ErrPostNotAllowed):
+				code = http.StatusForbidden
+			case errors.Is(err, ErrGroupNotFound):
+				code = http.StatusNotFound
+			case errors.Is(err, ErrSlowMode):
+				code = http.StatusTooManyRequests
+			}
+			c.SendError(code, err.Error())
 		}
 	}()
 }
 
 // handleTypingNotification 处理typing通知
-func (c *Client) handleTypingNotification(ctx context.Context, receiverID, groupID uint, wsManager *WebSocketManager) {
+func (c *Client) handleTypingNotification(ctx context.Context, receiverID, groupID uint, wsManager *WebSocketManager, messageService *MessageService) {
 	typingData := struct {
 		SenderID   uint   `json:"sender_id"`
 		Username   string `json:"username"`
@@ -173,11 +402,18 @@ func (c *Client) handleTypingNotification(ctx context.Context, receiverID, group
 
 	typingJSON, _ := json.Marshal(typingData)
 
+	// 记录输入状态，供轮询客户端查询
+	if groupID > 0 {
+		messageService.SetTyping(c.ID, groupID, true)
+	} else {
+		messageService.SetTyping(c.ID, receiverID, false)
+	}
+
 	if groupID > 0 {
 		// 发布到Kafka群组主题
-		wsManager.PublishMessage(ctx, "typing", typingJSON, 0, groupID)
+		wsManager.PublishMessage(ctx, "typing", typingJSON, c.ID, 0, groupID)
 	} else {
 		// 发布到Kafka私聊主题
-		wsManager.PublishMessage(ctx, "typing", typingJSON, receiverID, 0)
+		wsManager.PublishMessage(ctx, "typing", typingJSON, c.ID, receiverID, 0)
 	}
 }
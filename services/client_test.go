@@ -0,0 +1,28 @@
+package services
+
+import (
+	"testing"
+
+	"chatroom/config"
+)
+
+func TestNewClientSendBuffer(t *testing.T) {
+	original := config.AppConfig.WSSendBufferSize
+	t.Cleanup(func() { config.AppConfig.WSSendBufferSize = original })
+	config.AppConfig.WSSendBufferSize = 4
+
+	client := NewClient(1, "alice", newFakeConn())
+	if cap(client.Send) != 4 {
+		t.Fatalf("发送缓冲区大小 = %d，期望 4", cap(client.Send))
+	}
+
+	// 缓冲写满后不再接收消息
+	for i := 0; i < 4; i++ {
+		if !client.trySend([]byte("x")) {
+			t.Fatalf("第 %d 条消息放入失败", i+1)
+		}
+	}
+	if client.trySend([]byte("x")) {
+		t.Fatal("缓冲已满时不应放入消息")
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm/clause"
+
+	"chatroom/models"
+)
+
+const (
+	// DefaultConversationSearchLimit 会话搜索每类结果的默认条数，MaxConversationSearchLimit 为上限
+	DefaultConversationSearchLimit = 10
+	MaxConversationSearchLimit     = 20
+)
+
+// likeEscaper 转义LIKE中的通配符，搜索词中的 % 和 _ 按字面匹配
+// 转义符用 ! 而非反斜杠，在 MySQL 和 SQLite 中行为一致，LIKE 需配合 likeEscape 使用
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// likeEscape 与 likeEscaper 配套的 ESCAPE 子句
+const likeEscape = " ESCAPE '!'"
+
+// likePattern 构建包含匹配的LIKE模式
+func likePattern(query string) string {
+	return "%" + likeEscaper.Replace(query) + "%"
+}
+
+// rankByName 按名称匹配程度排序：完全匹配、前缀匹配、其余包含匹配，同级按名称长度
+func rankByName(column, query string) clause.OrderBy {
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL:                "CASE WHEN " + column + " = ? THEN 0 WHEN " + column + " LIKE ?" + likeEscape + " THEN 1 ELSE 2 END, CHAR_LENGTH(" + column + ")",
+		Vars:               []interface{}{query, likeEscaper.Replace(query) + "%"},
+		WithoutParentheses: true,
+	}}
+}
+
+// SearchConversations 按名称同时搜索可私聊的用户和可进入的群组，用于发起新会话
+// 用户结果排除自己、已封禁的账号以及隐私设置不允许向其发起私聊的用户；
+// 群组结果包括自己所在的群组和公开群组，每类最多返回 limit 条
+func (s *GroupService) SearchConversations(userID uint, query string, limit int) (*models.ConversationSearchResult, error) {
+	if limit <= 0 {
+		limit = DefaultConversationSearchLimit
+	}
+	if limit > MaxConversationSearchLimit {
+		limit = MaxConversationSearchLimit
+	}
+
+	users, err := s.searchChatUsers(userID, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.searchChatGroups(userID, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ConversationSearchResult{Users: users, Groups: groups}, nil
+}
+
+// searchChatUsers 搜索可以发起私聊的用户，多取一些候选以抵消隐私过滤掉的用户
+func (s *GroupService) searchChatUsers(userID uint, query string, limit int) ([]models.UserResponse, error) {
+	var candidates []models.User
+	if err := s.DB.Select("id").
+		Where("username LIKE ?"+likeEscape+" AND id <> ? AND banned_at IS NULL", likePattern(query), userID).
+		Order(rankByName("username", query)).
+		Limit(limit * 2).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(candidates))
+	for _, candidate := range candidates {
+		if len(ids) >= limit {
+			break
+		}
+		if err := s.userService.CheckCanMessage(userID, candidate.ID); err != nil {
+			if errors.Is(err, ErrMessagingNotAllowed) || errors.Is(err, ErrUserNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		ids = append(ids, candidate.ID)
+	}
+
+	responses, err := s.userService.userResponses(ids)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]models.UserResponse, 0, len(ids))
+	for _, id := range ids {
+		if user, ok := responses[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// searchChatGroups 搜索自己所在的群组和公开群组
+func (s *GroupService) searchChatGroups(userID uint, query string, limit int) ([]models.GroupSearchResult, error) {
+	memberGroups := s.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID)
+
+	var groups []models.Group
+	if err := s.DB.Select("id", "name", "avatar", "is_public", "join_policy").
+		Where("name LIKE ?"+likeEscape, likePattern(query)).
+		Where(s.DB.Where("is_public = ?", true).Or("id IN (?)", memberGroups)).
+		Order(rankByName("name", query)).
+		Limit(limit).
+		Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	groupIDs := make([]uint, 0, len(groups))
+	for _, group := range groups {
+		groupIDs = append(groupIDs, group.ID)
+	}
+	var joined []uint
+	if len(groupIDs) > 0 {
+		if err := s.DB.Model(&models.GroupMember{}).
+			Where("user_id = ? AND group_id IN ?", userID, groupIDs).
+			Pluck("group_id", &joined).Error; err != nil {
+			return nil, err
+		}
+	}
+	isMember := make(map[uint]bool, len(joined))
+	for _, groupID := range joined {
+		isMember[groupID] = true
+	}
+
+	results := make([]models.GroupSearchResult, 0, len(groups))
+	for _, group := range groups {
+		results = append(results, models.GroupSearchResult{
+			ID:         group.ID,
+			Name:       group.Name,
+			Avatar:     AssetURL(group.Avatar),
+			IsPublic:   group.IsPublic,
+			JoinPolicy: group.JoinPolicy,
+			IsMember:   isMember[group.ID],
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"testing"
+
+	"chatroom/models"
+)
+
+func TestSearchConversations(t *testing.T) {
+	env := newTestEnv(t)
+	me := env.createUser(t, "bobwatcher")
+	bobby := env.createUser(t, "bobby")
+	bob := env.createUser(t, "bob")
+	banned := env.createUser(t, "bobbanned")
+	private := env.createUser(t, "bobprivate")
+	env.createUser(t, "rob")
+	if err := env.users.BanUser(banned.ID); err != nil {
+		t.Fatalf("封禁用户失败: %v", err)
+	}
+	if err := env.users.SetMessagePrivacy(private.ID, models.PrivacyNobody); err != nil {
+		t.Fatalf("设置隐私失败: %v", err)
+	}
+
+	fans := env.createGroup(t, "bob fans", bobby)
+	secret := env.createGroup(t, "bob secret", bobby, me)
+	hidden := env.createGroup(t, "bob hidden", bobby)
+	env.createGroup(t, "other", bobby)
+	env.db.Model(&models.Group{}).Where("id IN ?", []uint{secret.ID, hidden.ID}).Update("is_public", false)
+
+	result, err := env.groups.SearchConversations(me.ID, "bob", 0)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+
+	// 用户：完全匹配在前，排除自己、已封禁和不允许私聊的用户
+	var users []uint
+	for _, user := range result.Users {
+		users = append(users, user.ID)
+	}
+	if len(users) != 2 || users[0] != bob.ID || users[1] != bobby.ID {
+		t.Fatalf("用户结果 = %v，期望 [%d %d]", users, bob.ID, bobby.ID)
+	}
+
+	// 群组：公开群组和自己所在的私有群组，标记是否已加入
+	got := make(map[uint]models.GroupSearchResult)
+	for _, group := range result.Groups {
+		got[group.ID] = group
+	}
+	if len(got) != 2 || !got[secret.ID].IsMember || got[fans.ID].IsMember || !got[fans.ID].IsPublic {
+		t.Fatalf("群组结果 = %+v，期望已加入的 %d 和可加入的 %d", result.Groups, secret.ID, fans.ID)
+	}
+
+	// 每类结果按 limit 截断
+	result, err = env.groups.SearchConversations(me.ID, "bob", 1)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if len(result.Users) != 1 || result.Users[0].ID != bob.ID || len(result.Groups) != 1 {
+		t.Fatalf("limit=1 时结果 = %+v", result)
+	}
+}
@@ -0,0 +1,33 @@
+package services
+
+// inClauseBatchSize IN 查询每批的参数个数
+//
+// main 中开启了 PrepareStmt，GORM 按 SQL 文本缓存预编译语句，而 IN ? 会展开成与切片长度相同数量的占位符，
+// 每种长度都会产生一条新的预编译语句且不会被淘汰。变长的 IN 查询统一经过 chunkIDs，
+// 按固定批大小分块并补齐最后一块，使每种查询只对应一条预编译语句。
+const inClauseBatchSize = 100
+
+// chunkIDs 去重后将ID按 inClauseBatchSize 分块，最后一块用重复的ID补齐到固定长度
+// IN 条件对重复值没有影响；去重保证同一个ID只出现在一个分块中，分块结果可以直接合并
+func chunkIDs(ids []uint) [][]uint {
+	seen := make(map[uint]struct{}, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, id)
+	}
+
+	var chunks [][]uint
+	for start := 0; start < len(unique); start += inClauseBatchSize {
+		chunk := make([]uint, inClauseBatchSize)
+		n := copy(chunk, unique[start:])
+		for i := n; i < inClauseBatchSize; i++ {
+			chunk[i] = chunk[n-1]
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
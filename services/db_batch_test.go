@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestChunkIDs(t *testing.T) {
+	if chunks := chunkIDs(nil); len(chunks) != 0 {
+		t.Fatalf("空切片分块 = %v", chunks)
+	}
+
+	ids := make([]uint, 0, 250)
+	for i := 1; i <= 250; i++ {
+		ids = append(ids, uint(i))
+	}
+	// 重复的ID去重后只出现在一个分块中
+	ids = append(ids, 1, 2, 3)
+
+	chunks := chunkIDs(ids)
+	if len(chunks) != 3 {
+		t.Fatalf("分块数 = %d，期望 3", len(chunks))
+	}
+	seen := make(map[uint]int)
+	for i, chunk := range chunks {
+		if len(chunk) != inClauseBatchSize {
+			t.Fatalf("第 %d 块长度 = %d，期望补齐到 %d", i, len(chunk), inClauseBatchSize)
+		}
+		for _, id := range chunk {
+			seen[id] = i
+		}
+	}
+	if len(seen) != 250 {
+		t.Fatalf("分块覆盖的ID数 = %d，期望 250", len(seen))
+	}
+	for _, id := range []uint{1, 2, 3} {
+		if seen[id] != 0 {
+			t.Fatalf("ID %d 出现在第 %d 块，期望只在第 0 块", id, seen[id])
+		}
+	}
+}
+
+func TestInQueriesBoundPreparedStatements(t *testing.T) {
+	env := newTestEnv(t)
+	prepared := env.db.Session(&gorm.Session{PrepareStmt: true})
+	users := NewUserService(prepared, env.rdb)
+
+	ids := make([]uint, 0, 250)
+	for i := 0; i < 250; i++ {
+		ids = append(ids, env.createUser(t, fmt.Sprintf("user%d", i)).ID)
+	}
+
+	// 不同长度的批量查询共用同一条预编译语句
+	for n := 1; n <= len(ids); n += 7 {
+		responses, err := users.userResponses(ids[:n])
+		if err != nil {
+			t.Fatalf("批量获取用户失败: %v", err)
+		}
+		if len(responses) != n {
+			t.Fatalf("获取 %d 个用户，返回 %d 个", n, len(responses))
+		}
+	}
+
+	stmtDB, ok := prepared.Statement.ConnPool.(*gorm.PreparedStmtDB)
+	if !ok {
+		t.Fatalf("连接池类型 = %T，期望 *gorm.PreparedStmtDB", prepared.Statement.ConnPool)
+	}
+	inStatements := 0
+	for _, sql := range stmtDB.Stmts.Keys() {
+		if strings.Contains(sql, " IN ") {
+			inStatements++
+		}
+	}
+	if inStatements != 1 {
+		t.Fatalf("IN 查询的预编译语句数 = %d，期望 1", inStatements)
+	}
+}
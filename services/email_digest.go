@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+const (
+	// digestLookback 只给最近这段时间内在线过的用户发送摘要，避免打扰长期不用的账号
+	digestLookback = 7 * 24 * time.Hour
+
+	// digestUserBatch 每批检查的离线用户数
+	digestUserBatch = 100
+
+	// digestScanLimit 每轮为单个用户读取的最大消息数，更多的消息在下一轮处理
+	digestScanLimit = 500
+
+	// digestMaxLines 摘要中列出的最大消息条数，以及每条消息内容的最大字符数
+	digestMaxLines   = 50
+	digestContentMax = 100
+
+	// digestPrivateName 摘要中私聊消息的会话名
+	digestPrivateName = "私聊"
+)
+
+// EmailDigestService 为离线用户发送未读消息邮件摘要
+type EmailDigestService struct {
+	db            *gorm.DB
+	messages      *MessageService
+	notifications *NotificationService
+	mailer        Mailer
+}
+
+// NewEmailDigestService 创建邮件摘要服务
+func NewEmailDigestService(db *gorm.DB, messageService *MessageService, notificationService *NotificationService, mailer Mailer) *EmailDigestService {
+	return &EmailDigestService{
+		db:            db,
+		messages:      messageService,
+		notifications: notificationService,
+		mailer:        mailer,
+	}
+}
+
+// Run 按 EMAIL_DIGEST_INTERVAL_MINUTES 间隔检查离线用户并发送摘要，ctx取消后退出
+func (s *EmailDigestService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(config.AppConfig.EmailDigestIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sendDigests(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendDigests 分批遍历离线超过阈值的用户，逐个发送摘要
+func (s *EmailDigestService) sendDigests(ctx context.Context) {
+	now := time.Now()
+	offlineBefore := now.Add(-time.Duration(config.AppConfig.EmailDigestOfflineMinutes) * time.Minute)
+	var lastID uint
+
+	for {
+		var users []models.User
+		if err := s.db.Select("id", "username", "email", "last_seen_at").
+			Where("id > ? AND email <> '' AND banned_at IS NULL", lastID).
+			Where("last_seen_at < ? AND last_seen_at > ?", offlineBefore, now.Add(-digestLookback)).
+			Order("id").
+			Limit(digestUserBatch).
+			Find(&users).Error; err != nil {
+			log.Printf("读取离线用户失败: %v", err)
+			return
+		}
+
+		for _, user := range users {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := s.digestUser(user, now); err != nil {
+				log.Printf("发送邮件摘要失败: 用户%d: %v", user.ID, err)
+			}
+		}
+		if len(users) < digestUserBatch {
+			return
+		}
+		lastID = users[len(users)-1].ID
+	}
+}
+
+// digestUser 汇总用户离线后收到且尚未发送过的消息，按通知偏好过滤后发送一封摘要
+// 免打扰时段内推迟到下一轮，发送成功或没有需要通知的消息时推进发送位置
+func (s *EmailDigestService) digestUser(user models.User, now time.Time) error {
+	if user.LastSeenAt == nil || s.messages.userService.IsUserOnline(user.ID) {
+		return nil
+	}
+
+	prefs, err := s.notifications.GetPrefs(user.ID)
+	if err != nil {
+		return err
+	}
+	if prefs.Level == models.NotifyNone {
+		return nil
+	}
+	// 全局勿扰期间不发送，勿扰结束后再处理
+	dnd, err := s.notifications.GetDND(user.ID)
+	if err != nil {
+		return err
+	}
+	if DNDActive(dnd, now) {
+		return nil
+	}
+
+	var digest models.EmailDigest
+	if err := s.db.First(&digest, "user_id = ?", user.ID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	memberGroups := s.db.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", user.ID)
+	var messages []models.Message
+	if err := s.db.Where("id > ? AND created_at > ? AND sender_id <> ? AND deleted_at IS NULL AND type <> ?",
+		digest.LastMessageID, *user.LastSeenAt, user.ID, models.SystemMessage).
+		Where(s.db.Where("group_id = 0 AND receiver_id = ?", user.ID).Or("group_id IN (?)", memberGroups)).
+		Order("id").
+		Limit(digestScanLimit).
+		Find(&messages).Error; err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var included []models.Message
+	for _, msg := range messages {
+		// 全局勿扰期间收到的消息不再补发邮件
+		if DNDActive(dnd, msg.CreatedAt) {
+			continue
+		}
+		s.messages.decryptContent(&msg)
+		switch decideNotification(prefs, IsMentioned(msg.Content, user.Username), now) {
+		case NotifyDefer:
+			return nil
+		case NotifySend:
+			included = append(included, msg)
+		}
+	}
+
+	if len(included) > 0 {
+		body, err := s.composeDigest(user, included)
+		if err != nil {
+			return err
+		}
+		subject := fmt.Sprintf("你有%d条未读消息", len(included))
+		if err := s.mailer.Send(user.Email, subject, body); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Save(&models.EmailDigest{
+		UserID:        user.ID,
+		LastMessageID: messages[len(messages)-1].ID,
+		SentAt:        now,
+	}).Error
+}
+
+// composeDigest 生成摘要正文，每行一条消息："[会话] 发送者: 内容"
+func (s *EmailDigestService) composeDigest(user models.User, messages []models.Message) (string, error) {
+	senderIDs := make([]uint, 0, len(messages))
+	var groupIDs []uint
+	for _, msg := range messages {
+		senderIDs = append(senderIDs, msg.SenderID)
+		if msg.GroupID > 0 {
+			groupIDs = append(groupIDs, msg.GroupID)
+		}
+	}
+
+	senders, err := s.messages.userService.userResponses(senderIDs)
+	if err != nil {
+		return "", err
+	}
+	groupNames := make(map[uint]string, len(groupIDs))
+	if len(groupIDs) > 0 {
+		var groups []models.Group
+		if err := s.db.Select("id", "name").Where("id IN ?", groupIDs).Find(&groups).Error; err != nil {
+			return "", err
+		}
+		for _, group := range groups {
+			groupNames[group.ID] = group.Name
+		}
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s，你好：\n\n你离线期间收到了以下消息：\n\n", user.Username)
+	for i, msg := range messages {
+		if i >= digestMaxLines {
+			fmt.Fprintf(&body, "\n……还有%d条消息，请登录查看。\n", len(messages)-digestMaxLines)
+			break
+		}
+		conversation := digestPrivateName
+		if msg.GroupID > 0 {
+			conversation = groupNames[msg.GroupID]
+		}
+		content := []rune(msg.Content)
+		if len(content) > digestContentMax {
+			content = append(content[:digestContentMax], '…')
+		}
+		fmt.Fprintf(&body, "[%s] %s: %s\n", conversation, senders[msg.SenderID].Username, string(content))
+	}
+	return body.String(), nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// sentMail 测试中记录的一封邮件
+type sentMail struct {
+	to, subject, body string
+}
+
+// fakeMailer 记录发送的邮件而不真正发送
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []sentMail
+}
+
+func (m *fakeMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, sentMail{to, subject, body})
+	return nil
+}
+
+func (m *fakeMailer) mails() []sentMail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]sentMail(nil), m.sent...)
+}
+
+func TestEmailDigestForOfflineUsers(t *testing.T) {
+	old := config.AppConfig.EmailDigestOfflineMinutes
+	config.AppConfig.EmailDigestOfflineMinutes = 30
+	t.Cleanup(func() { config.AppConfig.EmailDigestOfflineMinutes = old })
+
+	env := newTestEnv(t)
+	mailer := &fakeMailer{}
+	notifications := NewNotificationService(env.db, env.rdb)
+	digests := NewEmailDigestService(env.db, env.messages, notifications, mailer)
+
+	sender := env.createUser(t, "carol")
+	offline := env.createUser(t, "alice")
+	online := env.createUser(t, "bob")
+	muted := env.createUser(t, "dave")
+	group := env.createGroup(t, "team", sender, offline, online, muted)
+
+	lastSeen := time.Now().Add(-time.Hour)
+	for _, user := range []*models.User{offline, online, muted} {
+		env.db.Model(user).Update("last_seen_at", lastSeen)
+	}
+	env.rdb.SAdd(t.Context(), onlineUsersKey(), onlineMember(online.ID))
+	if _, err := notifications.UpdatePrefs(muted.ID, models.NotificationPrefsRequest{Level: models.NotifyNone}); err != nil {
+		t.Fatalf("更新通知偏好失败: %v", err)
+	}
+
+	// 离线前的消息已经看过，不进入摘要
+	env.createMessage(t, models.Message{SenderID: sender.ID, ReceiverID: offline.ID, Content: "seen", CreatedAt: lastSeen.Add(-time.Minute)})
+	env.createMessage(t, models.Message{SenderID: sender.ID, ReceiverID: offline.ID, Content: "are you there?"})
+	env.createMessage(t, models.Message{SenderID: sender.ID, GroupID: group.ID, Content: "standup in 5"})
+
+	digests.sendDigests(t.Context())
+	mails := mailer.mails()
+	if len(mails) != 1 {
+		t.Fatalf("发送了 %d 封邮件，期望只给离线用户发送 1 封: %+v", len(mails), mails)
+	}
+	mail := mails[0]
+	if mail.to != offline.Email || mail.subject != "你有2条未读消息" {
+		t.Fatalf("邮件 = %+v", mail)
+	}
+	for _, line := range []string{"[私聊] carol: are you there?", "[team] carol: standup in 5"} {
+		if !strings.Contains(mail.body, line) {
+			t.Errorf("摘要缺少 %q:\n%s", line, mail.body)
+		}
+	}
+	if strings.Contains(mail.body, "seen") {
+		t.Errorf("摘要不应包含离线前的消息:\n%s", mail.body)
+	}
+
+	// 已发送过的消息不重复发送，新消息进入下一封摘要
+	digests.sendDigests(t.Context())
+	if n := len(mailer.mails()); n != 1 {
+		t.Fatalf("没有新消息时又发送了邮件，共 %d 封", n)
+	}
+	env.createMessage(t, models.Message{SenderID: sender.ID, ReceiverID: offline.ID, Content: "ping"})
+	digests.sendDigests(t.Context())
+	mails = mailer.mails()
+	if len(mails) != 2 || !strings.Contains(mails[1].body, "ping") || strings.Contains(mails[1].body, "standup") {
+		t.Fatalf("新消息的摘要 = %+v", mails)
+	}
+}
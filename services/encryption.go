@@ -0,0 +1,83 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+
+	"chatroom/config"
+)
+
+// Encryptor 消息内容加解密接口，密文和随机数均为base64编码
+type Encryptor interface {
+	Encrypt(plaintext string) (ciphertext, nonce string, err error)
+	Decrypt(ciphertext, nonce string) (string, error)
+}
+
+// aesGCMEncryptor 基于AES-GCM的加密实现
+type aesGCMEncryptor struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMEncryptor 使用16/24/32字节的密钥创建AES-GCM加密器
+func NewAESGCMEncryptor(key []byte) (Encryptor, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建AES加密器失败: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("创建GCM模式失败: %v", err)
+	}
+	return &aesGCMEncryptor{aead: aead}, nil
+}
+
+// Encrypt 加密明文，每次使用新的随机数
+func (e *aesGCMEncryptor) Encrypt(plaintext string) (string, string, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+	sealed := e.aead.Seal(nil, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// Decrypt 解密密文
+func (e *aesGCMEncryptor) Decrypt(ciphertext, nonce string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	nonceBytes, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil {
+		return "", err
+	}
+	if len(nonceBytes) != e.aead.NonceSize() {
+		return "", errors.New("随机数长度错误")
+	}
+	plain, err := e.aead.Open(nil, nonceBytes, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// newEncryptorFromConfig 根据配置创建加密器，未配置密钥时返回nil（不加密）
+func newEncryptorFromConfig() Encryptor {
+	if config.AppConfig.MessageEncryptionKey == "" {
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(config.AppConfig.MessageEncryptionKey)
+	if err != nil {
+		log.Fatalf("MESSAGE_ENCRYPTION_KEY 不是合法的base64: %v", err)
+	}
+	encryptor, err := NewAESGCMEncryptor(key)
+	if err != nil {
+		log.Fatalf("初始化消息加密失败: %v", err)
+	}
+	return encryptor
+}
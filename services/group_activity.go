@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// recordGroupActivityScript 群组活跃度缓存存在时累加消息数并更新最后消息时间
+// 缓存不存在时不创建，下次读取时从数据库统计，避免计数从0开始
+var recordGroupActivityScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('HINCRBY', KEYS[1], 'count', 1)
+	redis.call('HSET', KEYS[1], 'last_at', ARGV[1])
+end
+return 0
+`)
+
+// groupActivity 群组的消息数和最后一条消息时间
+type groupActivity struct {
+	count  int64
+	lastAt *time.Time
+}
+
+// groupActivityKey 群组活跃度缓存的键，count 为未撤回的消息数，last_at 为最后消息时间（纳秒，0表示无消息）
+func groupActivityKey(groupID uint) string {
+	return RedisKey("group:activity:%d", groupID)
+}
+
+// recordGroupActivity 新群消息发送后更新群组活跃度缓存
+func (s *MessageService) recordGroupActivity(msg *models.Message) {
+	ctx := context.Background()
+	if err := recordGroupActivityScript.Run(ctx, s.rdb,
+		[]string{groupActivityKey(msg.GroupID)},
+		msg.CreatedAt.UnixNano()).Err(); err != nil {
+		log.Printf("更新群组%d活跃度缓存失败: %v", msg.GroupID, err)
+	}
+}
+
+// groupActivities 批量获取群组活跃度，未命中缓存的群组一次性从数据库统计并回填
+func (s *GroupService) groupActivities(groupIDs []uint) (map[uint]groupActivity, error) {
+	ctx := context.Background()
+	rdb := s.userService.rdb
+	activities := make(map[uint]groupActivity, len(groupIDs))
+
+	pipe := rdb.Pipeline()
+	cmds := make(map[uint]*redis.SliceCmd, len(groupIDs))
+	for _, groupID := range groupIDs {
+		cmds[groupID] = pipe.HMGet(ctx, groupActivityKey(groupID), "count", "last_at")
+	}
+	pipe.Exec(ctx)
+
+	var missing []uint
+	for groupID, cmd := range cmds {
+		values, err := cmd.Result()
+		if err != nil || values[0] == nil || values[1] == nil {
+			missing = append(missing, groupID)
+			continue
+		}
+		count, _ := strconv.ParseInt(values[0].(string), 10, 64)
+		nanos, _ := strconv.ParseInt(values[1].(string), 10, 64)
+		activity := groupActivity{count: count}
+		if nanos > 0 {
+			lastAt := time.Unix(0, nanos)
+			activity.lastAt = &lastAt
+		}
+		activities[groupID] = activity
+	}
+	if len(missing) == 0 {
+		return activities, nil
+	}
+
+	type activityRow struct {
+		GroupID uint
+		Count   int64
+		LastAt  *time.Time
+	}
+	var rows []activityRow
+	for _, chunk := range chunkIDs(missing) {
+		var batch []activityRow
+		if err := s.DB.Model(&models.Message{}).
+			Select("group_id, COUNT(*) AS count, MAX(created_at) AS last_at").
+			Where("group_id IN ? AND deleted_at IS NULL", chunk).
+			Group("group_id").
+			Scan(&batch).Error; err != nil {
+			return nil, err
+		}
+		rows = append(rows, batch...)
+	}
+
+	for _, groupID := range missing {
+		activities[groupID] = groupActivity{}
+	}
+	for _, row := range rows {
+		activities[row.GroupID] = groupActivity{count: row.Count, lastAt: row.LastAt}
+	}
+
+	// 回填缓存
+	expiration := time.Duration(config.AppConfig.CacheExpiration) * time.Second
+	pipe = rdb.Pipeline()
+	for _, groupID := range missing {
+		activity := activities[groupID]
+		var nanos int64
+		if activity.lastAt != nil {
+			nanos = activity.lastAt.UnixNano()
+		}
+		key := groupActivityKey(groupID)
+		pipe.HSet(ctx, key, "count", activity.count, "last_at", nanos)
+		pipe.Expire(ctx, key, expiration)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("回填群组活跃度缓存失败: %v", err)
+	}
+
+	return activities, nil
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+func TestDisbandGroupPurgesMessagesAndCaches(t *testing.T) {
+	tests := []struct {
+		mode        string
+		wantRows    int64
+		wantVisible int64
+	}{
+		{disbandKeepMessages, 2, 2},
+		{"soft_delete", 2, 0},
+		{disbandPurgeMessages, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			original := config.AppConfig.GroupDisbandMessages
+			t.Cleanup(func() { config.AppConfig.GroupDisbandMessages = original })
+			config.AppConfig.GroupDisbandMessages = tt.mode
+
+			env := newTestEnv(t)
+			ctx := context.Background()
+			owner := env.createUser(t, "owner")
+			member := env.createUser(t, "member")
+			group := env.createGroup(t, "g", owner, member)
+			conversationID := models.GroupConversationID(group.ID)
+
+			first := env.createMessage(t, models.Message{SenderID: owner.ID, GroupID: group.ID, Content: "hi"})
+			env.createMessage(t, models.Message{SenderID: member.ID, GroupID: group.ID, Content: "hey"})
+			if err := env.db.Create(&models.MessageReaction{MessageID: first.ID, UserID: member.ID, Emoji: "👍"}).Error; err != nil {
+				t.Fatalf("创建回应失败: %v", err)
+			}
+			if err := env.db.Create(&models.PinnedMessage{ConversationID: conversationID, MessageID: first.ID, PinnedBy: owner.ID}).Error; err != nil {
+				t.Fatalf("创建置顶失败: %v", err)
+			}
+			if err := env.messages.MarkMessagesAsRead(member.ID, group.ID, true, 0); err != nil {
+				t.Fatalf("标记已读失败: %v", err)
+			}
+
+			// 群组相关缓存
+			keys := []string{
+				recentMessagesKey(conversationID),
+				groupMembersKey(group.ID),
+				groupActivityKey(group.ID),
+			}
+			for _, userID := range []uint{owner.ID, member.ID} {
+				keys = append(keys, recentChatsKey(userID), lastReadKey(userID, conversationID), mentionUnreadKey(userID, group.ID))
+			}
+			for _, key := range keys {
+				env.rdb.Set(ctx, key, "1", 0)
+			}
+
+			if err := env.groups.DisbandGroup(group.ID, member.ID); err != ErrNoDisbandPermission {
+				t.Fatalf("普通成员解散群组 = %v，期望 ErrNoDisbandPermission", err)
+			}
+			if err := env.groups.DisbandGroup(group.ID, owner.ID); err != nil {
+				t.Fatalf("解散群组失败: %v", err)
+			}
+
+			count := func(model interface{}, query string, args ...interface{}) int64 {
+				var n int64
+				if err := env.db.Model(model).Where(query, args...).Count(&n).Error; err != nil {
+					t.Fatalf("统计失败: %v", err)
+				}
+				return n
+			}
+			if got := count(&models.Message{}, "group_id = ?", group.ID); got != tt.wantRows {
+				t.Errorf("消息行数 = %d，期望 %d", got, tt.wantRows)
+			}
+			if got := count(&models.Message{}, "group_id = ? AND deleted_at IS NULL", group.ID); got != tt.wantVisible {
+				t.Errorf("未删除消息数 = %d，期望 %d", got, tt.wantVisible)
+			}
+			if got := count(&models.MessageReaction{}, "message_id = ?", first.ID); tt.mode == disbandPurgeMessages && got != 0 {
+				t.Errorf("物理删除后仍有 %d 条回应", got)
+			}
+			if got := count(&models.PinnedMessage{}, "conversation_id = ?", conversationID); got != 0 {
+				t.Errorf("置顶记录未删除: %d", got)
+			}
+			if got := count(&models.ConversationRead{}, "conversation_id = ?", conversationID); got != 0 {
+				t.Errorf("已读记录未删除: %d", got)
+			}
+			if got := count(&models.GroupMember{}, "group_id = ?", group.ID); got != 0 {
+				t.Errorf("成员记录未删除: %d", got)
+			}
+			if _, err := env.groups.GetGroupByID(group.ID); err != ErrGroupNotFound {
+				t.Errorf("解散后获取群组 = %v，期望 ErrGroupNotFound", err)
+			}
+			for _, key := range keys {
+				if env.mr.Exists(key) {
+					t.Errorf("缓存 %s 未清理", key)
+				}
+			}
+		})
+	}
+}
+
+func TestDisbandGroupUnsubscribesSessions(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	env.groups.SetDisbandHook(m.HandleGroupDisbanded)
+
+	owner := env.createUser(t, "owner")
+	member := env.createUser(t, "member")
+	group := env.createGroup(t, "g", owner, member)
+	client, conn, _ := connectClient(t, m, member)
+
+	// 连接后再接入Kafka，避免上线状态发布到不存在的主题
+	m.kafka = newTestKafka(nil)
+	topic := m.kafka.BuildTopicName("group", group.ID)
+	m.kafka.topics[topic] = true
+	m.SubscribeToGroupChannel(client, group.ID)
+	if subs := m.GroupSubscriptions(client); len(subs) != 1 {
+		t.Fatalf("订阅列表 = %v，期望订阅群组", subs)
+	}
+
+	if err := env.groups.DisbandGroup(group.ID, owner.ID); err != nil {
+		t.Fatalf("解散群组失败: %v", err)
+	}
+
+	if subs := m.GroupSubscriptions(client); len(subs) != 0 {
+		t.Fatalf("解散后订阅列表 = %v，期望为空", subs)
+	}
+	m.kafka.handlerMutex.Lock()
+	_, consuming := m.kafka.consumers[topic]
+	m.kafka.handlerMutex.Unlock()
+	if consuming {
+		t.Fatal("解散后仍在消费群组主题")
+	}
+
+	// 在线成员收到解散通知
+	want := fmt.Sprintf(`{"group_id":%d}`, group.ID)
+	for i := 0; i < 100; i++ {
+		for _, frame := range conn.textFrames() {
+			var event WebSocketMessage
+			if json.Unmarshal(frame, &event) == nil && event.Type == "group_disbanded" && string(event.Content) == want {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("在线成员未收到 group_disbanded 通知")
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/models"
+)
+
+// 入群邀请相关错误
+var (
+	ErrInviteNotFound      = errors.New("邀请不存在")
+	ErrInviteNotPending    = errors.New("邀请已处理")
+	ErrNoInvitePermission  = errors.New("没有权限邀请成员")
+	ErrNotInvitee          = errors.New("只有被邀请人可以处理该邀请")
+	ErrInviteTargetMissing = errors.New("必须指定被邀请的用户名或用户ID")
+)
+
+// SetUserEventPublisher 设置发给单个用户的事件发布函数（用于推送入群邀请）
+func (s *GroupService) SetUserEventPublisher(publish func(userID uint, eventType string, payload []byte)) {
+	s.publishUserEvent = publish
+}
+
+// InviteMember 邀请用户入群，被邀请人同意后才会加入
+// 普通成员可以邀请他人加入开放群组，仅邀请的群组只有群主和管理员可以邀请
+// 已有待处理的邀请时直接返回该邀请，不重复通知
+func (s *GroupService) InviteMember(groupID, inviterID uint, req models.GroupInviteRequest) (*models.GroupInvite, error) {
+	group, err := s.GetGroupByID(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	isMember, isAdmin, err := s.getMemberRole(groupID, inviterID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrOperatorNotMember
+	}
+	if group.JoinPolicy == models.JoinInviteOnly && !isAdmin && group.CreatorID != inviterID {
+		return nil, ErrNoInvitePermission
+	}
+
+	invitee, err := s.resolveInvitee(req)
+	if err != nil {
+		return nil, err
+	}
+
+	inviteeIsMember, _, err := s.getMemberRole(groupID, invitee.ID)
+	if err != nil {
+		return nil, err
+	}
+	if inviteeIsMember {
+		return nil, ErrAlreadyMember
+	}
+
+	var existing models.GroupInvite
+	err = s.DB.Where("group_id = ? AND invitee_id = ? AND status = ?", groupID, invitee.ID, models.InvitePending).
+		First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	invite := models.GroupInvite{
+		GroupID:   groupID,
+		InviterID: inviterID,
+		InviteeID: invitee.ID,
+		Status:    models.InvitePending,
+	}
+	if err := s.DB.Create(&invite).Error; err != nil {
+		return nil, err
+	}
+
+	if s.publishUserEvent != nil {
+		inviter, err := s.userService.GetUserByID(inviterID)
+		if err == nil {
+			event, _ := json.Marshal(models.GroupInviteEvent{
+				InviteID:        invite.ID,
+				GroupID:         groupID,
+				GroupName:       group.Name,
+				InviterID:       inviterID,
+				InviterUsername: inviter.Username,
+			})
+			s.publishUserEvent(invitee.ID, "group_invite", event)
+		}
+	}
+
+	return &invite, nil
+}
+
+// resolveInvitee 按用户ID或用户名查找被邀请人，同时提供时以用户ID为准
+func (s *GroupService) resolveInvitee(req models.GroupInviteRequest) (*models.User, error) {
+	if req.UserID != 0 {
+		return s.userService.GetUserByID(req.UserID)
+	}
+	if req.Username != "" {
+		return s.userService.GetUserByUsername(req.Username)
+	}
+	return nil, ErrInviteTargetMissing
+}
+
+// GetPendingInvites 获取用户待处理的入群邀请
+func (s *GroupService) GetPendingInvites(userID uint) ([]models.GroupInvite, error) {
+	var invites []models.GroupInvite
+	if err := s.DB.Where("invitee_id = ? AND status = ?", userID, models.InvitePending).
+		Order("created_at DESC").
+		Find(&invites).Error; err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// AcceptInvite 接受入群邀请并加入群组
+// 邀请状态按条件更新，并发接受同一邀请时只有一个请求会生效；
+// 邀请状态和成员记录在同一事务中写入，只有成功入群时邀请才会被标记为已接受
+func (s *GroupService) AcceptInvite(inviteID, userID uint) (*models.GroupInvite, error) {
+	invite, err := s.pendingInvite(inviteID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 群组在邀请发出后可能已被解散
+	if _, err := s.GetGroupByID(invite.GroupID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := respondInvite(tx, invite.ID, models.InviteAccepted, now); err != nil {
+			return err
+		}
+		return insertMemberLocked(tx, &models.GroupMember{
+			GroupID:  invite.GroupID,
+			UserID:   userID,
+			JoinedAt: now,
+		})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			// 邀请发出后已通过其他途径入群，邀请不再有效
+			respondInvite(s.DB, invite.ID, models.InviteAccepted, now)
+			return nil, ErrAlreadyMember
+		}
+		// 群组已满等失败时事务回滚，邀请保持待处理状态
+		return nil, err
+	}
+	s.membershipChanged(invite.GroupID, userID, false)
+
+	invite.Status = models.InviteAccepted
+	invite.RespondedAt = &now
+	return invite, nil
+}
+
+// RejectInvite 拒绝入群邀请
+func (s *GroupService) RejectInvite(inviteID, userID uint) (*models.GroupInvite, error) {
+	invite, err := s.pendingInvite(inviteID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := respondInvite(s.DB, invite.ID, models.InviteRejected, now); err != nil {
+		return nil, err
+	}
+
+	invite.Status = models.InviteRejected
+	invite.RespondedAt = &now
+	return invite, nil
+}
+
+// pendingInvite 获取发给指定用户且尚未处理的邀请
+func (s *GroupService) pendingInvite(inviteID, userID uint) (*models.GroupInvite, error) {
+	var invite models.GroupInvite
+	if err := s.DB.First(&invite, inviteID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInviteNotFound
+		}
+		return nil, err
+	}
+	if invite.InviteeID != userID {
+		return nil, ErrNotInvitee
+	}
+	if invite.Status != models.InvitePending {
+		return nil, ErrInviteNotPending
+	}
+	return &invite, nil
+}
+
+// respondInvite 将待处理的邀请更新为指定状态，邀请已被处理时返回 ErrInviteNotPending
+func respondInvite(db *gorm.DB, inviteID uint, status models.GroupInviteStatus, at time.Time) error {
+	res := db.Model(&models.GroupInvite{}).
+		Where("id = ? AND status = ?", inviteID, models.InvitePending).
+		Updates(map[string]interface{}{
+			"status":       status,
+			"responded_at": at,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInviteNotPending
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+func TestGroupInviteLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser(t, "owner")
+	member := env.createUser(t, "member")
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	group := env.createGroup(t, "g", owner, member)
+
+	type userEvent struct {
+		userID    uint
+		eventType string
+		invite    models.GroupInviteEvent
+	}
+	var events []userEvent
+	env.groups.SetUserEventPublisher(func(userID uint, eventType string, payload []byte) {
+		event := userEvent{userID: userID, eventType: eventType}
+		json.Unmarshal(payload, &event.invite)
+		events = append(events, event)
+	})
+
+	// 仅邀请的群组只有群主和管理员可以邀请
+	if _, err := env.groups.UpdateGroup(group.ID, owner.ID, models.GroupRequest{Name: "g", JoinPolicy: models.JoinInviteOnly}); err != nil {
+		t.Fatalf("修改入群策略失败: %v", err)
+	}
+	if _, err := env.groups.InviteMember(group.ID, member.ID, models.GroupInviteRequest{Username: "alice"}); !errors.Is(err, ErrNoInvitePermission) {
+		t.Fatalf("普通成员邀请 = %v，期望 ErrNoInvitePermission", err)
+	}
+
+	// 按用户名邀请并通知被邀请人，重复邀请返回同一邀请且不重复通知
+	invite, err := env.groups.InviteMember(group.ID, owner.ID, models.GroupInviteRequest{Username: "alice"})
+	if err != nil {
+		t.Fatalf("邀请失败: %v", err)
+	}
+	if invite.InviteeID != alice.ID || invite.Status != models.InvitePending {
+		t.Fatalf("邀请 = %+v", invite)
+	}
+	again, err := env.groups.InviteMember(group.ID, owner.ID, models.GroupInviteRequest{UserID: alice.ID})
+	if err != nil || again.ID != invite.ID {
+		t.Fatalf("重复邀请 = %+v, %v，期望返回邀请 %d", again, err, invite.ID)
+	}
+	if len(events) != 1 || events[0].userID != alice.ID || events[0].eventType != "group_invite" ||
+		events[0].invite.InviteID != invite.ID || events[0].invite.InviterUsername != "owner" {
+		t.Fatalf("邀请通知 = %+v", events)
+	}
+
+	invalid := []struct {
+		name string
+		req  models.GroupInviteRequest
+		want error
+	}{
+		{"已是成员", models.GroupInviteRequest{Username: "member"}, ErrAlreadyMember},
+		{"用户不存在", models.GroupInviteRequest{Username: "nobody"}, ErrUserNotFound},
+		{"未指定用户", models.GroupInviteRequest{}, ErrInviteTargetMissing},
+	}
+	for _, tt := range invalid {
+		if _, err := env.groups.InviteMember(group.ID, owner.ID, tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("%s = %v，期望 %v", tt.name, err, tt.want)
+		}
+	}
+
+	// 只有被邀请人可以接受，接受后入群
+	if _, err := env.groups.AcceptInvite(invite.ID, bob.ID); !errors.Is(err, ErrNotInvitee) {
+		t.Fatalf("他人接受邀请 = %v，期望 ErrNotInvitee", err)
+	}
+	if pending, _ := env.groups.GetPendingInvites(alice.ID); len(pending) != 1 {
+		t.Fatalf("待处理邀请 = %+v，期望 1 条", pending)
+	}
+	accepted, err := env.groups.AcceptInvite(invite.ID, alice.ID)
+	if err != nil {
+		t.Fatalf("接受邀请失败: %v", err)
+	}
+	if accepted.Status != models.InviteAccepted || accepted.RespondedAt == nil {
+		t.Fatalf("接受后的邀请 = %+v", accepted)
+	}
+	if isMember, _, _ := env.groups.getMemberRole(group.ID, alice.ID); !isMember {
+		t.Fatal("接受邀请后应成为群成员")
+	}
+	if _, err := env.groups.AcceptInvite(invite.ID, alice.ID); !errors.Is(err, ErrInviteNotPending) {
+		t.Fatalf("重复接受 = %v，期望 ErrInviteNotPending", err)
+	}
+
+	// 拒绝后不入群，邀请不能再被接受
+	rejected, err := env.groups.InviteMember(group.ID, owner.ID, models.GroupInviteRequest{UserID: bob.ID})
+	if err != nil {
+		t.Fatalf("邀请失败: %v", err)
+	}
+	if _, err := env.groups.RejectInvite(rejected.ID, bob.ID); err != nil {
+		t.Fatalf("拒绝邀请失败: %v", err)
+	}
+	if _, err := env.groups.AcceptInvite(rejected.ID, bob.ID); !errors.Is(err, ErrInviteNotPending) {
+		t.Fatalf("拒绝后接受 = %v，期望 ErrInviteNotPending", err)
+	}
+	if isMember, _, _ := env.groups.getMemberRole(group.ID, bob.ID); isMember {
+		t.Fatal("拒绝邀请后不应成为群成员")
+	}
+	if _, err := env.groups.RejectInvite(9999, bob.ID); !errors.Is(err, ErrInviteNotFound) {
+		t.Fatalf("拒绝不存在的邀请 = %v，期望 ErrInviteNotFound", err)
+	}
+}
+
+func TestConcurrentInviteAcceptsRespectMemberCap(t *testing.T) {
+	old := config.AppConfig.GroupMaxMembers
+	config.AppConfig.GroupMaxMembers = 5
+	t.Cleanup(func() { config.AppConfig.GroupMaxMembers = old })
+
+	env := newTestEnv(t)
+	// SQLite没有行锁，单连接让事务串行执行，与MySQL中群组行锁的效果相同
+	sqlDB, _ := env.db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	owner := env.createUser(t, "owner")
+	group := env.createGroup(t, "g", owner)
+
+	const invitees = 10
+	invites := make([]*models.GroupInvite, invitees)
+	for i := range invites {
+		user := env.createUser(t, fmt.Sprintf("user%d", i))
+		invite, err := env.groups.InviteMember(group.ID, owner.ID, models.GroupInviteRequest{Username: user.Username})
+		if err != nil {
+			t.Fatalf("邀请失败: %v", err)
+		}
+		invites[i] = invite
+	}
+
+	errs := make([]error, invitees)
+	var wg sync.WaitGroup
+	for i, invite := range invites {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = env.groups.AcceptInvite(invite.ID, invite.InviteeID)
+		}()
+	}
+	wg.Wait()
+
+	accepted, full := 0, 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			accepted++
+		case errors.Is(err, ErrGroupFull):
+			full++
+		default:
+			t.Fatalf("接受邀请失败: %v", err)
+		}
+	}
+	if accepted != 4 || full != invitees-4 {
+		t.Fatalf("接受成功 %d 个、群满 %d 个，期望 4 和 %d", accepted, full, invitees-4)
+	}
+	var members, pending int64
+	env.db.Model(&models.GroupMember{}).Where("group_id = ?", group.ID).Count(&members)
+	env.db.Model(&models.GroupInvite{}).Where("status = ?", models.InvitePending).Count(&pending)
+	if members != 5 || pending != invitees-4 {
+		t.Fatalf("成员数 = %d，待处理邀请 = %d，期望 5 和 %d", members, pending, invitees-4)
+	}
+
+	// 同一用户并发加入只产生一条成员记录
+	config.AppConfig.GroupMaxMembers = 0
+	joiner := env.createUser(t, "joiner")
+	var joined, already atomic.Int32
+	for range invitees {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch err := env.groups.JoinGroup(group.ID, joiner.ID); {
+			case err == nil:
+				joined.Add(1)
+			case errors.Is(err, ErrAlreadyMember):
+				already.Add(1)
+			default:
+				t.Errorf("加入群组失败: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	var rows int64
+	env.db.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", group.ID, joiner.ID).Count(&rows)
+	if joined.Load() != 1 || already.Load() != invitees-1 || rows != 1 {
+		t.Fatalf("加入成功 %d 次、已是成员 %d 次、成员记录 %d 条，期望 1、%d、1", joined.Load(), already.Load(), rows, invitees-1)
+	}
+}
@@ -1,18 +1,75 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"log"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"chatroom/config"
 	"chatroom/models"
 )
 
+// 群组不存在相关错误
+var (
+	ErrGroupNotFound = errors.New("群组不存在")
+)
+
+// 群组权限相关错误
+var (
+	ErrGroupForbidden       = errors.New("没有权限访问该群组")
+	ErrOperatorNotMember    = errors.New("操作者不是群组成员")
+	ErrNoAddPermission      = errors.New("没有权限添加成员")
+	ErrNoRemovePermission   = errors.New("没有权限移除成员")
+	ErrRemoveOwner          = errors.New("不能移除群组创建者")
+	ErrNoUpdatePermission   = errors.New("没有权限更新群组")
+	ErrNoSetAdminPermission = errors.New("没有权限设置管理员")
+	ErrNoDisbandPermission  = errors.New("没有权限解散群组")
+	ErrDemoteOwner          = errors.New("不能取消群组创建者的管理员身份")
+	ErrJoinInviteOnly       = errors.New("该群组仅允许邀请加入")
+)
+
+// 群组请求校验相关错误
+var (
+	ErrGroupNameExists          = errors.New("群组名已存在")
+	ErrAlreadyMember            = errors.New("用户已经是群组成员")
+	ErrGroupFull                = errors.New("群组成员已满")
+	ErrNotMember                = errors.New("不是群组成员")
+	ErrTargetNotMember          = errors.New("目标用户不是群组成员")
+	ErrOwnerCannotLeave         = errors.New("群组创建者不能离开群组")
+	ErrInvalidJoinPolicy        = errors.New("无效的入群策略")
+	ErrInvalidPostPolicy        = errors.New("无效的发言策略")
+	ErrInvalidHistoryVisibility = errors.New("无效的历史消息可见范围")
+)
+
+// 解散群组时群消息的处理方式
+const (
+	disbandKeepMessages  = "keep"
+	disbandSoftDelete    = "soft_delete"
+	disbandPurgeMessages = "purge"
+)
+
 // GroupService 群组服务
 type GroupService struct {
 	DB          *gorm.DB
 	userService *UserService
+
+	// 群组解散后的回调（用于取消订阅并通知在线成员）
+	onDisband func(groupID uint, memberIDs []uint)
+
+	// 群组事件发布函数（用于通知群成员）
+	publishEvent func(groupID uint, eventType string, payload []byte)
+
+	// 单个用户事件发布函数（用于推送入群邀请）
+	publishUserEvent func(userID uint, eventType string, payload []byte)
+
+	// 成员被移除或退出后的回调（用于取消其群组频道订阅）
+	onMemberRemoved func(groupID, userID uint)
 }
 
 // NewGroupService 创建群组服务实例
@@ -21,23 +78,42 @@ func NewGroupService(db *gorm.DB, userService *UserService) *GroupService {
 }
 
 // CreateGroup 创建新群组
-func (s *GroupService) CreateGroup(creatorID uint, name, description, avatar string) (*models.Group, error) {
+func (s *GroupService) CreateGroup(creatorID uint, req models.GroupRequest) (*models.Group, error) {
+	if err := validateGroupPolicies(req); err != nil {
+		return nil, err
+	}
+
 	// 检查群组名是否已存在
 	var existingGroup models.Group
-	if err := s.DB.Where("name = ?", name).First(&existingGroup).Error; err == nil {
-		return nil, errors.New("群组名已存在")
+	if err := s.DB.Where("name = ?", req.Name).First(&existingGroup).Error; err == nil {
+		return nil, ErrGroupNameExists
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, err
 	}
 
 	// 创建新群组
 	group := &models.Group{
-		Name:        name,
-		Description: description,
-		Avatar:      avatar,
-		CreatorID:   creatorID,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		Name:              req.Name,
+		Description:       req.Description,
+		Avatar:            req.Avatar,
+		Category:          req.Category,
+		IsPublic:          true,
+		JoinPolicy:        models.JoinOpen,
+		PostPolicy:        models.PostAll,
+		HistoryVisibility: models.HistoryAll,
+		CreatorID:         creatorID,
+	}
+	if req.JoinPolicy != "" {
+		group.JoinPolicy = req.JoinPolicy
+	}
+	if req.PostPolicy != "" {
+		group.PostPolicy = req.PostPolicy
+	}
+	if req.HistoryVisibility != "" {
+		group.HistoryVisibility = req.HistoryVisibility
+	}
+	if req.SlowModeSeconds != nil {
+		group.SlowModeSeconds = *req.SlowModeSeconds
 	}
 
 	// 开启事务
@@ -60,6 +136,23 @@ func (s *GroupService) CreateGroup(creatorID uint, name, description, avatar str
 		return nil, err
 	}
 
+	// is_public 字段带有数据库默认值，GORM 创建时会忽略零值false，需要单独更新
+	if req.IsPublic != nil && !*req.IsPublic {
+		if err := tx.Model(group).Update("is_public", false).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		group.IsPublic = false
+	}
+
+	// 写入欢迎系统消息，群组创建后即有可渲染的内容
+	if welcome := welcomeMessage(group); welcome != nil {
+		if err := tx.Create(welcome).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		return nil, err
@@ -68,18 +161,68 @@ func (s *GroupService) CreateGroup(creatorID uint, name, description, avatar str
 	return group, nil
 }
 
+// welcomeMessage 按 GROUP_WELCOME_MESSAGE 模板构建群组的欢迎系统消息，未启用时返回nil
+func welcomeMessage(group *models.Group) *models.Message {
+	template := config.AppConfig.GroupWelcomeMessage
+	if template == "" {
+		return nil
+	}
+	return &models.Message{
+		Content:   strings.ReplaceAll(template, "{group}", group.Name),
+		Type:      models.SystemMessage,
+		SenderID:  group.CreatorID,
+		GroupID:   group.ID,
+		CreatedAt: time.Now(),
+	}
+}
+
+// validateGroupPolicies 校验请求中的策略枚举值和头像地址（空值表示使用默认值或保持不变）
+func validateGroupPolicies(req models.GroupRequest) error {
+	if req.JoinPolicy != "" && !req.JoinPolicy.Valid() {
+		return ErrInvalidJoinPolicy
+	}
+	if req.PostPolicy != "" && !req.PostPolicy.Valid() {
+		return ErrInvalidPostPolicy
+	}
+	if req.HistoryVisibility != "" && !req.HistoryVisibility.Valid() {
+		return ErrInvalidHistoryVisibility
+	}
+	return ValidateAvatarURL(req.Avatar)
+}
+
 // GetGroupByID 根据ID获取群组
 func (s *GroupService) GetGroupByID(id uint) (*models.Group, error) {
 	var group models.Group
 	if err := s.DB.First(&group, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("群组不存在")
+			return nil, ErrGroupNotFound
 		}
 		return nil, err
 	}
 	return &group, nil
 }
 
+// CheckGroupAccess 检查用户是否可以查看群组
+// 群组不存在返回 ErrGroupNotFound，私有群组且用户不是成员返回 ErrGroupForbidden
+func (s *GroupService) CheckGroupAccess(groupID, userID uint) error {
+	group, err := s.GetGroupByID(groupID)
+	if err != nil {
+		return err
+	}
+	if group.IsPublic {
+		return nil
+	}
+
+	isMember, _, err := s.getMemberRole(groupID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrGroupForbidden
+	}
+	return nil
+}
+
 // GetGroupResponse 获取群组响应模型
 func (s *GroupService) GetGroupResponse(id uint, includeMembers bool) (*models.GroupResponse, error) {
 	group, err := s.GetGroupByID(id)
@@ -94,25 +237,44 @@ func (s *GroupService) GetGroupResponse(id uint, includeMembers bool) (*models.G
 	}
 
 	response := &models.GroupResponse{
-		ID:          group.ID,
-		Name:        group.Name,
-		Description: group.Description,
-		Avatar:      group.Avatar,
-		CreatorID:   group.CreatorID,
-		CreatedAt:   group.CreatedAt,
-		MemberCount: int(memberCount),
+		ID:                group.ID,
+		Name:              group.Name,
+		Description:       group.Description,
+		Avatar:            AssetURL(group.Avatar),
+		Category:          group.Category,
+		IsPublic:          group.IsPublic,
+		JoinPolicy:        group.JoinPolicy,
+		PostPolicy:        group.PostPolicy,
+		HistoryVisibility: group.HistoryVisibility,
+		SlowModeSeconds:   group.SlowModeSeconds,
+		CreatorID:         group.CreatorID,
+		CreatedAt:         group.CreatedAt,
+		MemberCount:       int(memberCount),
 	}
 
+	activities, err := s.groupActivities([]uint{id})
+	if err != nil {
+		return nil, err
+	}
+	response.MessageCount = activities[id].count
+	response.LastMessageAt = activities[id].lastAt
+
 	// 如果需要包含成员信息
 	if includeMembers {
 		var members []models.User
 		if err := s.DB.Table("users").
-			Joins("JOIN group_members ON users.id = group_members.user_id").
+			Joins("JOIN group_members ON users.id = group_members.user_id AND group_members.deleted_at IS NULL").
 			Where("group_members.group_id = ?", id).
 			Find(&members).Error; err != nil {
 			return nil, err
 		}
 
+		memberIDs := make([]uint, len(members))
+		for i, member := range members {
+			memberIDs[i] = member.ID
+		}
+		online := s.userService.onlineStatuses(memberIDs)
+
 		// 构建成员响应
 		memberResponses := make([]models.UserResponse, len(members))
 		for i, member := range members {
@@ -120,30 +282,59 @@ func (s *GroupService) GetGroupResponse(id uint, includeMembers bool) (*models.G
 				ID:       member.ID,
 				Username: member.Username,
 				Email:    member.Email,
-				Avatar:   member.Avatar,
-				Online:   s.userService.IsUserOnline(member.ID),
+				Avatar:   AssetURL(member.Avatar),
+				Online:   online[member.ID],
+			}
+			if member.ID == group.CreatorID {
+				response.Creator = &memberResponses[i]
 			}
 		}
 
 		response.Members = memberResponses
 	}
 
+	// 创建者不在成员列表中时单独获取，账号已不存在则留空
+	if response.Creator == nil {
+		creator, err := s.userService.GetUserResponse(group.CreatorID)
+		if err != nil && !errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+		response.Creator = creator
+	}
+
 	return response, nil
 }
 
 // GetUserGroups 获取用户加入的所有群组
-func (s *GroupService) GetUserGroups(userID uint) ([]models.GroupResponse, error) {
-	var groupIDs []uint
-	if err := s.DB.Table("group_members").
-		Select("group_id").
-		Where("user_id = ?", userID).
-		Pluck("group_id", &groupIDs).Error; err != nil {
+// category 不为空时只返回该分类的群组，folder 不为空时只返回用户个人文件夹中的群组
+func (s *GroupService) GetUserGroups(userID uint, category, folder string) ([]models.GroupResponse, error) {
+	var memberships []models.GroupMember
+	membershipQuery := s.DB.Where("user_id = ?", userID)
+	if folder != "" {
+		membershipQuery = membershipQuery.Where("folder = ?", folder)
+	}
+	if err := membershipQuery.Find(&memberships).Error; err != nil {
 		return nil, err
 	}
 
+	groupIDs := make([]uint, len(memberships))
+	folders := make(map[uint]string, len(memberships))
+	for i, m := range memberships {
+		groupIDs[i] = m.GroupID
+		folders[m.GroupID] = m.Folder
+	}
+
 	var groups []models.Group
-	if err := s.DB.Where("id IN ?", groupIDs).Find(&groups).Error; err != nil {
-		return nil, err
+	for _, chunk := range chunkIDs(groupIDs) {
+		var batch []models.Group
+		groupQuery := s.DB.Where("id IN ?", chunk)
+		if category != "" {
+			groupQuery = groupQuery.Where("category = ?", category)
+		}
+		if err := groupQuery.Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		groups = append(groups, batch...)
 	}
 
 	// 获取每个群组的成员数量
@@ -156,17 +347,44 @@ func (s *GroupService) GetUserGroups(userID uint) ([]models.GroupResponse, error
 		groupMemberCounts[groupID] = count
 	}
 
+	activities, err := s.groupActivities(groupIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 批量获取创建者信息
+	creatorIDs := make([]uint, 0, len(groups))
+	for _, group := range groups {
+		creatorIDs = append(creatorIDs, group.CreatorID)
+	}
+	creators, err := s.userService.userResponses(creatorIDs)
+	if err != nil {
+		return nil, err
+	}
+
 	// 构建响应
 	responses := make([]models.GroupResponse, len(groups))
 	for i, group := range groups {
 		responses[i] = models.GroupResponse{
-			ID:          group.ID,
-			Name:        group.Name,
-			Description: group.Description,
-			Avatar:      group.Avatar,
-			CreatorID:   group.CreatorID,
-			CreatedAt:   group.CreatedAt,
-			MemberCount: int(groupMemberCounts[group.ID]),
+			ID:                group.ID,
+			Name:              group.Name,
+			Description:       group.Description,
+			Avatar:            AssetURL(group.Avatar),
+			Category:          group.Category,
+			IsPublic:          group.IsPublic,
+			JoinPolicy:        group.JoinPolicy,
+			PostPolicy:        group.PostPolicy,
+			HistoryVisibility: group.HistoryVisibility,
+			SlowModeSeconds:   group.SlowModeSeconds,
+			Folder:            folders[group.ID],
+			CreatorID:         group.CreatorID,
+			CreatedAt:         group.CreatedAt,
+			MemberCount:       int(groupMemberCounts[group.ID]),
+			MessageCount:      activities[group.ID].count,
+			LastMessageAt:     activities[group.ID].lastAt,
+		}
+		if creator, ok := creators[group.CreatorID]; ok {
+			responses[i].Creator = &creator
 		}
 	}
 
@@ -182,30 +400,29 @@ func (s *GroupService) AddMember(groupID, operatorID, targetUserID uint) error {
 	}
 
 	// 检查操作者是否有权限（创建者或管理员）
-	var isAdmin bool
-	err = s.DB.Model(&models.GroupMember{}).
-		Select("is_admin").
-		Where("group_id = ? AND user_id = ?", groupID, operatorID).
-		First(&isAdmin).Error
-
+	isMember, isAdmin, err := s.getMemberRole(groupID, operatorID)
 	if err != nil {
-		return errors.New("操作者不是群组成员")
+		return err
+	}
+	if !isMember {
+		return ErrOperatorNotMember
 	}
-
 	if !isAdmin && group.CreatorID != operatorID {
-		return errors.New("没有权限添加成员")
+		return ErrNoAddPermission
 	}
 
-	// 检查目标用户是否已在群组中
-	var count int64
-	if err := s.DB.Model(&models.GroupMember{}).
-		Where("group_id = ? AND user_id = ?", groupID, targetUserID).
-		Count(&count).Error; err != nil {
+	// 检查目标用户是否存在
+	if _, err := s.userService.GetUserByID(targetUserID); err != nil {
 		return err
 	}
 
-	if count > 0 {
-		return errors.New("用户已经是群组成员")
+	// 检查目标用户是否已在群组中
+	targetIsMember, _, err := s.getMemberRole(groupID, targetUserID)
+	if err != nil {
+		return err
+	}
+	if targetIsMember {
+		return ErrAlreadyMember
 	}
 
 	// 添加成员
@@ -216,63 +433,220 @@ func (s *GroupService) AddMember(groupID, operatorID, targetUserID uint) error {
 		IsAdmin:  false,
 	}
 
-	if err := s.DB.Create(&groupMember).Error; err != nil {
+	if err := s.joinMember(&groupMember); err != nil {
+		// 检查之后被并发加入
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrAlreadyMember
+		}
 		return err
 	}
+	s.membershipChanged(groupID, targetUserID, false)
 
 	return nil
 }
 
-// RemoveMember 移除群组成员（管理员权限）
-func (s *GroupService) RemoveMember(groupID, operatorID, targetUserID uint) error {
+// AddMembers 批量添加群组成员，逐个返回结果而不是在第一个错误时整体失败
+func (s *GroupService) AddMembers(groupID, operatorID uint, userIDs []uint) (map[uint]models.AddMemberResult, error) {
 	// 检查群组是否存在
 	group, err := s.GetGroupByID(groupID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	results := make(map[uint]models.AddMemberResult, len(userIDs))
+
 	// 检查操作者是否有权限（创建者或管理员）
-	var isAdmin bool
-	err = s.DB.Model(&models.GroupMember{}).
-		Select("is_admin").
-		Where("group_id = ? AND user_id = ?", groupID, operatorID).
-		First(&isAdmin).Error
+	isMember, isAdmin, err := s.getMemberRole(groupID, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember || (!isAdmin && group.CreatorID != operatorID) {
+		for _, userID := range userIDs {
+			results[userID] = models.AddMemberUnauthorized
+		}
+		return results, nil
+	}
+
+	for _, userID := range userIDs {
+		if _, done := results[userID]; done {
+			continue
+		}
+		results[userID] = s.addMember(groupID, userID)
+	}
+	return results, nil
+}
+
+// addMember 添加单个成员（调用方已检查权限）
+func (s *GroupService) addMember(groupID, userID uint) models.AddMemberResult {
+	// 检查目标用户是否存在
+	if _, err := s.userService.GetUserByID(userID); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return models.AddMemberNotFound
+		}
+		return models.AddMemberFailed
+	}
 
+	// 检查目标用户是否已在群组中
+	isMember, _, err := s.getMemberRole(groupID, userID)
 	if err != nil {
-		return errors.New("操作者不是群组成员")
+		return models.AddMemberFailed
+	}
+	if isMember {
+		return models.AddMemberAlreadyMember
 	}
 
-	if !isAdmin && group.CreatorID != operatorID {
-		return errors.New("没有权限移除成员")
+	groupMember := models.GroupMember{
+		GroupID:  groupID,
+		UserID:   userID,
+		JoinedAt: time.Now(),
+		IsAdmin:  false,
+	}
+	if err := s.joinMember(&groupMember); err != nil {
+		// 检查之后被并发加入
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return models.AddMemberAlreadyMember
+		}
+		if errors.Is(err, ErrGroupFull) {
+			return models.AddMemberGroupFull
+		}
+		log.Printf("添加成员%d到群组%d失败: %v", userID, groupID, err)
+		return models.AddMemberFailed
+	}
+	s.membershipChanged(groupID, userID, false)
+	return models.AddMemberAdded
+}
+
+// joinMember 在事务中检查成员数上限并写入成员记录
+func (s *GroupService) joinMember(member *models.GroupMember) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		return insertMemberLocked(tx, member)
+	})
+}
+
+// insertMemberLocked 锁定群组行后检查成员关系和成员数上限再写入成员记录，调用方需在事务中调用
+// 同一群组的并发加入在群组行锁上串行，不会超过 GROUP_MAX_MEMBERS；
+// 已是有效成员时返回 gorm.ErrDuplicatedKey，群组已满时返回 ErrGroupFull
+func insertMemberLocked(tx *gorm.DB, member *models.GroupMember) error {
+	var group models.Group
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&group, member.GroupID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrGroupNotFound
+		}
+		return err
+	}
+
+	var existing int64
+	if err := tx.Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id = ?", member.GroupID, member.UserID).
+		Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return gorm.ErrDuplicatedKey
+	}
+
+	if limit := config.AppConfig.GroupMaxMembers; limit > 0 {
+		var count int64
+		if err := tx.Model(&models.GroupMember{}).Where("group_id = ?", member.GroupID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= int64(limit) {
+			return ErrGroupFull
+		}
+	}
+	return insertMember(tx, member)
+}
+
+// insertMember 写入成员记录，曾被移出或退出的成员恢复其软删除的记录
+// 仍为有效成员时返回 gorm.ErrDuplicatedKey
+func insertMember(db *gorm.DB, member *models.GroupMember) error {
+	err := db.Create(member).Error
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		return err
+	}
+
+	result := db.Unscoped().Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id = ? AND deleted_at IS NOT NULL", member.GroupID, member.UserID).
+		Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"joined_at":  member.JoinedAt,
+			"is_admin":   member.IsAdmin,
+			"folder":     "",
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrDuplicatedKey
+	}
+	return nil
+}
+
+// RemoveMember 移除群组成员（管理员权限，成员可以移除自己即退出群组）
+func (s *GroupService) RemoveMember(groupID, operatorID, targetUserID uint) error {
+	// 检查群组是否存在
+	group, err := s.GetGroupByID(groupID)
+	if err != nil {
+		return err
 	}
 
 	// 不能移除群组创建者
 	if group.CreatorID == targetUserID {
-		return errors.New("不能移除群组创建者")
+		return ErrRemoveOwner
 	}
 
-	// 检查目标用户是否在群组中
-	var count int64
-	if err := s.DB.Model(&models.GroupMember{}).
-		Where("group_id = ? AND user_id = ?", groupID, targetUserID).
-		Count(&count).Error; err != nil {
+	// 检查操作者是否为群组成员
+	isMember, isAdmin, err := s.getMemberRole(groupID, operatorID)
+	if err != nil {
 		return err
 	}
+	if !isMember {
+		return ErrOperatorNotMember
+	}
 
-	if count == 0 {
-		return errors.New("用户不是群组成员")
+	// 移除他人需要创建者或管理员权限
+	if operatorID != targetUserID && !isAdmin && group.CreatorID != operatorID {
+		return ErrNoRemovePermission
+	}
+
+	// 检查目标用户是否在群组中
+	targetIsMember, _, err := s.getMemberRole(groupID, targetUserID)
+	if err != nil {
+		return err
+	}
+	if !targetIsMember {
+		return ErrTargetNotMember
 	}
 
 	// 移除成员
 	if err := s.DB.Where("group_id = ? AND user_id = ?", groupID, targetUserID).Delete(&models.GroupMember{}).Error; err != nil {
 		return err
 	}
+	s.membershipChanged(groupID, targetUserID, true)
+	s.disbandIfEmpty(groupID, operatorID)
 
 	return nil
 }
 
+// getMemberRole 获取用户在群组中的身份
+func (s *GroupService) getMemberRole(groupID, userID uint) (isMember bool, isAdmin bool, err error) {
+	var member models.GroupMember
+	err = s.DB.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	return true, member.IsAdmin, nil
+}
+
 // UpdateGroup 更新群组信息
-func (s *GroupService) UpdateGroup(id, userID uint, name, description, avatar string) (*models.Group, error) {
+func (s *GroupService) UpdateGroup(id, userID uint, req models.GroupRequest) (*models.Group, error) {
+	if err := validateGroupPolicies(req); err != nil {
+		return nil, err
+	}
+
 	// 检查群组是否存在
 	group, err := s.GetGroupByID(id)
 	if err != nil {
@@ -287,24 +661,42 @@ func (s *GroupService) UpdateGroup(id, userID uint, name, description, avatar st
 		First(&isAdmin).Error
 
 	if err != nil || !isAdmin {
-		return nil, errors.New("没有权限更新群组")
+		return nil, ErrNoUpdatePermission
 	}
 
 	// 检查群组名是否已被其他群组使用
-	if name != group.Name {
+	if req.Name != group.Name {
 		var existingGroup models.Group
-		if err := s.DB.Where("name = ? AND id != ?", name, id).First(&existingGroup).Error; err == nil {
-			return nil, errors.New("群组名已存在")
+		if err := s.DB.Where("name = ? AND id != ?", req.Name, id).First(&existingGroup).Error; err == nil {
+			return nil, ErrGroupNameExists
 		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, err
 		}
-		group.Name = name
+		group.Name = req.Name
 	}
 
 	// 更新其他信息
-	group.Description = description
-	if avatar != "" {
-		group.Avatar = avatar
+	group.Description = req.Description
+	if req.Avatar != "" {
+		group.Avatar = req.Avatar
+	}
+	group.Category = req.Category
+
+	// 更新策略（未传时保持不变）
+	if req.IsPublic != nil {
+		group.IsPublic = *req.IsPublic
+	}
+	if req.JoinPolicy != "" {
+		group.JoinPolicy = req.JoinPolicy
+	}
+	if req.PostPolicy != "" {
+		group.PostPolicy = req.PostPolicy
+	}
+	if req.HistoryVisibility != "" {
+		group.HistoryVisibility = req.HistoryVisibility
+	}
+	if req.SlowModeSeconds != nil {
+		group.SlowModeSeconds = *req.SlowModeSeconds
 	}
 	group.UpdatedAt = time.Now()
 
@@ -316,26 +708,48 @@ func (s *GroupService) UpdateGroup(id, userID uint, name, description, avatar st
 	return group, nil
 }
 
+// SetMemberFolder 将群组放入用户的个人文件夹
+func (s *GroupService) SetMemberFolder(groupID, userID uint, folder string) error {
+	result := s.DB.Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		Update("folder", folder)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// 文件夹未变化时也可能影响0行，需要区分是否为成员
+		isMember, _, err := s.getMemberRole(groupID, userID)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return ErrNotMember
+		}
+	}
+
+	// 最近聊天按文件夹分组，需要清理缓存
+	ctx := context.Background()
+	s.userService.rdb.Del(ctx, recentChatsKey(userID))
+
+	return nil
+}
+
 // JoinGroup 加入群组
 func (s *GroupService) JoinGroup(groupID, userID uint) error {
 	// 检查群组是否存在
-	if _, err := s.GetGroupByID(groupID); err != nil {
-		return err
-	}
-
-	// 检查用户是否已在群组中
-	var count int64
-	if err := s.DB.Model(&models.GroupMember{}).
-		Where("group_id = ? AND user_id = ?", groupID, userID).
-		Count(&count).Error; err != nil {
+	group, err := s.GetGroupByID(groupID)
+	if err != nil {
 		return err
 	}
 
-	if count > 0 {
-		return errors.New("已经是群组成员")
+	// 仅邀请的群组不允许主动加入
+	if group.JoinPolicy == models.JoinInviteOnly {
+		return ErrJoinInviteOnly
 	}
 
 	// 加入群组
+	// 不预先查询成员关系，由(group_id, user_id)复合主键保证唯一，
+	// 并发加入时后到的请求会得到重复键错误，按已是成员处理；成员数上限在锁定群组后检查
 	groupMember := models.GroupMember{
 		GroupID:  groupID,
 		UserID:   userID,
@@ -343,9 +757,13 @@ func (s *GroupService) JoinGroup(groupID, userID uint) error {
 		IsAdmin:  false,
 	}
 
-	if err := s.DB.Create(&groupMember).Error; err != nil {
+	if err := s.joinMember(&groupMember); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrAlreadyMember
+		}
 		return err
 	}
+	s.membershipChanged(groupID, userID, false)
 
 	return nil
 }
@@ -360,7 +778,7 @@ func (s *GroupService) LeaveGroup(groupID, userID uint) error {
 
 	// 创建者不能离开群组
 	if group.CreatorID == userID {
-		return errors.New("群组创建者不能离开群组")
+		return ErrOwnerCannotLeave
 	}
 
 	// 检查用户是否在群组中
@@ -372,13 +790,15 @@ func (s *GroupService) LeaveGroup(groupID, userID uint) error {
 	}
 
 	if count == 0 {
-		return errors.New("不是群组成员")
+		return ErrNotMember
 	}
 
 	// 离开群组
 	if err := s.DB.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupMember{}).Error; err != nil {
 		return err
 	}
+	s.membershipChanged(groupID, userID, true)
+	s.disbandIfEmpty(groupID, userID)
 
 	return nil
 }
@@ -393,31 +813,63 @@ func (s *GroupService) SetGroupAdmin(groupID, userID, targetUserID uint, isAdmin
 
 	// 只有创建者可以设置管理员
 	if group.CreatorID != userID {
-		return errors.New("没有权限设置管理员")
+		return ErrNoSetAdminPermission
 	}
 
-	// 检查目标用户是否在群组中
-	var count int64
-	if err := s.DB.Model(&models.GroupMember{}).
-		Where("group_id = ? AND user_id = ?", groupID, targetUserID).
-		Count(&count).Error; err != nil {
-		return err
+	// 创建者始终是管理员
+	if targetUserID == group.CreatorID && !isAdmin {
+		return ErrDemoteOwner
 	}
 
-	if count == 0 {
-		return errors.New("目标用户不是群组成员")
-	}
+	changed := false
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定成员记录，避免并发的角色变更互相覆盖
+		var member models.GroupMember
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("group_id = ? AND user_id = ?", groupID, targetUserID).
+			First(&member).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTargetNotMember
+			}
+			return err
+		}
 
-	// 更新管理员状态
-	if err := s.DB.Model(&models.GroupMember{}).
-		Where("group_id = ? AND user_id = ?", groupID, targetUserID).
-		Update("is_admin", isAdmin).Error; err != nil {
+		if member.IsAdmin == isAdmin {
+			return nil
+		}
+
+		// 更新管理员状态
+		if err := tx.Model(&models.GroupMember{}).
+			Where("group_id = ? AND user_id = ?", groupID, targetUserID).
+			Update("is_admin", isAdmin).Error; err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 
+	// 角色确实发生变化时通知群成员（包括被设置的用户）
+	if changed && s.publishEvent != nil {
+		event, _ := json.Marshal(models.MemberRoleChangedEvent{
+			GroupID:   groupID,
+			UserID:    targetUserID,
+			IsAdmin:   isAdmin,
+			ChangedBy: userID,
+		})
+		s.publishEvent(groupID, "member_role_changed", event)
+	}
+
 	return nil
 }
 
+// SetEventPublisher 设置群组事件发布函数
+func (s *GroupService) SetEventPublisher(publish func(groupID uint, eventType string, payload []byte)) {
+	s.publishEvent = publish
+}
+
 // DisbandGroup 解散群组
 func (s *GroupService) DisbandGroup(groupID, userID uint) error {
 	// 检查群组是否存在
@@ -428,12 +880,62 @@ func (s *GroupService) DisbandGroup(groupID, userID uint) error {
 
 	// 只有创建者可以解散群组
 	if group.CreatorID != userID {
-		return errors.New("没有权限解散群组")
+		return ErrNoDisbandPermission
 	}
 
+	return s.disband(groupID, userID)
+}
+
+// disbandIfEmpty 最后一名成员离开或被移除后自动解散群组，避免留下无人可访问的空群组
+// 创建者账号已不存在时其余成员全部离开会出现这种情况，失败只记录日志
+func (s *GroupService) disbandIfEmpty(groupID, operatorID uint) {
+	var count int64
+	if err := s.DB.Model(&models.GroupMember{}).Where("group_id = ?", groupID).Count(&count).Error; err != nil {
+		log.Printf("统计群组%d成员数失败: %v", groupID, err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+
+	if err := s.disband(groupID, operatorID); err != nil {
+		log.Printf("自动解散空群组%d失败: %v", groupID, err)
+		return
+	}
+	log.Printf("群组%d已无成员，已自动解散", groupID)
+}
+
+// disband 解散群组：按 GROUP_DISBAND_MESSAGES 处理群消息，删除成员和群组并清理缓存（调用方已检查权限）
+func (s *GroupService) disband(groupID, userID uint) error {
+	// 记录解散前的成员，用于清理缓存和通知
+	var memberIDs []uint
+	if err := s.DB.Model(&models.GroupMember{}).
+		Where("group_id = ?", groupID).
+		Pluck("user_id", &memberIDs).Error; err != nil {
+		return err
+	}
+
+	conversationID := models.GroupConversationID(groupID)
+
 	// 开启事务
 	tx := s.DB.Begin()
 
+	// 处理群消息
+	if err := purgeGroupMessages(tx, groupID, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 删除会话相关的置顶和已读记录
+	if err := tx.Where("conversation_id = ?", conversationID).Delete(&models.PinnedMessage{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("conversation_id = ?", conversationID).Delete(&models.ConversationRead{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// 删除所有群组成员
 	if err := tx.Where("group_id = ?", groupID).Delete(&models.GroupMember{}).Error; err != nil {
 		tx.Rollback()
@@ -451,14 +953,98 @@ func (s *GroupService) DisbandGroup(groupID, userID uint) error {
 		return err
 	}
 
+	// 清理缓存
+	s.clearGroupCaches(groupID, memberIDs)
+
+	if s.onDisband != nil {
+		s.onDisband(groupID, memberIDs)
+	}
+
 	return nil
 }
 
+// SetMemberRemovedHook 设置成员被移除或退出后的回调
+func (s *GroupService) SetMemberRemovedHook(hook func(groupID, userID uint)) {
+	s.onMemberRemoved = hook
+}
+
+// membershipChanged 成员关系变化后清理成员列表缓存，并在成员离开时通知回调
+// 群事件按成员列表投递，缓存不及时清理会把事件发给已离开的成员
+func (s *GroupService) membershipChanged(groupID, userID uint, removed bool) {
+	ctx := context.Background()
+	if err := s.userService.rdb.Del(ctx,
+		groupMembersKey(groupID),
+		RedisKey("user:groups:%d", userID),
+		recentChatsKey(userID),
+	).Err(); err != nil {
+		log.Printf("清理群组%d成员缓存失败: %v", groupID, err)
+	}
+
+	if removed && s.onMemberRemoved != nil {
+		s.onMemberRemoved(groupID, userID)
+	}
+}
+
+// SetDisbandHook 设置群组解散后的回调
+func (s *GroupService) SetDisbandHook(hook func(groupID uint, memberIDs []uint)) {
+	s.onDisband = hook
+}
+
+// purgeGroupMessages 按配置处理被解散群组的消息
+func purgeGroupMessages(tx *gorm.DB, groupID, operatorID uint) error {
+	switch config.AppConfig.GroupDisbandMessages {
+	case disbandKeepMessages:
+		return nil
+	case disbandPurgeMessages:
+		// 先删除表情回应，再删除消息本身
+		if err := tx.Where("message_id IN (?)", tx.Model(&models.Message{}).Select("id").Where("group_id = ?", groupID)).
+			Delete(&models.MessageReaction{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("group_id = ?", groupID).Delete(&models.Message{}).Error
+	default:
+		return tx.Model(&models.Message{}).
+			Where("group_id = ? AND deleted_at IS NULL", groupID).
+			Updates(map[string]interface{}{
+				"deleted_at": time.Now(),
+				"deleted_by": operatorID,
+			}).Error
+	}
+}
+
+// clearGroupCaches 清理群组相关的缓存键
+func (s *GroupService) clearGroupCaches(groupID uint, memberIDs []uint) {
+	ctx := context.Background()
+	conversationID := models.GroupConversationID(groupID)
+
+	keys := []string{
+		recentMessagesKey(conversationID),
+		RedisKey("typing:%s", conversationID),
+		groupMembersKey(groupID),
+		groupActivityKey(groupID),
+	}
+	for _, memberID := range memberIDs {
+		keys = append(keys,
+			recentChatsKey(memberID),
+			lastReadKey(memberID, conversationID),
+			mentionUnreadKey(memberID, groupID),
+		)
+	}
+
+	if err := s.userService.rdb.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("清理群组%d缓存失败: %v", groupID, err)
+	}
+}
+
 // GetGroupMembers 获取群组成员
 func (s *GroupService) GetGroupMembers(groupID uint) ([]models.UserResponse, error) {
+	if _, err := s.GetGroupByID(groupID); err != nil {
+		return nil, err
+	}
+
 	var members []models.User
 	if err := s.DB.Table("users").
-		Joins("JOIN group_members ON users.id = group_members.user_id").
+		Joins("JOIN group_members ON users.id = group_members.user_id AND group_members.deleted_at IS NULL").
 		Where("group_members.group_id = ?", groupID).
 		Find(&members).Error; err != nil {
 		return nil, err
@@ -469,7 +1055,7 @@ func (s *GroupService) GetGroupMembers(groupID uint) ([]models.UserResponse, err
 	var admins []struct {
 		UserID uint
 	}
-	if err := s.DB.Table("group_members").
+	if err := s.DB.Model(&models.GroupMember{}).
 		Select("user_id").
 		Where("group_id = ? AND is_admin = ?", groupID, true).
 		Find(&admins).Error; err != nil {
@@ -487,7 +1073,7 @@ func (s *GroupService) GetGroupMembers(groupID uint) ([]models.UserResponse, err
 			ID:       member.ID,
 			Username: member.Username,
 			Email:    member.Email,
-			Avatar:   member.Avatar,
+			Avatar:   AssetURL(member.Avatar),
 			Online:   s.userService.IsUserOnline(member.ID),
 		}
 	}
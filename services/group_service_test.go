@@ -0,0 +1,643 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+func TestGroupMemberPermissions(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser(t, "owner")
+	admin := env.createUser(t, "admin")
+	member := env.createUser(t, "member")
+	newcomer := env.createUser(t, "newcomer")
+	outsider := env.createUser(t, "outsider")
+	group := env.createGroup(t, "g", owner, admin, member)
+	if err := env.groups.SetGroupAdmin(group.ID, owner.ID, admin.ID, true); err != nil {
+		t.Fatalf("设置管理员失败: %v", err)
+	}
+
+	// 普通成员和非成员不能添加成员
+	if err := env.groups.AddMember(group.ID, member.ID, newcomer.ID); !errors.Is(err, ErrNoAddPermission) {
+		t.Fatalf("普通成员添加成员 = %v，期望 ErrNoAddPermission", err)
+	}
+	if err := env.groups.AddMember(group.ID, outsider.ID, newcomer.ID); !errors.Is(err, ErrOperatorNotMember) {
+		t.Fatalf("非成员添加成员 = %v，期望 ErrOperatorNotMember", err)
+	}
+
+	// 管理员可以添加成员，重复添加返回已是成员
+	if err := env.groups.AddMember(group.ID, admin.ID, newcomer.ID); err != nil {
+		t.Fatalf("管理员添加成员失败: %v", err)
+	}
+	if err := env.groups.AddMember(group.ID, owner.ID, newcomer.ID); !errors.Is(err, ErrAlreadyMember) {
+		t.Fatalf("重复添加 = %v，期望 ErrAlreadyMember", err)
+	}
+
+	// 普通成员不能移除他人，任何人不能移除创建者
+	if err := env.groups.RemoveMember(group.ID, member.ID, newcomer.ID); !errors.Is(err, ErrNoRemovePermission) {
+		t.Fatalf("普通成员移除他人 = %v，期望 ErrNoRemovePermission", err)
+	}
+	if err := env.groups.RemoveMember(group.ID, admin.ID, owner.ID); !errors.Is(err, ErrRemoveOwner) {
+		t.Fatalf("移除创建者 = %v，期望 ErrRemoveOwner", err)
+	}
+	if err := env.groups.RemoveMember(group.ID, outsider.ID, member.ID); !errors.Is(err, ErrOperatorNotMember) {
+		t.Fatalf("非成员移除成员 = %v，期望 ErrOperatorNotMember", err)
+	}
+
+	// 成员可以移除自己（退出群组）
+	if err := env.groups.RemoveMember(group.ID, member.ID, member.ID); err != nil {
+		t.Fatalf("成员退出失败: %v", err)
+	}
+	if err := env.groups.RemoveMember(group.ID, admin.ID, member.ID); !errors.Is(err, ErrTargetNotMember) {
+		t.Fatalf("移除已退出的成员 = %v，期望 ErrTargetNotMember", err)
+	}
+
+	// 管理员可以移除普通成员，退出的成员可以被重新添加
+	if err := env.groups.RemoveMember(group.ID, admin.ID, newcomer.ID); err != nil {
+		t.Fatalf("管理员移除成员失败: %v", err)
+	}
+	if err := env.groups.AddMember(group.ID, owner.ID, member.ID); err != nil {
+		t.Fatalf("重新添加退出的成员失败: %v", err)
+	}
+}
+
+func TestGroupCategoryAndFolders(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	work, err := env.groups.CreateGroup(alice.ID, models.GroupRequest{Name: "work", Category: "work"})
+	if err != nil {
+		t.Fatalf("创建群组失败: %v", err)
+	}
+	games, err := env.groups.CreateGroup(alice.ID, models.GroupRequest{Name: "games", Category: "gaming"})
+	if err != nil {
+		t.Fatalf("创建群组失败: %v", err)
+	}
+	for _, g := range []*models.Group{work, games} {
+		if err := env.groups.AddMember(g.ID, alice.ID, bob.ID); err != nil {
+			t.Fatalf("添加成员失败: %v", err)
+		}
+		env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: g.ID, Content: "hi"})
+	}
+	env.seedGroupActivity(t, work.ID, games.ID)
+
+	groupIDs := func(groups []models.GroupResponse) []uint {
+		ids := make([]uint, len(groups))
+		for i, g := range groups {
+			ids[i] = g.ID
+		}
+		return ids
+	}
+
+	// 按群组分类过滤
+	groups, err := env.groups.GetUserGroups(bob.ID, "work", "")
+	if err != nil {
+		t.Fatalf("获取群组失败: %v", err)
+	}
+	if ids := groupIDs(groups); len(ids) != 1 || ids[0] != work.ID || groups[0].Category != "work" {
+		t.Fatalf("work 分类的群组 = %+v", groups)
+	}
+	if groups, _ := env.groups.GetUserGroups(bob.ID, "", ""); len(groups) != 2 {
+		t.Fatalf("不过滤时群组数 = %d，期望 2", len(groups))
+	}
+
+	// 只有管理员能修改群组分类
+	if _, err := env.groups.UpdateGroup(games.ID, bob.ID, models.GroupRequest{Name: "games", Category: "friends"}); !errors.Is(err, ErrNoUpdatePermission) {
+		t.Fatalf("普通成员修改分类 = %v，期望 ErrNoUpdatePermission", err)
+	}
+
+	// 个人文件夹只影响自己
+	if _, err := env.messages.GetRecentChats(ctx, bob.ID); err != nil {
+		t.Fatalf("获取最近聊天失败: %v", err)
+	}
+	if err := env.groups.SetMemberFolder(games.ID, bob.ID, "weekend"); err != nil {
+		t.Fatalf("设置个人文件夹失败: %v", err)
+	}
+	groups, err = env.groups.GetUserGroups(bob.ID, "", "weekend")
+	if err != nil {
+		t.Fatalf("获取群组失败: %v", err)
+	}
+	if ids := groupIDs(groups); len(ids) != 1 || ids[0] != games.ID || groups[0].Folder != "weekend" {
+		t.Fatalf("weekend 文件夹的群组 = %+v", groups)
+	}
+	if groups, _ := env.groups.GetUserGroups(alice.ID, "", "weekend"); len(groups) != 0 {
+		t.Fatalf("其他成员不应看到个人文件夹: %+v", groups)
+	}
+
+	// 最近聊天中个人文件夹优先于群组分类，设置后缓存已失效
+	folders := func(userID uint) map[uint]string {
+		chats, err := env.messages.GetRecentChats(ctx, userID)
+		if err != nil {
+			t.Fatalf("获取最近聊天失败: %v", err)
+		}
+		got := make(map[uint]string)
+		for _, chat := range chats {
+			got[chat.TargetID] = chat.Folder
+		}
+		return got
+	}
+	if got := folders(bob.ID); got[work.ID] != "work" || got[games.ID] != "weekend" {
+		t.Fatalf("bob 的会话文件夹 = %v", got)
+	}
+	if got := folders(alice.ID); got[games.ID] != "gaming" {
+		t.Fatalf("alice 的会话文件夹 = %v", got)
+	}
+
+	// 清空个人文件夹后回到群组分类
+	if err := env.groups.SetMemberFolder(games.ID, bob.ID, ""); err != nil {
+		t.Fatalf("清空个人文件夹失败: %v", err)
+	}
+	if got := folders(bob.ID); got[games.ID] != "gaming" {
+		t.Fatalf("清空后 bob 的会话文件夹 = %v", got)
+	}
+
+	outsider := env.createUser(t, "outsider")
+	if err := env.groups.SetMemberFolder(games.ID, outsider.ID, "x"); !errors.Is(err, ErrNotMember) {
+		t.Fatalf("非成员设置文件夹 = %v，期望 ErrNotMember", err)
+	}
+}
+
+func TestUpdateGroupPolicies(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser(t, "owner")
+	admin := env.createUser(t, "admin")
+	member := env.createUser(t, "member")
+	group := env.createGroup(t, "g", owner, admin, member)
+	if err := env.groups.SetGroupAdmin(group.ID, owner.ID, admin.ID, true); err != nil {
+		t.Fatalf("设置管理员失败: %v", err)
+	}
+
+	private := false
+	req := models.GroupRequest{
+		Name:       "g",
+		Category:   "work",
+		IsPublic:   &private,
+		JoinPolicy: models.JoinInviteOnly,
+		PostPolicy: models.PostAdminsOnly,
+	}
+
+	// 普通成员不能修改策略
+	if _, err := env.groups.UpdateGroup(group.ID, member.ID, req); !errors.Is(err, ErrNoUpdatePermission) {
+		t.Fatalf("普通成员修改策略 = %v，期望 ErrNoUpdatePermission", err)
+	}
+
+	// 无效的枚举值被拒绝，且不修改群组
+	invalid := []struct {
+		req  models.GroupRequest
+		want error
+	}{
+		{models.GroupRequest{Name: "g", JoinPolicy: "anyone"}, ErrInvalidJoinPolicy},
+		{models.GroupRequest{Name: "g", PostPolicy: "nobody"}, ErrInvalidPostPolicy},
+		{models.GroupRequest{Name: "g", HistoryVisibility: "forever"}, ErrInvalidHistoryVisibility},
+	}
+	for _, tt := range invalid {
+		if _, err := env.groups.UpdateGroup(group.ID, owner.ID, tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("UpdateGroup(%+v) = %v，期望 %v", tt.req, err, tt.want)
+		}
+	}
+
+	// 管理员可以修改策略，响应反映新的策略
+	if _, err := env.groups.UpdateGroup(group.ID, admin.ID, req); err != nil {
+		t.Fatalf("管理员修改策略失败: %v", err)
+	}
+	env.seedGroupActivity(t, group.ID)
+	resp, err := env.groups.GetGroupResponse(group.ID, false)
+	if err != nil {
+		t.Fatalf("获取群组失败: %v", err)
+	}
+	if resp.IsPublic || resp.JoinPolicy != models.JoinInviteOnly || resp.PostPolicy != models.PostAdminsOnly || resp.Category != "work" {
+		t.Fatalf("更新后的群组 = %+v", resp)
+	}
+
+	// 未传的策略保持不变
+	if _, err := env.groups.UpdateGroup(group.ID, owner.ID, models.GroupRequest{Name: "g", Category: "work"}); err != nil {
+		t.Fatalf("更新群组失败: %v", err)
+	}
+	if resp, _ := env.groups.GetGroupResponse(group.ID, false); resp.IsPublic || resp.JoinPolicy != models.JoinInviteOnly || resp.PostPolicy != models.PostAdminsOnly {
+		t.Fatalf("未传策略时被修改: %+v", resp)
+	}
+}
+
+func TestSetGroupAdminNotifiesMembers(t *testing.T) {
+	env := newTestEnv(t)
+	delivered := recordDeliveries(env.messages)
+	env.groups.SetEventPublisher(env.messages.PublishGroupEvent)
+	owner := env.createUser(t, "owner")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	outsider := env.createUser(t, "outsider")
+	group := env.createGroup(t, "g", owner, bob, carol)
+
+	roleEvents := func() map[uint]models.MemberRoleChangedEvent {
+		events := make(map[uint]models.MemberRoleChangedEvent)
+		for _, d := range delivered() {
+			if d.event.Type != "member_role_changed" {
+				continue
+			}
+			var event models.MemberRoleChangedEvent
+			if err := json.Unmarshal(d.event.Content, &event); err != nil {
+				t.Fatalf("解析角色变更事件失败: %v", err)
+			}
+			events[d.userID] = event
+		}
+		return events
+	}
+
+	if err := env.groups.SetGroupAdmin(group.ID, owner.ID, bob.ID, true); err != nil {
+		t.Fatalf("设置管理员失败: %v", err)
+	}
+	events := roleEvents()
+	want := models.MemberRoleChangedEvent{GroupID: group.ID, UserID: bob.ID, IsAdmin: true, ChangedBy: owner.ID}
+	if events[bob.ID] != want {
+		t.Fatalf("被设置的用户收到的事件 = %+v，期望 %+v", events[bob.ID], want)
+	}
+	if _, ok := events[carol.ID]; !ok {
+		t.Fatal("其他成员未收到角色变更事件")
+	}
+
+	// 角色未变化时不重复通知
+	count := len(delivered())
+	if err := env.groups.SetGroupAdmin(group.ID, owner.ID, bob.ID, true); err != nil {
+		t.Fatalf("重复设置管理员失败: %v", err)
+	}
+	if len(delivered()) != count {
+		t.Fatal("角色未变化时不应发送事件")
+	}
+
+	// 不能降级群主，只有群主可以设置管理员，目标必须是成员
+	if err := env.groups.SetGroupAdmin(group.ID, owner.ID, owner.ID, false); !errors.Is(err, ErrDemoteOwner) {
+		t.Fatalf("降级群主 = %v，期望 ErrDemoteOwner", err)
+	}
+	if err := env.groups.SetGroupAdmin(group.ID, bob.ID, carol.ID, true); !errors.Is(err, ErrNoSetAdminPermission) {
+		t.Fatalf("管理员设置管理员 = %v，期望 ErrNoSetAdminPermission", err)
+	}
+	if err := env.groups.SetGroupAdmin(group.ID, owner.ID, outsider.ID, true); !errors.Is(err, ErrTargetNotMember) {
+		t.Fatalf("设置非成员为管理员 = %v，期望 ErrTargetNotMember", err)
+	}
+	if _, isAdmin, _ := env.groups.getMemberRole(group.ID, owner.ID); !isAdmin {
+		t.Fatal("群主的管理员状态被修改")
+	}
+}
+
+func TestAddMembersBatch(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser(t, "owner")
+	member := env.createUser(t, "member")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", owner, member)
+
+	results, err := env.groups.AddMembers(group.ID, owner.ID, []uint{bob.ID, member.ID, 9999, carol.ID, bob.ID})
+	if err != nil {
+		t.Fatalf("批量添加失败: %v", err)
+	}
+	want := map[uint]models.AddMemberResult{
+		bob.ID:    models.AddMemberAdded,
+		member.ID: models.AddMemberAlreadyMember,
+		9999:      models.AddMemberNotFound,
+		carol.ID:  models.AddMemberAdded,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("批量添加结果 = %v，期望 %v", results, want)
+	}
+	for userID, result := range want {
+		if results[userID] != result {
+			t.Errorf("用户 %d 的结果 = %q，期望 %q", userID, results[userID], result)
+		}
+	}
+	// 部分失败不影响其他用户加入
+	for _, user := range []*models.User{bob, carol} {
+		if isMember, _, _ := env.groups.getMemberRole(group.ID, user.ID); !isMember {
+			t.Fatalf("用户 %s 未加入群组", user.Username)
+		}
+	}
+
+	// 没有权限时每个用户都标记为 unauthorized
+	dave := env.createUser(t, "dave")
+	results, err = env.groups.AddMembers(group.ID, member.ID, []uint{dave.ID})
+	if err != nil {
+		t.Fatalf("批量添加失败: %v", err)
+	}
+	if results[dave.ID] != models.AddMemberUnauthorized {
+		t.Fatalf("无权限批量添加结果 = %v", results)
+	}
+	if isMember, _, _ := env.groups.getMemberRole(group.ID, dave.ID); isMember {
+		t.Fatal("无权限时不应添加成员")
+	}
+
+	if _, err := env.groups.AddMembers(9999, owner.ID, []uint{dave.ID}); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("群组不存在 = %v，期望 ErrGroupNotFound", err)
+	}
+}
+
+func TestConcurrentJoinGroup(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser(t, "owner")
+	bob := env.createUser(t, "bob")
+	group := env.createGroup(t, "g", owner)
+
+	const n = 10
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- env.groups.JoinGroup(group.ID, bob.ID)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// 只有一个请求成功，其余都按已是成员处理
+	joined := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			joined++
+		case errors.Is(err, ErrAlreadyMember):
+		default:
+			t.Fatalf("并发加入返回意外错误: %v", err)
+		}
+	}
+	if joined != 1 {
+		t.Fatalf("成功加入 %d 次，期望 1 次", joined)
+	}
+	var count int64
+	env.db.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", group.ID, bob.ID).Count(&count)
+	if count != 1 {
+		t.Fatalf("成员记录数 = %d，期望 1", count)
+	}
+
+	// 绕过预检查直接写入时由复合主键拒绝重复
+	err := insertMember(env.db, &models.GroupMember{GroupID: group.ID, UserID: bob.ID, JoinedAt: time.Now()})
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("重复写入成员 = %v，期望 gorm.ErrDuplicatedKey", err)
+	}
+}
+
+func TestRemovedMemberSoftDeleted(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser(t, "owner")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", owner, bob, carol)
+	env.seedGroupActivity(t, group.ID)
+	if group.CreatedAt.IsZero() || group.UpdatedAt.IsZero() {
+		t.Fatalf("群组时间戳未自动填充: %+v", group)
+	}
+	if err := env.groups.SetMemberFolder(group.ID, bob.ID, "work"); err != nil {
+		t.Fatalf("设置个人文件夹失败: %v", err)
+	}
+
+	if err := env.groups.RemoveMember(group.ID, owner.ID, bob.ID); err != nil {
+		t.Fatalf("移除成员失败: %v", err)
+	}
+
+	// 成员记录保留并标记删除时间
+	var removed models.GroupMember
+	if err := env.db.Unscoped().Where("group_id = ? AND user_id = ?", group.ID, bob.ID).First(&removed).Error; err != nil {
+		t.Fatalf("移除后成员记录应保留: %v", err)
+	}
+	if !removed.DeletedAt.Valid {
+		t.Fatal("移除后成员记录未标记删除")
+	}
+
+	// 成员列表和群组列表都不包含已移除的成员
+	members, err := env.groups.GetGroupMembers(group.ID)
+	if err != nil {
+		t.Fatalf("获取成员列表失败: %v", err)
+	}
+	for _, member := range members {
+		if member.ID == bob.ID {
+			t.Fatalf("成员列表包含已移除的成员: %+v", members)
+		}
+	}
+	if len(members) != 2 {
+		t.Fatalf("成员数 = %d，期望 2", len(members))
+	}
+	resp, err := env.groups.GetGroupResponse(group.ID, true)
+	if err != nil {
+		t.Fatalf("获取群组失败: %v", err)
+	}
+	if len(resp.Members) != 2 {
+		t.Fatalf("群组详情成员数 = %d，期望 2", len(resp.Members))
+	}
+	if groups, _ := env.groups.GetUserGroups(bob.ID, "", ""); len(groups) != 0 {
+		t.Fatalf("已移除成员的群组列表 = %+v，期望为空", groups)
+	}
+	if isMember, _, _ := env.groups.getMemberRole(group.ID, bob.ID); isMember {
+		t.Fatal("已移除的用户仍被视为成员")
+	}
+
+	// 重新加入时恢复原记录，个人设置不保留
+	if err := env.groups.JoinGroup(group.ID, bob.ID); err != nil {
+		t.Fatalf("重新加入失败: %v", err)
+	}
+	var rejoined models.GroupMember
+	if err := env.db.Where("group_id = ? AND user_id = ?", group.ID, bob.ID).First(&rejoined).Error; err != nil {
+		t.Fatalf("重新加入后成员记录 = %v", err)
+	}
+	if rejoined.Folder != "" || rejoined.IsAdmin {
+		t.Fatalf("重新加入后成员记录 = %+v，期望重置个人设置", rejoined)
+	}
+	var count int64
+	env.db.Unscoped().Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", group.ID, bob.ID).Count(&count)
+	if count != 1 {
+		t.Fatalf("成员记录数 = %d，期望 1", count)
+	}
+}
+
+func TestCreateGroupWelcomeMessage(t *testing.T) {
+	old := config.AppConfig.GroupWelcomeMessage
+	t.Cleanup(func() { config.AppConfig.GroupWelcomeMessage = old })
+	env := newTestEnv(t)
+	owner := env.createUser(t, "owner")
+
+	groupMessages := func(groupID uint) []models.Message {
+		t.Helper()
+		var messages []models.Message
+		if err := env.db.Where("group_id = ?", groupID).Find(&messages).Error; err != nil {
+			t.Fatalf("查询群消息失败: %v", err)
+		}
+		return messages
+	}
+
+	config.AppConfig.GroupWelcomeMessage = "Welcome to {group}!"
+	group, err := env.groups.CreateGroup(owner.ID, models.GroupRequest{Name: "gophers"})
+	if err != nil {
+		t.Fatalf("创建群组失败: %v", err)
+	}
+	messages := groupMessages(group.ID)
+	if len(messages) != 1 || messages[0].Type != models.SystemMessage || messages[0].Content != "Welcome to gophers!" {
+		t.Fatalf("新群组的消息 = %+v，期望一条欢迎系统消息", messages)
+	}
+	// 欢迎消息不计入未读
+	if got := env.messages.getUnreadCount(owner.ID, group.ID, true); got != 0 {
+		t.Fatalf("欢迎消息未读数 = %d，期望 0", got)
+	}
+
+	config.AppConfig.GroupWelcomeMessage = ""
+	group, err = env.groups.CreateGroup(owner.ID, models.GroupRequest{Name: "quiet"})
+	if err != nil {
+		t.Fatalf("创建群组失败: %v", err)
+	}
+	if messages := groupMessages(group.ID); len(messages) != 0 {
+		t.Fatalf("关闭欢迎消息后新群组的消息 = %+v，期望为空", messages)
+	}
+}
+
+func TestGroupMessageCountCached(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	group := env.createGroup(t, "g", alice, bob)
+	env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Content: "one"})
+	env.createMessage(t, models.Message{SenderID: bob.ID, GroupID: group.ID, Content: "two"})
+	env.seedGroupActivity(t, group.ID)
+
+	response, err := env.groups.GetGroupResponse(group.ID, false)
+	if err != nil {
+		t.Fatalf("获取群组失败: %v", err)
+	}
+	if response.MessageCount != 2 || response.LastMessageAt == nil {
+		t.Fatalf("发送前 message_count = %d, last_message_at = %v，期望 2 和非空", response.MessageCount, response.LastMessageAt)
+	}
+
+	msg := &models.Message{SenderID: bob.ID, GroupID: group.ID, Type: models.GroupMessage, Content: "three"}
+	if err := env.messages.ProcessMessage(msg); err != nil {
+		t.Fatalf("发送消息失败: %v", err)
+	}
+
+	// 新消息累加缓存中的计数，读取时不再统计消息表
+	queries := countTableQueries(t, env.db, "messages")
+	response, err = env.groups.GetGroupResponse(group.ID, false)
+	if err != nil {
+		t.Fatalf("获取群组失败: %v", err)
+	}
+	if response.MessageCount != 3 || response.LastMessageAt == nil || !response.LastMessageAt.Equal(msg.CreatedAt) {
+		t.Fatalf("发送后 message_count = %d, last_message_at = %v，期望 3 和 %v", response.MessageCount, response.LastMessageAt, msg.CreatedAt)
+	}
+	groups, err := env.groups.GetUserGroups(alice.ID, "", "")
+	if err != nil {
+		t.Fatalf("获取群组列表失败: %v", err)
+	}
+	if len(groups) != 1 || groups[0].MessageCount != 3 {
+		t.Fatalf("群组列表 = %+v，期望 message_count 为 3", groups)
+	}
+	if got := atomic.LoadInt64(queries); got != 0 {
+		t.Fatalf("命中缓存时查询消息表 %d 次，期望 0", got)
+	}
+
+	// 撤回后缓存失效，下次读取时重新统计
+	if _, err := env.messages.RecallMessage(msg.ID, bob.ID); err != nil {
+		t.Fatalf("撤回消息失败: %v", err)
+	}
+	if exists, _ := env.rdb.Exists(context.Background(), groupActivityKey(group.ID)).Result(); exists != 0 {
+		t.Fatal("撤回后群组活跃度缓存应被清除")
+	}
+}
+
+func TestGroupResponseIncludesCreator(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	owner := env.createUser(t, "owner")
+	member := env.createUser(t, "member")
+	group := env.createGroup(t, "g", owner, member)
+	env.db.Model(&models.User{}).Where("id = ?", owner.ID).Update("avatar", "https://cdn/owner.png")
+	env.rdb.SAdd(ctx, onlineUsersKey(), fmt.Sprint(owner.ID))
+
+	check := func(name string, creator *models.UserResponse) {
+		t.Helper()
+		if creator == nil || creator.ID != owner.ID || creator.Username != "owner" ||
+			creator.Avatar != "https://cdn/owner.png" || !creator.Online {
+			t.Fatalf("%s 创建者 = %+v", name, creator)
+		}
+	}
+	for _, includeMembers := range []bool{false, true} {
+		response, err := env.groups.GetGroupResponse(group.ID, includeMembers)
+		if err != nil {
+			t.Fatalf("获取群组失败: %v", err)
+		}
+		check(fmt.Sprintf("GetGroupResponse(%v)", includeMembers), response.Creator)
+	}
+	groups, err := env.groups.GetUserGroups(member.ID, "", "")
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("获取群组列表 = %+v, %v", groups, err)
+	}
+	check("GetUserGroups", groups[0].Creator)
+
+	// 创建者账号已不存在时留空
+	env.db.Unscoped().Delete(&models.User{}, owner.ID)
+	env.rdb.Del(ctx, userCacheKey(owner.ID))
+	response, err := env.groups.GetGroupResponse(group.ID, false)
+	if err != nil {
+		t.Fatalf("创建者不存在时获取群组失败: %v", err)
+	}
+	if response.Creator != nil {
+		t.Fatalf("创建者不存在时 creator = %+v，期望为空", response.Creator)
+	}
+	if groups, err := env.groups.GetUserGroups(member.ID, "", ""); err != nil || groups[0].Creator != nil {
+		t.Fatalf("创建者不存在时群组列表 = %+v, %v", groups, err)
+	}
+}
+
+func TestLastMemberLeavingDisbandsGroup(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	owner := env.createUser(t, "owner")
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	group := env.createGroup(t, "g", owner, alice, bob)
+	var disbanded []uint
+	env.groups.SetDisbandHook(func(groupID uint, _ []uint) { disbanded = append(disbanded, groupID) })
+
+	// 有创建者的群组不会变空：创建者不能退出
+	if err := env.groups.LeaveGroup(group.ID, owner.ID); !errors.Is(err, ErrOwnerCannotLeave) {
+		t.Fatalf("创建者退出 = %v，期望 ErrOwnerCannotLeave", err)
+	}
+
+	// 创建者账号被删除后，其余成员依次离开
+	env.db.Where("group_id = ? AND user_id = ?", group.ID, owner.ID).Delete(&models.GroupMember{})
+	env.db.Delete(owner)
+	if err := env.groups.LeaveGroup(group.ID, alice.ID); err != nil {
+		t.Fatalf("alice 退出失败: %v", err)
+	}
+	if _, err := env.groups.GetGroupByID(group.ID); err != nil {
+		t.Fatalf("仍有成员时群组不应解散: %v", err)
+	}
+	if _, err := env.groups.GetGroupMembers(group.ID); err != nil {
+		t.Fatalf("获取成员失败: %v", err)
+	}
+
+	if err := env.groups.LeaveGroup(group.ID, bob.ID); err != nil {
+		t.Fatalf("bob 退出失败: %v", err)
+	}
+	if _, err := env.groups.GetGroupByID(group.ID); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("最后一名成员离开后获取群组 = %v，期望 ErrGroupNotFound", err)
+	}
+	if len(disbanded) != 1 || disbanded[0] != group.ID {
+		t.Fatalf("解散回调 = %v，期望 [%d]", disbanded, group.ID)
+	}
+	if exists, _ := env.rdb.Exists(ctx, groupMembersKey(group.ID)).Result(); exists != 0 {
+		t.Fatal("解散后成员列表缓存未清理")
+	}
+	var members int64
+	env.db.Model(&models.GroupMember{}).Where("group_id = ?", group.ID).Count(&members)
+	if members != 0 {
+		t.Fatalf("解散后成员记录 = %d，期望 0", members)
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/models"
+)
+
+// ErrNoWatchwordPermission 只有群管理员可以管理关键词和查看提醒
+var ErrNoWatchwordPermission = errors.New("没有权限管理群组关键词")
+
+// checkWatchwordPermission 检查用户是否为群组管理员
+func (s *GroupService) checkWatchwordPermission(groupID, userID uint) error {
+	if _, err := s.GetGroupByID(groupID); err != nil {
+		return err
+	}
+	_, isAdmin, err := s.getMemberRole(groupID, userID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return ErrNoWatchwordPermission
+	}
+	return nil
+}
+
+// GetWatchwords 获取群组关键词（仅管理员）
+func (s *GroupService) GetWatchwords(groupID, userID uint) ([]string, error) {
+	if err := s.checkWatchwordPermission(groupID, userID); err != nil {
+		return nil, err
+	}
+
+	words := []string{}
+	if err := s.DB.Model(&models.GroupWatchword{}).
+		Where("group_id = ?", groupID).
+		Order("word").
+		Pluck("word", &words).Error; err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// SetWatchwords 整体替换群组关键词（仅管理员），匹配时不区分大小写
+// 其他节点缓存的匹配器最多在 watchwordCacheTTL 后生效
+func (s *GroupService) SetWatchwords(groupID, userID uint, words []string) ([]string, error) {
+	if err := s.checkWatchwordPermission(groupID, userID); err != nil {
+		return nil, err
+	}
+
+	// 统一小写并去重
+	seen := make(map[string]bool, len(words))
+	normalized := []string{}
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" || seen[word] {
+			continue
+		}
+		seen[word] = true
+		normalized = append(normalized, word)
+	}
+
+	now := time.Now()
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", groupID).Delete(&models.GroupWatchword{}).Error; err != nil {
+			return err
+		}
+		if len(normalized) == 0 {
+			return nil
+		}
+		rows := make([]models.GroupWatchword, 0, len(normalized))
+		for _, word := range normalized {
+			rows = append(rows, models.GroupWatchword{
+				GroupID:   groupID,
+				Word:      word,
+				CreatedBy: userID,
+				CreatedAt: now,
+			})
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// GetKeywordAlerts 获取群组的关键词提醒记录（仅管理员）
+func (s *GroupService) GetKeywordAlerts(groupID, userID uint, limit, offset int) ([]models.KeywordAlert, error) {
+	if err := s.checkWatchwordPermission(groupID, userID); err != nil {
+		return nil, err
+	}
+
+	alerts := []models.KeywordAlert{}
+	if err := s.DB.Where("group_id = ?", groupID).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
@@ -0,0 +1,435 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/alicebob/miniredis/v2"
+	sqlitedriver "github.com/glebarez/go-sqlite"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+func TestMain(m *testing.M) {
+	config.LoadConfig()
+	// sqlite 没有 MySQL 的 CHAR_LENGTH，注册一个按字符计数的同名函数
+	sqlitedriver.MustRegisterDeterministicScalarFunction("CHAR_LENGTH", 1, func(_ *sqlitedriver.FunctionContext, args []driver.Value) (driver.Value, error) {
+		switch v := args[0].(type) {
+		case string:
+			return int64(utf8.RuneCountInString(v)), nil
+		case []byte:
+			return int64(utf8.RuneCount(v)), nil
+		}
+		return nil, nil
+	})
+	os.Exit(m.Run())
+}
+
+var testDBSeq int64
+
+// newTestDB 创建迁移好全部表结构的内存SQLite数据库，每个测试独立
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:testdb%d?mode=memory&cache=shared&_pragma=foreign_keys(0)", atomic.AddInt64(&testDBSeq, 1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Message{}, &models.Group{}, &models.GroupMember{}, &models.NotificationPrefs{}, &models.ConversationRead{}, &models.PinnedMessage{}, &models.MessageReaction{}, &models.OutboxMessage{}, &models.Session{}, &models.GroupWatchword{}, &models.KeywordAlert{}, &models.Report{}, &models.ConversationClear{}, &models.GroupInvite{}, &models.EmailDigest{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// newTestRedis 创建连接到内存Redis的客户端，可通过返回的 miniredis 快进时间
+func newTestRedis(t testing.TB) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb, mr
+}
+
+// newTestKafka 创建使用模拟同步生产者的Kafka服务，topics 为视为已存在的主题
+func newTestKafka(producer *mocks.SyncProducer, topics ...string) *KafkaService {
+	k := &KafkaService{
+		producer:     producer,
+		available:    1,
+		reconnectCh:  make(chan struct{}, 1),
+		topics:       make(map[string]bool),
+		handlers:     make(map[string]MessageHandler),
+		consumers:    make(map[string]context.CancelFunc),
+		controls:     make(map[string]*topicControl),
+		lags:         make(map[string]int64),
+		recentErrors: newKafkaErrorRing(10),
+		metrics:      &KafkaMetrics{},
+		retryChan:    make(chan *sarama.ProducerMessage, 10),
+		ctx:          context.Background(),
+		consumer:     fakeConsumerGroup{},
+	}
+	for _, topic := range topics {
+		k.topics[topic] = true
+	}
+	return k
+}
+
+// fakeConsumerGroup 不接收任何消息的消费者组，Consume 阻塞到订阅被取消
+type fakeConsumerGroup struct{}
+
+func (fakeConsumerGroup) Consume(ctx context.Context, _ []string, _ sarama.ConsumerGroupHandler) error {
+	<-ctx.Done()
+	return nil
+}
+func (fakeConsumerGroup) Errors() <-chan error      { return nil }
+func (fakeConsumerGroup) Close() error              { return nil }
+func (fakeConsumerGroup) Pause(map[string][]int32)  {}
+func (fakeConsumerGroup) Resume(map[string][]int32) {}
+func (fakeConsumerGroup) PauseAll()                 {}
+func (fakeConsumerGroup) ResumeAll()                {}
+
+// withEncryptionKey 在测试期间开启私聊消息加密，需在创建服务前调用
+func withEncryptionKey(t *testing.T) {
+	t.Helper()
+	old := config.AppConfig.MessageEncryptionKey
+	config.AppConfig.MessageEncryptionKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	t.Cleanup(func() { config.AppConfig.MessageEncryptionKey = old })
+}
+
+// testEnv 测试用的数据库、Redis和服务
+type testEnv struct {
+	db       *gorm.DB
+	rdb      *redis.Client
+	mr       *miniredis.Miniredis
+	users    *UserService
+	messages *MessageService
+	groups   *GroupService
+}
+
+// newTestEnv 创建不连接Kafka的服务集合
+func newTestEnv(t testing.TB) *testEnv {
+	t.Helper()
+	db := newTestDB(t)
+	rdb, mr := newTestRedis(t)
+	users := NewUserService(db, rdb)
+	messages := NewMessageService(db, rdb, users, nil)
+	return &testEnv{
+		db:       db,
+		rdb:      rdb,
+		mr:       mr,
+		users:    users,
+		messages: messages,
+		groups:   NewGroupService(db, users),
+	}
+}
+
+// createUser 直接写入一个测试用户
+func (e *testEnv) createUser(t testing.TB, username string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, Password: "x", Email: username + "@example.com"}
+	if err := e.db.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	return user
+}
+
+// createGroup 直接写入一个群组，creator 同时成为成员
+func (e *testEnv) createGroup(t testing.TB, name string, creator *models.User, members ...*models.User) *models.Group {
+	t.Helper()
+	group := &models.Group{Name: name, CreatorID: creator.ID}
+	if err := e.db.Create(group).Error; err != nil {
+		t.Fatalf("创建群组失败: %v", err)
+	}
+	for _, u := range append([]*models.User{creator}, members...) {
+		member := &models.GroupMember{GroupID: group.ID, UserID: u.ID, JoinedAt: time.Now(), IsAdmin: u.ID == creator.ID}
+		if err := e.db.Create(member).Error; err != nil {
+			t.Fatalf("添加成员失败: %v", err)
+		}
+	}
+	return group
+}
+
+// createMessage 直接写入一条消息，createdAt 为零值时使用当前时间
+func (e *testEnv) createMessage(t testing.TB, msg models.Message) *models.Message {
+	t.Helper()
+	if msg.Type == "" {
+		msg.Type = models.PrivateMessage
+		if msg.GroupID > 0 {
+			msg.Type = models.GroupMessage
+		}
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	if err := e.db.Create(&msg).Error; err != nil {
+		t.Fatalf("创建消息失败: %v", err)
+	}
+	return &msg
+}
+
+// errFakeReadTimeout 内存连接读超时返回的错误
+var errFakeReadTimeout = errors.New("i/o timeout")
+
+// fakeTimeoutError 内存连接写超时返回的错误，与网络连接一样实现 net.Error
+type fakeTimeoutError struct{}
+
+func (fakeTimeoutError) Error() string   { return "i/o timeout" }
+func (fakeTimeoutError) Timeout() bool   { return true }
+func (fakeTimeoutError) Temporary() bool { return true }
+
+// seedGroupActivity 按数据库中的消息写入群组活跃度缓存
+// sqlite 中 MAX(created_at) 返回字符串，无法扫描为时间，测试中预先写入缓存以跳过聚合查询
+func (e *testEnv) seedGroupActivity(t *testing.T, groupIDs ...uint) {
+	t.Helper()
+	ctx := context.Background()
+	for _, groupID := range groupIDs {
+		var messages []models.Message
+		if err := e.db.Where("group_id = ? AND deleted_at IS NULL", groupID).Order("created_at DESC").Find(&messages).Error; err != nil {
+			t.Fatalf("统计群组活跃度失败: %v", err)
+		}
+		var nanos int64
+		if len(messages) > 0 {
+			nanos = messages[0].CreatedAt.UnixNano()
+		}
+		e.rdb.HSet(ctx, groupActivityKey(groupID), "count", len(messages), "last_at", nanos)
+	}
+}
+
+// fakeFrame 内存连接记录的一帧
+type fakeFrame struct {
+	messageType int
+	data        []byte
+}
+
+// fakeConn 记录写出内容的内存WebSocket连接
+// 读操作遵循读超时，超时后返回错误，模拟对端失联
+type fakeConn struct {
+	mu           sync.Mutex
+	frames       []fakeFrame
+	closed       bool
+	stalled      bool // 对端停止接收，数据帧和ping写入超时
+	done         chan struct{}
+	readDeadline time.Time
+	deadlineSet  chan struct{}
+	pongHandler  func(string) error
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{done: make(chan struct{}), deadlineSet: make(chan struct{})}
+}
+
+func (c *fakeConn) ReadMessage() (int, []byte, error) {
+	for {
+		c.mu.Lock()
+		deadline, deadlineSet := c.readDeadline, c.deadlineSet
+		c.mu.Unlock()
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+		select {
+		case <-c.done:
+			return 0, nil, io.EOF
+		case <-timeout:
+			return 0, nil, errFakeReadTimeout
+		case <-deadlineSet:
+			// 读超时已更新，重新计时
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (c *fakeConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	stalled := c.stalled
+	c.mu.Unlock()
+	if stalled && messageType != websocket.CloseMessage {
+		return fakeTimeoutError{}
+	}
+	return c.record(messageType, data)
+}
+
+// record 记录写出的一帧
+func (c *fakeConn) record(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return websocket.ErrCloseSent
+	}
+	c.frames = append(c.frames, fakeFrame{messageType, append([]byte(nil), data...)})
+	return nil
+}
+
+// stall 模拟对端停止接收，之后的写入在写超时后失败
+func (c *fakeConn) stall() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stalled = true
+}
+
+func (c *fakeConn) NextWriter(messageType int) (io.WriteCloser, error) {
+	return &fakeWriter{conn: c, messageType: messageType}, nil
+}
+
+func (c *fakeConn) WriteControl(messageType int, data []byte, _ time.Time) error {
+	return c.record(messageType, data)
+}
+
+func (c *fakeConn) SetReadLimit(int64)               {}
+func (c *fakeConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *fakeConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	close(c.deadlineSet)
+	c.deadlineSet = make(chan struct{})
+	return nil
+}
+
+func (c *fakeConn) SetPongHandler(h func(string) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pongHandler = h
+}
+
+// pong 模拟收到对端的pong帧
+func (c *fakeConn) pong() {
+	c.mu.Lock()
+	h := c.pongHandler
+	c.mu.Unlock()
+	if h != nil {
+		h("")
+	}
+}
+
+// getReadDeadline 返回当前的读超时时间
+func (c *fakeConn) getReadDeadline() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readDeadline
+}
+
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+	return nil
+}
+
+// closeCodes 返回连接上写出的所有关闭帧的关闭码
+func (c *fakeConn) closeCodes() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var codes []int
+	for _, f := range c.frames {
+		if f.messageType == websocket.CloseMessage && len(f.data) >= 2 {
+			codes = append(codes, int(binary.BigEndian.Uint16(f.data)))
+		}
+	}
+	return codes
+}
+
+// lastFrame 返回连接上写出的最后一帧
+func (c *fakeConn) lastFrame() fakeFrame {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.frames) == 0 {
+		return fakeFrame{}
+	}
+	return c.frames[len(c.frames)-1]
+}
+
+// textFrames 返回连接上写出的所有数据帧
+func (c *fakeConn) textFrames() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out [][]byte
+	for _, f := range c.frames {
+		if f.messageType == websocket.TextMessage || f.messageType == websocket.BinaryMessage {
+			out = append(out, f.data)
+		}
+	}
+	return out
+}
+
+type fakeWriter struct {
+	conn        *fakeConn
+	messageType int
+	buf         bytes.Buffer
+}
+
+func (w *fakeWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+func (w *fakeWriter) Close() error                { return w.conn.WriteMessage(w.messageType, w.buf.Bytes()) }
+
+// newTestManager 创建不连接Kafka的WebSocket管理器
+func newTestManager(env *testEnv) *WebSocketManager {
+	return &WebSocketManager{
+		clients:          make(map[uint]*Client),
+		groupSubscribers: make(map[uint]map[*Client]struct{}),
+		rdb:              env.rdb,
+		messageService:   env.messages,
+		UserService:      env.users,
+		maxConnections:   100,
+		sendTimeout:      10 * time.Millisecond,
+		stopCh:           make(chan struct{}),
+	}
+}
+
+// connectClient 注册一个使用内存连接的客户端并启动写协程，返回写协程结束的通知
+func connectClient(t *testing.T, m *WebSocketManager, user *models.User) (*Client, *fakeConn, <-chan struct{}) {
+	t.Helper()
+	conn := newFakeConn()
+	client := NewClient(user.ID, user.Username, conn)
+	if !m.RegisterClient(client) {
+		t.Fatal("注册客户端失败")
+	}
+	done := make(chan struct{})
+	go func() {
+		client.WritePump(m)
+		close(done)
+	}()
+	return client, conn, done
+}
+
+// waitClosed 等待写协程结束
+func waitClosed(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("写协程未结束")
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// fakeSession 记录已标记消息的消费者会话
+type fakeSession struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Claims() map[string][]int32               { return nil }
+func (s *fakeSession) MemberID() string                         { return "test" }
+func (s *fakeSession) GenerationID() int32                      { return 1 }
+func (s *fakeSession) MarkOffset(string, int32, int64, string)  {}
+func (s *fakeSession) Commit()                                  {}
+func (s *fakeSession) ResetOffset(string, int32, int64, string) {}
+func (s *fakeSession) Context() context.Context                 { return s.ctx }
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+// fakeClaim 从通道读取消息的分区认领
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return "test" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return int64(cap(c.messages)) }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestConsumerSkipsUnsupportedEnvelopes(t *testing.T) {
+	k := newTestKafka(nil)
+	current, _ := NewEnvelope("chat_message", []byte(`{"id":1}`))
+	values := [][]byte{
+		current,
+		[]byte(`{"schema_version":99,"content_type":"application/json","type":"chat_message","content":{}}`),
+		[]byte(`{"schema_version":1,"content_type":"application/protobuf","type":"chat_message","content":{}}`),
+		[]byte(`{"type":"chat_message","content":{"id":2}}`),
+		[]byte(`not json`),
+	}
+
+	var mu sync.Mutex
+	var handled []string
+	var wg sync.WaitGroup
+	wg.Add(2)
+	k.handlers["test"] = func(message []byte) {
+		mu.Lock()
+		handled = append(handled, string(message))
+		mu.Unlock()
+		wg.Done()
+	}
+
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(values))}
+	for i, value := range values {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "test", Offset: int64(i), Value: value}
+	}
+	close(claim.messages)
+
+	session := &fakeSession{ctx: context.Background()}
+	handler := &kafkaConsumerHandler{ready: make(chan bool), service: k, topic: "test"}
+	if err := handler.ConsumeClaim(session, claim); err != nil {
+		t.Fatalf("消费失败: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("受支持的消息未被处理")
+	}
+
+	// 当前版本和旧格式交给处理函数，不支持的消息被跳过但仍然提交位移
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handled) != 2 {
+		t.Fatalf("处理的消息 = %q，期望 2 条", handled)
+	}
+	if len(session.marked) != len(values) {
+		t.Fatalf("标记的位移 = %v，期望全部 %d 条", session.marked, len(values))
+	}
+	if got := k.GetMetrics()["skipped"]; got != 3 {
+		t.Fatalf("跳过的消息数 = %d，期望 3", got)
+	}
+}
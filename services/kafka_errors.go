@@ -0,0 +1,87 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// KafkaErrorRecord 一条Kafka错误记录
+type KafkaErrorRecord struct {
+	Message   string    `json:"message"`
+	Topic     string    `json:"topic,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// kafkaErrorRing 保存最近N条Kafka错误的环形缓冲，写满后覆盖最旧的记录
+type kafkaErrorRing struct {
+	mu      sync.Mutex
+	records []KafkaErrorRecord
+	next    int  // 下一条记录写入的位置
+	full    bool // 缓冲是否已写满过一轮
+}
+
+// newKafkaErrorRing 创建指定容量的错误环形缓冲
+func newKafkaErrorRing(size int) *kafkaErrorRing {
+	if size <= 0 {
+		size = 1
+	}
+	return &kafkaErrorRing{records: make([]KafkaErrorRecord, size)}
+}
+
+// add 写入一条错误记录
+func (r *kafkaErrorRing) add(record KafkaErrorRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records[r.next] = record
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot 按时间倒序返回当前缓冲中的错误记录
+func (r *kafkaErrorRing) snapshot() []KafkaErrorRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.records)
+	}
+
+	result := make([]KafkaErrorRecord, 0, n)
+	for i := 1; i <= n; i++ {
+		idx := (r.next - i + len(r.records)) % len(r.records)
+		result = append(result, r.records[idx])
+	}
+	return result
+}
+
+// recordError 记录一次Kafka错误：累加错误计数并写入最近错误缓冲
+func (s *KafkaService) recordError(topic string, err error) {
+	s.metrics.mu.Lock()
+	s.metrics.errors++
+	s.metrics.mu.Unlock()
+
+	s.recentErrors.add(KafkaErrorRecord{
+		Message:   err.Error(),
+		Topic:     topic,
+		Timestamp: time.Now(),
+	})
+}
+
+// recordFallback 记录一次回退到直接投递，未启用Kafka时直接投递是常规路径，不计数
+func (s *KafkaService) recordFallback() {
+	if s == nil {
+		return
+	}
+	s.metrics.mu.Lock()
+	s.metrics.fallbacks++
+	s.metrics.mu.Unlock()
+}
+
+// RecentErrors 获取最近的Kafka错误（最新的在前）
+func (s *KafkaService) RecentErrors() []KafkaErrorRecord {
+	return s.recentErrors.snapshot()
+}
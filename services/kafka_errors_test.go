@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/IBM/sarama/mocks"
+)
+
+func TestKafkaErrorRingEvictsOldest(t *testing.T) {
+	ring := newKafkaErrorRing(3)
+	if got := ring.snapshot(); len(got) != 0 {
+		t.Fatalf("空缓冲 = %+v", got)
+	}
+
+	for i := 1; i <= 5; i++ {
+		ring.add(KafkaErrorRecord{Message: fmt.Sprintf("err%d", i)})
+	}
+	got := ring.snapshot()
+	want := []string{"err5", "err4", "err3"}
+	if len(got) != len(want) {
+		t.Fatalf("缓冲记录数 = %d，期望 %d", len(got), len(want))
+	}
+	for i, record := range got {
+		if record.Message != want[i] {
+			t.Fatalf("缓冲记录 = %+v，期望按时间倒序 %v", got, want)
+		}
+	}
+
+	// 并发写入与读取
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ring.add(KafkaErrorRecord{Message: "concurrent"})
+				ring.snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+	if got := ring.snapshot(); len(got) != 3 {
+		t.Fatalf("并发写入后缓冲记录数 = %d，期望 3", len(got))
+	}
+}
+
+func TestPublishErrorsRecorded(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	t.Cleanup(func() { producer.Close() })
+	k := newTestKafka(producer, "chat")
+
+	producer.ExpectSendMessageAndFail(errors.New("broker down"))
+	if err := k.PublishMessage("chat", "", []byte("hi")); err == nil {
+		t.Fatal("期望发送失败")
+	}
+
+	got := k.RecentErrors()
+	if len(got) != 1 || got[0].Topic != "chat" || got[0].Message != "broker down" || got[0].Timestamp.IsZero() {
+		t.Fatalf("最近错误 = %+v", got)
+	}
+	if k.metrics.errors != 1 {
+		t.Fatalf("错误计数 = %d，期望 1", k.metrics.errors)
+	}
+}
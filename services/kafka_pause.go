@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// ErrTopicNotSubscribed 主题未在本节点订阅，无法暂停或恢复
+var ErrTopicNotSubscribed = errors.New("主题未在本节点订阅")
+
+// topicControl 主题的暂停状态，暂停或恢复时关闭 changed 唤醒正在等待的消费协程
+type topicControl struct {
+	mu      sync.Mutex
+	paused  bool
+	changed chan struct{}
+}
+
+// state 返回当前是否暂停，以及下一次状态变化时会被关闭的通道
+func (c *topicControl) state() (bool, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.paused, c.changed
+}
+
+// set 更新暂停状态，状态未变化时返回false
+func (c *topicControl) set(paused bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.paused == paused {
+		return false
+	}
+	c.paused = paused
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return true
+}
+
+// topicControl 获取主题的暂停状态，不存在时创建
+// 消费协程每条消息都会调用，已存在时只持有读锁，避免与处理函数查找互相阻塞
+func (s *KafkaService) topicControl(topic string) *topicControl {
+	s.handlerMutex.RLock()
+	ctrl, ok := s.controls[topic]
+	s.handlerMutex.RUnlock()
+	if ok {
+		return ctrl
+	}
+
+	s.handlerMutex.Lock()
+	defer s.handlerMutex.Unlock()
+
+	// 获取写锁期间可能已被其他协程创建
+	if ctrl, ok := s.controls[topic]; ok {
+		return ctrl
+	}
+	ctrl = &topicControl{changed: make(chan struct{})}
+	s.controls[topic] = ctrl
+	return ctrl
+}
+
+// PauseTopic 暂停本节点对主题的消费，不关闭消费者组，消息在Kafka中积压直到恢复
+func (s *KafkaService) PauseTopic(topic string) error {
+	return s.setTopicPaused(topic, true)
+}
+
+// ResumeTopic 恢复本节点对主题的消费，从暂停时的位置继续投递积压的消息
+func (s *KafkaService) ResumeTopic(topic string) error {
+	return s.setTopicPaused(topic, false)
+}
+
+// setTopicPaused 切换主题的暂停状态，消费协程被唤醒后暂停或恢复各自分区的拉取
+func (s *KafkaService) setTopicPaused(topic string, paused bool) error {
+	s.handlerMutex.RLock()
+	_, consuming := s.consumers[topic]
+	s.handlerMutex.RUnlock()
+	if !consuming {
+		return ErrTopicNotSubscribed
+	}
+
+	if s.topicControl(topic).set(paused) {
+		if paused {
+			log.Printf("已暂停消费主题: %s", topic)
+		} else {
+			log.Printf("已恢复消费主题: %s", topic)
+		}
+	}
+	return nil
+}
+
+// PausedTopics 返回本节点上暂停消费的主题
+func (s *KafkaService) PausedTopics() []string {
+	s.handlerMutex.RLock()
+	controls := make(map[string]*topicControl, len(s.controls))
+	for topic, ctrl := range s.controls {
+		controls[topic] = ctrl
+	}
+	s.handlerMutex.RUnlock()
+
+	topics := []string{}
+	for topic, ctrl := range controls {
+		if paused, _ := ctrl.state(); paused {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// waitWhilePaused 主题暂停期间停止拉取分区并阻塞，恢复后重新开始拉取
+// 返回未暂停状态下下一次状态变化时关闭的通道；返回false表示会话已结束，调用方应退出ConsumeClaim
+func (s *KafkaService) waitWhilePaused(session sarama.ConsumerGroupSession, topic string, partition int32) (<-chan struct{}, bool) {
+	ctrl := s.topicControl(topic)
+	paused, changed := ctrl.state()
+	if !paused {
+		return changed, true
+	}
+
+	partitions := map[string][]int32{topic: {partition}}
+	s.clientMu.RLock()
+	s.consumer.Pause(partitions)
+	s.clientMu.RUnlock()
+
+	for paused {
+		select {
+		case <-changed:
+			paused, changed = ctrl.state()
+		case <-session.Context().Done():
+			return nil, false
+		}
+	}
+
+	s.clientMu.RLock()
+	s.consumer.Resume(partitions)
+	s.clientMu.RUnlock()
+	return changed, true
+}
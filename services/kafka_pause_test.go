@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// pauseRecordingConsumer 记录暂停和恢复拉取的分区
+type pauseRecordingConsumer struct {
+	fakeConsumerGroup
+	mu      sync.Mutex
+	calls   []string
+	changed chan struct{}
+}
+
+func (c *pauseRecordingConsumer) record(call string) {
+	c.mu.Lock()
+	c.calls = append(c.calls, call)
+	c.mu.Unlock()
+	c.changed <- struct{}{}
+}
+
+func (c *pauseRecordingConsumer) Pause(map[string][]int32)  { c.record("pause") }
+func (c *pauseRecordingConsumer) Resume(map[string][]int32) { c.record("resume") }
+
+func TestPausedTopicHoldsMessagesUntilResumed(t *testing.T) {
+	const topic = "chatroom-group-1"
+	k := newTestKafka(nil, topic)
+	consumer := &pauseRecordingConsumer{changed: make(chan struct{}, 2)}
+	k.consumer = consumer
+	handled := make(chan string, 2)
+	k.handlers[topic] = func(value []byte) { handled <- string(value) }
+	k.consumers[topic] = func() {}
+
+	if err := k.PauseTopic("chatroom-group-2"); !errors.Is(err, ErrTopicNotSubscribed) {
+		t.Fatalf("暂停未订阅的主题 = %v，期望 ErrTopicNotSubscribed", err)
+	}
+	if err := k.PauseTopic(topic); err != nil {
+		t.Fatalf("暂停主题失败: %v", err)
+	}
+	if paused := k.PausedTopics(); len(paused) != 1 || paused[0] != topic {
+		t.Fatalf("暂停的主题 = %v，期望 [%s]", paused, topic)
+	}
+
+	value, err := NewEnvelope("chat_message", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("封装消息失败: %v", err)
+	}
+	claim := &fakeReplayClaim{partition: 0, highWater: 1, messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: topic, Value: value}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		handler := &kafkaConsumerHandler{ready: make(chan bool), service: k, topic: topic}
+		handler.ConsumeClaim(&fakeReplaySession{ctx: ctx}, claim)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// 暂停期间停止拉取分区，已拉取的消息不交给处理函数
+	select {
+	case <-consumer.changed:
+	case <-time.After(time.Second):
+		t.Fatal("暂停后未停止拉取分区")
+	}
+	select {
+	case got := <-handled:
+		t.Fatalf("暂停期间处理了消息: %s", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 恢复后重新拉取并投递积压的消息
+	if err := k.ResumeTopic(topic); err != nil {
+		t.Fatalf("恢复主题失败: %v", err)
+	}
+	select {
+	case got := <-handled:
+		if got != string(value) {
+			t.Fatalf("处理的消息 = %s，期望 %s", got, value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("恢复后未投递积压的消息")
+	}
+	consumer.mu.Lock()
+	calls := append([]string(nil), consumer.calls...)
+	consumer.mu.Unlock()
+	if len(calls) != 2 || calls[0] != "pause" || calls[1] != "resume" {
+		t.Fatalf("分区拉取调用 = %v，期望 [pause resume]", calls)
+	}
+	if paused := k.PausedTopics(); len(paused) != 0 {
+		t.Fatalf("恢复后暂停的主题 = %v，期望为空", paused)
+	}
+}
+
+func TestTopicControlLookupTakesReadLock(t *testing.T) {
+	const topic = "chatroom-group-1"
+	k := newTestKafka(nil, topic)
+	ctrl := k.topicControl(topic)
+
+	// 其他协程持有读锁（如查找处理函数）时，已存在的暂停状态仍可立即获取
+	k.handlerMutex.RLock()
+	got := make(chan *topicControl, 1)
+	go func() { got <- k.topicControl(topic) }()
+	select {
+	case c := <-got:
+		if c != ctrl {
+			t.Fatal("再次获取返回了不同的暂停状态")
+		}
+	case <-time.After(time.Second):
+		k.handlerMutex.RUnlock()
+		t.Fatal("获取已存在的暂停状态时等待了写锁")
+	}
+	k.handlerMutex.RUnlock()
+
+	// 并发首次获取同一主题只创建一个暂停状态
+	const other = "chatroom-group-2"
+	var wg sync.WaitGroup
+	controls := make([]*topicControl, 8)
+	for i := range controls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			controls[i] = k.topicControl(other)
+		}(i)
+	}
+	wg.Wait()
+	for _, c := range controls {
+		if c != controls[0] {
+			t.Fatal("并发获取创建了多个暂停状态")
+		}
+	}
+}
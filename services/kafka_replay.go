@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"chatroom/config"
+)
+
+const (
+	// 单次重放允许的最大时间跨度和最多读取的消息数
+	replayMaxSpan     = 24 * time.Hour
+	replayMaxMessages = 10000
+	// replayExportLimit 导出模式最多返回的消息数
+	replayExportLimit = 1000
+	// replayTimeout 单次重放的最长运行时间
+	replayTimeout = time.Minute
+	// replayIdleTimeout 分区在该时间内没有新消息即视为已读完（用于空分区）
+	replayIdleTimeout = 3 * time.Second
+)
+
+// ErrReplayInProgress 同一时间只允许一个重放任务
+var ErrReplayInProgress = errors.New("已有重放任务在运行")
+
+// ReplayResult 重放结果
+type ReplayResult struct {
+	Topic     string            `json:"topic"`
+	Scanned   int               `json:"scanned"`   // 读取的消息数
+	Matched   int               `json:"matched"`   // 时间范围内的消息数
+	Delivered int               `json:"delivered"` // 交给本节点订阅者重新投递的消息数
+	Truncated bool              `json:"truncated"` // 因超时或达到条数上限提前结束
+	Messages  []json.RawMessage `json:"messages,omitempty"`
+}
+
+// Replay 使用临时消费者组从最早的偏移量读取主题，重放时间范围内的消息
+// export 为false时交给本节点上该主题的订阅处理函数重新投递，为true时只收集消息内容
+// 临时消费者组不影响正常消费的偏移量，客户端按消息ID去重
+func (s *KafkaService) Replay(topic string, from, to time.Time, export bool) (*ReplayResult, error) {
+	if !to.After(from) {
+		return nil, ErrInvalidRange
+	}
+	if to.Sub(from) > replayMaxSpan {
+		return nil, fmt.Errorf("%w，最多%v", ErrRangeTooLarge, replayMaxSpan)
+	}
+	if !atomic.CompareAndSwapInt32(&s.replaying, 0, 1) {
+		return nil, ErrReplayInProgress
+	}
+	defer atomic.StoreInt32(&s.replaying, 0)
+
+	if err := s.EnsureTopicExists(topic); err != nil {
+		return nil, err
+	}
+
+	groupID := fmt.Sprintf("%s-replay-%d", config.AppConfig.KafkaConsumerGroup, time.Now().UnixNano())
+	consumer, err := s.CreateConsumerGroup(groupID, sarama.OffsetOldest)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(s.ctx, replayTimeout)
+	defer cancel()
+
+	handler := &replayHandler{
+		service: s,
+		topic:   topic,
+		from:    from,
+		to:      to,
+		export:  export,
+		cancel:  cancel,
+		done:    make(map[int32]bool),
+		result:  &ReplayResult{Topic: topic},
+	}
+
+	// 重平衡会结束会话，已标记的偏移量保证重新加入后不会重复处理
+	for ctx.Err() == nil {
+		if err := consumer.Consume(ctx, []string{topic}, handler); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				break
+			}
+			return nil, err
+		}
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	handler.result.Truncated = !handler.finished || handler.limited
+	log.Printf("重放主题 %s 完成: 读取%d条，命中%d条，投递%d条", topic,
+		handler.result.Scanned, handler.result.Matched, handler.result.Delivered)
+	return handler.result, nil
+}
+
+// replayHandler 重放用的消费者组处理器，所有分区读完后结束重放
+type replayHandler struct {
+	service  *KafkaService
+	topic    string
+	from, to time.Time
+	export   bool
+	cancel   context.CancelFunc
+
+	mu       sync.Mutex
+	done     map[int32]bool // 已读完的分区
+	finished bool           // 所有分区都已读完
+	limited  bool           // 达到条数上限
+	result   *ReplayResult
+}
+
+// Setup 在消费者会话开始时调用
+func (h *replayHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup 在消费者会话结束时调用
+func (h *replayHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim 读取分区直到最新的消息、超出时间范围或空闲超时
+// 读完后等待会话结束而不是立即返回，否则会提前结束其他分区的读取
+func (h *replayHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	idle := time.NewTimer(replayIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			stop := h.handle(message)
+			session.MarkMessage(message, "")
+			if stop || message.Offset >= claim.HighWaterMarkOffset()-1 {
+				h.partitionDone(session, claim.Partition())
+				<-session.Context().Done()
+				return nil
+			}
+			idle.Reset(replayIdleTimeout)
+
+		case <-idle.C:
+			h.partitionDone(session, claim.Partition())
+			<-session.Context().Done()
+			return nil
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// handle 处理一条消息，返回是否应停止读取该分区
+func (h *replayHandler) handle(message *sarama.ConsumerMessage) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.result.Scanned >= replayMaxMessages {
+		// 达到条数上限，结束整个重放
+		h.limited = true
+		h.cancel()
+		return true
+	}
+	h.result.Scanned++
+	if message.Timestamp.Before(h.from) {
+		return false
+	}
+	if message.Timestamp.After(h.to) {
+		return true
+	}
+	if err := checkEnvelope(message.Value); err != nil {
+		return false
+	}
+	h.result.Matched++
+
+	if h.export {
+		if len(h.result.Messages) < replayExportLimit {
+			h.result.Messages = append(h.result.Messages, json.RawMessage(message.Value))
+		}
+		return false
+	}
+
+	h.service.handlerMutex.RLock()
+	handler := h.service.handlers[h.topic]
+	h.service.handlerMutex.RUnlock()
+	if handler != nil {
+		handler(message.Value)
+		h.result.Delivered++
+	}
+	return false
+}
+
+// partitionDone 标记分区已读完，会话中的所有分区都读完时结束重放
+func (h *replayHandler) partitionDone(session sarama.ConsumerGroupSession, partition int32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.done[partition] = true
+	for _, p := range session.Claims()[h.topic] {
+		if !h.done[p] {
+			return
+		}
+	}
+	h.finished = true
+	h.cancel()
+}
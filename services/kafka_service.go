@@ -3,12 +3,16 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"chatroom/config"
+	"chatroom/models"
 
 	"github.com/IBM/sarama"
 )
@@ -18,14 +22,25 @@ type KafkaService struct {
 	producer      sarama.SyncProducer
 	asyncProducer sarama.AsyncProducer // 添加异步生产者
 	consumer      sarama.ConsumerGroup
+	clientMu      sync.RWMutex // 保护重连时被替换的生产者和消费者组
+	available     int32        // Kafka是否可用（原子读写）
+	failures      int32        // 连续失败次数，达到阈值后判定不可用
+	reconnectCh   chan struct{}
 	topics        map[string]bool
 	topicsMutex   sync.RWMutex
 	handlers      map[string]MessageHandler
+	consumers     map[string]context.CancelFunc // 每个主题消费协程的取消函数
+	controls      map[string]*topicControl      // 主题的暂停状态，与handlers共用handlerMutex
 	handlerMutex  sync.RWMutex
 	ctx           context.Context
 	cancel        context.CancelFunc
-	errorChan     chan *sarama.ConsumerError // 添加错误通道
-	metrics       *KafkaMetrics              // 添加指标收集
+	errorChan     chan *sarama.ConsumerError   // 添加错误通道
+	metrics       *KafkaMetrics                // 添加指标收集
+	retryChan     chan *sarama.ProducerMessage // 主题创建失败时的本地重试缓冲
+	recentErrors  *kafkaErrorRing              // 最近的错误，供运维排查
+	replaying     int32                        // 是否有重放任务在运行（原子读写），同一时间只允许一个
+	lags          map[string]int64             // 各主题分区的消费积压消息数，键为 主题/分区
+	lagMu         sync.Mutex
 }
 
 // KafkaMetrics 收集Kafka相关指标
@@ -33,14 +48,125 @@ type KafkaMetrics struct {
 	messagesSent     int64
 	messagesReceived int64
 	errors           int64
+	topicErrors      int64 // 主题创建失败次数
+	retried          int64 // 重试缓冲中重新投递成功的消息数
+	dropped          int64 // 重试缓冲已满或重试耗尽而丢弃的消息数
+	skipped          int64 // 消费时因格式版本不支持而跳过的消息数
+	fallbacks        int64 // 因Kafka不可用或发布失败而回退到直接投递的消息数
 	mu               sync.RWMutex
 }
 
+// maxPublishRetries 重试缓冲中单条消息的最大重试次数
+const maxPublishRetries = 10
+
+// 消息队列封装格式
+const (
+	EnvelopeSchemaVersion = 1                  // 当前封装格式版本
+	ContentTypeJSON       = "application/json" // content 字段为JSON
+)
+
+// KafkaEnvelope 消息队列中的消息封装
+// schema_version 为0表示旧格式（未带版本的消息），按原样处理
+type KafkaEnvelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	ContentType   string          `json:"content_type"`
+	Type          string          `json:"type"`
+	Content       json.RawMessage `json:"content"`
+	Timestamp     time.Time       `json:"timestamp"`
+}
+
+// NewEnvelope 使用当前格式版本封装消息
+func NewEnvelope(msgType string, content []byte) ([]byte, error) {
+	return json.Marshal(KafkaEnvelope{
+		SchemaVersion: EnvelopeSchemaVersion,
+		ContentType:   ContentTypeJSON,
+		Type:          msgType,
+		Content:       content,
+		Timestamp:     time.Now(),
+	})
+}
+
+// checkEnvelope 检查消费到的消息格式是否受支持
+func checkEnvelope(message []byte) error {
+	var header struct {
+		SchemaVersion int    `json:"schema_version"`
+		ContentType   string `json:"content_type"`
+	}
+	if err := json.Unmarshal(message, &header); err != nil {
+		return fmt.Errorf("消息不是合法的JSON: %v", err)
+	}
+
+	switch header.SchemaVersion {
+	case 0:
+		// 旧格式消息没有版本信息，原样交给处理函数
+		return nil
+	case EnvelopeSchemaVersion:
+		if header.ContentType != ContentTypeJSON {
+			return fmt.Errorf("不支持的消息内容类型: %s", header.ContentType)
+		}
+		return nil
+	default:
+		return fmt.Errorf("不支持的消息格式版本: %d", header.SchemaVersion)
+	}
+}
+
 // MessageHandler 消息处理函数类型
 type MessageHandler func(message []byte)
 
 // NewKafkaService 创建Kafka服务
 func NewKafkaService() (*KafkaService, error) {
+	clients, err := newKafkaClients()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errorChan := make(chan *sarama.ConsumerError, 100)
+
+	service := &KafkaService{
+		producer:      clients.producer,
+		asyncProducer: clients.asyncProducer,
+		consumer:      clients.consumer,
+		available:     1,
+		reconnectCh:   make(chan struct{}, 1),
+		topics:        make(map[string]bool),
+		handlers:      make(map[string]MessageHandler),
+		consumers:     make(map[string]context.CancelFunc),
+		controls:      make(map[string]*topicControl),
+		lags:          make(map[string]int64),
+		ctx:           ctx,
+		cancel:        cancel,
+		errorChan:     errorChan,
+		recentErrors:  newKafkaErrorRing(config.AppConfig.KafkaErrorBufferSize),
+		metrics:       &KafkaMetrics{},
+		retryChan:     make(chan *sarama.ProducerMessage, config.AppConfig.ChannelBuffSize),
+	}
+
+	// 处理异步生产者的成功和错误回调
+	go service.handleAsyncProducerResponses(clients.asyncProducer)
+
+	// 处理消费者错误
+	go service.forwardConsumerErrors(clients.consumer)
+	go service.handleConsumerErrors()
+
+	// 处理重试缓冲中的消息
+	go service.handleRetryBuffer()
+
+	// 持续失败时重建连接
+	go service.superviseConnection()
+
+	return service, nil
+}
+
+// kafkaClients 一组Kafka生产者和消费者组，重连时整体替换
+type kafkaClients struct {
+	producer      sarama.SyncProducer
+	asyncProducer sarama.AsyncProducer
+	consumer      sarama.ConsumerGroup
+}
+
+// newKafkaClients 创建同步生产者、异步生产者和消费者组
+func newKafkaClients() (*kafkaClients, error) {
 	// 创建同步生产者配置
 	producerConfig := sarama.NewConfig()
 	producerConfig.Producer.RequiredAcks = sarama.WaitForAll
@@ -77,7 +203,7 @@ func NewKafkaService() (*KafkaService, error) {
 	// 创建消费者配置
 	consumerConfig := sarama.NewConfig()
 	consumerConfig.Consumer.Return.Errors = true
-	consumerConfig.Consumer.Offsets.Initial = sarama.OffsetNewest // 从最新的偏移量开始消费
+	consumerConfig.Consumer.Offsets.Initial = initialOffset() // 没有已提交偏移量时的起始位置
 	consumerConfig.Consumer.Offsets.AutoCommit.Enable = true
 	consumerConfig.Consumer.Offsets.AutoCommit.Interval = 1 * time.Second
 	//consumerConfig.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin // 使用轮询策略
@@ -94,51 +220,53 @@ func NewKafkaService() (*KafkaService, error) {
 		return nil, fmt.Errorf("创建Kafka消费者组失败: %v", err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	errorChan := make(chan *sarama.ConsumerError, 100)
-
-	service := &KafkaService{
+	return &kafkaClients{
 		producer:      producer,
 		asyncProducer: asyncProducer,
 		consumer:      consumer,
-		topics:        make(map[string]bool),
-		handlers:      make(map[string]MessageHandler),
-		ctx:           ctx,
-		cancel:        cancel,
-		errorChan:     errorChan,
-		metrics:       &KafkaMetrics{},
-	}
-
-	// 处理异步生产者的成功和错误回调
-	go service.handleAsyncProducerResponses()
-
-	// 处理消费者错误
-	go service.handleConsumerErrors()
-
-	return service, nil
+	}, nil
 }
 
-// 处理异步生产者的响应
-func (s *KafkaService) handleAsyncProducerResponses() {
-	for {
+// 处理异步生产者的响应，生产者被关闭（如重连替换）后退出
+func (s *KafkaService) handleAsyncProducerResponses(producer sarama.AsyncProducer) {
+	successes, errs := producer.Successes(), producer.Errors()
+	for successes != nil || errs != nil {
 		select {
 		case <-s.ctx.Done():
 			return
-		case success := <-s.asyncProducer.Successes():
-			if success != nil {
-				s.metrics.mu.Lock()
-				s.metrics.messagesSent++
-				s.metrics.mu.Unlock()
-				log.Printf("消息成功发送到主题 %s [分区:%d] @ 偏移量 %d",
-					success.Topic, success.Partition, success.Offset)
+		case success, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
 			}
-		case err := <-s.asyncProducer.Errors():
-			if err != nil {
-				s.metrics.mu.Lock()
-				s.metrics.errors++
-				s.metrics.mu.Unlock()
-				log.Printf("发送消息失败: %v", err)
+			s.metrics.mu.Lock()
+			s.metrics.messagesSent++
+			s.metrics.mu.Unlock()
+			s.markSuccess()
+			log.Printf("消息成功发送到主题 %s [分区:%d] @ 偏移量 %d",
+				success.Topic, success.Partition, success.Offset)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
 			}
+			s.recordError(err.Msg.Topic, err.Err)
+			s.markFailure()
+			log.Printf("发送消息失败: %v", err)
+		}
+	}
+}
+
+// forwardConsumerErrors 将消费者组的错误转发到错误通道，消费者组关闭后退出
+func (s *KafkaService) forwardConsumerErrors(consumer sarama.ConsumerGroup) {
+	for err := range consumer.Errors() {
+		var consumerErr *sarama.ConsumerError
+		if !errors.As(err, &consumerErr) {
+			consumerErr = &sarama.ConsumerError{Err: err}
+		}
+		select {
+		case s.errorChan <- consumerErr:
+		default:
 		}
 	}
 }
@@ -151,19 +279,77 @@ func (s *KafkaService) handleConsumerErrors() {
 			return
 		case err := <-s.errorChan:
 			if err != nil {
+				s.recordError(err.Topic, err.Err)
+				s.markFailure()
+				log.Printf("消费消息错误: %v", err)
+			}
+		}
+	}
+}
+
+// 定期重新投递重试缓冲中的消息
+func (s *KafkaService) handleRetryBuffer() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			// Kafka不可用期间保留缓冲，恢复后再投递
+			if !s.Available() {
+				continue
+			}
+			n := len(s.retryChan)
+			for i := 0; i < n; i++ {
+				msg := <-s.retryChan
+				if err := s.EnsureTopicExists(msg.Topic); err != nil {
+					s.bufferForRetry(msg)
+					continue
+				}
+				if !s.sendAsync(msg) {
+					s.bufferForRetry(msg)
+					continue
+				}
+
 				s.metrics.mu.Lock()
-				s.metrics.errors++
+				s.metrics.retried++
 				s.metrics.mu.Unlock()
-				log.Printf("消费消息错误: %v", err)
 			}
 		}
 	}
 }
 
+// bufferForRetry 将无法投递的消息放入重试缓冲，缓冲已满时丢弃
+func (s *KafkaService) bufferForRetry(msg *sarama.ProducerMessage) {
+	retries, _ := msg.Metadata.(int)
+	if retries >= maxPublishRetries {
+		s.metrics.mu.Lock()
+		s.metrics.dropped++
+		s.metrics.mu.Unlock()
+		log.Printf("消息重试次数耗尽，已丢弃: 主题 %s", msg.Topic)
+		return
+	}
+	msg.Metadata = retries + 1
+
+	select {
+	case s.retryChan <- msg:
+	default:
+		s.metrics.mu.Lock()
+		s.metrics.dropped++
+		s.metrics.mu.Unlock()
+		log.Printf("重试缓冲已满，已丢弃消息: 主题 %s", msg.Topic)
+	}
+}
+
 // Close 关闭Kafka服务
 func (s *KafkaService) Close() error {
 	s.cancel()
 
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+
 	var errs []error
 
 	if err := s.producer.Close(); err != nil {
@@ -191,12 +377,44 @@ func (s *KafkaService) GetMetrics() map[string]int64 {
 	defer s.metrics.mu.RUnlock()
 
 	return map[string]int64{
-		"messages_sent":     s.metrics.messagesSent,
-		"messages_received": s.metrics.messagesReceived,
-		"errors":            s.metrics.errors,
+		"messages_sent":       s.metrics.messagesSent,
+		"messages_received":   s.metrics.messagesReceived,
+		"errors":              s.metrics.errors,
+		"topic_errors":        s.metrics.topicErrors,
+		"retried":             s.metrics.retried,
+		"dropped":             s.metrics.dropped,
+		"retry_pending":       int64(len(s.retryChan)),
+		"skipped":             s.metrics.skipped,
+		"fallback_deliveries": s.metrics.fallbacks,
+		"consumer_lag":        s.ConsumerLag(),
 	}
 }
 
+// recordLag 记录主题分区最新的消费积压，即分区最新偏移量与刚读取的消息之间的消息数
+func (s *KafkaService) recordLag(topic string, partition int32, highWaterMark, offset int64) {
+	lag := highWaterMark - offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	s.lagMu.Lock()
+	s.lags[fmt.Sprintf("%s/%d", topic, partition)] = lag
+	s.lagMu.Unlock()
+}
+
+// ConsumerLag 返回本节点订阅的各主题分区中最大的消费积压消息数
+func (s *KafkaService) ConsumerLag() int64 {
+	s.lagMu.Lock()
+	defer s.lagMu.Unlock()
+
+	var maxLag int64
+	for _, lag := range s.lags {
+		if lag > maxLag {
+			maxLag = lag
+		}
+	}
+	return maxLag
+}
+
 // EnsureTopicExists 确保主题存在
 func (s *KafkaService) EnsureTopicExists(topic string) error {
 	s.topicsMutex.RLock()
@@ -213,6 +431,8 @@ func (s *KafkaService) EnsureTopicExists(topic string) error {
 
 	admin, err := sarama.NewClusterAdmin(config.AppConfig.KafkaBootstrapServers, adminConfig)
 	if err != nil {
+		s.recordTopicError(topic, err)
+		s.markFailure()
 		return fmt.Errorf("创建Kafka管理客户端失败: %v", err)
 	}
 	defer admin.Close()
@@ -220,21 +440,25 @@ func (s *KafkaService) EnsureTopicExists(topic string) error {
 	// 检查主题是否存在
 	topics, err := admin.ListTopics()
 	if err != nil {
+		s.recordTopicError(topic, err)
+		s.markFailure()
 		return fmt.Errorf("获取主题列表失败: %v", err)
 	}
 
 	if _, exists := topics[topic]; !exists {
-		// 创建主题
+		// 创建主题，保留时间和清理策略按主题类型配置
+		policy := config.KafkaTopicPolicyFor(topicTypeOf(topic))
 		topicDetail := &sarama.TopicDetail{
 			NumPartitions:     int32(config.AppConfig.KafkaPartitions),
 			ReplicationFactor: int16(config.AppConfig.KafkaReplicationFactor),
 			ConfigEntries: map[string]*string{
-				"retention.ms":   strPtr("86400000"), // 1天的消息保留时间
-				"cleanup.policy": strPtr("delete"),
+				"retention.ms":   strPtr(strconv.FormatInt(policy.Retention.Milliseconds(), 10)),
+				"cleanup.policy": strPtr(policy.CleanupPolicy),
 			},
 		}
 
-		if err := admin.CreateTopic(topic, topicDetail, false); err != nil {
+		if err := admin.CreateTopic(topic, topicDetail, false); err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+			s.recordTopicError(topic, err)
 			return fmt.Errorf("创建主题失败: %v", err)
 		}
 
@@ -248,6 +472,14 @@ func (s *KafkaService) EnsureTopicExists(topic string) error {
 	return nil
 }
 
+// recordTopicError 记录主题创建失败
+func (s *KafkaService) recordTopicError(topic string, err error) {
+	s.metrics.mu.Lock()
+	s.metrics.topicErrors++
+	s.metrics.mu.Unlock()
+	s.recordError(topic, err)
+}
+
 // PublishMessage 发布消息到Kafka (同步)
 func (s *KafkaService) PublishMessage(topic string, key string, message []byte) error {
 	// 确保主题存在
@@ -267,17 +499,19 @@ func (s *KafkaService) PublishMessage(topic string, key string, message []byte)
 	}
 
 	// 发送消息
+	s.clientMu.RLock()
 	partition, offset, err := s.producer.SendMessage(msg)
+	s.clientMu.RUnlock()
 	if err != nil {
-		s.metrics.mu.Lock()
-		s.metrics.errors++
-		s.metrics.mu.Unlock()
-		return fmt.Errorf("发送消息失败: %v", err)
+		s.recordError(topic, err)
+		s.markFailure()
+		return fmt.Errorf("发送消息到主题%s失败: %w", topic, err)
 	}
 
 	s.metrics.mu.Lock()
 	s.metrics.messagesSent++
 	s.metrics.mu.Unlock()
+	s.markSuccess()
 
 	log.Printf("消息已发送到主题 %s [分区:%d] @ 偏移量 %d", topic, partition, offset)
 	return nil
@@ -287,11 +521,6 @@ func (s *KafkaService) PublishMessage(topic string, key string, message []byte)
 func (s *KafkaService) PublishMessageAsync(topic string, key string, message []byte) {
 	// 确保主题存在 (异步方式)
 	go func() {
-		if err := s.EnsureTopicExists(topic); err != nil {
-			log.Printf("确保主题存在失败: %v", err)
-			return
-		}
-
 		// 创建消息
 		msg := &sarama.ProducerMessage{
 			Topic:     topic,
@@ -303,8 +532,17 @@ func (s *KafkaService) PublishMessageAsync(topic string, key string, message []b
 			msg.Key = sarama.StringEncoder(key)
 		}
 
+		if err := s.EnsureTopicExists(topic); err != nil {
+			// 主题暂不可用，放入重试缓冲而非直接丢弃
+			log.Printf("确保主题存在失败，消息已放入重试缓冲: %v", err)
+			s.bufferForRetry(msg)
+			return
+		}
+
 		// 异步发送消息
-		s.asyncProducer.Input() <- msg
+		if !s.sendAsync(msg) {
+			s.bufferForRetry(msg)
+		}
 	}()
 }
 
@@ -315,9 +553,15 @@ func (s *KafkaService) SubscribeTopic(topic string, handler MessageHandler) erro
 		return err
 	}
 
-	// 注册处理函数
+	// 注册处理函数，已有消费协程时只替换处理函数
 	s.handlerMutex.Lock()
 	s.handlers[topic] = handler
+	if _, consuming := s.consumers[topic]; consuming {
+		s.handlerMutex.Unlock()
+		return nil
+	}
+	topicCtx, topicCancel := context.WithCancel(s.ctx)
+	s.consumers[topic] = topicCancel
 	s.handlerMutex.Unlock()
 
 	// 启动消费者
@@ -331,26 +575,33 @@ func (s *KafkaService) SubscribeTopic(topic string, handler MessageHandler) erro
 
 		for {
 			select {
-			case <-s.ctx.Done():
+			case <-topicCtx.Done():
 				return
 			default:
+				// 每轮重新获取消费者组，重连后自动切换到新的消费者组
+				s.clientMu.RLock()
+				consumer := s.consumer
+				s.clientMu.RUnlock()
+
 				// 消费消息
-				if err := s.consumer.Consume(s.ctx, []string{topic}, handler); err != nil {
-					if err == sarama.ErrClosedConsumerGroup {
-						return
+				if err := consumer.Consume(topicCtx, []string{topic}, handler); err != nil {
+					if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+						// 服务关闭时退出；重连替换消费者组时稍后用新的消费者组继续
+						if s.ctx.Err() != nil {
+							return
+						}
+					} else {
+						s.markFailure()
+						log.Printf("消费主题 %s 失败: %v", topic, err)
 					}
-					log.Printf("消费主题 %s 失败: %v", topic, err)
 					time.Sleep(5 * time.Second) // 重试前等待
 					continue
 				}
 
 				// 检查上下文是否已取消
-				if s.ctx.Err() != nil {
+				if topicCtx.Err() != nil {
 					return
 				}
-
-				// 等待消费者就绪
-				<-handler.ready
 			}
 		}
 	}()
@@ -359,6 +610,27 @@ func (s *KafkaService) SubscribeTopic(topic string, handler MessageHandler) erro
 	return nil
 }
 
+// UnsubscribeTopic 取消订阅主题，停止其消费协程
+func (s *KafkaService) UnsubscribeTopic(topic string) {
+	s.handlerMutex.Lock()
+	defer s.handlerMutex.Unlock()
+
+	delete(s.handlers, topic)
+	delete(s.controls, topic)
+	s.lagMu.Lock()
+	for key := range s.lags {
+		if strings.HasPrefix(key, topic+"/") {
+			delete(s.lags, key)
+		}
+	}
+	s.lagMu.Unlock()
+	if cancel, ok := s.consumers[topic]; ok {
+		cancel()
+		delete(s.consumers, topic)
+		log.Printf("已取消订阅主题: %s", topic)
+	}
+}
+
 // kafkaConsumerHandler 实现sarama.ConsumerGroupHandler接口
 type kafkaConsumerHandler struct {
 	ready   chan bool
@@ -379,19 +651,39 @@ func (h *kafkaConsumerHandler) Cleanup(sarama.ConsumerGroupSession) error {
 }
 
 // ConsumeClaim 消费消息
+// 主题暂停期间不读取已拉取的消息，恢复后继续处理
 func (h *kafkaConsumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	for {
+		changed, ok := h.service.waitWhilePaused(session, h.topic, claim.Partition())
+		if !ok {
+			return nil
+		}
+
 		select {
+		case <-changed:
+			// 暂停状态变化，回到循环开头重新判断
+			continue
+
 		case message, ok := <-claim.Messages():
 			if !ok {
 				return nil
 			}
+			h.service.recordLag(h.topic, claim.Partition(), claim.HighWaterMarkOffset(), message.Offset)
 
 			// 处理消息
 			h.service.handlerMutex.RLock()
 			handler := h.service.handlers[h.topic]
 			h.service.handlerMutex.RUnlock()
 
+			// 不支持的格式直接跳过，避免新版本生产者的消息导致旧消费者出错
+			if err := checkEnvelope(message.Value); err != nil {
+				log.Printf("跳过主题 %s 的消息(offset=%d): %v", h.topic, message.Offset, err)
+				h.service.metrics.mu.Lock()
+				h.service.metrics.skipped++
+				h.service.metrics.mu.Unlock()
+				handler = nil
+			}
+
 			if handler != nil {
 				// 使用goroutine处理消息，避免阻塞消费者
 				go func(msg *sarama.ConsumerMessage) {
@@ -423,19 +715,28 @@ func (s *KafkaService) BuildTopicName(topicType string, id uint) string {
 	return fmt.Sprintf("%s%s-%d", config.AppConfig.KafkaTopicPrefix, topicType, id)
 }
 
+// topicTypeOf 从 BuildTopicName 生成的主题名中解析主题类型，格式不符时返回空
+func topicTypeOf(topic string) string {
+	name := strings.TrimPrefix(topic, config.AppConfig.KafkaTopicPrefix)
+	if i := strings.LastIndex(name, "-"); i > 0 {
+		return name[:i]
+	}
+	return ""
+}
+
 // PublishChatMessage 发布聊天消息
-func (s *KafkaService) PublishChatMessage(msgType string, message []byte, receiverID, groupID uint) error {
+func (s *KafkaService) PublishChatMessage(msgType string, message []byte, senderID, receiverID, groupID uint) error {
 	var topic string
 	var key string
 
 	if groupID > 0 {
 		// 群组消息
 		topic = s.BuildTopicName("group", groupID)
-		key = fmt.Sprintf("group-%d", groupID)
+		key = models.GroupConversationID(groupID)
 	} else if receiverID > 0 {
 		// 私聊消息
 		topic = s.BuildTopicName("private", receiverID)
-		key = fmt.Sprintf("user-%d", receiverID)
+		key = models.ConversationID(senderID, receiverID)
 	} else {
 		// 全局消息
 		topic = s.BuildTopicName("global", 0)
@@ -443,17 +744,7 @@ func (s *KafkaService) PublishChatMessage(msgType string, message []byte, receiv
 	}
 
 	// 包装消息
-	wrapper := struct {
-		Type      string          `json:"type"`
-		Content   json.RawMessage `json:"content"`
-		Timestamp time.Time       `json:"timestamp"`
-	}{
-		Type:      msgType,
-		Content:   message,
-		Timestamp: time.Now(),
-	}
-
-	wrapperJSON, err := json.Marshal(wrapper)
+	wrapperJSON, err := NewEnvelope(msgType, message)
 	if err != nil {
 		return fmt.Errorf("序列化消息失败: %v", err)
 	}
@@ -469,11 +760,19 @@ func (s *KafkaService) PublishChatMessage(msgType string, message []byte, receiv
 	}
 }
 
-// CreateConsumerGroup 创建新的消费者组
-func (s *KafkaService) CreateConsumerGroup(groupID string) (sarama.ConsumerGroup, error) {
+// initialOffset 按 KAFKA_OFFSET_RESET 返回消费者组的初始偏移量
+func initialOffset() int64 {
+	if config.AppConfig.KafkaOffsetReset == "earliest" {
+		return sarama.OffsetOldest
+	}
+	return sarama.OffsetNewest
+}
+
+// CreateConsumerGroup 创建新的消费者组，offset 为没有已提交偏移量时的起始位置（sarama.OffsetOldest / OffsetNewest）
+func (s *KafkaService) CreateConsumerGroup(groupID string, offset int64) (sarama.ConsumerGroup, error) {
 	consumerConfig := sarama.NewConfig()
 	consumerConfig.Consumer.Return.Errors = true
-	consumerConfig.Consumer.Offsets.Initial = sarama.OffsetNewest
+	consumerConfig.Consumer.Offsets.Initial = offset
 	//consumerConfig.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
 	consumerConfig.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{
 		sarama.NewBalanceStrategyRoundRobin(), // 轮询
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// withUnreachableKafka 在测试期间将Kafka地址指向无法连接的端口，使主题创建失败
+func withUnreachableKafka(t *testing.T) {
+	t.Helper()
+	old := config.AppConfig.KafkaBootstrapServers
+	config.AppConfig.KafkaBootstrapServers = []string{"127.0.0.1:1"}
+	t.Cleanup(func() { config.AppConfig.KafkaBootstrapServers = old })
+}
+
+func TestPublishMessageTopicCreationFails(t *testing.T) {
+	withUnreachableKafka(t)
+	k := newTestKafka(mocks.NewSyncProducer(t, nil))
+
+	if err := k.PublishMessage("chat-private-1", "", []byte("{}")); err == nil {
+		t.Fatal("主题创建失败时同步发布应返回错误")
+	}
+	metrics := k.GetMetrics()
+	if metrics["topic_errors"] != 1 {
+		t.Fatalf("topic_errors = %d，期望 1", metrics["topic_errors"])
+	}
+	if len(k.RecentErrors()) != 1 {
+		t.Fatalf("最近错误 %d 条，期望 1 条", len(k.RecentErrors()))
+	}
+}
+
+func TestPublishMessageAsyncBuffersOnTopicFailure(t *testing.T) {
+	withUnreachableKafka(t)
+	k := newTestKafka(mocks.NewSyncProducer(t, nil))
+
+	k.PublishMessageAsync("chat-private-1", "k", []byte("{}"))
+	deadline := time.Now().Add(10 * time.Second)
+	for len(k.retryChan) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("主题创建失败的消息没有放入重试缓冲")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := k.GetMetrics()["retry_pending"]; got != 1 {
+		t.Fatalf("retry_pending = %d，期望 1", got)
+	}
+}
+
+func TestBufferForRetryDropsWhenExhausted(t *testing.T) {
+	k := newTestKafka(nil)
+	msg := &sarama.ProducerMessage{Topic: "t"}
+	msg.Metadata = maxPublishRetries
+	k.bufferForRetry(msg)
+	if len(k.retryChan) != 0 || k.GetMetrics()["dropped"] != 1 {
+		t.Fatalf("重试耗尽的消息应丢弃并计数: pending=%d dropped=%d", len(k.retryChan), k.GetMetrics()["dropped"])
+	}
+
+	for i := 0; i < cap(k.retryChan)+1; i++ {
+		k.bufferForRetry(&sarama.ProducerMessage{Topic: "t"})
+	}
+	if len(k.retryChan) != cap(k.retryChan) || k.GetMetrics()["dropped"] != 2 {
+		t.Fatalf("缓冲已满时应丢弃并计数: pending=%d dropped=%d", len(k.retryChan), k.GetMetrics()["dropped"])
+	}
+}
+
+func TestProcessMessageFallsBackWhenTopicCreationFails(t *testing.T) {
+	withUnreachableKafka(t)
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	env.messages.kafka = newTestKafka(mocks.NewSyncProducer(t, nil))
+	var delivered []uint
+	env.messages.SetDirectDelivery(func(userID uint, _ []byte) bool {
+		delivered = append(delivered, userID)
+		return true
+	})
+
+	msg := &models.Message{Content: "hi", Type: models.PrivateMessage, SenderID: alice.ID, ReceiverID: bob.ID}
+	if err := env.messages.ProcessMessage(msg); err != nil {
+		t.Fatalf("发布失败不应导致发送失败: %v", err)
+	}
+	if len(delivered) != 1 || delivered[0] != bob.ID {
+		t.Fatalf("应回退到直接投递给接收者，实际投递给 %v", delivered)
+	}
+	if got := env.messages.kafka.GetMetrics()["fallback_deliveries"]; got != 1 {
+		t.Fatalf("fallback_deliveries = %d，期望 1", got)
+	}
+}
+
+func TestProcessMessageFallsBackWhenPublishFails(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", alice, bob, carol)
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(sarama.ErrNotLeaderForPartition)
+	k := newTestKafka(producer)
+	topic := k.BuildTopicName("group", group.ID)
+	k.topics[topic] = true
+	env.messages.kafka = k
+	delivered := recordDeliveries(env.messages)
+
+	msg := &models.Message{Content: "hi", Type: models.GroupMessage, SenderID: alice.ID, GroupID: group.ID}
+	if err := env.messages.ProcessMessage(msg); err != nil {
+		t.Fatalf("发布失败不应导致发送失败: %v", err)
+	}
+
+	// 发布失败后直接投递给发送者以外的群成员
+	got := make(map[uint]bool)
+	for _, d := range delivered() {
+		got[d.userID] = true
+	}
+	if len(got) != 2 || !got[bob.ID] || !got[carol.ID] {
+		t.Fatalf("直接投递给 %v，期望 bob 和 carol", got)
+	}
+	if n := k.GetMetrics()["fallback_deliveries"]; n != 1 {
+		t.Fatalf("fallback_deliveries = %d，期望 1", n)
+	}
+	if errs := k.RecentErrors(); len(errs) != 1 || errs[0].Topic != topic {
+		t.Fatalf("最近错误 = %+v，期望记录主题 %s", errs, topic)
+	}
+
+	// 接收者都已直接投递，发件箱记录标记为已发布，避免中继重复发布
+	var outbox models.OutboxMessage
+	if err := env.db.Where("message_id = ?", msg.ID).First(&outbox).Error; err != nil {
+		t.Fatalf("查询发件箱记录失败: %v", err)
+	}
+	if outbox.SentAt == nil || outbox.Attempts != 1 {
+		t.Fatalf("发件箱记录 = %+v，期望已标记发布且尝试 1 次", outbox)
+	}
+}
+
+func TestInitialOffset(t *testing.T) {
+	old := config.AppConfig.KafkaOffsetReset
+	t.Cleanup(func() { config.AppConfig.KafkaOffsetReset = old })
+
+	tests := []struct {
+		reset string
+		want  int64
+	}{
+		{"earliest", sarama.OffsetOldest},
+		{"latest", sarama.OffsetNewest},
+	}
+	for _, tt := range tests {
+		config.AppConfig.KafkaOffsetReset = tt.reset
+		if got := initialOffset(); got != tt.want {
+			t.Errorf("KafkaOffsetReset=%q: initialOffset() = %d，期望 %d", tt.reset, got, tt.want)
+		}
+	}
+}
+
+func TestEnsureTopicExistsAppliesTopicPolicy(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetController(broker.BrokerID()).
+			SetBroker(broker.Addr(), broker.BrokerID()),
+		"ApiVersionsRequest":     sarama.NewMockApiVersionsResponse(t),
+		"DescribeConfigsRequest": sarama.NewMockDescribeConfigsResponse(t),
+		"CreateTopicsRequest":    sarama.NewMockCreateTopicsResponse(t),
+	})
+	old := config.AppConfig.KafkaBootstrapServers
+	config.AppConfig.KafkaBootstrapServers = []string{broker.Addr()}
+	t.Cleanup(func() { config.AppConfig.KafkaBootstrapServers = old })
+
+	k := newTestKafka(nil)
+	statusTopic, groupTopic := k.BuildTopicName("status", 1), k.BuildTopicName("group", 1)
+	for _, topic := range []string{statusTopic, groupTopic} {
+		if err := k.EnsureTopicExists(topic); err != nil {
+			t.Fatalf("创建主题%s失败: %v", topic, err)
+		}
+	}
+
+	retention := make(map[string]string)
+	for _, rr := range broker.History() {
+		req, ok := rr.Request.(*sarama.CreateTopicsRequest)
+		if !ok {
+			continue
+		}
+		for topic, detail := range req.TopicDetails {
+			retention[topic] = *detail.ConfigEntries["retention.ms"] + "/" + *detail.ConfigEntries["cleanup.policy"]
+		}
+	}
+	tests := []struct {
+		topic string
+		want  config.KafkaTopicPolicy
+	}{
+		{statusTopic, config.KafkaTopicPolicyFor("status")},
+		{groupTopic, config.KafkaTopicPolicyFor("group")},
+	}
+	for _, tt := range tests {
+		want := fmt.Sprintf("%d/%s", tt.want.Retention.Milliseconds(), tt.want.CleanupPolicy)
+		if retention[tt.topic] != want {
+			t.Errorf("主题%s的创建配置 = %q，期望 %q", tt.topic, retention[tt.topic], want)
+		}
+	}
+	if config.KafkaTopicPolicyFor("status").Retention >= config.KafkaTopicPolicyFor("group").Retention {
+		t.Fatal("状态主题的保留时间应短于群聊主题")
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"chatroom/config"
+)
+
+const (
+	// 重建Kafka连接的初始和最大退避时间
+	reconnectInitialBackoff = time.Second
+	reconnectMaxBackoff     = 30 * time.Second
+
+	// asyncSendTimeout 异步生产者输入通道阻塞的最长等待时间
+	asyncSendTimeout = time.Second
+)
+
+// Available Kafka当前是否可用，nil表示未启用Kafka
+// 不可用期间消息路径回退到直接投递，发件箱记录等恢复后由中继补发
+func (s *KafkaService) Available() bool {
+	return s != nil && atomic.LoadInt32(&s.available) == 1
+}
+
+// markSuccess 记录一次成功的生产或消费，清零连续失败计数
+func (s *KafkaService) markSuccess() {
+	atomic.StoreInt32(&s.failures, 0)
+}
+
+// markFailure 记录一次失败，连续失败达到 KAFKA_FAILURE_THRESHOLD 时判定不可用并触发重连
+func (s *KafkaService) markFailure() {
+	if atomic.AddInt32(&s.failures, 1) < int32(config.AppConfig.KafkaFailureThreshold) {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&s.available, 1, 0) {
+		return
+	}
+
+	log.Printf("Kafka连续失败%d次，判定为不可用，开始重建连接", atomic.LoadInt32(&s.failures))
+	select {
+	case s.reconnectCh <- struct{}{}:
+	default:
+	}
+}
+
+// sendAsync 将消息放入异步生产者，输入通道长时间阻塞时放弃并返回false
+// 持有读锁发送，保证重连关闭旧生产者时不会有消息写入已关闭的通道
+func (s *KafkaService) sendAsync(msg *sarama.ProducerMessage) bool {
+	s.clientMu.RLock()
+	defer s.clientMu.RUnlock()
+
+	select {
+	case s.asyncProducer.Input() <- msg:
+		return true
+	case <-time.After(asyncSendTimeout):
+		s.markFailure()
+		return false
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// superviseConnection 等待不可用信号，按指数退避重建生产者和消费者组直到成功
+func (s *KafkaService) superviseConnection() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.reconnectCh:
+		}
+
+		backoff := reconnectInitialBackoff
+		for {
+			clients, err := newKafkaClients()
+			if err == nil {
+				s.replaceClients(clients)
+				break
+			}
+			log.Printf("重建Kafka连接失败，%v后重试: %v", backoff, err)
+
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > reconnectMaxBackoff {
+				backoff = reconnectMaxBackoff
+			}
+		}
+	}
+}
+
+// replaceClients 用新建的客户端替换旧客户端并恢复可用状态
+// 已订阅主题的消费协程在下一轮消费时切换到新的消费者组
+func (s *KafkaService) replaceClients(clients *kafkaClients) {
+	s.clientMu.Lock()
+	if s.ctx.Err() != nil {
+		// 服务已关闭，丢弃新建的客户端
+		s.clientMu.Unlock()
+		closeKafkaClients(clients)
+		return
+	}
+	old := &kafkaClients{
+		producer:      s.producer,
+		asyncProducer: s.asyncProducer,
+		consumer:      s.consumer,
+	}
+	s.producer = clients.producer
+	s.asyncProducer = clients.asyncProducer
+	s.consumer = clients.consumer
+	s.clientMu.Unlock()
+
+	go s.handleAsyncProducerResponses(clients.asyncProducer)
+	go s.forwardConsumerErrors(clients.consumer)
+
+	// 旧客户端关闭时可能等待未完成的请求超时，放到后台进行
+	go closeKafkaClients(old)
+
+	atomic.StoreInt32(&s.failures, 0)
+	atomic.StoreInt32(&s.available, 1)
+	log.Println("Kafka连接已恢复")
+}
+
+// closeKafkaClients 关闭一组客户端，错误只记录日志
+func closeKafkaClients(clients *kafkaClients) {
+	if err := clients.producer.Close(); err != nil {
+		log.Printf("关闭旧的Kafka同步生产者失败: %v", err)
+	}
+	if err := clients.asyncProducer.Close(); err != nil {
+		log.Printf("关闭旧的Kafka异步生产者失败: %v", err)
+	}
+	if err := clients.consumer.Close(); err != nil {
+		log.Printf("关闭旧的Kafka消费者组失败: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama/mocks"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+func TestKafkaDownAndRecovered(t *testing.T) {
+	old := config.AppConfig.KafkaFailureThreshold
+	config.AppConfig.KafkaFailureThreshold = 3
+	t.Cleanup(func() { config.AppConfig.KafkaFailureThreshold = old })
+
+	const topic = "chat-private-1"
+	down := mocks.NewSyncProducer(t, nil)
+	for i := 0; i < 3; i++ {
+		down.ExpectSendMessageAndFail(errors.New("broker down"))
+	}
+	k := newTestKafka(down, topic)
+	k.asyncProducer = mocks.NewAsyncProducer(t, nil)
+
+	// 连续失败未达到阈值前仍视为可用
+	for i := 0; i < 2; i++ {
+		k.PublishMessage(topic, "", []byte("{}"))
+	}
+	if !k.Available() {
+		t.Fatal("失败次数未达到阈值时不应判定不可用")
+	}
+	k.PublishMessage(topic, "", []byte("{}"))
+	if k.Available() {
+		t.Fatal("连续失败达到阈值后应判定不可用")
+	}
+	select {
+	case <-k.reconnectCh:
+	default:
+		t.Fatal("判定不可用后应触发重连")
+	}
+
+	// 不可用期间消息直接投递，不再尝试发布到Kafka
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	env.messages.kafka = k
+	delivered := recordDeliveries(env.messages)
+	msg := &models.Message{Content: "hi", Type: models.PrivateMessage, SenderID: alice.ID, ReceiverID: bob.ID}
+	if err := env.messages.ProcessMessage(msg); err != nil {
+		t.Fatalf("Kafka不可用时发送失败: %v", err)
+	}
+	if got := delivered(); len(got) != 1 || got[0].userID != bob.ID {
+		t.Fatalf("不可用期间应直接投递给接收者，实际 %+v", got)
+	}
+
+	// 重建客户端后恢复可用，使用新的生产者发布
+	up := mocks.NewSyncProducer(t, nil)
+	up.ExpectSendMessageAndSucceed()
+	recovered := mocks.NewAsyncProducer(t, nil)
+	t.Cleanup(func() { recovered.Close() })
+	k.replaceClients(&kafkaClients{producer: up, asyncProducer: recovered, consumer: fakeConsumerGroup{}})
+	if !k.Available() {
+		t.Fatal("重建连接后应恢复可用")
+	}
+	if err := k.PublishMessage(topic, "", []byte("{}")); err != nil {
+		t.Fatalf("恢复后发布失败: %v", err)
+	}
+}
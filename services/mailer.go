@@ -0,0 +1,64 @@
+package services
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"chatroom/config"
+)
+
+// Mailer 邮件发送接口，便于替换为第三方邮件服务
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// smtpMailer 通过SMTP发送纯文本邮件
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewMailer 根据 SMTP_* 配置创建邮件发送器，未配置 SMTP_ADDR 时返回nil
+func NewMailer() Mailer {
+	addr := config.AppConfig.SMTPAddr
+	if addr == "" {
+		return nil
+	}
+
+	var auth smtp.Auth
+	if config.AppConfig.SMTPUsername != "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		auth = smtp.PlainAuth("", config.AppConfig.SMTPUsername, config.AppConfig.SMTPPassword, host)
+	}
+	return &smtpMailer{
+		addr: addr,
+		auth: auth,
+		from: config.AppConfig.SMTPFrom,
+	}
+}
+
+// Send 发送UTF-8纯文本邮件，主题按RFC 2047编码
+func (m *smtpMailer) Send(to, subject, body string) error {
+	// 防止地址中的换行注入额外的邮件头
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("无效的收件人地址: %q", to)
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + m.from + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg.String()))
+}
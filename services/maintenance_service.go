@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"chatroom/models"
+)
+
+// defaultMaintenanceRetryAfter 未指定时建议客户端重试的间隔秒数
+const defaultMaintenanceRetryAfter = 300
+
+// MaintenanceService 维护模式服务，状态保存在Redis中供所有节点共享
+type MaintenanceService struct {
+	rdb *redis.Client
+}
+
+// NewMaintenanceService 创建维护模式服务
+func NewMaintenanceService(rdb *redis.Client) *MaintenanceService {
+	return &MaintenanceService{
+		rdb: rdb,
+	}
+}
+
+// Status 获取当前维护模式状态，未开启或Redis出错时返回未开启
+func (s *MaintenanceService) Status() models.MaintenanceStatus {
+	data, err := s.rdb.Get(context.Background(), maintenanceKey()).Bytes()
+	if err != nil {
+		return models.MaintenanceStatus{}
+	}
+
+	var status models.MaintenanceStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return models.MaintenanceStatus{}
+	}
+	status.Enabled = true
+	return status
+}
+
+// Enable 开启维护模式，已开启时更新原因和重试间隔但保留开始时间
+func (s *MaintenanceService) Enable(reason string, retryAfter int) (models.MaintenanceStatus, error) {
+	if retryAfter <= 0 {
+		retryAfter = defaultMaintenanceRetryAfter
+	}
+
+	status := models.MaintenanceStatus{
+		Enabled:    true,
+		Reason:     reason,
+		RetryAfter: retryAfter,
+		StartedAt:  time.Now(),
+	}
+	if current := s.Status(); current.Enabled {
+		status.StartedAt = current.StartedAt
+	}
+
+	data, _ := json.Marshal(status)
+	if err := s.rdb.Set(context.Background(), maintenanceKey(), data, 0).Err(); err != nil {
+		return models.MaintenanceStatus{}, err
+	}
+	return status, nil
+}
+
+// Disable 关闭维护模式
+func (s *MaintenanceService) Disable() error {
+	return s.rdb.Del(context.Background(), maintenanceKey()).Err()
+}
@@ -0,0 +1,35 @@
+package services
+
+import "testing"
+
+func TestMaintenanceStatus(t *testing.T) {
+	env := newTestEnv(t)
+	maintenance := NewMaintenanceService(env.rdb)
+
+	if maintenance.Status().Enabled {
+		t.Fatal("默认不应处于维护模式")
+	}
+	first, err := maintenance.Enable("升级", 0)
+	if err != nil {
+		t.Fatalf("开启维护模式失败: %v", err)
+	}
+	if first.RetryAfter != defaultMaintenanceRetryAfter {
+		t.Fatalf("RetryAfter = %d，期望默认值 %d", first.RetryAfter, defaultMaintenanceRetryAfter)
+	}
+
+	// 再次开启更新原因，保留开始时间
+	if _, err := maintenance.Enable("延长维护", 60); err != nil {
+		t.Fatalf("更新维护模式失败: %v", err)
+	}
+	status := maintenance.Status()
+	if !status.Enabled || status.Reason != "延长维护" || status.RetryAfter != 60 || !status.StartedAt.Equal(first.StartedAt) {
+		t.Fatalf("维护状态 = %+v，期望保留开始时间 %v", status, first.StartedAt)
+	}
+
+	if err := maintenance.Disable(); err != nil {
+		t.Fatalf("关闭维护模式失败: %v", err)
+	}
+	if maintenance.Status().Enabled {
+		t.Fatal("关闭后仍处于维护模式")
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// BuildBackfill 为刚连接的用户构建最近活跃会话的消息回填
+// 只包含用户参与的会话（群聊遵循历史消息可见范围），总大小不超过配置上限
+func (s *MessageService) BuildBackfill(ctx context.Context, userID uint) (*models.Backfill, error) {
+	chats, err := s.GetRecentChats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	backfill := &models.Backfill{Conversations: []models.BackfillConversation{}}
+	maxChats := config.AppConfig.WSBackfillConversations
+	limit := config.AppConfig.WSBackfillMessages
+	budget := config.AppConfig.WSBackfillMaxBytes
+
+	for i, chat := range chats {
+		if i >= maxChats {
+			break
+		}
+
+		var messages []models.MessageResponse
+		if chat.Type == "group" {
+			messages, err = s.GetGroupMessages(ctx, userID, chat.TargetID, limit, 0)
+		} else {
+			messages, err = s.GetMessagesByUser(ctx, userID, chat.TargetID, limit, 0)
+		}
+		if err != nil || len(messages) == 0 {
+			continue
+		}
+
+		conversation := models.BackfillConversation{
+			TargetID: chat.TargetID,
+			Type:     chat.Type,
+			Messages: messages,
+		}
+		size, _ := json.Marshal(conversation)
+		if len(size) > budget {
+			backfill.Truncated = true
+			break
+		}
+		budget -= len(size)
+		backfill.Conversations = append(backfill.Conversations, conversation)
+	}
+
+	return backfill, nil
+}
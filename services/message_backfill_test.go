@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// withBackfillConfig 临时修改回填配置，测试结束后恢复
+func withBackfillConfig(t *testing.T, conversations, messages, maxBytes int) {
+	t.Helper()
+	c, m, b := config.AppConfig.WSBackfillConversations, config.AppConfig.WSBackfillMessages, config.AppConfig.WSBackfillMaxBytes
+	t.Cleanup(func() {
+		config.AppConfig.WSBackfillConversations = c
+		config.AppConfig.WSBackfillMessages = m
+		config.AppConfig.WSBackfillMaxBytes = b
+	})
+	config.AppConfig.WSBackfillConversations = conversations
+	config.AppConfig.WSBackfillMessages = messages
+	config.AppConfig.WSBackfillMaxBytes = maxBytes
+}
+
+func TestBackfillOnConnect(t *testing.T) {
+	withBackfillConfig(t, 5, 2, 1<<20)
+	env := newTestEnv(t)
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", bob, alice)
+	other := env.createGroup(t, "other", carol)
+	env.seedGroupActivity(t, group.ID, other.ID)
+
+	for i := 0; i < 3; i++ {
+		env.createMessage(t, models.Message{SenderID: bob.ID, ReceiverID: alice.ID, Content: "hi"})
+	}
+	env.createMessage(t, models.Message{SenderID: bob.ID, GroupID: group.ID, Content: "group"})
+	// 不相关的会话不能出现在回填中
+	env.createMessage(t, models.Message{SenderID: bob.ID, ReceiverID: carol.ID, Content: "secret"})
+	env.createMessage(t, models.Message{SenderID: carol.ID, GroupID: other.ID, Content: "secret"})
+
+	backfill, err := env.messages.BuildBackfill(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("构建回填失败: %v", err)
+	}
+	if backfill.Truncated {
+		t.Fatal("未超出上限时不应截断")
+	}
+	got := make(map[string]int)
+	for _, conversation := range backfill.Conversations {
+		switch {
+		case conversation.Type == "private" && conversation.TargetID == bob.ID:
+		case conversation.Type == "group" && conversation.TargetID == group.ID:
+		default:
+			t.Fatalf("回填包含无权访问的会话: %+v", conversation)
+		}
+		for _, msg := range conversation.Messages {
+			if msg.Content == "secret" {
+				t.Fatalf("回填包含无权访问的消息: %+v", msg)
+			}
+		}
+		got[conversation.Type] = len(conversation.Messages)
+	}
+	// 每个会话最多回填 N 条
+	if got["private"] != 2 || got["group"] != 1 {
+		t.Fatalf("回填消息数 = %v，期望 private=2 group=1", got)
+	}
+
+	// 连接后收到 backfill 事件
+	client := NewClient(alice.ID, alice.Username, newFakeConn())
+	client.SendBackfill(backfill, 0)
+	select {
+	case frame := <-client.Send:
+		var event struct {
+			Type    string          `json:"type"`
+			Content models.Backfill `json:"content"`
+		}
+		if err := json.Unmarshal(frame, &event); err != nil {
+			t.Fatalf("解析事件失败: %v", err)
+		}
+		if event.Type != "backfill" || len(event.Content.Conversations) != 2 {
+			t.Fatalf("回填事件 = %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("未收到回填事件")
+	}
+}
+
+func TestBackfillLimits(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+
+	env.createMessage(t, models.Message{SenderID: bob.ID, ReceiverID: alice.ID, Content: "from bob"})
+	time.Sleep(time.Millisecond)
+	env.createMessage(t, models.Message{SenderID: carol.ID, ReceiverID: alice.ID, Content: "from carol"})
+
+	// 会话数量上限
+	withBackfillConfig(t, 1, 20, 1<<20)
+	backfill, err := env.messages.BuildBackfill(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("构建回填失败: %v", err)
+	}
+	if len(backfill.Conversations) != 1 {
+		t.Fatalf("回填会话数 = %d，期望 1", len(backfill.Conversations))
+	}
+
+	// 超出大小上限时截断
+	config.AppConfig.WSBackfillConversations = 5
+	config.AppConfig.WSBackfillMaxBytes = 10
+	backfill, err = env.messages.BuildBackfill(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("构建回填失败: %v", err)
+	}
+	if !backfill.Truncated || len(backfill.Conversations) != 0 {
+		t.Fatalf("超出上限的回填 = %+v，期望截断且为空", backfill)
+	}
+}
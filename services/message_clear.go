@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// clearedBeforeKey 用户清空会话时间的缓存键，值为Unix纳秒，0表示未清空
+func clearedBeforeKey(userID uint, conversationID string) string {
+	return RedisKey("cleared_before:%d:%s", userID, conversationID)
+}
+
+// ClearHistory 为当前用户清空会话记录，不影响对方或其他群成员
+// 清空时间之前的消息不再出现在该用户的历史、回填和导出中，会话也会从最近聊天中移除直到有新消息
+func (s *MessageService) ClearHistory(userID, targetID uint, isGroup bool) (time.Time, error) {
+	if isGroup {
+		rank, err := s.groupRank(targetID, userID)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if rank == rankNone {
+			return time.Time{}, ErrNotConversationUser
+		}
+	} else if _, err := s.userService.GetUserByID(targetID); err != nil {
+		return time.Time{}, err
+	}
+
+	conversationID := targetConversationKey(userID, targetID, isGroup)
+	record := models.ConversationClear{
+		UserID:         userID,
+		ConversationID: conversationID,
+		ClearedBefore:  time.Now(),
+	}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "conversation_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"cleared_before"}),
+	}).Create(&record).Error; err != nil {
+		return time.Time{}, err
+	}
+
+	ctx := context.Background()
+	s.rdb.Set(ctx, clearedBeforeKey(userID, conversationID), record.ClearedBefore.UnixNano(),
+		time.Duration(config.AppConfig.CacheExpiration)*time.Second)
+
+	// 被清空的消息同时视为已读，避免留下无法查看的未读数
+	if err := s.MarkMessagesAsRead(userID, targetID, isGroup, 0); err != nil {
+		return time.Time{}, err
+	}
+	s.rdb.Del(ctx, recentChatsKey(userID))
+
+	return record.ClearedBefore, nil
+}
+
+// clearedBefore 获取用户清空会话的时间，零值表示未清空
+func (s *MessageService) clearedBefore(ctx context.Context, userID, targetID uint, isGroup bool) time.Time {
+	conversationID := targetConversationKey(userID, targetID, isGroup)
+	key := clearedBeforeKey(userID, conversationID)
+
+	// 先尝试从缓存获取
+	if cached, err := s.rdb.Get(ctx, key).Result(); err == nil {
+		if nanos, err := strconv.ParseInt(cached, 10, 64); err == nil {
+			if nanos == 0 {
+				return time.Time{}
+			}
+			return time.Unix(0, nanos)
+		}
+	}
+
+	var record models.ConversationClear
+	var nanos int64
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND conversation_id = ?", userID, conversationID).
+		Limit(1).Find(&record).Error; err == nil && !record.ClearedBefore.IsZero() {
+		nanos = record.ClearedBefore.UnixNano()
+	}
+	s.rdb.Set(ctx, key, nanos, time.Duration(config.AppConfig.CacheExpiration)*time.Second)
+
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestClearHistoryOnlyForClearer(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", alice, bob)
+
+	past := time.Now().Add(-time.Hour)
+	env.createMessage(t, models.Message{SenderID: bob.ID, ReceiverID: alice.ID, Content: "old1", CreatedAt: past})
+	env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "old2", CreatedAt: past})
+	env.createMessage(t, models.Message{SenderID: bob.ID, GroupID: group.ID, Content: "old group", CreatedAt: past})
+	env.seedGroupActivity(t, group.ID)
+
+	hasChat := func(userID, targetID uint, chatType string) bool {
+		t.Helper()
+		chats, err := s.GetRecentChats(ctx, userID)
+		if err != nil {
+			t.Fatalf("获取最近聊天失败: %v", err)
+		}
+		for _, chat := range chats {
+			if chat.TargetID == targetID && chat.Type == chatType {
+				return true
+			}
+		}
+		return false
+	}
+	private := func(userID, peerID uint) int {
+		t.Helper()
+		messages, err := s.GetMessagesByUser(ctx, userID, peerID, 50, 0)
+		if err != nil {
+			t.Fatalf("获取私聊消息失败: %v", err)
+		}
+		return len(messages)
+	}
+	if !hasChat(alice.ID, bob.ID, "private") {
+		t.Fatal("清空前最近聊天应包含该会话")
+	}
+
+	if _, err := s.ClearHistory(alice.ID, bob.ID, false); err != nil {
+		t.Fatalf("清空会话失败: %v", err)
+	}
+
+	// 清空者看不到旧消息，对方不受影响
+	if got := private(alice.ID, bob.ID); got != 0 {
+		t.Fatalf("清空后 alice 看到 %d 条消息，期望 0", got)
+	}
+	if got := private(bob.ID, alice.ID); got != 2 {
+		t.Fatalf("清空后 bob 看到 %d 条消息，期望 2", got)
+	}
+	if hasChat(alice.ID, bob.ID, "private") {
+		t.Fatal("清空后会话应从最近聊天中移除")
+	}
+	if !hasChat(bob.ID, alice.ID, "private") {
+		t.Fatal("对方的最近聊天不应受影响")
+	}
+	if got := s.getUnreadCount(alice.ID, bob.ID, false); got != 0 {
+		t.Fatalf("清空后未读数 = %d，期望 0", got)
+	}
+
+	// 清空时间持久化，缓存失效后仍然有效
+	env.mr.FlushAll()
+	env.seedGroupActivity(t, group.ID)
+	if got := private(alice.ID, bob.ID); got != 0 {
+		t.Fatalf("缓存失效后 alice 看到 %d 条消息，期望 0", got)
+	}
+
+	// 新消息到达后会话重新出现，只显示新消息
+	time.Sleep(time.Millisecond)
+	env.createMessage(t, models.Message{SenderID: bob.ID, ReceiverID: alice.ID, Content: "new"})
+	env.rdb.Del(ctx, recentChatsKey(alice.ID))
+	if got := private(alice.ID, bob.ID); got != 1 {
+		t.Fatalf("新消息后 alice 看到 %d 条消息，期望 1", got)
+	}
+	if !hasChat(alice.ID, bob.ID, "private") {
+		t.Fatal("新消息到达后会话应重新出现在最近聊天中")
+	}
+
+	// 群聊同样只对清空者生效，非成员不能清空
+	if _, err := s.ClearHistory(alice.ID, group.ID, true); err != nil {
+		t.Fatalf("清空群聊失败: %v", err)
+	}
+	if messages, _ := s.GetGroupMessages(ctx, alice.ID, group.ID, 50, 0); len(messages) != 0 {
+		t.Fatalf("清空后 alice 的群消息 = %d 条，期望 0", len(messages))
+	}
+	if messages, _ := s.GetGroupMessages(ctx, bob.ID, group.ID, 50, 0); len(messages) == 0 {
+		t.Fatal("其他成员的群消息不应受影响")
+	}
+	if _, err := s.ClearHistory(carol.ID, group.ID, true); !errors.Is(err, ErrNotConversationUser) {
+		t.Fatalf("非成员清空群聊 = %v，期望 ErrNotConversationUser", err)
+	}
+}
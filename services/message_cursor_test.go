@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestHistoryCursorPagination(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	group := env.createGroup(t, "g", alice, bob)
+
+	base := time.Now().Add(-time.Hour)
+	var private, grouped []uint
+	for i := 0; i < 5; i++ {
+		at := base.Add(time.Duration(i) * time.Minute)
+		private = append(private, env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: fmt.Sprint(i), CreatedAt: at}).ID)
+		grouped = append(grouped, env.createMessage(t, models.Message{SenderID: bob.ID, GroupID: group.ID, Content: fmt.Sprint(i), CreatedAt: at}).ID)
+	}
+
+	tests := []struct {
+		name  string
+		fetch func(beforeID uint, limit int) ([]models.MessageResponse, *uint, error)
+		ids   []uint
+		send  func()
+	}{
+		{
+			"私聊",
+			func(beforeID uint, limit int) ([]models.MessageResponse, *uint, error) {
+				return s.GetMessagesByUserBefore(ctx, bob.ID, alice.ID, beforeID, limit)
+			},
+			private,
+			func() { env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "new"}) },
+		},
+		{
+			"群聊",
+			func(beforeID uint, limit int) ([]models.MessageResponse, *uint, error) {
+				return s.GetGroupMessagesBefore(ctx, alice.ID, group.ID, beforeID, limit)
+			},
+			grouped,
+			func() { env.createMessage(t, models.Message{SenderID: bob.ID, GroupID: group.ID, Content: "new"}) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 从最新处按游标向前翻页，翻页途中有新消息也不会重复或错位
+			seen := make(map[uint]bool)
+			var pages [][]uint
+			before := uint(math.MaxUint32)
+			for {
+				messages, next, err := tt.fetch(before, 2)
+				if err != nil {
+					t.Fatalf("获取消息失败: %v", err)
+				}
+				var page []uint
+				for _, msg := range messages {
+					if seen[msg.ID] {
+						t.Fatalf("消息%d重复出现", msg.ID)
+					}
+					seen[msg.ID] = true
+					page = append(page, msg.ID)
+				}
+				pages = append(pages, page)
+				if next == nil {
+					break
+				}
+				if *next != page[0] {
+					t.Fatalf("next_cursor = %d，期望本页最早的消息 %v", *next, page)
+				}
+				before = *next
+				if len(pages) == 1 {
+					tt.send()
+				}
+			}
+
+			// 每页按时间正序返回
+			want := [][]uint{{tt.ids[3], tt.ids[4]}, {tt.ids[1], tt.ids[2]}, {tt.ids[0]}}
+			if fmt.Sprint(pages) != fmt.Sprint(want) {
+				t.Fatalf("分页结果 = %v，期望 %v", pages, want)
+			}
+		})
+	}
+
+	// 刚好取完时下一页为空，游标为空
+	messages, next, err := s.GetMessagesByUserBefore(ctx, bob.ID, alice.ID, private[0], 2)
+	if err != nil || len(messages) != 0 || next != nil {
+		t.Fatalf("最早消息之前 = %v, %v, %v，期望为空", messages, next, err)
+	}
+}
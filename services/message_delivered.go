@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"chatroom/models"
+)
+
+// deliveredReceiptTTL 送达回执去重标记的有效期，接收者多个设备或节点重复收到时只回执一次
+const deliveredReceiptTTL = 24 * time.Hour
+
+// deliveredKey 消息已发送送达回执的标记键
+func deliveredKey(messageID uint) string {
+	return RedisKey("delivered:%d", messageID)
+}
+
+// privateMessageHeader 从投递给用户的数据中解析私聊消息的ID和收发双方
+// 只有消息响应本身（而非事件封装）才会解析成功，系统消息和群消息返回false
+func privateMessageHeader(message []byte) (id, senderID, receiverID uint, ok bool) {
+	var header struct {
+		SchemaVersion int                `json:"schema_version"`
+		ID            uint               `json:"id"`
+		Type          models.MessageType `json:"type"`
+		SenderID      uint               `json:"sender_id"`
+		ReceiverID    uint               `json:"receiver_id"`
+		GroupID       uint               `json:"group_id"`
+	}
+	if err := json.Unmarshal(message, &header); err != nil {
+		return 0, 0, 0, false
+	}
+	if header.SchemaVersion != 0 || header.ID == 0 || header.SenderID == 0 || header.GroupID > 0 ||
+		header.Type == models.SystemMessage {
+		return 0, 0, 0, false
+	}
+	return header.ID, header.SenderID, header.ReceiverID, true
+}
+
+// notifyDelivered 私聊消息放入接收者连接的发送队列后，向发送者推送 delivered 回执
+func (m *WebSocketManager) notifyDelivered(userID uint, message []byte) {
+	messageID, senderID, receiverID, ok := privateMessageHeader(message)
+	if !ok || receiverID != userID || senderID == userID {
+		return
+	}
+	go m.messageService.sendDeliveredReceipt(messageID, senderID, userID)
+}
+
+// sendDeliveredReceipt 发送送达回执，同一消息只发送一次
+func (s *MessageService) sendDeliveredReceipt(messageID, senderID, receiverID uint) {
+	ok, err := s.rdb.SetNX(context.Background(), deliveredKey(messageID), 1, deliveredReceiptTTL).Result()
+	if err != nil || !ok {
+		return
+	}
+
+	payload, _ := json.Marshal(models.MessageDeliveredEvent{
+		MessageID:   messageID,
+		ReceiverID:  receiverID,
+		DeliveredAt: time.Now(),
+	})
+	s.PublishUserEvent(senderID, "delivered", payload)
+}
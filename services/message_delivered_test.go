@@ -0,0 +1,78 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+// deliveredReceipts 解析连接上收到的 delivered 回执，合并写出的帧按换行拆分
+func deliveredReceipts(conn *fakeConn) []models.MessageDeliveredEvent {
+	var receipts []models.MessageDeliveredEvent
+	for _, frame := range conn.textFrames() {
+		for _, line := range bytes.Split(frame, []byte{'\n'}) {
+			var event WebSocketMessage
+			if json.Unmarshal(line, &event) != nil || event.Type != "delivered" {
+				continue
+			}
+			var receipt models.MessageDeliveredEvent
+			json.Unmarshal(event.Content, &receipt)
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts
+}
+
+func TestDeliveredReceiptEchoedToSender(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	env.messages.SetDirectDelivery(m.SendToUser)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", alice, bob)
+	_, aliceConn, aliceDone := connectClient(t, m, alice)
+	bobClient, _, bobDone := connectClient(t, m, bob)
+	t.Cleanup(func() {
+		m.UnregisterClient(bobClient)
+		m.DisconnectUser(alice.ID, "")
+		waitClosed(t, aliceDone)
+		waitClosed(t, bobDone)
+	})
+
+	send := func(msg *models.Message) *models.Message {
+		t.Helper()
+		if err := env.messages.ProcessMessage(msg); err != nil {
+			t.Fatalf("发送消息失败: %v", err)
+		}
+		return msg
+	}
+	// 群消息和发给离线用户的消息没有送达回执
+	send(&models.Message{SenderID: alice.ID, GroupID: group.ID, Type: models.GroupMessage, Content: "group"})
+	send(&models.Message{SenderID: alice.ID, ReceiverID: carol.ID, Type: models.PrivateMessage, Content: "offline"})
+	msg := send(&models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Type: models.PrivateMessage, Content: "hi"})
+
+	var receipts []models.MessageDeliveredEvent
+	for i := 0; i < 200 && len(receipts) == 0; i++ {
+		time.Sleep(time.Millisecond)
+		receipts = deliveredReceipts(aliceConn)
+	}
+	if len(receipts) != 1 || receipts[0].MessageID != msg.ID || receipts[0].ReceiverID != bob.ID || receipts[0].DeliveredAt.IsZero() {
+		t.Fatalf("送达回执 = %+v，期望消息 %d 的一条回执", receipts, msg.ID)
+	}
+
+	// 同一消息再次推送给接收者（如另一设备或节点）不重复回执
+	resp, err := env.messages.convertMessagesToResponse([]models.Message{*msg}, bob.ID)
+	if err != nil {
+		t.Fatalf("转换消息失败: %v", err)
+	}
+	payload, _ := json.Marshal(resp[0])
+	m.SendToUser(bob.ID, payload)
+	time.Sleep(20 * time.Millisecond)
+	if receipts := deliveredReceipts(aliceConn); len(receipts) != 1 {
+		t.Fatalf("重复推送后送达回执 = %+v，期望仍为 1 条", receipts)
+	}
+}
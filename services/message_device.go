@@ -0,0 +1,52 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxSentFromLength 消息发送设备标识的最大字符数
+const maxSentFromLength = 32
+
+// SentFromHeader REST发送消息时客户端声明设备的请求头
+const SentFromHeader = "X-Client-Device"
+
+// SentFrom 返回消息的发送设备标识
+// 优先使用客户端声明的设备名（去除控制字符并截断），未声明时只从User-Agent粗略识别平台，
+// 不保存完整的User-Agent
+func SentFrom(declared, userAgent string) string {
+	declared = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(declared))
+	if declared != "" {
+		if runes := []rune(declared); len(runes) > maxSentFromLength {
+			declared = string(runes[:maxSentFromLength])
+		}
+		return declared
+	}
+	return platformFromUserAgent(userAgent)
+}
+
+// platformFromUserAgent 从User-Agent识别客户端平台，无法识别时返回空
+func platformFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return ""
+	case strings.Contains(ua, "android"):
+		return "android"
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"):
+		return "ios"
+	case strings.Contains(ua, "windows"):
+		return "windows"
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os"):
+		return "macos"
+	case strings.Contains(ua, "linux"):
+		return "linux"
+	default:
+		return ""
+	}
+}
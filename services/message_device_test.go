@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"chatroom/models"
+)
+
+func TestSentFrom(t *testing.T) {
+	tests := []struct {
+		declared, userAgent string
+		want                string
+	}{
+		{"Pixel 8", "Mozilla/5.0 (Linux; Android 14)", "Pixel 8"},
+		{"  web\n\x00 ", "", "web"},
+		{strings.Repeat("设", 40), "", strings.Repeat("设", maxSentFromLength)},
+		{"", "Mozilla/5.0 (Linux; Android 14)", "android"},
+		{"", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", "ios"},
+		{"", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "windows"},
+		{"", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0)", "macos"},
+		{"", "Mozilla/5.0 (X11; Linux x86_64)", "linux"},
+		{"", "curl/8.0", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := SentFrom(tt.declared, tt.userAgent); got != tt.want {
+			t.Errorf("SentFrom(%q, %q) = %q，期望 %q", tt.declared, tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestSentFromVisibleOnlyToSender(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	msg := &models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Type: models.PrivateMessage, Content: "hi", SentFrom: "Pixel 8"}
+	if err := env.messages.ProcessMessage(msg); err != nil {
+		t.Fatalf("发送消息失败: %v", err)
+	}
+
+	for _, tt := range []struct {
+		viewer *models.User
+		peer   *models.User
+		want   string
+	}{
+		{alice, bob, "Pixel 8"},
+		{bob, alice, ""},
+	} {
+		history, err := env.messages.GetMessagesByUser(context.Background(), tt.viewer.ID, tt.peer.ID, 20, 0)
+		if err != nil || len(history) != 1 {
+			t.Fatalf("%s 获取历史 = %+v, %v", tt.viewer.Username, history, err)
+		}
+		if history[0].SentFrom != tt.want {
+			t.Errorf("%s 看到的发送设备 = %q，期望 %q", tt.viewer.Username, history[0].SentFrom, tt.want)
+		}
+	}
+}
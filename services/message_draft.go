@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"chatroom/models"
+)
+
+// draftTTL 草稿保存时间，每次更新后重新计时
+const draftTTL = 7 * 24 * time.Hour
+
+// draftKey 用户在会话中的草稿键
+func draftKey(userID uint, conversationID string) string {
+	return RedisKey("draft:%d:%s", userID, conversationID)
+}
+
+// SaveDraft 保存用户在会话中的草稿，内容为空时删除草稿
+func (s *MessageService) SaveDraft(userID, targetID uint, isGroup bool, content string) (*models.Draft, error) {
+	ctx := context.Background()
+	key := draftKey(userID, targetConversationKey(userID, targetID, isGroup))
+
+	if content == "" {
+		return nil, s.rdb.Del(ctx, key).Err()
+	}
+
+	draft := models.Draft{Content: content, UpdatedAt: time.Now()}
+	draftJSON, _ := json.Marshal(draft)
+	if err := s.rdb.Set(ctx, key, draftJSON, draftTTL).Err(); err != nil {
+		return nil, err
+	}
+	return &draft, nil
+}
+
+// GetDraft 获取用户在会话中的草稿，没有草稿时返回nil
+func (s *MessageService) GetDraft(userID, targetID uint, isGroup bool) (*models.Draft, error) {
+	ctx := context.Background()
+	key := draftKey(userID, targetConversationKey(userID, targetID, isGroup))
+
+	draftJSON, err := s.rdb.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var draft models.Draft
+	if err := json.Unmarshal([]byte(draftJSON), &draft); err != nil {
+		return nil, nil
+	}
+	return &draft, nil
+}
+
+// clearDraft 消息发出后清除发送者在该会话中的草稿
+func (s *MessageService) clearDraft(msg *models.Message) {
+	conversationID := conversationKey(msg.SenderID, msg.ReceiverID, msg.GroupID)
+	s.rdb.Del(context.Background(), draftKey(msg.SenderID, conversationID))
+}
+
+// attachDrafts 为最近聊天列表填充草稿
+// 草稿独立于列表缓存变化，因此每次读取时单独查询
+func (s *MessageService) attachDrafts(userID uint, chats []models.RecentChat) {
+	if len(chats) == 0 {
+		return
+	}
+
+	keys := make([]string, len(chats))
+	for i, chat := range chats {
+		keys[i] = draftKey(userID, targetConversationKey(userID, chat.TargetID, chat.Type == "group"))
+	}
+
+	values, err := s.rdb.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		return
+	}
+	for i, value := range values {
+		draftJSON, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var draft models.Draft
+		if json.Unmarshal([]byte(draftJSON), &draft) == nil {
+			chats[i].Draft = &draft
+		}
+	}
+}
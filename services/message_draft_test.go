@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"chatroom/models"
+)
+
+func TestDraftSaveRetrieveAndClearOnSend(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	group := env.createGroup(t, "g", alice, bob)
+	env.createMessage(t, models.Message{SenderID: bob.ID, ReceiverID: alice.ID, Content: "hi"})
+	env.createMessage(t, models.Message{SenderID: bob.ID, GroupID: group.ID, Content: "hi"})
+	env.seedGroupActivity(t, group.ID)
+
+	if draft, err := s.GetDraft(alice.ID, bob.ID, false); err != nil || draft != nil {
+		t.Fatalf("没有草稿时 = %+v, %v，期望 nil", draft, err)
+	}
+
+	if _, err := s.SaveDraft(alice.ID, bob.ID, false, "half typed"); err != nil {
+		t.Fatalf("保存草稿失败: %v", err)
+	}
+	if _, err := s.SaveDraft(alice.ID, group.ID, true, "group draft"); err != nil {
+		t.Fatalf("保存草稿失败: %v", err)
+	}
+	draft, err := s.GetDraft(alice.ID, bob.ID, false)
+	if err != nil || draft == nil || draft.Content != "half typed" {
+		t.Fatalf("获取草稿 = %+v, %v", draft, err)
+	}
+	// 草稿只属于保存者本人
+	if draft, _ := s.GetDraft(bob.ID, alice.ID, false); draft != nil {
+		t.Fatalf("对方不应看到草稿: %+v", draft)
+	}
+
+	// 最近聊天中携带草稿
+	drafts := func(userID uint) map[string]string {
+		t.Helper()
+		chats, err := s.GetRecentChats(ctx, userID)
+		if err != nil {
+			t.Fatalf("获取最近聊天失败: %v", err)
+		}
+		got := make(map[string]string)
+		for _, chat := range chats {
+			if chat.Draft != nil {
+				got[chat.Type] = chat.Draft.Content
+			}
+		}
+		return got
+	}
+	if got := drafts(alice.ID); got["private"] != "half typed" || got["group"] != "group draft" {
+		t.Fatalf("最近聊天草稿 = %v", got)
+	}
+	if got := drafts(bob.ID); len(got) != 0 {
+		t.Fatalf("bob 的最近聊天不应有草稿: %v", got)
+	}
+
+	// 发送消息后清除该会话的草稿，其他会话不受影响
+	msg := &models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Type: models.PrivateMessage, Content: "done"}
+	if err := s.ProcessMessage(msg); err != nil {
+		t.Fatalf("发送消息失败: %v", err)
+	}
+	if draft, _ := s.GetDraft(alice.ID, bob.ID, false); draft != nil {
+		t.Fatalf("发送后草稿 = %+v，期望已清除", draft)
+	}
+	if draft, _ := s.GetDraft(alice.ID, group.ID, true); draft == nil {
+		t.Fatal("其他会话的草稿不应被清除")
+	}
+
+	// 保存空内容即删除草稿
+	if _, err := s.SaveDraft(alice.ID, group.ID, true, ""); err != nil {
+		t.Fatalf("删除草稿失败: %v", err)
+	}
+	if draft, _ := s.GetDraft(alice.ID, group.ID, true); draft != nil {
+		t.Fatalf("删除后草稿 = %+v", draft)
+	}
+
+	// 草稿过期后自动删除
+	if _, err := s.SaveDraft(alice.ID, bob.ID, false, "later"); err != nil {
+		t.Fatalf("保存草稿失败: %v", err)
+	}
+	env.mr.FastForward(draftTTL)
+	if draft, _ := s.GetDraft(alice.ID, bob.ID, false); draft != nil {
+		t.Fatalf("过期后草稿 = %+v", draft)
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/models"
+)
+
+// messageEditWindow 消息发送后可以编辑的时长
+const messageEditWindow = 15 * time.Minute
+
+// 消息编辑相关错误
+var (
+	ErrNotMessageAuthor  = errors.New("只能编辑自己发送的消息")
+	ErrEditWindowExpired = errors.New("消息发送已超过15分钟，无法编辑")
+)
+
+// EditMessage 编辑自己发送的消息内容，只能在发送后 messageEditWindow 内编辑
+// 编辑后清理会话缓存，并向会话成员推送 message_edited 事件
+func (s *MessageService) EditMessage(messageID, userID uint, content string) (*models.MessageResponse, error) {
+	var msg models.Message
+	if err := s.db.First(&msg, messageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageAlreadyGone
+	}
+	if msg.SenderID != userID {
+		return nil, ErrNotMessageAuthor
+	}
+	if msg.Type == models.SystemMessage {
+		return nil, ErrSystemMessageAction
+	}
+	now := time.Now()
+	if now.Sub(msg.CreatedAt) > messageEditWindow {
+		return nil, ErrEditWindowExpired
+	}
+	if err := ValidateContent(content); err != nil {
+		return nil, err
+	}
+
+	// 私聊内容按当前密钥重新加密，返回前再由 convertMessagesToResponse 解密
+	msg.Content = content
+	msg.Nonce = ""
+	plaintext, err := s.encryptContent(&msg)
+	if err != nil {
+		return nil, err
+	}
+	result := s.db.Model(&models.Message{}).
+		Where("id = ? AND deleted_at IS NULL", msg.ID).
+		Updates(map[string]interface{}{
+			"content":   msg.Content,
+			"nonce":     msg.Nonce,
+			"edited_at": now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrMessageAlreadyGone
+	}
+	msg.EditedAt = &now
+
+	responses, err := s.convertMessagesToResponse([]models.Message{msg}, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 清理缓存并通知会话成员
+	s.invalidateConversationCaches(&msg)
+	eventJSON, _ := json.Marshal(models.MessageEditedEvent{
+		MessageID:  msg.ID,
+		Type:       msg.Type,
+		SenderID:   msg.SenderID,
+		ReceiverID: msg.ReceiverID,
+		GroupID:    msg.GroupID,
+		Content:    plaintext,
+		EditedAt:   now,
+	})
+	s.publishConversationEvent("message_edited", eventJSON, &msg)
+
+	return &responses[0], nil
+}
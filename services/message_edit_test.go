@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestEditMessage(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := context.Background()
+	delivered := recordDeliveries(s)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	msg := env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "helo"})
+
+	// 预先填充双方的最近聊天缓存
+	for _, userID := range []uint{alice.ID, bob.ID} {
+		if _, err := s.GetRecentChats(ctx, userID); err != nil {
+			t.Fatalf("获取最近聊天失败: %v", err)
+		}
+		if !env.mr.Exists(recentChatsKey(userID)) {
+			t.Fatalf("用户%d的最近聊天未缓存", userID)
+		}
+	}
+
+	edited, err := s.EditMessage(msg.ID, alice.ID, "hello")
+	if err != nil {
+		t.Fatalf("编辑消息失败: %v", err)
+	}
+	if edited.Content != "hello" || edited.EditedAt == nil {
+		t.Fatalf("编辑结果 = %+v", edited)
+	}
+	history, err := s.GetMessagesInRange(alice.ID, bob.ID, false, msg.CreatedAt.Add(-time.Second), msg.CreatedAt.Add(time.Second), 50, 0)
+	if err != nil || len(history) != 1 || history[0].Content != "hello" || history[0].EditedAt == nil {
+		t.Fatalf("历史记录 = %+v, %v，期望显示编辑后的内容", history, err)
+	}
+
+	// 编辑后清理双方缓存
+	for _, userID := range []uint{alice.ID, bob.ID} {
+		if env.mr.Exists(recentChatsKey(userID)) {
+			t.Fatalf("用户%d的最近聊天缓存未清理", userID)
+		}
+	}
+
+	// 会话双方收到 message_edited 事件
+	notified := make(map[uint]models.MessageEditedEvent)
+	for _, d := range delivered() {
+		if d.event.Type != "message_edited" {
+			continue
+		}
+		var event models.MessageEditedEvent
+		if err := json.Unmarshal(d.event.Content, &event); err != nil {
+			t.Fatalf("解析编辑事件失败: %v", err)
+		}
+		notified[d.userID] = event
+	}
+	for _, userID := range []uint{alice.ID, bob.ID} {
+		event, ok := notified[userID]
+		if !ok {
+			t.Fatalf("用户%d没有收到 message_edited 事件", userID)
+		}
+		if event.MessageID != msg.ID || event.Content != "hello" || event.EditedAt.IsZero() {
+			t.Fatalf("编辑事件 = %+v", event)
+		}
+	}
+
+	old := env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "old"})
+	env.db.Model(old).Update("created_at", time.Now().Add(-messageEditWindow-time.Minute))
+
+	tests := []struct {
+		name      string
+		messageID uint
+		userID    uint
+		want      error
+	}{
+		{"非作者编辑", msg.ID, bob.ID, ErrNotMessageAuthor},
+		{"超过编辑时限", old.ID, alice.ID, ErrEditWindowExpired},
+		{"消息不存在", 9999, alice.ID, ErrMessageNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := s.EditMessage(tt.messageID, tt.userID, "x"); !errors.Is(err, tt.want) {
+			t.Errorf("%s = %v，期望 %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// exportPageSize 导出时每页从数据库读取的消息数
+const exportPageSize = 500
+
+// ConversationExport 会话导出游标，按消息ID分页读取并逐行写出NDJSON，内存占用与会话大小无关
+type ConversationExport struct {
+	service  *MessageService
+	userID   uint
+	query    func() *gorm.DB // 会话范围内的消息查询，每页重新构建
+	manifest models.ExportManifest
+
+	maxID     uint  // 导出开始时的最大消息ID，之后的新消息不导出
+	lastID    uint  // 已写出的最后一条消息ID
+	remaining int64 // 还可以写出的消息数
+	started   bool
+}
+
+// NewConversationExport 创建会话导出，私聊为请求者与对方的消息，群聊要求请求者为群成员并遵循历史可见范围
+func (s *MessageService) NewConversationExport(userID, targetID uint, isGroup bool) (*ConversationExport, error) {
+	var base func() *gorm.DB
+	if isGroup {
+		rank, err := s.groupRank(targetID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if rank == rankNone {
+			return nil, ErrNotConversationUser
+		}
+		since, err := s.historyVisibleSince(context.Background(), userID, targetID)
+		if err != nil {
+			return nil, err
+		}
+		base = func() *gorm.DB {
+			q := s.db.Model(&models.Message{}).Where("group_id = ? AND deleted_at IS NULL", targetID)
+			if !since.IsZero() {
+				q = q.Where("created_at >= ?", since)
+			}
+			return q
+		}
+	} else {
+		base = func() *gorm.DB {
+			return s.db.Model(&models.Message{}).
+				Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)", userID, targetID, targetID, userID).
+				Where("group_id = 0 AND deleted_at IS NULL")
+		}
+	}
+
+	// 请求者清空过的消息不导出
+	query := base
+	if cleared := s.clearedBefore(context.Background(), userID, targetID, isGroup); !cleared.IsZero() {
+		query = func() *gorm.DB {
+			return base().Where("created_at > ?", cleared)
+		}
+	}
+
+	export := &ConversationExport{
+		service: s,
+		userID:  userID,
+		query:   query,
+		manifest: models.ExportManifest{
+			Type:           "manifest",
+			ConversationID: targetConversationKey(userID, targetID, isGroup),
+			ExportedAt:     time.Now(),
+		},
+	}
+
+	// 固定导出范围，导出过程中到达的新消息不计入
+	if err := query().Select("COALESCE(MAX(id), 0)").Scan(&export.maxID).Error; err != nil {
+		return nil, err
+	}
+	if err := query().Where("id <= ?", export.maxID).Count(&export.manifest.Total).Error; err != nil {
+		return nil, err
+	}
+
+	limit := int64(config.AppConfig.MessageExportMax)
+	export.manifest.Count = export.manifest.Total
+	if export.manifest.Total > limit {
+		export.manifest.Count = limit
+		export.manifest.Truncated = true
+	}
+	export.remaining = export.manifest.Count
+
+	return export, nil
+}
+
+// WriteNext 写出下一段内容：首次调用写清单行，之后每次写一页消息（按时间顺序）
+// 返回false表示导出已完成或出错，可直接用作 gin.Context.Stream 的步骤函数
+func (e *ConversationExport) WriteNext(w io.Writer) (bool, error) {
+	encoder := json.NewEncoder(w)
+
+	if !e.started {
+		e.started = true
+		if err := encoder.Encode(e.manifest); err != nil {
+			return false, err
+		}
+		return e.remaining > 0, nil
+	}
+
+	pageSize := int64(exportPageSize)
+	if e.remaining < pageSize {
+		pageSize = e.remaining
+	}
+
+	var messages []models.Message
+	if err := e.query().Preload("Sender").
+		Where("id > ? AND id <= ?", e.lastID, e.maxID).
+		Order("id ASC").
+		Limit(int(pageSize)).
+		Find(&messages).Error; err != nil {
+		return false, err
+	}
+	if len(messages) == 0 {
+		return false, nil
+	}
+
+	responses, err := e.service.messagesToResponses(messages, e.userID)
+	if err != nil {
+		return false, err
+	}
+	for _, resp := range responses {
+		if err := encoder.Encode(resp); err != nil {
+			return false, err
+		}
+	}
+
+	e.lastID = messages[len(messages)-1].ID
+	e.remaining -= int64(len(messages))
+	return e.remaining > 0, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestConversationExportAscendingAcrossPages(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	total := exportPageSize*2 + 37
+	base := time.Now().Add(-time.Hour)
+	messages := make([]models.Message, 0, total)
+	for i := 0; i < total; i++ {
+		sender, receiver := alice.ID, bob.ID
+		if i%2 == 1 {
+			sender, receiver = bob.ID, alice.ID
+		}
+		messages = append(messages, models.Message{
+			Content:    "hello",
+			Type:       models.PrivateMessage,
+			SenderID:   sender,
+			ReceiverID: receiver,
+			CreatedAt:  base.Add(time.Duration(i) * time.Millisecond),
+		})
+	}
+	if err := env.db.CreateInBatches(messages, 200).Error; err != nil {
+		t.Fatalf("写入消息失败: %v", err)
+	}
+
+	export, err := env.messages.NewConversationExport(alice.ID, bob.ID, false)
+	if err != nil {
+		t.Fatalf("创建导出失败: %v", err)
+	}
+	var buf bytes.Buffer
+	for {
+		more, err := export.WriteNext(&buf)
+		if err != nil {
+			t.Fatalf("导出失败: %v", err)
+		}
+		if !more {
+			break
+		}
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	if !scanner.Scan() {
+		t.Fatal("缺少清单行")
+	}
+	var manifest models.ExportManifest
+	if err := json.Unmarshal(scanner.Bytes(), &manifest); err != nil || manifest.Type != "manifest" {
+		t.Fatalf("清单行无效: %s", scanner.Text())
+	}
+
+	var lastID uint
+	count := 0
+	for scanner.Scan() {
+		var resp models.MessageResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			t.Fatalf("解析消息行失败: %v", err)
+		}
+		if resp.ID <= lastID {
+			t.Fatalf("第%d行消息ID %d 未严格递增（上一条 %d）", count+1, resp.ID, lastID)
+		}
+		lastID = resp.ID
+		count++
+	}
+	if int64(count) != manifest.Count {
+		t.Fatalf("导出 %d 条，清单记录 %d 条", count, manifest.Count)
+	}
+	if count <= exportPageSize {
+		t.Fatalf("导出 %d 条，未覆盖多页", count)
+	}
+}
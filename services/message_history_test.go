@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestGroupHistoryVisibilityForNewMembers(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	owner := env.createUser(t, "owner")
+	newcomer := env.createUser(t, "newcomer")
+	group := env.createGroup(t, "g", owner)
+
+	now := time.Now()
+	if err := env.db.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", group.ID, owner.ID).
+		Update("joined_at", now.Add(-4*time.Hour)).Error; err != nil {
+		t.Fatalf("设置入群时间失败: %v", err)
+	}
+	before := env.createMessage(t, models.Message{SenderID: owner.ID, GroupID: group.ID, Content: "before", CreatedAt: now.Add(-3 * time.Hour)})
+	after1 := env.createMessage(t, models.Message{SenderID: owner.ID, GroupID: group.ID, Content: "after1", CreatedAt: now.Add(-time.Hour)})
+	after2 := env.createMessage(t, models.Message{SenderID: owner.ID, GroupID: group.ID, Content: "after2", CreatedAt: now.Add(-30 * time.Minute)})
+
+	// 新成员在历史中途加入
+	if err := env.db.Create(&models.GroupMember{GroupID: group.ID, UserID: newcomer.ID, JoinedAt: now.Add(-2 * time.Hour)}).Error; err != nil {
+		t.Fatalf("添加成员失败: %v", err)
+	}
+
+	ids := func(userID uint) []uint {
+		t.Helper()
+		messages, err := env.messages.GetGroupMessages(ctx, userID, group.ID, 50, 0)
+		if err != nil {
+			t.Fatalf("获取群消息失败: %v", err)
+		}
+		got := make([]uint, len(messages))
+		for i, msg := range messages {
+			got[i] = msg.ID
+		}
+		return got
+	}
+	equal := func(got, want []uint) bool {
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	// 默认可查看全部历史
+	all := []uint{before.ID, after1.ID, after2.ID}
+	if got := ids(newcomer.ID); !equal(got, all) {
+		t.Fatalf("公开历史时新成员看到 %v，期望 %v", got, all)
+	}
+
+	// 仅入群后可见时只返回入群后的消息，老成员不受影响
+	if err := env.db.Model(group).Update("history_visibility", models.HistorySinceJoin).Error; err != nil {
+		t.Fatalf("设置历史可见范围失败: %v", err)
+	}
+	sinceJoin := []uint{after1.ID, after2.ID}
+	if got := ids(newcomer.ID); !equal(got, sinceJoin) {
+		t.Fatalf("仅入群后可见时新成员看到 %v，期望 %v", got, sinceJoin)
+	}
+	if got := ids(owner.ID); !equal(got, all) {
+		t.Fatalf("群主看到 %v，期望 %v", got, all)
+	}
+	outsider := env.createUser(t, "outsider")
+	if got := ids(outsider.ID); len(got) != 0 {
+		t.Fatalf("非成员看到 %v，期望为空", got)
+	}
+
+	// 游标分页同样遵守可见范围
+	messages, next, err := env.messages.GetGroupMessagesBefore(ctx, newcomer.ID, group.ID, after2.ID, 50)
+	if err != nil {
+		t.Fatalf("按游标获取群消息失败: %v", err)
+	}
+	if len(messages) != 1 || messages[0].ID != after1.ID || next != nil {
+		t.Fatalf("游标分页返回 %+v，期望只有 after1", messages)
+	}
+}
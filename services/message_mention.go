@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"chatroom/models"
+)
+
+// mentionUnreadKey 获取用户在群组中未读@提及计数的Redis键
+func mentionUnreadKey(userID, groupID uint) string {
+	return RedisKey("mention_unread:%d:group:%d", userID, groupID)
+}
+
+// incrementMentionCounts 为群消息中被@提及的成员累加未读提及计数
+func (s *MessageService) incrementMentionCounts(msg *models.Message) {
+	// 系统消息中的用户名（如入群通知）不算提及
+	if msg.Type == models.SystemMessage {
+		return
+	}
+
+	var members []struct {
+		UserID   uint
+		Username string
+	}
+	if err := s.db.Model(&models.GroupMember{}).
+		Select("group_members.user_id, users.username").
+		Joins("JOIN users ON users.id = group_members.user_id").
+		Where("group_members.group_id = ? AND group_members.user_id <> ?", msg.GroupID, msg.SenderID).
+		Scan(&members).Error; err != nil {
+		log.Printf("获取群组成员失败，跳过提及计数: %v", err)
+		return
+	}
+
+	ctx := context.Background()
+	for _, member := range members {
+		if IsMentioned(msg.Content, member.Username) {
+			s.rdb.Incr(ctx, mentionUnreadKey(member.UserID, msg.GroupID))
+		}
+	}
+}
+
+// getMentionCount 获取用户在群组中的未读提及数
+func (s *MessageService) getMentionCount(userID, groupID uint) int {
+	ctx := context.Background()
+	count, err := s.rdb.Get(ctx, mentionUnreadKey(userID, groupID)).Int()
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// resetMentionCount 已读位置变化后重新计算未读提及数
+// 已读到最新消息时直接清零，部分已读时按剩余未读消息重新统计
+func (s *MessageService) resetMentionCount(userID, groupID, lastReadID uint) {
+	ctx := context.Background()
+	key := mentionUnreadKey(userID, groupID)
+
+	latest, err := s.latestMessageID(userID, groupID, true)
+	if err != nil || lastReadID >= latest {
+		s.rdb.Del(ctx, key)
+		return
+	}
+
+	user, err := s.userService.GetUserByID(userID)
+	if err != nil {
+		s.rdb.Del(ctx, key)
+		return
+	}
+
+	var count int64
+	s.unreadQuery(userID, groupID, true).
+		Where("id > ? AND content LIKE ?", lastReadID, "%@"+user.Username+"%").
+		Count(&count)
+	if count == 0 {
+		s.rdb.Del(ctx, key)
+		return
+	}
+	s.rdb.Set(ctx, key, count, 0)
+}
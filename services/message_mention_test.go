@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"chatroom/models"
+)
+
+func TestMentionCountSeparateFromUnread(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", alice, bob, carol)
+
+	send := func(content string) *models.Message {
+		t.Helper()
+		msg := &models.Message{SenderID: alice.ID, GroupID: group.ID, Type: models.GroupMessage, Content: content}
+		if err := s.ProcessMessage(msg); err != nil {
+			t.Fatalf("发送消息失败: %v", err)
+		}
+		return msg
+	}
+	counts := func(user *models.User) (unread, mentions int) {
+		t.Helper()
+		chats, err := s.GetRecentChats(context.Background(), user.ID)
+		if err != nil {
+			t.Fatalf("获取最近聊天失败: %v", err)
+		}
+		for _, chat := range chats {
+			if chat.Type == "group" && chat.TargetID == group.ID {
+				return chat.UnreadCount, chat.MentionCount
+			}
+		}
+		t.Fatalf("最近聊天中没有群组 %d", group.ID)
+		return 0, 0
+	}
+
+	// 普通消息只增加未读数
+	plain := send("大家好")
+	if unread, mentions := counts(bob); unread != 1 || mentions != 0 {
+		t.Fatalf("普通消息后 bob 未读 = %d，提及 = %d，期望 1, 0", unread, mentions)
+	}
+
+	// @提及同时增加未读数和提及数，只影响被提及的成员
+	send("@bob 看一下")
+	if unread, mentions := counts(bob); unread != 2 || mentions != 1 {
+		t.Fatalf("提及后 bob 未读 = %d，提及 = %d，期望 2, 1", unread, mentions)
+	}
+	if unread, mentions := counts(carol); unread != 2 || mentions != 0 {
+		t.Fatalf("提及后 carol 未读 = %d，提及 = %d，期望 2, 0", unread, mentions)
+	}
+
+	// 只读到提及之前的消息时提及数保留
+	if err := s.MarkMessagesAsRead(bob.ID, group.ID, true, plain.ID); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+	if unread, mentions := counts(bob); unread != 1 || mentions != 1 {
+		t.Fatalf("部分已读后 bob 未读 = %d，提及 = %d，期望 1, 1", unread, mentions)
+	}
+
+	// 全部已读后两者清零
+	if err := s.MarkMessagesAsRead(bob.ID, group.ID, true, 0); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+	if unread, mentions := counts(bob); unread != 0 || mentions != 0 {
+		t.Fatalf("全部已读后 bob 未读 = %d，提及 = %d，期望 0, 0", unread, mentions)
+	}
+}
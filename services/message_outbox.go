@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/models"
+)
+
+const (
+	// outboxRelayInterval 发件箱中继的轮询间隔
+	outboxRelayInterval = 2 * time.Second
+	// outboxGracePeriod 新写入的发件箱记录由发送流程直接发布，中继只处理超过该时间仍未发布的记录
+	outboxGracePeriod = 5 * time.Second
+	// outboxBatchSize 每轮中继处理的最大记录数
+	outboxBatchSize = 100
+	// outboxRetention 已发布记录的保留时间
+	outboxRetention = 24 * time.Hour
+)
+
+// newOutboxMessage 为已保存的消息构建发件箱记录，私聊消息的负载与消息内容一样加密存储
+func (s *MessageService) newOutboxMessage(msg *models.Message, payload []byte) (*models.OutboxMessage, error) {
+	var topic string
+	if msg.GroupID > 0 { // 群聊消息
+		topic = s.kafka.BuildTopicName("group", msg.GroupID)
+	} else { // 私聊消息
+		topic = s.kafka.BuildTopicName("private", msg.ReceiverID)
+	}
+
+	outbox := &models.OutboxMessage{
+		MessageID: msg.ID,
+		Topic:     topic,
+		// 使用会话ID作为分区键，保证同一会话内消息有序
+		Key:       conversationKey(msg.SenderID, msg.ReceiverID, msg.GroupID),
+		Payload:   string(payload),
+		CreatedAt: time.Now(),
+	}
+	if s.encryptor != nil && msg.GroupID == 0 {
+		ciphertext, nonce, err := s.encryptor.Encrypt(outbox.Payload)
+		if err != nil {
+			return nil, err
+		}
+		outbox.Payload, outbox.Nonce = ciphertext, nonce
+	}
+	return outbox, nil
+}
+
+// outboxPayload 返回发件箱记录的明文负载
+func (s *MessageService) outboxPayload(outbox *models.OutboxMessage) ([]byte, error) {
+	if outbox.Nonce == "" {
+		return []byte(outbox.Payload), nil
+	}
+	if s.encryptor == nil {
+		return nil, fmt.Errorf("发件箱记录%d已加密，但未配置消息加密密钥", outbox.ID)
+	}
+	plaintext, err := s.encryptor.Decrypt(outbox.Payload, outbox.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("解密发件箱记录%d失败: %v", outbox.ID, err)
+	}
+	return []byte(plaintext), nil
+}
+
+// publishOutbox 发布发件箱记录，标记为已发布并清空负载，已发布的记录只保留元数据
+func (s *MessageService) publishOutbox(outbox *models.OutboxMessage) error {
+	payload, err := s.outboxPayload(outbox)
+	if err != nil {
+		return err
+	}
+	if err := s.kafka.PublishMessage(outbox.Topic, outbox.Key, payload); err != nil {
+		s.db.Model(outbox).UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+		return err
+	}
+
+	if err := s.markOutboxSent(outbox); err != nil {
+		// 标记失败时消息会被中继再次发布，接收端按消息ID去重
+		log.Printf("标记发件箱记录%d为已发布失败: %v", outbox.ID, err)
+	}
+	return nil
+}
+
+// markOutboxSent 标记发件箱记录为已发布并清空负载
+func (s *MessageService) markOutboxSent(outbox *models.OutboxMessage) error {
+	return s.db.Model(outbox).UpdateColumns(map[string]interface{}{
+		"sent_at": time.Now(),
+		"payload": "",
+		"nonce":   "",
+	}).Error
+}
+
+// RunOutboxRelay 运行发件箱中继，发布保存后未能及时发布的消息（如进程在保存与发布之间崩溃）
+func (s *MessageService) RunOutboxRelay(ctx context.Context) {
+	if s.kafka == nil {
+		log.Println("Kafka不可用，发件箱中继不启动")
+		return
+	}
+
+	ticker := time.NewTicker(outboxRelayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Kafka不可用期间积压的记录在恢复后按顺序补发
+			if s.kafka.Available() {
+				s.relayOutbox()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// relayOutbox 按写入顺序发布待发布的记录，并清理过期的已发布记录
+func (s *MessageService) relayOutbox() {
+	var pending []models.OutboxMessage
+	if err := s.db.Where("sent_at IS NULL AND created_at < ?", time.Now().Add(-outboxGracePeriod)).
+		Order("id").
+		Limit(outboxBatchSize).
+		Find(&pending).Error; err != nil {
+		log.Printf("读取发件箱失败: %v", err)
+		return
+	}
+
+	for i := range pending {
+		if err := s.publishOutbox(&pending[i]); err != nil {
+			// 遇到失败即停止本轮，保证同一会话内的消息顺序
+			log.Printf("中继发布发件箱记录%d失败: %v", pending[i].ID, err)
+			break
+		}
+	}
+
+	s.db.Where("sent_at < ?", time.Now().Add(-outboxRetention)).Delete(&models.OutboxMessage{})
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama/mocks"
+
+	"chatroom/models"
+)
+
+const outboxSecret = "outbox-secret-content"
+
+// assertNoPlaintext 检查消息表和发件箱表中都没有私聊明文
+func assertNoPlaintext(t *testing.T, env *testEnv) {
+	t.Helper()
+	var messages []models.Message
+	env.db.Find(&messages)
+	for _, m := range messages {
+		if strings.Contains(m.Content, outboxSecret) {
+			t.Fatalf("消息%d以明文存储", m.ID)
+		}
+	}
+	var outbox []models.OutboxMessage
+	env.db.Find(&outbox)
+	for _, o := range outbox {
+		if strings.Contains(o.Payload, outboxSecret) {
+			t.Fatalf("发件箱记录%d以明文存储私聊内容", o.ID)
+		}
+	}
+}
+
+func TestOutboxNoPlaintextAfterPublish(t *testing.T) {
+	withEncryptionKey(t)
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(val []byte) error {
+		if !strings.Contains(string(val), outboxSecret) {
+			return errors.New("发布到Kafka的负载不是明文")
+		}
+		return nil
+	})
+	env.messages.kafka = newTestKafka(producer, env.messages.kafka.BuildTopicName("private", bob.ID))
+
+	msg := &models.Message{Content: outboxSecret, Type: models.PrivateMessage, SenderID: alice.ID, ReceiverID: bob.ID}
+	if err := env.messages.ProcessMessage(msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	var outbox models.OutboxMessage
+	if err := env.db.First(&outbox).Error; err != nil {
+		t.Fatalf("读取发件箱失败: %v", err)
+	}
+	if outbox.SentAt == nil || outbox.Payload != "" {
+		t.Fatalf("已发布记录应清空负载: sent_at=%v payload=%q", outbox.SentAt, outbox.Payload)
+	}
+	assertNoPlaintext(t, env)
+}
+
+func TestOutboxPendingEncryptedAndRelayed(t *testing.T) {
+	withEncryptionKey(t)
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(errors.New("broker down"))
+	env.messages.kafka = newTestKafka(producer, env.messages.kafka.BuildTopicName("private", bob.ID))
+
+	msg := &models.Message{Content: outboxSecret, Type: models.PrivateMessage, SenderID: alice.ID, ReceiverID: bob.ID}
+	if err := env.messages.ProcessMessage(msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	var outbox models.OutboxMessage
+	env.db.First(&outbox)
+	if outbox.SentAt != nil || outbox.Nonce == "" {
+		t.Fatalf("发布失败的记录应保持待发布并加密: sent_at=%v nonce=%q", outbox.SentAt, outbox.Nonce)
+	}
+	assertNoPlaintext(t, env)
+
+	// 中继解密后发布明文负载
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(val []byte) error {
+		if !strings.Contains(string(val), outboxSecret) {
+			return errors.New("中继发布的负载未解密")
+		}
+		return nil
+	})
+	env.db.Model(&outbox).UpdateColumn("created_at", time.Now().Add(-time.Minute))
+	env.messages.relayOutbox()
+
+	env.db.First(&outbox)
+	if outbox.SentAt == nil || outbox.Payload != "" {
+		t.Fatalf("中继发布后应标记已发布并清空负载: sent_at=%v payload=%q", outbox.SentAt, outbox.Payload)
+	}
+	assertNoPlaintext(t, env)
+}
+
+// pendingOutbox 返回尚未发布的发件箱记录数，并将其创建时间提前到中继的等待期之外
+func pendingOutbox(t *testing.T, env *testEnv) int64 {
+	t.Helper()
+	var count int64
+	env.db.Model(&models.OutboxMessage{}).Where("sent_at IS NULL").Count(&count)
+	env.db.Model(&models.OutboxMessage{}).Where("sent_at IS NULL").UpdateColumn("created_at", time.Now().Add(-time.Minute))
+	return count
+}
+
+func TestOutboxFallbackDeliveredNotRelayed(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(errors.New("broker down"))
+	env.messages.kafka = newTestKafka(producer, env.messages.kafka.BuildTopicName("private", bob.ID))
+	var deliveries int
+	env.messages.SetDirectDelivery(func(userID uint, _ []byte) bool {
+		deliveries++
+		return userID == bob.ID
+	})
+
+	msg := &models.Message{Content: "hi", Type: models.PrivateMessage, SenderID: alice.ID, ReceiverID: bob.ID}
+	if err := env.messages.ProcessMessage(msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if deliveries != 1 {
+		t.Fatalf("直接投递 %d 次，期望 1 次", deliveries)
+	}
+	if n := pendingOutbox(t, env); n != 0 {
+		t.Fatalf("直接投递成功后仍有 %d 条待发布记录，中继会重复投递", n)
+	}
+	// 模拟生产者没有更多预期，中继若再次发布会使测试失败
+	env.messages.relayOutbox()
+}
+
+func TestOutboxFallbackRemoteReceiverRelayed(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	// bob 在其他节点在线，本节点无法直接投递
+	env.rdb.SAdd(t.Context(), onlineUsersKey(), onlineMember(bob.ID))
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(errors.New("broker down"))
+	env.messages.kafka = newTestKafka(producer, env.messages.kafka.BuildTopicName("private", bob.ID))
+	env.messages.SetDirectDelivery(func(uint, []byte) bool { return false })
+
+	msg := &models.Message{Content: "hi", Type: models.PrivateMessage, SenderID: alice.ID, ReceiverID: bob.ID}
+	if err := env.messages.ProcessMessage(msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if n := pendingOutbox(t, env); n != 1 {
+		t.Fatalf("待发布记录 %d 条，期望 1 条由中继补发", n)
+	}
+
+	producer.ExpectSendMessageAndSucceed()
+	env.messages.relayOutbox()
+	if n := pendingOutbox(t, env); n != 0 {
+		t.Fatalf("中继后仍有 %d 条待发布记录", n)
+	}
+}
+
+func TestOutboxRelayAfterCrash(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	producer := mocks.NewSyncProducer(t, nil)
+	env.messages.kafka = newTestKafka(producer, env.messages.kafka.BuildTopicName("private", bob.ID))
+
+	// 保存消息和发件箱记录后、发布前进程崩溃
+	sender, err := env.users.GetUserResponse(alice.ID)
+	if err != nil {
+		t.Fatalf("获取发送者失败: %v", err)
+	}
+	msg := &models.Message{Content: "survives", Type: models.PrivateMessage, SenderID: alice.ID, ReceiverID: bob.ID}
+	if _, _, err := env.messages.SaveMessage(msg, sender); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+
+	// 重启后中继发布该消息
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(val []byte) error {
+		var resp models.MessageResponse
+		if err := json.Unmarshal(val, &resp); err != nil || resp.ID != msg.ID || resp.Content != "survives" {
+			return errors.New("中继发布的内容不是崩溃前保存的消息")
+		}
+		return nil
+	})
+	if n := pendingOutbox(t, env); n != 1 {
+		t.Fatalf("待发布记录 %d 条，期望 1 条", n)
+	}
+	env.messages.relayOutbox()
+	if n := pendingOutbox(t, env); n != 0 {
+		t.Fatalf("中继后仍有 %d 条待发布记录", n)
+	}
+}
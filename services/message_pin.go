@@ -0,0 +1,188 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/models"
+)
+
+// PinMessage 置顶消息
+// 群聊中只有群主和管理员可以置顶，私聊中双方都可以置顶
+func (s *MessageService) PinMessage(messageID, operatorID uint) (*models.PinnedMessage, error) {
+	msg, err := s.getPinnableMessage(messageID, operatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	conversationID := conversationKey(msg.SenderID, msg.ReceiverID, msg.GroupID)
+
+	var count int64
+	if err := s.db.Model(&models.PinnedMessage{}).
+		Where("conversation_id = ? AND message_id = ?", conversationID, messageID).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrAlreadyPinned
+	}
+
+	pin := &models.PinnedMessage{
+		ConversationID: conversationID,
+		MessageID:      messageID,
+		PinnedBy:       operatorID,
+		PinnedAt:       time.Now(),
+	}
+	if err := s.db.Create(pin).Error; err != nil {
+		return nil, err
+	}
+
+	s.publishPinEvent(msg, operatorID, true)
+	return pin, nil
+}
+
+// UnpinMessage 取消置顶消息
+func (s *MessageService) UnpinMessage(messageID, operatorID uint) error {
+	msg, err := s.getPinnableMessage(messageID, operatorID)
+	if err != nil {
+		return err
+	}
+
+	conversationID := conversationKey(msg.SenderID, msg.ReceiverID, msg.GroupID)
+	result := s.db.Where("conversation_id = ? AND message_id = ?", conversationID, messageID).
+		Delete(&models.PinnedMessage{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotPinned
+	}
+
+	s.publishPinEvent(msg, operatorID, false)
+	return nil
+}
+
+// ListPinned 获取会话中的置顶消息，按置顶时间倒序
+func (s *MessageService) ListPinned(userID, targetID uint, isGroup bool) ([]models.PinnedMessageResponse, error) {
+	if isGroup {
+		rank, err := s.groupRank(targetID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if rank == rankNone {
+			return nil, ErrNotConversationUser
+		}
+	}
+
+	var pins []models.PinnedMessage
+	if err := s.db.Where("conversation_id = ?", targetConversationKey(userID, targetID, isGroup)).
+		Order("pinned_at DESC").
+		Find(&pins).Error; err != nil {
+		return nil, err
+	}
+	if len(pins) == 0 {
+		return []models.PinnedMessageResponse{}, nil
+	}
+
+	messageIDs := make([]uint, len(pins))
+	for i, pin := range pins {
+		messageIDs[i] = pin.MessageID
+	}
+
+	var messages []models.Message
+	for _, chunk := range chunkIDs(messageIDs) {
+		var batch []models.Message
+		if err := s.db.Where("id IN ? AND deleted_at IS NULL", chunk).Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		messages = append(messages, batch...)
+	}
+	messageMap := make(map[uint]models.Message, len(messages))
+	for _, msg := range messages {
+		messageMap[msg.ID] = msg
+	}
+
+	responses := make([]models.PinnedMessageResponse, 0, len(pins))
+	for _, pin := range pins {
+		msg, ok := messageMap[pin.MessageID]
+		if !ok {
+			// 已撤回的消息不再展示
+			continue
+		}
+
+		s.decryptContent(&msg)
+		sender, err := s.userService.GetUserResponse(msg.SenderID)
+		if err != nil {
+			sender = &models.UserResponse{ID: msg.SenderID, Username: "未知用户"}
+		}
+
+		responses = append(responses, models.PinnedMessageResponse{
+			Message: models.MessageResponse{
+				ID:         msg.ID,
+				Content:    msg.Content,
+				Type:       msg.Type,
+				SenderID:   msg.SenderID,
+				Sender:     *sender,
+				ReceiverID: msg.ReceiverID,
+				GroupID:    msg.GroupID,
+				CreatedAt:  msg.CreatedAt,
+			},
+			PinnedBy: pin.PinnedBy,
+			PinnedAt: pin.PinnedAt,
+		})
+	}
+
+	return responses, nil
+}
+
+// getPinnableMessage 获取消息并检查操作者是否有置顶权限
+func (s *MessageService) getPinnableMessage(messageID, operatorID uint) (*models.Message, error) {
+	var msg models.Message
+	if err := s.db.First(&msg, messageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageAlreadyGone
+	}
+
+	if msg.GroupID > 0 {
+		rank, err := s.groupRank(msg.GroupID, operatorID)
+		if err != nil {
+			return nil, err
+		}
+		if rank < rankAdmin {
+			return nil, ErrNoPinPermission
+		}
+		return &msg, nil
+	}
+
+	if msg.SenderID != operatorID && msg.ReceiverID != operatorID {
+		return nil, ErrNoPinPermission
+	}
+	return &msg, nil
+}
+
+// publishPinEvent 通知会话成员置顶状态变化
+func (s *MessageService) publishPinEvent(msg *models.Message, operatorID uint, pinned bool) {
+	event := models.MessagePinEvent{
+		MessageID:  msg.ID,
+		ReceiverID: msg.ReceiverID,
+		GroupID:    msg.GroupID,
+		Pinned:     pinned,
+		OperatorID: operatorID,
+		At:         time.Now(),
+	}
+	eventJSON, _ := json.Marshal(event)
+
+	eventType := "message_pinned"
+	if !pinned {
+		eventType = "message_unpinned"
+	}
+	s.publishConversationEvent(eventType, eventJSON, msg)
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestPinGroupMessages(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", alice, bob)
+
+	first := env.createMessage(t, models.Message{SenderID: bob.ID, GroupID: group.ID, Content: "first"})
+	second := env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Content: "second"})
+
+	// 普通成员和非成员都不能置顶
+	if _, err := s.PinMessage(first.ID, bob.ID); !errors.Is(err, ErrNoPinPermission) {
+		t.Fatalf("普通成员置顶 err = %v，期望 ErrNoPinPermission", err)
+	}
+	if _, err := s.PinMessage(first.ID, carol.ID); !errors.Is(err, ErrNoPinPermission) {
+		t.Fatalf("非成员置顶 err = %v，期望 ErrNoPinPermission", err)
+	}
+
+	if _, err := s.PinMessage(first.ID, alice.ID); err != nil {
+		t.Fatalf("置顶失败: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := s.PinMessage(second.ID, alice.ID); err != nil {
+		t.Fatalf("置顶失败: %v", err)
+	}
+	if _, err := s.PinMessage(first.ID, alice.ID); !errors.Is(err, ErrAlreadyPinned) {
+		t.Fatalf("重复置顶 err = %v，期望 ErrAlreadyPinned", err)
+	}
+
+	// 成员都能查看，按置顶时间倒序
+	pins, err := s.ListPinned(bob.ID, group.ID, true)
+	if err != nil {
+		t.Fatalf("获取置顶列表失败: %v", err)
+	}
+	if len(pins) != 2 || pins[0].Message.ID != second.ID || pins[1].Message.ID != first.ID {
+		t.Fatalf("置顶列表 = %+v，期望 [second, first]", pins)
+	}
+	if pins[1].PinnedBy != alice.ID || pins[1].Message.Sender.Username != "bob" {
+		t.Fatalf("置顶信息 = %+v", pins[1])
+	}
+	if _, err := s.ListPinned(carol.ID, group.ID, true); !errors.Is(err, ErrNotConversationUser) {
+		t.Fatalf("非成员查看 err = %v，期望 ErrNotConversationUser", err)
+	}
+
+	// 普通成员不能取消置顶
+	if err := s.UnpinMessage(second.ID, bob.ID); !errors.Is(err, ErrNoPinPermission) {
+		t.Fatalf("普通成员取消置顶 err = %v，期望 ErrNoPinPermission", err)
+	}
+	if err := s.UnpinMessage(second.ID, alice.ID); err != nil {
+		t.Fatalf("取消置顶失败: %v", err)
+	}
+	if err := s.UnpinMessage(second.ID, alice.ID); !errors.Is(err, ErrNotPinned) {
+		t.Fatalf("重复取消置顶 err = %v，期望 ErrNotPinned", err)
+	}
+
+	// 已撤回的消息不再展示
+	now := time.Now()
+	if err := env.db.Model(first).Update("deleted_at", &now).Error; err != nil {
+		t.Fatalf("删除消息失败: %v", err)
+	}
+	if pins, _ := s.ListPinned(alice.ID, group.ID, true); len(pins) != 0 {
+		t.Fatalf("撤回后置顶列表 = %+v，期望为空", pins)
+	}
+}
+
+func TestPinPrivateMessages(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	delivered := recordDeliveries(s)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+
+	msg := env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "hi"})
+
+	if _, err := s.PinMessage(msg.ID, carol.ID); !errors.Is(err, ErrNoPinPermission) {
+		t.Fatalf("第三方置顶 err = %v，期望 ErrNoPinPermission", err)
+	}
+	// 接收方也可以置顶
+	if _, err := s.PinMessage(msg.ID, bob.ID); err != nil {
+		t.Fatalf("置顶失败: %v", err)
+	}
+
+	// 双方看到同一个会话的置顶列表
+	for _, viewer := range [][2]uint{{alice.ID, bob.ID}, {bob.ID, alice.ID}} {
+		pins, err := s.ListPinned(viewer[0], viewer[1], false)
+		if err != nil {
+			t.Fatalf("获取置顶列表失败: %v", err)
+		}
+		if len(pins) != 1 || pins[0].Message.ID != msg.ID {
+			t.Fatalf("用户 %d 的置顶列表 = %+v", viewer[0], pins)
+		}
+	}
+	if pins, _ := s.ListPinned(carol.ID, alice.ID, false); len(pins) != 0 {
+		t.Fatalf("其他会话不应看到置顶: %+v", pins)
+	}
+
+	// 发送方可以取消对方的置顶
+	if err := s.UnpinMessage(msg.ID, alice.ID); err != nil {
+		t.Fatalf("取消置顶失败: %v", err)
+	}
+
+	// 置顶和取消置顶都通知双方
+	got := make(map[string]map[uint]bool)
+	for _, d := range delivered() {
+		if got[d.event.Type] == nil {
+			got[d.event.Type] = make(map[uint]bool)
+		}
+		got[d.event.Type][d.userID] = true
+	}
+	for _, eventType := range []string{"message_pinned", "message_unpinned"} {
+		if !got[eventType][alice.ID] || !got[eventType][bob.ID] {
+			t.Fatalf("%s 事件投递 = %v，期望通知双方", eventType, got[eventType])
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestGroupSendRequiresMembership(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser(t, "owner")
+	member := env.createUser(t, "member")
+	outsider := env.createUser(t, "outsider")
+	group := env.createGroup(t, "g", owner, member)
+
+	send := func(sender *models.User, groupID uint) error {
+		return env.messages.ProcessMessage(&models.Message{Content: "hi", Type: models.GroupMessage, SenderID: sender.ID, GroupID: groupID})
+	}
+	countMessages := func() int64 {
+		var n int64
+		env.db.Model(&models.Message{}).Count(&n)
+		return n
+	}
+
+	if err := send(outsider, group.ID); !errors.Is(err, ErrNotConversationUser) {
+		t.Fatalf("非成员发送 = %v，期望 ErrNotConversationUser", err)
+	}
+	if err := send(member, group.ID+100); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("向不存在的群组发送 = %v，期望 ErrGroupNotFound", err)
+	}
+	if n := countMessages(); n != 0 {
+		t.Fatalf("被拒绝的消息不应保存，已保存 %d 条", n)
+	}
+
+	if err := send(member, group.ID); err != nil {
+		t.Fatalf("成员发送失败: %v", err)
+	}
+	if err := send(owner, group.ID); err != nil {
+		t.Fatalf("群主发送失败: %v", err)
+	}
+	if n := countMessages(); n != 2 {
+		t.Fatalf("已保存 %d 条消息，期望 2 条", n)
+	}
+
+	// 退出群组后不能再发言
+	env.db.Where("group_id = ? AND user_id = ?", group.ID, member.ID).Delete(&models.GroupMember{})
+	if err := send(member, group.ID); !errors.Is(err, ErrNotConversationUser) {
+		t.Fatalf("已退出的成员发送 = %v，期望 ErrNotConversationUser", err)
+	}
+}
+
+func TestGroupSlowModeAndAdminsOnly(t *testing.T) {
+	env := newTestEnv(t)
+	owner := env.createUser(t, "owner")
+	member := env.createUser(t, "member")
+	group := env.createGroup(t, "g", owner, member)
+
+	send := func(sender *models.User) error {
+		return env.messages.ProcessMessage(&models.Message{Content: "hi", Type: models.GroupMessage, SenderID: sender.ID, GroupID: group.ID})
+	}
+
+	// 未开启慢速模式时可以连续发言
+	for i := 0; i < 3; i++ {
+		if err := send(member); err != nil {
+			t.Fatalf("第%d条消息发送失败: %v", i+1, err)
+		}
+	}
+
+	env.db.Model(group).UpdateColumn("slow_mode_seconds", 30)
+	if err := send(member); err != nil {
+		t.Fatalf("开启慢速模式后的第一条消息发送失败: %v", err)
+	}
+	if err := send(member); !errors.Is(err, ErrSlowMode) {
+		t.Fatalf("间隔内再次发送 = %v，期望 ErrSlowMode", err)
+	}
+	if err := send(owner); err != nil {
+		t.Fatalf("群主不受慢速模式限制: %v", err)
+	}
+	if err := send(owner); err != nil {
+		t.Fatalf("群主不受慢速模式限制: %v", err)
+	}
+	// 间隔结束后可以再次发言
+	env.mr.FastForward(31 * time.Second)
+	if err := send(member); err != nil {
+		t.Fatalf("间隔结束后发送失败: %v", err)
+	}
+
+	// 通过检查后保存失败的消息不占用发言间隔
+	env.mr.FastForward(31 * time.Second)
+	if err := env.db.Migrator().DropTable(&models.Message{}); err != nil {
+		t.Fatalf("删除消息表失败: %v", err)
+	}
+	if err := send(member); err == nil {
+		t.Fatal("消息表不存在时发送应失败")
+	}
+	if err := env.db.AutoMigrate(&models.Message{}); err != nil {
+		t.Fatalf("重建消息表失败: %v", err)
+	}
+	if err := send(member); err != nil {
+		t.Fatalf("上一条消息保存失败后再次发送 = %v，期望成功", err)
+	}
+
+	env.db.Model(group).UpdateColumn("post_policy", models.PostAdminsOnly)
+	if err := send(member); !errors.Is(err, ErrPostNotAllowed) {
+		t.Fatalf("仅管理员发言时普通成员发送 = %v，期望 ErrPostNotAllowed", err)
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"chatroom/models"
+)
+
+const (
+	// purgeBatchSize 批量删除自己消息时每批处理的条数
+	purgeBatchSize = 500
+
+	// PurgeTokenTTL 删除确认令牌的有效期
+	PurgeTokenTTL = 5 * time.Minute
+
+	// purgeRecallWindow 该时间内发送的消息删除后推送撤回事件，让在线客户端及时移除
+	purgeRecallWindow = 24 * time.Hour
+
+	// purgeRecallEventMax 单次删除最多推送的撤回事件数，更早的消息由客户端下次拉取历史时更新
+	purgeRecallEventMax = 200
+)
+
+// ErrInvalidPurgeToken 删除确认令牌无效或已过期
+var ErrInvalidPurgeToken = errors.New("确认令牌无效或已过期，请重新获取")
+
+// purgeTokenKey 批量删除确认令牌的键
+func purgeTokenKey(userID uint) string {
+	return RedisKey("messages:purge_token:%d", userID)
+}
+
+// countOwnMessages 统计用户发送的未删除消息数（不含系统消息）
+func (s *MessageService) countOwnMessages(userID uint) (int64, error) {
+	var count int64
+	err := s.db.Model(&models.Message{}).
+		Where("sender_id = ? AND deleted_at IS NULL AND type <> ?", userID, models.SystemMessage).
+		Count(&count).Error
+	return count, err
+}
+
+// RequestPurgeToken 生成删除自己全部消息的确认令牌，并返回待删除的消息数
+// 令牌在 PurgeTokenTTL 内有效，重复获取会使之前的令牌失效
+func (s *MessageService) RequestPurgeToken(userID uint) (string, int64, error) {
+	count, err := s.countOwnMessages(userID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", 0, err
+	}
+	token := hex.EncodeToString(buf)
+
+	if err := s.rdb.Set(context.Background(), purgeTokenKey(userID), token, PurgeTokenTTL).Err(); err != nil {
+		return "", 0, err
+	}
+	return token, count, nil
+}
+
+// consumePurgeToken 校验并作废确认令牌，令牌只能使用一次
+func (s *MessageService) consumePurgeToken(userID uint, token string) bool {
+	if token == "" {
+		return false
+	}
+	ctx := context.Background()
+	stored, err := s.rdb.Get(ctx, purgeTokenKey(userID)).Result()
+	if err != nil || stored != token {
+		return false
+	}
+	return s.rdb.Del(ctx, purgeTokenKey(userID)).Val() == 1
+}
+
+// PurgeOwnMessages 软删除用户发送的全部消息，按ID分批处理并向本人推送进度
+// 最近 purgeRecallWindow 内的消息推送撤回事件，涉及会话的缓存在结束后统一清理
+func (s *MessageService) PurgeOwnMessages(userID uint, token string) (int, error) {
+	if !s.consumePurgeToken(userID, token) {
+		return 0, ErrInvalidPurgeToken
+	}
+
+	total, err := s.countOwnMessages(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	recallSince := time.Now().Add(-purgeRecallWindow)
+	conversations := make(map[string]models.Message)
+	recallEvents := 0
+	deleted := 0
+	var lastID uint
+
+	for {
+		var batch []models.Message
+		if err := s.db.Select("id", "type", "sender_id", "receiver_id", "group_id", "created_at").
+			Where("sender_id = ? AND id > ? AND deleted_at IS NULL AND type <> ?", userID, lastID, models.SystemMessage).
+			Order("id ASC").
+			Limit(purgeBatchSize).
+			Find(&batch).Error; err != nil {
+			return deleted, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+
+		ids := make([]uint, len(batch))
+		for i, msg := range batch {
+			ids[i] = msg.ID
+		}
+
+		now := time.Now()
+		result := s.db.Model(&models.Message{}).
+			Where("id IN ? AND deleted_at IS NULL", ids).
+			Updates(map[string]interface{}{
+				"deleted_at": now,
+				"deleted_by": userID,
+			})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += int(result.RowsAffected)
+
+		for i := range batch {
+			msg := &batch[i]
+			conversations[conversationKey(msg.SenderID, msg.ReceiverID, msg.GroupID)] = *msg
+
+			if recallEvents >= purgeRecallEventMax || msg.CreatedAt.Before(recallSince) {
+				continue
+			}
+			recallEvents++
+			s.publishRecall(&models.MessageRecallEvent{
+				MessageID:  msg.ID,
+				Type:       msg.Type,
+				SenderID:   msg.SenderID,
+				ReceiverID: msg.ReceiverID,
+				GroupID:    msg.GroupID,
+				DeletedBy:  userID,
+				Reason:     models.RecallWithdrawn,
+				DeletedAt:  now,
+			}, msg)
+		}
+
+		s.publishPurgeProgress(userID, models.MessagePurgeProgress{Deleted: deleted, Total: int(total)})
+		if len(batch) < purgeBatchSize {
+			break
+		}
+	}
+
+	for _, msg := range conversations {
+		s.invalidateConversationCaches(&msg)
+	}
+	s.publishPurgeProgress(userID, models.MessagePurgeProgress{Deleted: deleted, Total: int(total), Done: true})
+	log.Printf("用户%d删除了自己发送的%d条消息，涉及%d个会话", userID, deleted, len(conversations))
+
+	return deleted, nil
+}
+
+// publishPurgeProgress 向本人推送批量删除进度
+func (s *MessageService) publishPurgeProgress(userID uint, progress models.MessagePurgeProgress) {
+	payload, _ := json.Marshal(progress)
+	s.PublishUserEvent(userID, "messages_purge_progress", payload)
+}
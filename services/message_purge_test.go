@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestPurgeOwnMessages(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := context.Background()
+	delivered := recordDeliveries(s)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	group := env.createGroup(t, "g", alice, bob)
+
+	recent := env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "hi"})
+	old := env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "old", CreatedAt: time.Now().Add(-48 * time.Hour)})
+	env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Content: "hello"})
+	system := env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Type: models.SystemMessage, Content: "alice 加入了群组"})
+	reply := env.createMessage(t, models.Message{SenderID: bob.ID, ReceiverID: alice.ID, Content: "hey"})
+
+	// 没有令牌或令牌错误时不删除
+	for _, token := range []string{"", "wrong"} {
+		if _, err := s.PurgeOwnMessages(alice.ID, token); !errors.Is(err, ErrInvalidPurgeToken) {
+			t.Fatalf("令牌 %q 删除 = %v，期望 ErrInvalidPurgeToken", token, err)
+		}
+	}
+	token, count, err := s.RequestPurgeToken(alice.ID)
+	if err != nil || count != 3 {
+		t.Fatalf("获取确认令牌 = %d, %v，期望待删除 3 条", count, err)
+	}
+	// 令牌属于本人
+	if _, err := s.PurgeOwnMessages(bob.ID, token); !errors.Is(err, ErrInvalidPurgeToken) {
+		t.Fatalf("使用他人令牌删除 = %v，期望 ErrInvalidPurgeToken", err)
+	}
+
+	deleted, err := s.PurgeOwnMessages(alice.ID, token)
+	if err != nil || deleted != 3 {
+		t.Fatalf("删除消息 = %d, %v，期望 3", deleted, err)
+	}
+	if _, err := s.PurgeOwnMessages(alice.ID, token); !errors.Is(err, ErrInvalidPurgeToken) {
+		t.Fatalf("重复使用令牌 = %v，期望 ErrInvalidPurgeToken", err)
+	}
+
+	// 历史记录中不再出现本人的消息，对方的消息和系统消息保留
+	private, err := s.GetMessagesByUser(ctx, bob.ID, alice.ID, 50, 0)
+	if err != nil || len(private) != 1 || private[0].ID != reply.ID {
+		t.Fatalf("私聊历史 = %+v, %v，期望只剩 bob 的消息", private, err)
+	}
+	groupHistory, err := s.GetGroupMessages(ctx, bob.ID, group.ID, 50, 0)
+	if err != nil || len(groupHistory) != 1 || groupHistory[0].ID != system.ID {
+		t.Fatalf("群聊历史 = %+v, %v，期望只剩系统消息", groupHistory, err)
+	}
+
+	// 最近的消息推送撤回事件，较早的消息不推送；本人收到完成进度
+	recalled := make(map[uint]bool)
+	var progress models.MessagePurgeProgress
+	for _, d := range delivered() {
+		switch d.event.Type {
+		case "message_recalled":
+			if d.userID == bob.ID {
+				var event models.MessageRecallEvent
+				json.Unmarshal(d.event.Content, &event)
+				recalled[event.MessageID] = true
+			}
+		case "messages_purge_progress":
+			if d.userID == alice.ID {
+				json.Unmarshal(d.event.Content, &progress)
+			}
+		}
+	}
+	if !recalled[recent.ID] || recalled[old.ID] {
+		t.Fatalf("bob 收到的撤回事件 = %v，期望包含 %d 且不含 %d", recalled, recent.ID, old.ID)
+	}
+	if !progress.Done || progress.Deleted != 3 || progress.Total != 3 {
+		t.Fatalf("删除进度 = %+v", progress)
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// pushWebhookTimeout 离线推送webhook的请求超时
+const pushWebhookTimeout = 5 * time.Second
+
+// PushNotification 离线推送webhook的请求内容
+type PushNotification struct {
+	UserID  uint            `json:"user_id"`
+	Message json.RawMessage `json:"message"`
+}
+
+// newPushWebhookFromConfig 根据配置创建离线推送函数，未配置 PUSH_WEBHOOK 时返回nil（不推送）
+func newPushWebhookFromConfig() func(userID uint, message []byte) {
+	url := config.AppConfig.PushWebhook
+	if url == "" {
+		return nil
+	}
+	client := &http.Client{Timeout: pushWebhookTimeout}
+	return func(userID uint, message []byte) {
+		payload, _ := json.Marshal(PushNotification{UserID: userID, Message: message})
+		resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			log.Printf("发送离线推送webhook失败: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("离线推送webhook返回状态码 %d", resp.StatusCode)
+		}
+	}
+}
+
+// notifyOffline 向不在线的接收者推送消息，逐个按全局勿扰和通知偏好决定是否推送，
+// 免打扰时段内的推送暂存到时段结束后由 RunDeferredPushes 补发
+func (s *MessageService) notifyOffline(msg *models.Message, msgJSON []byte) {
+	var recipients []uint
+	if msg.GroupID > 0 {
+		memberIDs, err := s.GetGroupMembers(msg.GroupID)
+		if err != nil {
+			log.Printf("获取群组成员失败，离线推送中止: %v", err)
+			return
+		}
+		for _, memberID := range memberIDs {
+			if memberID != msg.SenderID {
+				recipients = append(recipients, memberID)
+			}
+		}
+	} else {
+		recipients = []uint{msg.ReceiverID}
+	}
+
+	var offline []uint
+	for _, userID := range recipients {
+		if !s.userService.IsUserOnline(userID) {
+			offline = append(offline, userID)
+		}
+	}
+	if len(offline) == 0 {
+		return
+	}
+
+	// 判断是否被@需要接收者的用户名
+	var users []models.User
+	if err := s.db.Select("id", "username").Where("id IN ?", offline).Find(&users).Error; err != nil {
+		log.Printf("获取离线接收者失败，离线推送中止: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, user := range users {
+		mentioned := IsMentioned(msg.Content, user.Username)
+		switch s.notifications.Decide(user.ID, mentioned, now) {
+		case NotifySend:
+			s.pushNotify(user.ID, msgJSON)
+		case NotifyDefer:
+			s.deferPush(user.ID, mentioned, msgJSON, s.notifications.QuietHoursEnd(user.ID, now))
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// deferredPushInterval 检查免打扰时段是否结束的间隔
+	deferredPushInterval = time.Minute
+	// deferredPushMaxPerUser 每个用户最多暂存的推送数，超出时丢弃最早的
+	deferredPushMaxPerUser = 100
+	// deferredPushTTL 暂存推送的有效期，覆盖最长一天的免打扰时段
+	deferredPushTTL = 48 * time.Hour
+)
+
+// deferredPush 免打扰时段内暂存的一条推送
+type deferredPush struct {
+	Mentioned bool            `json:"mentioned"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// deferredPushKey 用户暂存推送的列表
+func deferredPushKey(userID uint) string {
+	return RedisKey("push:deferred:%d", userID)
+}
+
+// deferredPushDueKey 有暂存推送的用户的有序集合，分值为免打扰结束的Unix时间
+func deferredPushDueKey() string {
+	return RedisKey("push:deferred:due")
+}
+
+// deferPush 暂存免打扰时段内的推送，在 until 之后补发
+func (s *MessageService) deferPush(userID uint, mentioned bool, msgJSON []byte, until time.Time) {
+	entry, err := json.Marshal(deferredPush{Mentioned: mentioned, Message: msgJSON})
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	key := deferredPushKey(userID)
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, entry)
+		pipe.LTrim(ctx, key, -deferredPushMaxPerUser, -1)
+		pipe.Expire(ctx, key, deferredPushTTL)
+		// 已在等待的用户保留更早的补发时间
+		pipe.ZAddNX(ctx, deferredPushDueKey(), &redis.Z{
+			Score:  float64(until.Unix()),
+			Member: strconv.FormatUint(uint64(userID), 10),
+		})
+		return nil
+	})
+	if err != nil {
+		log.Printf("暂存用户 %d 的推送失败: %v", userID, err)
+	}
+}
+
+// RunDeferredPushes 按 deferredPushInterval 间隔补发免打扰时段已结束的暂存推送，ctx取消后退出
+func (s *MessageService) RunDeferredPushes(ctx context.Context) {
+	ticker := time.NewTicker(deferredPushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flushDeferredPushes(ctx, time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// flushDeferredPushes 补发免打扰时段在 now 之前结束的用户的暂存推送。
+// 用户已上线时丢弃（消息已通过WebSocket送达），仍处于免打扰时重新暂存，
+// 全局勿扰或偏好变为不推送时丢弃
+func (s *MessageService) flushDeferredPushes(ctx context.Context, now time.Time) {
+	dueKey := deferredPushDueKey()
+	members, err := s.rdb.ZRangeByScore(ctx, dueKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		log.Printf("读取待补发推送失败: %v", err)
+		return
+	}
+
+	for _, member := range members {
+		if ctx.Err() != nil {
+			return
+		}
+		// 多个节点同时检查时，只有移除成功的节点负责补发
+		if removed, err := s.rdb.ZRem(ctx, dueKey, member).Result(); err != nil || removed == 0 {
+			continue
+		}
+		id, err := strconv.ParseUint(member, 10, 32)
+		if err != nil {
+			continue
+		}
+		userID := uint(id)
+
+		key := deferredPushKey(userID)
+		var entries *redis.StringSliceCmd
+		if _, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			entries = pipe.LRange(ctx, key, 0, -1)
+			pipe.Del(ctx, key)
+			return nil
+		}); err != nil {
+			log.Printf("读取用户 %d 的暂存推送失败: %v", userID, err)
+			continue
+		}
+		if s.userService.IsUserOnline(userID) {
+			continue
+		}
+
+		for _, raw := range entries.Val() {
+			var entry deferredPush
+			if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+				continue
+			}
+			switch s.notifications.Decide(userID, entry.Mentioned, now) {
+			case NotifySend:
+				s.pushNotify(userID, entry.Message)
+			case NotifyDefer:
+				s.deferPush(userID, entry.Mentioned, entry.Message, s.notifications.QuietHoursEnd(userID, now))
+			}
+		}
+	}
+}
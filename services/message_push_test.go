@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+// recordPushes 替换离线推送函数，返回收到推送的用户ID
+func recordPushes(s *MessageService) func() []uint {
+	var mu sync.Mutex
+	var pushed []uint
+	s.pushNotify = func(userID uint, _ []byte) {
+		mu.Lock()
+		pushed = append(pushed, userID)
+		mu.Unlock()
+	}
+	return func() []uint {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]uint(nil), pushed...)
+	}
+}
+
+func TestNotifyOfflineRespectsPrefsAndDND(t *testing.T) {
+	env := newTestEnv(t)
+	pushed := recordPushes(env.messages)
+	notifications := NewNotificationService(env.db, env.rdb)
+
+	sender := env.createUser(t, "sender")
+	normal := env.createUser(t, "normal")
+	muted := env.createUser(t, "muted")
+	dnd := env.createUser(t, "dnd")
+	mentionsOnly := env.createUser(t, "mentions")
+	online := env.createUser(t, "online")
+	group := env.createGroup(t, "g", sender, normal, muted, dnd, mentionsOnly, online)
+
+	if _, err := notifications.UpdatePrefs(muted.ID, models.NotificationPrefsRequest{Level: models.NotifyNone}); err != nil {
+		t.Fatalf("设置通知偏好失败: %v", err)
+	}
+	if _, err := notifications.UpdatePrefs(mentionsOnly.ID, models.NotificationPrefsRequest{Level: models.NotifyMentions}); err != nil {
+		t.Fatalf("设置通知偏好失败: %v", err)
+	}
+	if _, err := notifications.UpdateDND(dnd.ID, models.DoNotDisturbRequest{Enabled: true}); err != nil {
+		t.Fatalf("设置勿扰失败: %v", err)
+	}
+	env.rdb.SAdd(t.Context(), onlineUsersKey(), onlineMember(online.ID))
+
+	msg := &models.Message{ID: 1, Content: "hello", Type: models.GroupMessage, SenderID: sender.ID, GroupID: group.ID}
+	env.messages.notifyOffline(msg, []byte("{}"))
+	got := pushed()
+	if len(got) != 1 || got[0] != normal.ID {
+		t.Fatalf("推送给了 %v，期望只有 %d", got, normal.ID)
+	}
+
+	// 被@时仅提及偏好的用户也会收到，勿扰和关闭通知的用户仍不推送
+	msg.Content = "@mentions @dnd @muted 看一下"
+	env.messages.notifyOffline(msg, []byte("{}"))
+	got = pushed()[1:]
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if len(got) != 2 || got[0] != normal.ID || got[1] != mentionsOnly.ID {
+		t.Fatalf("推送给了 %v，期望 %d 和 %d", got, normal.ID, mentionsOnly.ID)
+	}
+}
+
+func TestNotifyOfflinePrivateDND(t *testing.T) {
+	env := newTestEnv(t)
+	pushed := recordPushes(env.messages)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	msg := &models.Message{ID: 1, Content: "hi", Type: models.PrivateMessage, SenderID: alice.ID, ReceiverID: bob.ID}
+	env.messages.notifyOffline(msg, []byte("{}"))
+	if got := pushed(); len(got) != 1 || got[0] != bob.ID {
+		t.Fatalf("离线接收者应收到推送，得到 %v", got)
+	}
+
+	if _, err := env.messages.notifications.UpdateDND(bob.ID, models.DoNotDisturbRequest{Enabled: true}); err != nil {
+		t.Fatalf("设置勿扰失败: %v", err)
+	}
+	env.messages.notifyOffline(msg, []byte("{}"))
+	if got := pushed(); len(got) != 1 {
+		t.Fatalf("勿扰的接收者不应收到推送，得到 %v", got)
+	}
+}
+
+func TestNotifyOfflineDefersDuringQuietHours(t *testing.T) {
+	env := newTestEnv(t)
+	pushed := recordPushes(env.messages)
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	// 免打扰时段覆盖当前时间，一小时后结束
+	now := time.Now()
+	if _, err := env.messages.notifications.UpdatePrefs(bob.ID, models.NotificationPrefsRequest{
+		Level:           models.NotifyAll,
+		QuietHoursStart: now.Add(-time.Hour).Format(quietHoursLayout),
+		QuietHoursEnd:   now.Add(time.Hour).Format(quietHoursLayout),
+	}); err != nil {
+		t.Fatalf("设置通知偏好失败: %v", err)
+	}
+
+	msg := &models.Message{ID: 1, Content: "hi", Type: models.PrivateMessage, SenderID: alice.ID, ReceiverID: bob.ID}
+	env.messages.notifyOffline(msg, []byte(`{"id":1}`))
+	if got := pushed(); len(got) != 0 {
+		t.Fatalf("免打扰时段内不应立即推送，得到 %v", got)
+	}
+	if n, _ := env.rdb.LLen(ctx, deferredPushKey(bob.ID)).Result(); n != 1 {
+		t.Fatalf("暂存推送数 = %d，期望 1", n)
+	}
+
+	// 时段结束前检查不补发
+	env.messages.flushDeferredPushes(ctx, now)
+	if got := pushed(); len(got) != 0 {
+		t.Fatalf("免打扰时段结束前不应补发，得到 %v", got)
+	}
+
+	// 时段结束后补发一次
+	end := env.messages.notifications.QuietHoursEnd(bob.ID, now)
+	env.messages.flushDeferredPushes(ctx, end.Add(time.Second))
+	if got := pushed(); len(got) != 1 || got[0] != bob.ID {
+		t.Fatalf("免打扰结束后应补发给 %d，得到 %v", bob.ID, got)
+	}
+	env.messages.flushDeferredPushes(ctx, end.Add(2*time.Second))
+	if got := pushed(); len(got) != 1 {
+		t.Fatalf("暂存推送不应重复补发，得到 %v", got)
+	}
+	if env.mr.Exists(deferredPushKey(bob.ID)) {
+		t.Fatal("补发后应清除暂存推送")
+	}
+}
+
+func TestFlushDeferredPushesDropsForOnlineUser(t *testing.T) {
+	env := newTestEnv(t)
+	pushed := recordPushes(env.messages)
+	ctx := context.Background()
+	bob := env.createUser(t, "bob")
+
+	now := time.Now()
+	env.messages.deferPush(bob.ID, false, []byte("{}"), now)
+	env.rdb.SAdd(ctx, onlineUsersKey(), onlineMember(bob.ID))
+	env.messages.flushDeferredPushes(ctx, now.Add(time.Second))
+	if got := pushed(); len(got) != 0 {
+		t.Fatalf("已上线的用户不应收到补发，得到 %v", got)
+	}
+	if env.mr.Exists(deferredPushKey(bob.ID)) {
+		t.Fatal("已上线用户的暂存推送应被丢弃")
+	}
+}
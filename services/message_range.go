@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+var (
+	ErrInvalidRange  = errors.New("时间范围无效，结束时间必须晚于开始时间")
+	ErrRangeTooLarge = errors.New("时间范围过大")
+)
+
+// GetMessagesInRange 获取会话在 [from, to) 时间范围内的消息，按时间正序返回
+// 群聊要求请求者为群成员，并遵循历史可见范围
+func (s *MessageService) GetMessagesInRange(userID, targetID uint, isGroup bool, from, to time.Time, limit, offset int) ([]models.MessageResponse, error) {
+	if !to.After(from) {
+		return nil, ErrInvalidRange
+	}
+	if to.Sub(from) > time.Duration(config.AppConfig.MessageRangeMaxDays)*24*time.Hour {
+		return nil, ErrRangeTooLarge
+	}
+	limit = clampHistoryLimit(limit)
+
+	query := s.db.Preload("Sender")
+	if isGroup {
+		rank, err := s.groupRank(targetID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if rank == rankNone {
+			return nil, ErrNotConversationUser
+		}
+		since, err := s.historyVisibleSince(context.Background(), userID, targetID)
+		if err != nil {
+			return nil, err
+		}
+		if since.After(from) {
+			from = since
+		}
+		query = query.Where("group_id = ? AND deleted_at IS NULL", targetID)
+	} else {
+		query = query.
+			Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)", userID, targetID, targetID, userID).
+			Where("group_id = 0 AND deleted_at IS NULL")
+	}
+
+	if cleared := s.clearedBefore(context.Background(), userID, targetID, isGroup); !cleared.IsZero() {
+		query = query.Where("created_at > ?", cleared)
+	}
+
+	var messages []models.Message
+	if err := query.
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Order("created_at ASC, id ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	return s.messagesToResponses(messages, userID)
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestGetMessagesInRangeAscending(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	from := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	to := from.Add(time.Hour)
+	env.createMessage(t, models.Message{Content: "before", SenderID: alice.ID, ReceiverID: bob.ID, CreatedAt: from.Add(-time.Minute)})
+	for i := 0; i < 5; i++ {
+		env.createMessage(t, models.Message{Content: "in", SenderID: bob.ID, ReceiverID: alice.ID, CreatedAt: from.Add(time.Duration(i) * time.Minute)})
+	}
+	env.createMessage(t, models.Message{Content: "after", SenderID: alice.ID, ReceiverID: bob.ID, CreatedAt: to})
+
+	got, err := env.messages.GetMessagesInRange(alice.ID, bob.ID, false, from, to, 50, 0)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(got) != 5 {
+		t.Fatalf("返回 %d 条消息，期望 5 条", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if !got[i].CreatedAt.After(got[i-1].CreatedAt) {
+			t.Fatalf("第%d条消息时间 %v 未晚于上一条 %v", i, got[i].CreatedAt, got[i-1].CreatedAt)
+		}
+	}
+	for _, m := range got {
+		if m.Content != "in" {
+			t.Fatalf("返回了范围外的消息: %q", m.Content)
+		}
+	}
+}
+
+func TestGetMessagesInRangeInvalid(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+	if _, err := env.messages.GetMessagesInRange(1, 2, false, now, now, 50, 0); err != ErrInvalidRange {
+		t.Fatalf("期望 ErrInvalidRange，得到 %v", err)
+	}
+	if _, err := env.messages.GetMessagesInRange(1, 2, false, now.AddDate(-10, 0, 0), now, 50, 0); err != ErrRangeTooLarge {
+		t.Fatalf("期望 ErrRangeTooLarge，得到 %v", err)
+	}
+}
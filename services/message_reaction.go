@@ -0,0 +1,199 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chatroom/models"
+)
+
+// AddReaction 添加表情回应，返回该消息最新的回应汇总
+func (s *MessageService) AddReaction(messageID, userID uint, emoji string) ([]models.ReactionSummary, error) {
+	msg, err := s.getReactableMessage(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	reaction := models.MessageReaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     emoji,
+		CreatedAt: time.Now(),
+	}
+	// 重复回应同一表情视为成功
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction).Error; err != nil {
+		return nil, err
+	}
+
+	summary, err := s.reactionSummary(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishReactionUpdate(msg, userID, emoji, true)
+	return summary, nil
+}
+
+// RemoveReaction 取消表情回应，返回该消息最新的回应汇总
+func (s *MessageService) RemoveReaction(messageID, userID uint, emoji string) ([]models.ReactionSummary, error) {
+	msg, err := s.getReactableMessage(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.db.Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&models.MessageReaction{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrReactionNotFound
+	}
+
+	summary, err := s.reactionSummary(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 最后一个回应被取消时该表情不再出现在汇总中
+	s.publishReactionUpdate(msg, userID, emoji, false)
+	return summary, nil
+}
+
+// reactionSummary 获取单条消息的表情回应汇总
+func (s *MessageService) reactionSummary(messageID, viewerID uint) ([]models.ReactionSummary, error) {
+	summaries, err := s.aggregateReactions([]uint{messageID}, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if summary, ok := summaries[messageID]; ok {
+		return summary, nil
+	}
+	return []models.ReactionSummary{}, nil
+}
+
+// attachReactions 为一页消息批量附加表情回应汇总（单次聚合查询，避免N+1）
+func (s *MessageService) attachReactions(responses []models.MessageResponse, viewerID uint) error {
+	if len(responses) == 0 {
+		return nil
+	}
+
+	messageIDs := make([]uint, len(responses))
+	for i, resp := range responses {
+		messageIDs[i] = resp.ID
+	}
+
+	summaries, err := s.aggregateReactions(messageIDs, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for i := range responses {
+		responses[i].Reactions = summaries[responses[i].ID]
+	}
+	return nil
+}
+
+// aggregateReactions 按消息和表情聚合回应数量，并标记查看者是否回应过
+func (s *MessageService) aggregateReactions(messageIDs []uint, viewerID uint) (map[uint][]models.ReactionSummary, error) {
+	type reactionRow struct {
+		MessageID uint
+		Emoji     string
+		Count     int
+		Mine      int
+	}
+	var rows []reactionRow
+	for _, chunk := range chunkIDs(messageIDs) {
+		var chunkRows []reactionRow
+		if err := s.db.Model(&models.MessageReaction{}).
+			Select("message_id, emoji, COUNT(*) AS count, SUM(CASE WHEN user_id = ? THEN 1 ELSE 0 END) AS mine", viewerID).
+			Where("message_id IN ?", chunk).
+			Group("message_id, emoji").
+			Scan(&chunkRows).Error; err != nil {
+			return nil, err
+		}
+		rows = append(rows, chunkRows...)
+	}
+
+	summaries := make(map[uint][]models.ReactionSummary)
+	for _, row := range rows {
+		summaries[row.MessageID] = append(summaries[row.MessageID], models.ReactionSummary{
+			Emoji:       row.Emoji,
+			Count:       row.Count,
+			ReactedByMe: row.Mine > 0,
+		})
+	}
+
+	// 按回应数量降序，数量相同时按表情排序，保证输出稳定
+	for _, summary := range summaries {
+		sort.Slice(summary, func(i, j int) bool {
+			if summary[i].Count != summary[j].Count {
+				return summary[i].Count > summary[j].Count
+			}
+			return summary[i].Emoji < summary[j].Emoji
+		})
+	}
+
+	return summaries, nil
+}
+
+// getReactableMessage 获取消息并检查用户是否为会话成员
+func (s *MessageService) getReactableMessage(messageID, userID uint) (*models.Message, error) {
+	var msg models.Message
+	if err := s.db.First(&msg, messageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageAlreadyGone
+	}
+	if msg.Type == models.SystemMessage {
+		return nil, ErrSystemMessageAction
+	}
+
+	if msg.GroupID > 0 {
+		rank, err := s.groupRank(msg.GroupID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if rank == rankNone {
+			return nil, ErrNotConversationUser
+		}
+		return &msg, nil
+	}
+
+	if msg.SenderID != userID && msg.ReceiverID != userID {
+		return nil, ErrNotConversationUser
+	}
+	return &msg, nil
+}
+
+// publishReactionUpdate 通知会话成员表情回应变化
+// 事件广播给所有成员，汇总中的 reacted_by_me 均为false，客户端根据 user_id 和 added 更新自己的状态
+func (s *MessageService) publishReactionUpdate(msg *models.Message, userID uint, emoji string, added bool) {
+	summary, err := s.reactionSummary(msg.ID, 0)
+	if err != nil {
+		log.Printf("获取表情回应汇总失败，跳过推送: %v", err)
+		return
+	}
+
+	event := models.ReactionUpdateEvent{
+		MessageID:  msg.ID,
+		ReceiverID: msg.ReceiverID,
+		GroupID:    msg.GroupID,
+		UserID:     userID,
+		Emoji:      emoji,
+		Added:      added,
+		Reactions:  summary,
+	}
+	eventJSON, _ := json.Marshal(event)
+	s.publishConversationEvent("reaction_update", eventJSON, msg)
+}
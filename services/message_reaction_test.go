@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"chatroom/models"
+)
+
+// countTableQueries 统计之后对指定表执行的查询次数
+func countTableQueries(t *testing.T, db *gorm.DB, table string) *int64 {
+	t.Helper()
+	var count int64
+	counter := func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			atomic.AddInt64(&count, 1)
+		}
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("test:count_"+table, counter); err != nil {
+		t.Fatalf("注册查询回调失败: %v", err)
+	}
+	if err := db.Callback().Row().After("gorm:row").Register("test:count_"+table, counter); err != nil {
+		t.Fatalf("注册查询回调失败: %v", err)
+	}
+	return &count
+}
+
+func TestHistoryReactionsSingleQuery(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	const pageSize = 20
+	for i := 0; i < pageSize; i++ {
+		msg := env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "hi"})
+		reactions := []models.MessageReaction{
+			{MessageID: msg.ID, UserID: alice.ID, Emoji: "👍"},
+			{MessageID: msg.ID, UserID: bob.ID, Emoji: "👍"},
+			{MessageID: msg.ID, UserID: bob.ID, Emoji: "🎉"},
+		}
+		if err := env.db.Create(&reactions).Error; err != nil {
+			t.Fatalf("创建回应失败: %v", err)
+		}
+	}
+
+	queries := countTableQueries(t, env.db, "message_reactions")
+	messages, err := env.messages.GetMessagesByUser(context.Background(), alice.ID, bob.ID, pageSize, 0)
+	if err != nil {
+		t.Fatalf("获取历史消息失败: %v", err)
+	}
+	if got := atomic.LoadInt64(queries); got != 1 {
+		t.Fatalf("一页消息的回应查询次数 = %d，期望 1", got)
+	}
+
+	if len(messages) != pageSize {
+		t.Fatalf("消息数 = %d，期望 %d", len(messages), pageSize)
+	}
+	for _, msg := range messages {
+		want := []models.ReactionSummary{
+			{Emoji: "👍", Count: 2, ReactedByMe: true},
+			{Emoji: "🎉", Count: 1, ReactedByMe: false},
+		}
+		if len(msg.Reactions) != len(want) {
+			t.Fatalf("消息 %d 的回应汇总 = %+v", msg.ID, msg.Reactions)
+		}
+		for i := range want {
+			if msg.Reactions[i] != want[i] {
+				t.Fatalf("消息 %d 的回应汇总 = %+v，期望 %+v", msg.ID, msg.Reactions, want)
+			}
+		}
+	}
+}
+
+func TestReactionAddRemoveBroadcast(t *testing.T) {
+	env := newTestEnv(t)
+	delivered := recordDeliveries(env.messages)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", alice, bob, carol)
+	msg := env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Content: "hi"})
+
+	// 先缓存成员列表，移除成员后缓存应失效
+	if _, err := env.messages.GetGroupMembers(group.ID); err != nil {
+		t.Fatalf("获取群成员失败: %v", err)
+	}
+	if err := env.groups.RemoveMember(group.ID, alice.ID, carol.ID); err != nil {
+		t.Fatalf("移除成员失败: %v", err)
+	}
+
+	summary, err := env.messages.AddReaction(msg.ID, bob.ID, "👍")
+	if err != nil {
+		t.Fatalf("添加回应失败: %v", err)
+	}
+	if len(summary) != 1 || summary[0] != (models.ReactionSummary{Emoji: "👍", Count: 1, ReactedByMe: true}) {
+		t.Fatalf("添加后回应汇总 = %+v", summary)
+	}
+	summary, err = env.messages.RemoveReaction(msg.ID, bob.ID, "👍")
+	if err != nil {
+		t.Fatalf("取消回应失败: %v", err)
+	}
+	if len(summary) != 0 {
+		t.Fatalf("取消最后一个回应后汇总 = %+v，期望为空", summary)
+	}
+	if _, err := env.messages.RemoveReaction(msg.ID, bob.ID, "👍"); !errors.Is(err, ErrReactionNotFound) {
+		t.Fatalf("重复取消 = %v，期望 ErrReactionNotFound", err)
+	}
+
+	// 添加和取消都推送给当前成员，已移除的成员收不到
+	var updates []models.ReactionUpdateEvent
+	for _, d := range delivered() {
+		if d.event.Type != "reaction_update" {
+			continue
+		}
+		if d.userID == carol.ID {
+			t.Fatal("已移除的成员不应收到回应事件")
+		}
+		if d.userID != alice.ID {
+			continue
+		}
+		var event models.ReactionUpdateEvent
+		json.Unmarshal(d.event.Content, &event)
+		updates = append(updates, event)
+	}
+	if len(updates) != 2 {
+		t.Fatalf("alice 收到 %d 个回应事件，期望 2", len(updates))
+	}
+	if !updates[0].Added || len(updates[0].Reactions) != 1 || updates[0].Reactions[0].Count != 1 {
+		t.Fatalf("添加事件 = %+v", updates[0])
+	}
+	if updates[1].Added || updates[1].Emoji != "👍" || len(updates[1].Reactions) != 0 {
+		t.Fatalf("取消事件 = %+v，期望表情从汇总中消失", updates[1])
+	}
+}
+
+func BenchmarkAttachReactions(b *testing.B) {
+	env := newTestEnv(b)
+	alice := env.createUser(b, "alice")
+	bob := env.createUser(b, "bob")
+
+	responses := make([]models.MessageResponse, 50)
+	for i := range responses {
+		msg := env.createMessage(b, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "hi"})
+		env.db.Create(&[]models.MessageReaction{
+			{MessageID: msg.ID, UserID: alice.ID, Emoji: "👍"},
+			{MessageID: msg.ID, UserID: bob.ID, Emoji: "🎉"},
+		})
+		responses[i].ID = msg.ID
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := env.messages.attachReactions(responses, alice.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
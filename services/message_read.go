@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// unreadBaselineKey 旧版未读计数迁移时的消息ID基线
+// 迁移前没有未读计数的会话视为已读到该基线
+func unreadBaselineKey() string {
+	return RedisKey("unread:baseline_message_id")
+}
+
+// lastReadKey 获取用户在会话中最后已读消息ID的缓存键
+func lastReadKey(userID uint, conversationID string) string {
+	return RedisKey("lastread:%d:%s", userID, conversationID)
+}
+
+// MarkMessagesAsRead 标记消息为已读
+// messageID为0时标记会话中的所有消息为已读，否则标记到指定消息为止
+func (s *MessageService) MarkMessagesAsRead(userID, targetID uint, isGroup bool, messageID uint) error {
+	if messageID == 0 {
+		latest, err := s.latestMessageID(userID, targetID, isGroup)
+		if err != nil {
+			return err
+		}
+		messageID = latest
+	}
+
+	conversationID := targetConversationKey(userID, targetID, isGroup)
+
+	// 已读位置只前进不后退
+	prevID := s.getLastReadID(userID, targetID, isGroup)
+	if messageID <= prevID {
+		return nil
+	}
+
+	if err := s.setLastReadID(userID, conversationID, messageID); err != nil {
+		return err
+	}
+
+	// 群消息维护聚合已读计数
+	if isGroup {
+		s.incrementSeenCounts(userID, targetID, prevID, messageID)
+		s.resetMentionCount(userID, targetID, messageID)
+	}
+
+	// 未读数变化，清理最近聊天缓存
+	ctx := context.Background()
+	s.rdb.Del(ctx, recentChatsKey(userID))
+
+	return nil
+}
+
+// GetUnreadSummary 获取用户所有会话的未读汇总
+func (s *MessageService) GetUnreadSummary(ctx context.Context, userID uint) (*models.UnreadSummary, error) {
+	chats, err := s.GetRecentChats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.UnreadSummary{Conversations: []models.RecentChat{}}
+	for _, chat := range chats {
+		if chat.UnreadCount == 0 && chat.MentionCount == 0 {
+			continue
+		}
+		summary.TotalUnread += chat.UnreadCount
+		summary.TotalMentions += chat.MentionCount
+		summary.Conversations = append(summary.Conversations, chat)
+	}
+	return summary, nil
+}
+
+// LastAckedMessageID 获取用户在所有会话中已读到的最大消息ID
+func (s *MessageService) LastAckedMessageID(userID uint) uint {
+	var lastID uint
+	s.db.Model(&models.ConversationRead{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(MAX(last_read_message_id), 0)").
+		Scan(&lastID)
+	return lastID
+}
+
+// setLastReadID 保存用户在会话中的已读位置
+func (s *MessageService) setLastReadID(userID uint, conversationID string, messageID uint) error {
+	read := models.ConversationRead{
+		UserID:            userID,
+		ConversationID:    conversationID,
+		LastReadMessageID: messageID,
+		UpdatedAt:         time.Now(),
+	}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "conversation_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_read_message_id", "updated_at"}),
+	}).Create(&read).Error; err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	s.rdb.Set(ctx, lastReadKey(userID, conversationID), messageID, time.Duration(config.AppConfig.CacheExpiration)*time.Second)
+	return nil
+}
+
+// getLastReadID 获取用户在会话中最后已读的消息ID
+func (s *MessageService) getLastReadID(userID, targetID uint, isGroup bool) uint {
+	conversationID := targetConversationKey(userID, targetID, isGroup)
+	ctx := context.Background()
+	key := lastReadKey(userID, conversationID)
+
+	// 先尝试从缓存获取
+	if id, err := s.rdb.Get(ctx, key).Uint64(); err == nil {
+		return uint(id)
+	}
+
+	// 从数据库获取
+	var read models.ConversationRead
+	err := s.db.Where("user_id = ? AND conversation_id = ?", userID, conversationID).First(&read).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0
+		}
+		// 尚未记录已读位置，使用迁移基线
+		read.LastReadMessageID, _ = s.unreadBaseline()
+	}
+
+	s.rdb.Set(ctx, key, read.LastReadMessageID, time.Duration(config.AppConfig.CacheExpiration)*time.Second)
+	return read.LastReadMessageID
+}
+
+// getUnreadCount 计算会话中晚于已读位置的未读消息数
+func (s *MessageService) getUnreadCount(userID, targetID uint, isGroup bool) int {
+	lastReadID := s.getLastReadID(userID, targetID, isGroup)
+
+	var count int64
+	s.unreadQuery(userID, targetID, isGroup).
+		Where("id > ?", lastReadID).
+		Count(&count)
+	return int(count)
+}
+
+// unreadQuery 构建会话中他人发送的、未删除消息的查询，系统消息不计入未读
+func (s *MessageService) unreadQuery(userID, targetID uint, isGroup bool) *gorm.DB {
+	query := s.db.Model(&models.Message{}).Where("deleted_at IS NULL AND type <> ?", models.SystemMessage)
+	if isGroup {
+		return query.Where("group_id = ? AND sender_id <> ?", targetID, userID)
+	}
+	return query.Where("group_id = 0 AND sender_id = ? AND receiver_id = ?", targetID, userID)
+}
+
+// latestMessageID 获取会话中最新一条消息的ID
+func (s *MessageService) latestMessageID(userID, targetID uint, isGroup bool) (uint, error) {
+	query := s.db.Model(&models.Message{})
+	if isGroup {
+		query = query.Where("group_id = ?", targetID)
+	} else {
+		query = query.Where("group_id = 0 AND ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))",
+			userID, targetID, targetID, userID)
+	}
+
+	var latest uint
+	if err := query.Select("COALESCE(MAX(id), 0)").Scan(&latest).Error; err != nil {
+		return 0, err
+	}
+	return latest, nil
+}
+
+// unreadBaseline 获取迁移基线消息ID
+func (s *MessageService) unreadBaseline() (uint, error) {
+	ctx := context.Background()
+	id, err := s.rdb.Get(ctx, unreadBaselineKey()).Uint64()
+	return uint(id), err
+}
+
+// MigrateUnreadCounters 将旧版Redis未读计数迁移为已读位置
+// 计数为N的会话，已读位置设置为倒数第N+1条他人消息；迁移完成后删除旧计数
+func (s *MessageService) MigrateUnreadCounters() error {
+	ctx := context.Background()
+
+	// 已迁移过则跳过
+	if _, err := s.unreadBaseline(); err == nil {
+		return nil
+	}
+
+	var maxID uint
+	if err := s.db.Model(&models.Message{}).Select("COALESCE(MAX(id), 0)").Scan(&maxID).Error; err != nil {
+		return err
+	}
+
+	migrated := 0
+	// 旧版计数写入时还没有键前缀，因此按原始键名扫描
+	iter := s.rdb.Scan(ctx, 0, "unread:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if key == unreadBaselineKey() {
+			continue
+		}
+
+		userID, targetID, isGroup, ok := parseLegacyUnreadKey(key)
+		if !ok {
+			continue
+		}
+
+		count, err := s.rdb.Get(ctx, key).Int()
+		if err != nil {
+			continue
+		}
+
+		// 找到倒数第count+1条他人消息作为已读位置
+		var lastReadID uint
+		var ids []uint
+		s.unreadQuery(userID, targetID, isGroup).
+			Where("id <= ?", maxID).
+			Order("id DESC").
+			Offset(count).
+			Limit(1).
+			Pluck("id", &ids)
+		if len(ids) > 0 {
+			lastReadID = ids[0]
+		}
+
+		conversationID := targetConversationKey(userID, targetID, isGroup)
+		if err := s.setLastReadID(userID, conversationID, lastReadID); err != nil {
+			log.Printf("迁移未读计数失败 %s: %v", key, err)
+			continue
+		}
+		s.rdb.Del(ctx, key)
+		migrated++
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	// 记录基线，迁移前没有计数的会话视为全部已读
+	if err := s.rdb.Set(ctx, unreadBaselineKey(), maxID, 0).Err(); err != nil {
+		return err
+	}
+
+	log.Printf("未读计数迁移完成，共迁移 %d 个会话", migrated)
+	return nil
+}
+
+// parseLegacyUnreadKey 解析旧版未读计数键
+// 支持 unread:<user>:group:<group>、unread:<user>:private:<other> 和 unread:<user>:private:<a>:<b>
+func parseLegacyUnreadKey(key string) (userID, targetID uint, isGroup bool, ok bool) {
+	parts := strings.Split(key, ":")
+	if len(parts) < 4 || parts[0] != "unread" {
+		return 0, 0, false, false
+	}
+
+	ids := make([]uint, 0, 3)
+	for _, p := range append([]string{parts[1]}, parts[3:]...) {
+		id, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return 0, 0, false, false
+		}
+		ids = append(ids, uint(id))
+	}
+	userID = ids[0]
+
+	switch {
+	case parts[2] == "group" && len(ids) == 2:
+		return userID, ids[1], true, true
+	case parts[2] == "private" && len(ids) == 2:
+		return userID, ids[1], false, true
+	case parts[2] == "private" && len(ids) == 3:
+		// 会话ID中的另一方即为目标用户
+		if ids[1] == userID {
+			return userID, ids[2], false, true
+		}
+		return userID, ids[1], false, true
+	}
+	return 0, 0, false, false
+}
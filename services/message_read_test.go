@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestUnreadCountFollowsLastRead(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	send := func(from, to *models.User) *models.Message {
+		return env.createMessage(t, models.Message{SenderID: from.ID, ReceiverID: to.ID, Content: "hi"})
+	}
+
+	first := send(alice, bob)
+	second := send(alice, bob)
+	// 自己发送的消息不计入未读
+	send(bob, alice)
+	if got := s.getUnreadCount(bob.ID, alice.ID, false); got != 2 {
+		t.Fatalf("未读数 = %d，期望 2", got)
+	}
+
+	// 标记到第一条为已读
+	if err := s.MarkMessagesAsRead(bob.ID, alice.ID, false, first.ID); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+	if got := s.getUnreadCount(bob.ID, alice.ID, false); got != 1 {
+		t.Fatalf("部分已读后未读数 = %d，期望 1", got)
+	}
+
+	if err := s.MarkMessagesAsRead(bob.ID, alice.ID, false, second.ID); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+	if got := s.getUnreadCount(bob.ID, alice.ID, false); got != 0 {
+		t.Fatalf("全部已读后未读数 = %d，期望 0", got)
+	}
+
+	// 已读位置不后退
+	if err := s.MarkMessagesAsRead(bob.ID, alice.ID, false, first.ID); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+	if got := s.getUnreadCount(bob.ID, alice.ID, false); got != 0 {
+		t.Fatalf("已读位置后退后未读数 = %d，期望 0", got)
+	}
+
+	// 新消息重新计数
+	send(alice, bob)
+	latest := send(alice, bob)
+	if got := s.getUnreadCount(bob.ID, alice.ID, false); got != 2 {
+		t.Fatalf("新消息后未读数 = %d，期望 2", got)
+	}
+
+	// 删除未读消息后未读数随之减少
+	now := time.Now()
+	if err := env.db.Model(latest).Update("deleted_at", &now).Error; err != nil {
+		t.Fatalf("删除消息失败: %v", err)
+	}
+	if got := s.getUnreadCount(bob.ID, alice.ID, false); got != 1 {
+		t.Fatalf("删除后未读数 = %d，期望 1", got)
+	}
+
+	// 已读位置持久化到数据库，缓存失效后仍然有效
+	env.mr.FlushAll()
+	if got := s.getUnreadCount(bob.ID, alice.ID, false); got != 1 {
+		t.Fatalf("缓存失效后未读数 = %d，期望 1", got)
+	}
+}
+
+func TestGroupUnreadExcludesSystemMessages(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	group := env.createGroup(t, "g", alice, bob)
+
+	env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Content: "hi"})
+	env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Content: "加入群组", Type: models.SystemMessage})
+	env.createMessage(t, models.Message{SenderID: bob.ID, GroupID: group.ID, Content: "hey"})
+
+	if got := s.getUnreadCount(bob.ID, group.ID, true); got != 1 {
+		t.Fatalf("群未读数 = %d，期望 1", got)
+	}
+	if err := s.MarkMessagesAsRead(bob.ID, group.ID, true, 0); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+	if got := s.getUnreadCount(bob.ID, group.ID, true); got != 0 {
+		t.Fatalf("已读后群未读数 = %d，期望 0", got)
+	}
+	if got := s.LastAckedMessageID(bob.ID); got == 0 {
+		t.Fatal("已读位置未记录")
+	}
+}
+
+func TestMigrateUnreadCounters(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+
+	for i := 0; i < 3; i++ {
+		env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "hi"})
+	}
+	env.createMessage(t, models.Message{SenderID: carol.ID, ReceiverID: bob.ID, Content: "hi"})
+
+	legacyKey := fmt.Sprintf("unread:%d:private:%d", bob.ID, alice.ID)
+	// 旧版计数：与 alice 的会话有 2 条未读，与 carol 的会话没有计数
+	env.rdb.Set(ctx, legacyKey, 2, 0)
+
+	if err := s.MigrateUnreadCounters(); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+	if got := s.getUnreadCount(bob.ID, alice.ID, false); got != 2 {
+		t.Fatalf("迁移后未读数 = %d，期望 2", got)
+	}
+	// 迁移前没有计数的会话视为已读
+	if got := s.getUnreadCount(bob.ID, carol.ID, false); got != 0 {
+		t.Fatalf("无计数会话未读数 = %d，期望 0", got)
+	}
+	if n, _ := env.rdb.Exists(ctx, legacyKey).Result(); n != 0 {
+		t.Fatal("旧版计数未删除")
+	}
+
+	// 迁移后的新消息正常计入
+	env.createMessage(t, models.Message{SenderID: carol.ID, ReceiverID: bob.ID, Content: "new"})
+	if got := s.getUnreadCount(bob.ID, carol.ID, false); got != 1 {
+		t.Fatalf("迁移后新消息未读数 = %d，期望 1", got)
+	}
+}
+
+func TestParseLegacyUnreadKey(t *testing.T) {
+	tests := []struct {
+		key      string
+		userID   uint
+		targetID uint
+		isGroup  bool
+		ok       bool
+	}{
+		{"unread:1:group:5", 1, 5, true, true},
+		{"unread:1:private:2", 1, 2, false, true},
+		{"unread:1:private:1:2", 1, 2, false, true},
+		{"unread:2:private:1:2", 2, 1, false, true},
+		{"unread:1:group", 0, 0, false, false},
+		{"unread:x:group:5", 0, 0, false, false},
+		{"unread:1:channel:5", 0, 0, false, false},
+		{"other:1:group:5", 0, 0, false, false},
+	}
+	for _, tt := range tests {
+		userID, targetID, isGroup, ok := parseLegacyUnreadKey(tt.key)
+		if userID != tt.userID || targetID != tt.targetID || isGroup != tt.isGroup || ok != tt.ok {
+			t.Errorf("parseLegacyUnreadKey(%q) = %d, %d, %v, %v", tt.key, userID, targetID, isGroup, ok)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/models"
+)
+
+// deliveredEvent 直接投递给用户的一条WebSocket事件
+type deliveredEvent struct {
+	userID uint
+	event  WebSocketMessage
+}
+
+// recordDeliveries 替换直接投递函数，返回投递过的事件
+func recordDeliveries(s *MessageService) func() []deliveredEvent {
+	var mu sync.Mutex
+	var events []deliveredEvent
+	s.SetDirectDelivery(func(userID uint, message []byte) bool {
+		var event WebSocketMessage
+		json.Unmarshal(message, &event)
+		mu.Lock()
+		events = append(events, deliveredEvent{userID, event})
+		mu.Unlock()
+		return true
+	})
+	return func() []deliveredEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]deliveredEvent(nil), events...)
+	}
+}
+
+func TestRecallPublishesDeletedTombstone(t *testing.T) {
+	env := newTestEnv(t)
+	delivered := recordDeliveries(env.messages)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	msg := env.createMessage(t, models.Message{Content: "oops", SenderID: alice.ID, ReceiverID: bob.ID})
+
+	if _, err := env.messages.RecallMessage(msg.ID, alice.ID); err != nil {
+		t.Fatalf("撤回失败: %v", err)
+	}
+
+	tombstones := make(map[uint]models.MessageDeletedEvent)
+	recalled := make(map[uint]bool)
+	for _, d := range delivered() {
+		switch d.event.Type {
+		case "message_deleted":
+			var tombstone models.MessageDeletedEvent
+			if err := json.Unmarshal(d.event.Content, &tombstone); err != nil {
+				t.Fatalf("解析墓碑失败: %v", err)
+			}
+			tombstones[d.userID] = tombstone
+		case "message_recalled":
+			recalled[d.userID] = true
+		}
+	}
+	for _, userID := range []uint{alice.ID, bob.ID} {
+		tombstone, ok := tombstones[userID]
+		if !ok {
+			t.Fatalf("用户%d没有收到 message_deleted 事件", userID)
+		}
+		if tombstone.MessageID != msg.ID || tombstone.DeletedBy != alice.ID || tombstone.SenderID != alice.ID ||
+			tombstone.Content != models.DeletedMessagePlaceholder || tombstone.Reason != models.RecallWithdrawn || tombstone.DeletedAt.IsZero() {
+			t.Fatalf("墓碑内容错误: %+v", tombstone)
+		}
+		if !recalled[userID] {
+			t.Fatalf("用户%d没有收到兼容的 message_recalled 事件", userID)
+		}
+	}
+
+	// 软删除后历史记录不再返回该消息，再次撤回返回错误
+	history, err := env.messages.GetMessagesInRange(alice.ID, bob.ID, false, msg.CreatedAt.Add(-time.Second), msg.CreatedAt.Add(time.Second), 50, 0)
+	if err != nil || len(history) != 0 {
+		t.Fatalf("历史记录 = %v, %v，期望为空", history, err)
+	}
+	if _, err := env.messages.RecallMessage(msg.ID, alice.ID); err != ErrMessageAlreadyGone {
+		t.Fatalf("重复撤回 = %v，期望 ErrMessageAlreadyGone", err)
+	}
+}
+
+func TestRecallLosingRaceReturnsAlreadyGone(t *testing.T) {
+	env := newTestEnv(t)
+	delivered := recordDeliveries(env.messages)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	msg := env.createMessage(t, models.Message{Content: "oops", SenderID: alice.ID, ReceiverID: bob.ID})
+
+	// 在读取消息之后、更新之前由另一个请求删除该消息
+	var once sync.Once
+	err := env.db.Callback().Update().Before("gorm:update").Register("test:concurrent_delete", func(tx *gorm.DB) {
+		once.Do(func() {
+			if _, err := tx.Statement.ConnPool.ExecContext(tx.Statement.Context,
+				"UPDATE messages SET deleted_at = ?, deleted_by = ? WHERE id = ?", time.Now(), bob.ID, msg.ID); err != nil {
+				t.Errorf("模拟并发删除失败: %v", err)
+			}
+		})
+	})
+	if err != nil {
+		t.Fatalf("注册更新回调失败: %v", err)
+	}
+
+	if _, err := env.messages.RecallMessage(msg.ID, alice.ID); !errors.Is(err, ErrMessageAlreadyGone) {
+		t.Fatalf("撤回已被并发删除的消息 = %v，期望 ErrMessageAlreadyGone", err)
+	}
+	if got := delivered(); len(got) != 0 {
+		t.Fatalf("未成功撤回时不应发布事件，得到 %d 个", len(got))
+	}
+	var stored models.Message
+	env.db.First(&stored, msg.ID)
+	if stored.DeletedBy != bob.ID {
+		t.Fatalf("deleted_by = %d，期望保留先删除者 %d", stored.DeletedBy, bob.ID)
+	}
+}
+
+func TestRecallPermissions(t *testing.T) {
+	env := newTestEnv(t)
+	recordDeliveries(env.messages)
+	owner := env.createUser(t, "owner")
+	member := env.createUser(t, "member")
+	other := env.createUser(t, "other")
+	group := env.createGroup(t, "g", owner, member, other)
+
+	// 私聊消息只有发送者可以撤回
+	private := env.createMessage(t, models.Message{Content: "hi", SenderID: member.ID, ReceiverID: other.ID})
+	if _, err := env.messages.RecallMessage(private.ID, other.ID); err != ErrNoRecallPermission {
+		t.Fatalf("接收者撤回私聊消息 = %v，期望 ErrNoRecallPermission", err)
+	}
+
+	// 普通成员不能删除他人的群消息，群主可以
+	groupMsg := env.createMessage(t, models.Message{Content: "spam", SenderID: member.ID, GroupID: group.ID})
+	if _, err := env.messages.RecallMessage(groupMsg.ID, other.ID); err != ErrNoRecallPermission {
+		t.Fatalf("普通成员删除他人消息 = %v，期望 ErrNoRecallPermission", err)
+	}
+	event, err := env.messages.RecallMessage(groupMsg.ID, owner.ID)
+	if err != nil {
+		t.Fatalf("群主删除成员消息失败: %v", err)
+	}
+	if event.Reason != models.RecallRemovedByAdmin {
+		t.Fatalf("撤回原因 = %q，期望 %q", event.Reason, models.RecallRemovedByAdmin)
+	}
+}
+
+func TestRecallRoleHierarchy(t *testing.T) {
+	env := newTestEnv(t)
+	recordDeliveries(env.messages)
+	owner := env.createUser(t, "owner")
+	admin := env.createUser(t, "admin")
+	admin2 := env.createUser(t, "admin2")
+	member := env.createUser(t, "member")
+	group := env.createGroup(t, "g", owner, admin, admin2, member)
+	for _, u := range []uint{admin.ID, admin2.ID} {
+		if err := env.groups.SetGroupAdmin(group.ID, owner.ID, u, true); err != nil {
+			t.Fatalf("设置管理员失败: %v", err)
+		}
+	}
+
+	memberMsg := env.createMessage(t, models.Message{Content: "m", SenderID: member.ID, GroupID: group.ID})
+	adminMsg := env.createMessage(t, models.Message{Content: "a", SenderID: admin2.ID, GroupID: group.ID})
+	ownerMsg := env.createMessage(t, models.Message{Content: "o", SenderID: owner.ID, GroupID: group.ID})
+
+	// 管理员不能删除同级管理员和群主的消息
+	if _, err := env.messages.RecallMessage(adminMsg.ID, admin.ID); err != ErrNoRecallPermission {
+		t.Fatalf("管理员删除管理员消息 = %v，期望 ErrNoRecallPermission", err)
+	}
+	if _, err := env.messages.RecallMessage(ownerMsg.ID, admin.ID); err != ErrNoRecallPermission {
+		t.Fatalf("管理员删除群主消息 = %v，期望 ErrNoRecallPermission", err)
+	}
+	// 管理员只能删除不能编辑他人的消息
+	if _, err := env.messages.EditMessage(memberMsg.ID, admin.ID, "edited"); err != ErrNotMessageAuthor {
+		t.Fatalf("管理员编辑成员消息 = %v，期望 ErrNotMessageAuthor", err)
+	}
+
+	event, err := env.messages.RecallMessage(memberMsg.ID, admin.ID)
+	if err != nil {
+		t.Fatalf("管理员删除成员消息失败: %v", err)
+	}
+	if event.Reason != models.RecallRemovedByAdmin || event.DeletedBy != admin.ID {
+		t.Fatalf("删除事件 = %+v，期望由管理员%d移除", event, admin.ID)
+	}
+	var stored models.Message
+	env.db.First(&stored, memberMsg.ID)
+	if stored.DeletedAt == nil || stored.DeletedBy != admin.ID {
+		t.Fatalf("数据库未记录删除者: deleted_at=%v deleted_by=%d", stored.DeletedAt, stored.DeletedBy)
+	}
+
+	// 群主可以删除管理员的消息
+	if _, err := env.messages.RecallMessage(adminMsg.ID, owner.ID); err != nil {
+		t.Fatalf("群主删除管理员消息失败: %v", err)
+	}
+	// 发送者撤回自己的消息原因为 withdrawn
+	event, err = env.messages.RecallMessage(ownerMsg.ID, owner.ID)
+	if err != nil || event.Reason != models.RecallWithdrawn {
+		t.Fatalf("撤回自己的消息 = %+v, %v", event, err)
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestResolveReceiver(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	tests := []struct {
+		name   string
+		req    models.MessageRequest
+		wantID uint
+		err    error
+	}{
+		{"按用户名解析", models.MessageRequest{ReceiverUsername: "bob"}, bob.ID, nil},
+		{"ID优先于用户名", models.MessageRequest{ReceiverID: alice.ID, ReceiverUsername: "bob"}, alice.ID, nil},
+		{"用户名不存在", models.MessageRequest{ReceiverUsername: "nobody"}, 0, ErrUserNotFound},
+		{"未指定接收者", models.MessageRequest{}, 0, ErrReceiverRequired},
+		{"群消息无需接收者", models.MessageRequest{GroupID: 1}, 0, nil},
+	}
+	for _, tt := range tests {
+		req := tt.req
+		err := env.messages.ResolveReceiver(&req)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v，期望 %v", tt.name, err, tt.err)
+			continue
+		}
+		if req.ReceiverID != tt.wantID {
+			t.Errorf("%s: ReceiverID = %d，期望 %d", tt.name, req.ReceiverID, tt.wantID)
+		}
+	}
+}
+
+func TestSelfMessageRejected(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+
+	msg := &models.Message{SenderID: alice.ID, ReceiverID: alice.ID, Type: models.PrivateMessage, Content: "hi"}
+	if err := env.messages.ProcessMessage(msg); !errors.Is(err, models.ErrSelfMessage) {
+		t.Fatalf("给自己发消息 = %v，期望 ErrSelfMessage", err)
+	}
+
+	// 绕过服务层直接写入也会被拒绝
+	if err := env.db.Create(&models.Message{SenderID: alice.ID, ReceiverID: alice.ID, Type: models.PrivateMessage, Content: "hi"}).Error; !errors.Is(err, models.ErrSelfMessage) {
+		t.Fatalf("直接写入自己发给自己的消息 = %v，期望 ErrSelfMessage", err)
+	}
+
+	var count int64
+	env.db.Model(&models.Message{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("消息数 = %d，期望不保存任何消息", count)
+	}
+}
+
+func TestWSSelfMessageRejected(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+	client := NewClient(alice.ID, alice.Username, newFakeConn())
+
+	req := models.MessageRequest{Content: "hi", Type: models.PrivateMessage, ReceiverID: alice.ID}
+	client.handleChatMessage(context.Background(), req, m, env.messages)
+
+	select {
+	case frame := <-client.Send:
+		var event struct {
+			Type    string  `json:"type"`
+			Content WSError `json:"content"`
+		}
+		if err := json.Unmarshal(frame, &event); err != nil {
+			t.Fatalf("解析事件失败: %v", err)
+		}
+		if event.Type != "error" || event.Content.Code != http.StatusBadRequest || event.Content.Message != models.ErrSelfMessage.Error() {
+			t.Fatalf("错误事件 = %+v，期望 400 %q", event, models.ErrSelfMessage.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("未收到错误事件")
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"chatroom/models"
+)
+
+const (
+	// DefaultMessageSearchLimit 消息搜索每页的默认条数，MaxMessageSearchLimit 为上限
+	DefaultMessageSearchLimit = 20
+	MaxMessageSearchLimit     = 50
+
+	// DefaultMessageSearchContext 每条搜索结果前后各附带的消息数，MaxMessageSearchContext 为上限
+	DefaultMessageSearchContext = 2
+	MaxMessageSearchContext     = 5
+
+	// maxSearchQueryRunes 搜索词的最大字符数
+	maxSearchQueryRunes = 100
+)
+
+// 消息搜索相关错误
+var (
+	ErrSearchQueryRequired    = errors.New("搜索关键词不能为空")
+	ErrSearchQueryTooLong     = fmt.Errorf("搜索关键词不能超过%d个字符", maxSearchQueryRunes)
+	ErrPrivateSearchEncrypted = errors.New("私聊消息已加密存储，无法按内容搜索")
+)
+
+// SearchMessages 在请求者参与的会话中按关键词搜索消息，按时间倒序分页，
+// 每条结果附带前后各 contextSize 条消息；私聊为请求者与对方的消息，群聊要求请求者为群成员并遵循历史可见范围
+// 搜索词中的 % 和 _ 按字面匹配；私聊内容加密存储时无法搜索私聊
+func (s *MessageService) SearchMessages(ctx context.Context, userID, targetID uint, isGroup bool, query string, contextSize, limit, offset int) ([]models.MessageSearchHit, bool, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, false, ErrSearchQueryRequired
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryRunes {
+		return nil, false, ErrSearchQueryTooLong
+	}
+	if limit <= 0 {
+		limit = DefaultMessageSearchLimit
+	}
+	if limit > MaxMessageSearchLimit {
+		limit = MaxMessageSearchLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if contextSize < 0 {
+		contextSize = 0
+	}
+	if contextSize > MaxMessageSearchContext {
+		contextSize = MaxMessageSearchContext
+	}
+
+	var base func() (*gorm.DB, error)
+	if isGroup {
+		rank, err := s.groupRank(targetID, userID)
+		if err != nil {
+			return nil, false, err
+		}
+		if rank == rankNone {
+			return nil, false, ErrNotConversationUser
+		}
+		base = func() (*gorm.DB, error) {
+			return s.groupHistoryQuery(ctx, userID, targetID)
+		}
+	} else {
+		if s.EncryptionEnabled() {
+			return nil, false, ErrPrivateSearchEncrypted
+		}
+		base = func() (*gorm.DB, error) {
+			return s.privateHistoryQuery(ctx, userID, targetID), nil
+		}
+	}
+
+	// 多取一条判断是否还有下一页
+	q, err := base()
+	if err != nil {
+		return nil, false, err
+	}
+	var matches []models.Message
+	if err := q.Where("content LIKE ?"+likeEscape, likePattern(query)).
+		Order("created_at DESC, id DESC").
+		Limit(limit + 1).
+		Offset(offset).
+		Find(&matches).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(matches) > limit
+	if hasMore {
+		matches = matches[:limit]
+	}
+
+	hits := make([]models.MessageSearchHit, 0, len(matches))
+	for _, match := range matches {
+		responses, err := s.convertMessagesToResponse([]models.Message{match}, userID)
+		if err != nil {
+			return nil, false, err
+		}
+		hit := models.MessageSearchHit{Message: responses[0]}
+
+		if contextSize > 0 {
+			if hit.Before, err = s.searchContext(base, match, contextSize, true, userID); err != nil {
+				return nil, false, err
+			}
+			if hit.After, err = s.searchContext(base, match, contextSize, false, userID); err != nil {
+				return nil, false, err
+			}
+		}
+		hits = append(hits, hit)
+	}
+	return hits, hasMore, nil
+}
+
+// searchContext 获取搜索结果前（before为true）或后的 n 条消息，按时间升序返回
+func (s *MessageService) searchContext(base func() (*gorm.DB, error), match models.Message, n int, before bool, userID uint) ([]models.MessageResponse, error) {
+	q, err := base()
+	if err != nil {
+		return nil, err
+	}
+	if before {
+		q = q.Where("id < ?", match.ID).Order("created_at DESC, id DESC")
+	} else {
+		q = q.Where("id > ?", match.ID).Order("created_at ASC, id ASC")
+	}
+
+	var messages []models.Message
+	if err := q.Limit(n).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	// convertMessagesToResponse 将倒序的消息反转为升序，之后的消息需先转为倒序
+	if !before {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return s.convertMessagesToResponse(messages, userID)
+}
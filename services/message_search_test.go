@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestSearchMessages(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", alice, bob)
+
+	base := time.Now().Add(-time.Hour)
+	var private []*models.Message
+	for i, content := range []string{"hello world", "foo", "50% off", "500 off", "bar", "hello again", "a_b", "axb"} {
+		private = append(private, env.createMessage(t, models.Message{
+			SenderID: alice.ID, ReceiverID: bob.ID, Content: content, CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+	env.createMessage(t, models.Message{SenderID: bob.ID, GroupID: group.ID, Content: "hello group", CreatedAt: base})
+
+	contents := func(messages []models.MessageResponse) string {
+		var out []string
+		for _, msg := range messages {
+			out = append(out, msg.Content)
+		}
+		return strings.Join(out, "|")
+	}
+
+	// 按时间倒序返回命中消息，并附带前后的上下文
+	hits, hasMore, err := s.SearchMessages(ctx, bob.ID, alice.ID, false, "Hello", 1, 10, 0)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if len(hits) != 2 || hasMore {
+		t.Fatalf("搜索结果 %d 条，has_more = %v，期望 2 条", len(hits), hasMore)
+	}
+	if hits[0].Message.ID != private[5].ID || contents(hits[0].Before) != "bar" || contents(hits[0].After) != "a_b" {
+		t.Fatalf("第一条结果 = %+v", hits[0])
+	}
+	if hits[1].Message.ID != private[0].ID || len(hits[1].Before) != 0 || contents(hits[1].After) != "foo" {
+		t.Fatalf("第二条结果 = %+v", hits[1])
+	}
+	hits, _, _ = s.SearchMessages(ctx, bob.ID, alice.ID, false, "hello", 3, 10, 0)
+	if contents(hits[0].Before) != "50% off|500 off|bar" {
+		t.Fatalf("前文 = %q，期望 50%% off|500 off|bar", contents(hits[0].Before))
+	}
+	if contents(hits[0].After) != "a_b|axb" {
+		t.Fatalf("后文 = %q，期望 a_b|axb", contents(hits[0].After))
+	}
+
+	// 通配符按字面匹配
+	for query, want := range map[string]string{"50%": "50% off", "a_b": "a_b", "0% off": "50% off", "a!b": ""} {
+		hits, _, err := s.SearchMessages(ctx, alice.ID, bob.ID, false, query, 0, 10, 0)
+		if err != nil {
+			t.Fatalf("搜索 %q 失败: %v", query, err)
+		}
+		var got []models.MessageResponse
+		for _, hit := range hits {
+			got = append(got, hit.Message)
+		}
+		if contents(got) != want {
+			t.Errorf("搜索 %q = %q，期望 %q", query, contents(got), want)
+		}
+	}
+
+	// 分页
+	hits, hasMore, _ = s.SearchMessages(ctx, alice.ID, bob.ID, false, "hello", 0, 1, 0)
+	if len(hits) != 1 || !hasMore {
+		t.Fatalf("第一页 %d 条，has_more = %v，期望 1 条且还有更多", len(hits), hasMore)
+	}
+	hits, hasMore, _ = s.SearchMessages(ctx, alice.ID, bob.ID, false, "hello", 0, 1, 1)
+	if len(hits) != 1 || hasMore || hits[0].Message.ID != private[0].ID {
+		t.Fatalf("第二页 = %+v，has_more = %v", hits, hasMore)
+	}
+
+	// 只搜索请求者参与的会话
+	if hits, _, _ := s.SearchMessages(ctx, carol.ID, alice.ID, false, "hello", 0, 10, 0); len(hits) != 0 {
+		t.Fatalf("非会话用户搜到了私聊消息: %+v", hits)
+	}
+	hits, _, err = s.SearchMessages(ctx, bob.ID, group.ID, true, "hello", 0, 10, 0)
+	if err != nil || len(hits) != 1 || hits[0].Message.Content != "hello group" {
+		t.Fatalf("群聊搜索 = %+v, %v", hits, err)
+	}
+
+	tests := []struct {
+		name     string
+		userID   uint
+		targetID uint
+		isGroup  bool
+		query    string
+		want     error
+	}{
+		{"非群成员", carol.ID, group.ID, true, "hello", ErrNotConversationUser},
+		{"空关键词", alice.ID, bob.ID, false, "  ", ErrSearchQueryRequired},
+		{"关键词过长", alice.ID, bob.ID, false, strings.Repeat("字", maxSearchQueryRunes+1), ErrSearchQueryTooLong},
+	}
+	for _, tt := range tests {
+		if _, _, err := s.SearchMessages(ctx, tt.userID, tt.targetID, tt.isGroup, tt.query, 0, 10, 0); !errors.Is(err, tt.want) {
+			t.Errorf("%s = %v，期望 %v", tt.name, err, tt.want)
+		}
+	}
+}
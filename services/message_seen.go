@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"chatroom/models"
+)
+
+const (
+	// seenCountTTL 群消息已读计数的保留时间
+	seenCountTTL = 7 * 24 * time.Hour
+	// maxSeenIncrements 单次标记已读最多累加计数的消息数，避免长时间未读后一次性写入过多键
+	maxSeenIncrements = 200
+)
+
+// ErrNotMessageSender 只有发送者可以查看已读详情
+var ErrNotMessageSender = errors.New("只有发送者可以查看已读详情")
+
+// advanceSeenCursorScript 原子地推进成员的已读计数游标
+// 游标前进时返回旧值，否则返回-1，保证同一成员对同一消息最多计数一次
+var advanceSeenCursorScript = redis.NewScript(`
+local cur = tonumber(redis.call('GET', KEYS[1]) or ARGV[2])
+local target = tonumber(ARGV[1])
+if target <= cur then
+	return -1
+end
+redis.call('SET', KEYS[1], target, 'PX', ARGV[3])
+return cur
+`)
+
+// seenCountKey 获取群消息已读计数的Redis键
+func seenCountKey(messageID uint) string {
+	return RedisKey("read:group:%d", messageID)
+}
+
+// seenCursorKey 获取成员在群组中已计数到的消息ID的Redis键
+func seenCursorKey(userID, groupID uint) string {
+	return RedisKey("read:group:cursor:%d:%d", userID, groupID)
+}
+
+// incrementSeenCounts 成员已读位置从prevID前进到lastID时，为区间内他人发送的消息累加已读计数
+func (s *MessageService) incrementSeenCounts(userID, groupID, prevID, lastID uint) {
+	ctx := context.Background()
+
+	from, err := advanceSeenCursorScript.Run(ctx, s.rdb,
+		[]string{seenCursorKey(userID, groupID)},
+		lastID, prevID, seenCountTTL.Milliseconds()).Int64()
+	if err != nil {
+		log.Printf("推进已读计数游标失败: %v", err)
+		return
+	}
+	if from < 0 {
+		// 其他请求已经计数过该区间
+		return
+	}
+
+	var messageIDs []uint
+	if err := s.unreadQuery(userID, groupID, true).
+		Where("id > ? AND id <= ?", from, lastID).
+		Order("id DESC").
+		Limit(maxSeenIncrements).
+		Pluck("id", &messageIDs).Error; err != nil {
+		log.Printf("查询已读区间消息失败: %v", err)
+		return
+	}
+	if len(messageIDs) == 0 {
+		return
+	}
+
+	pipe := s.rdb.Pipeline()
+	for _, id := range messageIDs {
+		key := seenCountKey(id)
+		pipe.HIncrBy(ctx, key, "count", 1)
+		pipe.Expire(ctx, key, seenCountTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("累加群消息已读计数失败: %v", err)
+	}
+}
+
+// attachSeenCounts 为群消息批量附加已读计数
+func (s *MessageService) attachSeenCounts(responses []models.MessageResponse) {
+	ctx := context.Background()
+	pipe := s.rdb.Pipeline()
+	cmds := make(map[int]*redis.StringCmd)
+	for i, resp := range responses {
+		if resp.GroupID == 0 {
+			continue
+		}
+		cmds[i] = pipe.HGet(ctx, seenCountKey(resp.ID), "count")
+	}
+	if len(cmds) == 0 {
+		return
+	}
+	pipe.Exec(ctx)
+
+	for i, cmd := range cmds {
+		count, err := cmd.Int()
+		if err != nil {
+			count = 0
+		}
+		responses[i].ReadCount = &count
+	}
+}
+
+// GetMessageReaders 获取已读群消息的成员列表（详细视图，仅发送者可查看）
+func (s *MessageService) GetMessageReaders(messageID, userID uint) ([]models.UserResponse, error) {
+	var msg models.Message
+	if err := s.db.First(&msg, messageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageAlreadyGone
+	}
+	if msg.GroupID == 0 {
+		return nil, ErrMessageNotFound
+	}
+	if msg.SenderID != userID {
+		return nil, ErrNotMessageSender
+	}
+
+	var readerIDs []uint
+	if err := s.db.Model(&models.ConversationRead{}).
+		Joins("JOIN group_members ON group_members.user_id = conversation_reads.user_id AND group_members.group_id = ? AND group_members.deleted_at IS NULL", msg.GroupID).
+		Where("conversation_reads.conversation_id = ? AND conversation_reads.last_read_message_id >= ? AND conversation_reads.user_id <> ?",
+			models.GroupConversationID(msg.GroupID), messageID, userID).
+		Pluck("conversation_reads.user_id", &readerIDs).Error; err != nil {
+		return nil, err
+	}
+
+	readers := make([]models.UserResponse, 0, len(readerIDs))
+	for _, id := range readerIDs {
+		user, err := s.userService.GetUserResponse(id)
+		if err != nil {
+			continue
+		}
+		readers = append(readers, *user)
+	}
+	return readers, nil
+}
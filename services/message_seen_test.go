@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"chatroom/models"
+)
+
+func TestSeenCountIdempotent(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", alice, bob, carol)
+
+	m1 := env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Content: "one"})
+	m2 := env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Content: "two"})
+
+	seen := func(msg *models.Message) int {
+		count, _ := env.rdb.HGet(ctx, seenCountKey(msg.ID), "count").Int()
+		return count
+	}
+	mark := func(user *models.User, messageID uint) {
+		t.Helper()
+		if err := s.MarkMessagesAsRead(user.ID, group.ID, true, messageID); err != nil {
+			t.Fatalf("标记已读失败: %v", err)
+		}
+	}
+
+	// 发送者自己已读不计数
+	mark(alice, 0)
+	if seen(m1) != 0 || seen(m2) != 0 {
+		t.Fatalf("发送者已读后计数 = %d, %d，期望 0, 0", seen(m1), seen(m2))
+	}
+
+	mark(bob, m1.ID)
+	mark(bob, 0)
+	// 重复标记和已读位置后退都不重复计数
+	mark(bob, 0)
+	mark(bob, m1.ID)
+	if seen(m1) != 1 || seen(m2) != 1 {
+		t.Fatalf("bob 已读后计数 = %d, %d，期望 1, 1", seen(m1), seen(m2))
+	}
+
+	mark(carol, m1.ID)
+	if seen(m1) != 2 || seen(m2) != 1 {
+		t.Fatalf("carol 已读后计数 = %d, %d，期望 2, 1", seen(m1), seen(m2))
+	}
+
+	// 并发推进同一区间只计数一次
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.incrementSeenCounts(carol.ID, group.ID, m1.ID, m2.ID)
+		}()
+	}
+	wg.Wait()
+	if seen(m2) != 2 {
+		t.Fatalf("并发已读后计数 = %d，期望 2", seen(m2))
+	}
+
+	// 历史消息响应中携带已读计数
+	responses, err := s.messagesToResponses([]models.Message{*m1, *m2}, bob.ID)
+	if err != nil {
+		t.Fatalf("转换消息失败: %v", err)
+	}
+	for i, want := range []int{2, 2} {
+		if responses[i].ReadCount == nil || *responses[i].ReadCount != want {
+			t.Fatalf("消息 %d 的 read_count = %v，期望 %d", responses[i].ID, responses[i].ReadCount, want)
+		}
+	}
+}
+
+func TestGetMessageReaders(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", alice, bob, carol)
+
+	m1 := env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Content: "one"})
+	m2 := env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Content: "two"})
+	if err := s.MarkMessagesAsRead(bob.ID, group.ID, true, m2.ID); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+	if err := s.MarkMessagesAsRead(carol.ID, group.ID, true, m1.ID); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+
+	if _, err := s.GetMessageReaders(m1.ID, bob.ID); !errors.Is(err, ErrNotMessageSender) {
+		t.Fatalf("非发送者查看已读详情 = %v，期望 ErrNotMessageSender", err)
+	}
+
+	readers, err := s.GetMessageReaders(m1.ID, alice.ID)
+	if err != nil {
+		t.Fatalf("获取已读详情失败: %v", err)
+	}
+	if len(readers) != 2 {
+		t.Fatalf("m1 已读成员 = %+v，期望 bob 和 carol", readers)
+	}
+	readers, _ = s.GetMessageReaders(m2.ID, alice.ID)
+	if len(readers) != 1 || readers[0].ID != bob.ID {
+		t.Fatalf("m2 已读成员 = %+v，期望 bob", readers)
+	}
+}
@@ -3,109 +3,552 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
+	"strconv"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 
+	"chatroom/config"
 	"chatroom/models"
 )
 
+// typingTTL 输入状态的有效期
+const typingTTL = 5 * time.Second
+
+// 消息操作相关错误
+var (
+	ErrMessageNotFound     = errors.New("消息不存在")
+	ErrNoRecallPermission  = errors.New("没有权限撤回该消息")
+	ErrMessageAlreadyGone  = errors.New("消息已被撤回")
+	ErrNoPinPermission     = errors.New("没有权限置顶该消息")
+	ErrAlreadyPinned       = errors.New("消息已置顶")
+	ErrNotPinned           = errors.New("消息未置顶")
+	ErrNotConversationUser = errors.New("不是该会话的成员")
+	ErrReactionNotFound    = errors.New("未找到该表情回应")
+	ErrPostNotAllowed      = errors.New("该群组仅允许管理员发言")
+	ErrSlowMode            = errors.New("群组已开启慢速模式")
+	ErrReceiverRequired    = errors.New("私聊消息必须指定接收者")
+	ErrContentTooLong      = errors.New("消息内容过长")
+	ErrInvalidContent      = errors.New("消息内容不是有效的UTF-8文本")
+	ErrSystemMessageSend   = errors.New("不能发送系统消息")
+	ErrSystemMessageAction = errors.New("系统消息不支持该操作")
+)
+
+// 群组内角色等级，用于判断管理权限
+const (
+	rankNone   = iota // 非群组成员
+	rankMember        // 普通成员
+	rankAdmin         // 管理员
+	rankOwner         // 群主
+)
+
 // MessageService 处理消息的存储和检索
 type MessageService struct {
 	db          *gorm.DB
 	rdb         *redis.Client
 	userService *UserService
 	kafka       *KafkaService
+
+	// 离线推送，按接收者的通知偏好过滤，pushNotify 为nil表示不推送
+	notifications *NotificationService
+	pushNotify    func(userID uint, message []byte)
+
+	// 直接投递（Kafka不可用或发布失败时的回退路径）
+	directDeliver func(userID uint, message []byte) bool
+
+	// 私聊消息内容加密器，为nil表示不加密
+	encryptor Encryptor
+
+	// 群组关键词匹配器缓存（groupID -> *watchwordMatcher）
+	watchwords sync.Map
 }
 
 // NewMessageService 创建一个新的消息服务
 func NewMessageService(db *gorm.DB, rdb *redis.Client, userService *UserService, kafka *KafkaService) *MessageService {
 	return &MessageService{
-		db:          db,
-		rdb:         rdb,
-		userService: userService,
-		kafka:       kafka,
+		db:            db,
+		rdb:           rdb,
+		userService:   userService,
+		kafka:         kafka,
+		notifications: NewNotificationService(db, rdb),
+		pushNotify:    newPushWebhookFromConfig(),
+		encryptor:     newEncryptorFromConfig(),
+	}
+}
+
+// EncryptionEnabled 是否对私聊消息内容进行静态加密
+// 开启后数据库中的私聊内容为密文，无法按内容检索
+func (s *MessageService) EncryptionEnabled() bool {
+	return s.encryptor != nil
+}
+
+// encryptContent 加密私聊消息内容，返回明文以便保存后恢复
+func (s *MessageService) encryptContent(msg *models.Message) (string, error) {
+	plaintext := msg.Content
+	if s.encryptor == nil || msg.GroupID > 0 {
+		return plaintext, nil
+	}
+	ciphertext, nonce, err := s.encryptor.Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+	msg.Content = ciphertext
+	msg.Nonce = nonce
+	return plaintext, nil
+}
+
+// decryptContent 解密从数据库读取的消息内容，明文存储的消息原样返回
+func (s *MessageService) decryptContent(msg *models.Message) {
+	if msg.Nonce == "" {
+		return
+	}
+	if s.encryptor == nil {
+		msg.Content = "[加密消息]"
+		return
+	}
+	plaintext, err := s.encryptor.Decrypt(msg.Content, msg.Nonce)
+	if err != nil {
+		log.Printf("解密消息%d失败: %v", msg.ID, err)
+		msg.Content = "[加密消息]"
+		return
 	}
+	msg.Content = plaintext
+}
+
+// SetDirectDelivery 设置Kafka不可用时的直接投递函数
+func (s *MessageService) SetDirectDelivery(deliver func(userID uint, message []byte) bool) {
+	s.directDeliver = deliver
+}
+
+// ResolveReceiver 解析私聊请求的接收者，未提供receiver_id时按用户名查找
+// 存储时始终使用用户ID
+func (s *MessageService) ResolveReceiver(req *models.MessageRequest) error {
+	if req.GroupID > 0 || req.ReceiverID > 0 {
+		return nil
+	}
+	if req.ReceiverUsername == "" {
+		return ErrReceiverRequired
+	}
+
+	user, err := s.userService.GetUserByUsername(req.ReceiverUsername)
+	if err != nil {
+		return err
+	}
+	req.ReceiverID = user.ID
+	return nil
 }
 
 // ProcessMessage 处理并分发消息
 func (s *MessageService) ProcessMessage(msg *models.Message) error {
-	// 1. 保存消息到数据库
-	if err := s.SaveMessage(msg); err != nil {
+	// 0. 校验消息，并检查群组发言策略
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	if err := ValidateContent(msg.Content); err != nil {
+		return err
+	}
+	// 系统消息只能由服务端生成，不计未读、不可回应
+	if msg.Type == models.SystemMessage {
+		return ErrSystemMessageSend
+	}
+	if err := s.userService.CheckCanPost(msg.SenderID); err != nil {
+		return err
+	}
+	slowModeHeld := false
+	if msg.GroupID > 0 {
+		held, err := s.checkPostPolicy(msg.GroupID, msg.SenderID)
+		if err != nil {
+			return err
+		}
+		slowModeHeld = held
+	} else if err := s.userService.CheckCanMessage(msg.SenderID, msg.ReceiverID); err != nil {
 		return err
 	}
 
-	// 2. 获取发送者信息
+	// 1. 获取发送者信息
 	sender, err := s.userService.GetUserResponse(msg.SenderID)
 	if err != nil {
+		if slowModeHeld {
+			s.releaseSlowMode(msg.GroupID, msg.SenderID)
+		}
 		return err
 	}
 
-	// 3. 构建消息响应
-	msgResp := models.MessageResponse{
-		ID:         msg.ID,
-		Content:    msg.Content,
-		Type:       msg.Type,
-		SenderID:   msg.SenderID,
-		Sender:     *sender,
-		ReceiverID: msg.ReceiverID,
-		GroupID:    msg.GroupID,
-		CreatedAt:  msg.CreatedAt,
+	// 2. 保存消息到数据库，并在同一事务中写入发件箱
+	msgResp, outbox, err := s.SaveMessage(msg, sender)
+	if err != nil {
+		// 消息未保存，撤销慢速模式的发言记录
+		if slowModeHeld {
+			s.releaseSlowMode(msg.GroupID, msg.SenderID)
+		}
+		return err
 	}
 
 	msgJSON, _ := json.Marshal(msgResp)
 
-	// 4. 推送到Kafka（如果可用）
-	if s.kafka != nil {
-		var topic string
-		if msg.GroupID > 0 { // 群聊消息
-			topic = s.kafka.BuildTopicName("group", msg.GroupID)
-		} else { // 私聊消息
-			topic = s.kafka.BuildTopicName("private", msg.ReceiverID)
-		}
-
-		if err := s.kafka.PublishMessage(topic, "message", msgJSON); err != nil {
-			log.Printf("发布消息到Kafka失败: %v", err)
-			// 非致命错误，消息已保存
+	// 3. 推送到Kafka（如果可用）
+	if outbox != nil && !s.kafka.Available() {
+		// Kafka暂不可用，发件箱记录在恢复后由中继发布，先直接投递给本节点的在线用户
+		s.kafka.recordFallback()
+		s.fallbackDeliver(msg, msgJSON, outbox)
+	} else if outbox != nil {
+		if err := s.publishOutbox(outbox); err != nil {
+			// 非致命错误，消息已保存，由发件箱中继稍后重新发布；同时先直接投递给本节点的在线用户
+			log.Printf("发布消息%d（会话%s，发送者%d，发件箱记录%d）到Kafka失败，回退到直接投递: %v",
+				msg.ID, conversationKey(msg.SenderID, msg.ReceiverID, msg.GroupID), msg.SenderID, outbox.ID, err)
+			s.kafka.recordFallback()
+			s.fallbackDeliver(msg, msgJSON, outbox)
 		}
 	} else {
-		log.Printf("Kafka不可用，跳过消息发布")
+		log.Printf("Kafka不可用，直接投递消息")
+		s.deliverDirectly(msg, msgJSON)
+	}
+
+	// 推送给不在线的接收者
+	if s.pushNotify != nil {
+		go s.notifyOffline(msg, msgJSON)
 	}
 
-	// 5. 更新最近聊天列表和缓存
+	// 4. 更新最近聊天列表和缓存
+	if msg.GroupID > 0 {
+		s.incrementMentionCounts(msg)
+		s.recordGroupActivity(msg)
+		go s.checkWatchwords(msg, msg.Content)
+	}
+	s.clearDraft(msg)
+	s.recordSent(msg)
 	s.updateRecentChats(msg)
-	s.cacheRecentMessage(&msgResp)
+	s.cacheRecentMessage(msgResp)
 
 	return nil
 }
 
-// SaveMessage 保存消息到数据库
-func (s *MessageService) SaveMessage(msg *models.Message) error {
+// fallbackDeliver 直接投递发布失败的消息，所有在线接收者都已投递时将发件箱记录标记为已发布，
+// 避免中继再次发布造成重复；仍有接收者在其他节点在线时保留记录，由中继补发
+func (s *MessageService) fallbackDeliver(msg *models.Message, msgJSON []byte, outbox *models.OutboxMessage) {
+	if !s.deliverDirectly(msg, msgJSON) {
+		return
+	}
+	if err := s.markOutboxSent(outbox); err != nil {
+		log.Printf("标记发件箱记录%d为已发布失败: %v", outbox.ID, err)
+	}
+}
+
+// deliverDirectly 绕过Kafka直接将消息投递给本节点上的在线接收者
+// 返回是否已覆盖所有接收者：每个接收者要么已投递，要么不在线（上线后从历史记录获取）
+func (s *MessageService) deliverDirectly(msg *models.Message, msgJSON []byte) bool {
+	if s.directDeliver == nil {
+		return false
+	}
+
+	if msg.GroupID > 0 {
+		memberIDs, err := s.GetGroupMembers(msg.GroupID)
+		if err != nil {
+			log.Printf("获取群组成员失败，直接投递中止: %v", err)
+			return false
+		}
+		reachedAll := true
+		for _, memberID := range memberIDs {
+			if memberID != msg.SenderID && !s.directDeliver(memberID, msgJSON) && s.userService.IsUserOnline(memberID) {
+				reachedAll = false
+			}
+		}
+		return reachedAll
+	}
+
+	return s.directDeliver(msg.ReceiverID, msgJSON) || !s.userService.IsUserOnline(msg.ReceiverID)
+}
+
+// SaveMessage 保存消息到数据库，Kafka可用时在同一事务中写入发件箱记录
+func (s *MessageService) SaveMessage(msg *models.Message, sender *models.UserResponse) (*models.MessageResponse, *models.OutboxMessage, error) {
+	var msgResp models.MessageResponse
+	var outbox *models.OutboxMessage
+
 	// 使用事务保存消息
 	err := s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(msg).Error; err != nil {
+		plaintext, err := s.encryptContent(msg)
+		if err != nil {
 			return err
 		}
-		return nil
+		err = tx.Create(msg).Error
+		// 数据库中保存密文，内存中的消息恢复为明文供后续投递
+		msg.Content = plaintext
+		if err != nil {
+			return err
+		}
+
+		// 构建消息响应
+		msgResp = models.MessageResponse{
+			ID:         msg.ID,
+			Content:    msg.Content,
+			Type:       msg.Type,
+			SenderID:   msg.SenderID,
+			Sender:     *sender,
+			ReceiverID: msg.ReceiverID,
+			GroupID:    msg.GroupID,
+			CreatedAt:  msg.CreatedAt,
+		}
+
+		if s.kafka == nil {
+			return nil
+		}
+
+		payload, err := json.Marshal(msgResp)
+		if err != nil {
+			return err
+		}
+		outbox, err = s.newOutboxMessage(msg, payload)
+		if err != nil {
+			return err
+		}
+		return tx.Create(outbox).Error
 	})
 
 	if err != nil {
 		log.Printf("保存消息失败: %v", err)
-		return err
+		return nil, nil, err
+	}
+
+	return &msgResp, outbox, nil
+}
+
+// RecallMessage 撤回/删除消息
+// 发送者可以撤回自己的消息；群聊中群主和管理员可以移除等级低于自己的成员的消息（只能删除，不能编辑）
+func (s *MessageService) RecallMessage(messageID, operatorID uint) (*models.MessageRecallEvent, error) {
+	var msg models.Message
+	if err := s.db.First(&msg, messageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageAlreadyGone
+	}
+
+	reason := models.RecallWithdrawn
+	if msg.SenderID != operatorID {
+		// 只有群聊消息可以由他人移除
+		if msg.GroupID == 0 {
+			return nil, ErrNoRecallPermission
+		}
+
+		operatorRank, err := s.groupRank(msg.GroupID, operatorID)
+		if err != nil {
+			return nil, err
+		}
+		senderRank, err := s.groupRank(msg.GroupID, msg.SenderID)
+		if err != nil {
+			return nil, err
+		}
+		if operatorRank < rankAdmin || operatorRank <= senderRank {
+			return nil, ErrNoRecallPermission
+		}
+		reason = models.RecallRemovedByAdmin
+	}
+
+	// 只更新尚未删除的消息，并发撤回时只有一个请求成功并发布事件
+	now := time.Now()
+	result := s.db.Model(&models.Message{}).Where("id = ? AND deleted_at IS NULL", msg.ID).Updates(map[string]interface{}{
+		"deleted_at": now,
+		"deleted_by": operatorID,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrMessageAlreadyGone
+	}
+
+	event := &models.MessageRecallEvent{
+		MessageID:  msg.ID,
+		Type:       msg.Type,
+		SenderID:   msg.SenderID,
+		ReceiverID: msg.ReceiverID,
+		GroupID:    msg.GroupID,
+		DeletedBy:  operatorID,
+		Reason:     reason,
+		DeletedAt:  now,
 	}
 
+	// 清理缓存并通知会话成员
+	s.invalidateConversationCaches(&msg)
+	s.publishRecall(event, &msg)
+
+	return event, nil
+}
+
+// publishRecall 通知会话成员消息已撤回/删除
+// message_deleted 事件携带墓碑，message_recalled 事件保留给尚未升级的客户端
+func (s *MessageService) publishRecall(event *models.MessageRecallEvent, msg *models.Message) {
+	deletedJSON, _ := json.Marshal(models.NewMessageDeletedEvent(*event))
+	s.publishConversationEvent("message_deleted", deletedJSON, msg)
+	recallJSON, _ := json.Marshal(event)
+	s.publishConversationEvent("message_recalled", recallJSON, msg)
+}
+
+// checkPostPolicy 检查用户是否可以在群组中发言：群组必须存在且用户为群成员，
+// 群主和管理员不受发言策略和慢速模式限制。返回是否记录了慢速模式下的本次发言
+func (s *MessageService) checkPostPolicy(groupID, userID uint) (bool, error) {
+	var group models.Group
+	if err := s.db.Select("id", "post_policy", "slow_mode_seconds").First(&group, groupID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, ErrGroupNotFound
+		}
+		return false, err
+	}
+
+	rank, err := s.groupRank(groupID, userID)
+	if err != nil {
+		return false, err
+	}
+	if rank == rankNone {
+		return false, ErrNotConversationUser
+	}
+	if rank >= rankAdmin {
+		return false, nil
+	}
+	if group.PostPolicy == models.PostAdminsOnly {
+		return false, ErrPostNotAllowed
+	}
+	if group.SlowModeSeconds <= 0 {
+		return false, nil
+	}
+	if err := s.checkSlowMode(groupID, userID, group.SlowModeSeconds); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ValidateContent 校验消息内容：必须是合法UTF-8，长度按字符而不是字节计算
+func ValidateContent(content string) error {
+	if !utf8.ValidString(content) {
+		return ErrInvalidContent
+	}
+	if limit := config.AppConfig.MessageMaxRunes; utf8.RuneCountInString(content) > limit {
+		return fmt.Errorf("%w，最多%d个字符", ErrContentTooLong, limit)
+	}
 	return nil
 }
 
-// GetMessagesByUser 获取两个用户之间的消息
-func (s *MessageService) GetMessagesByUser(userID1, userID2 uint, limit, offset int) ([]models.MessageResponse, error) {
+// groupRank 获取用户在群组中的角色等级
+func (s *MessageService) groupRank(groupID, userID uint) (int, error) {
+	var group models.Group
+	if err := s.db.Select("id", "creator_id").First(&group, groupID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return rankNone, nil
+		}
+		return rankNone, err
+	}
+	if group.CreatorID == userID {
+		return rankOwner, nil
+	}
+
+	var member models.GroupMember
+	if err := s.db.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return rankNone, nil
+		}
+		return rankNone, err
+	}
+	if member.IsAdmin {
+		return rankAdmin, nil
+	}
+	return rankMember, nil
+}
+
+// invalidateConversationCaches 清理消息所属会话的缓存
+func (s *MessageService) invalidateConversationCaches(msg *models.Message) {
+	ctx := context.Background()
+	s.rdb.Del(ctx, recentMessagesKey(conversationKey(msg.SenderID, msg.ReceiverID, msg.GroupID)))
+
+	if msg.GroupID > 0 {
+		// 撤回或删除后消息数变化，下次读取时重新统计
+		s.rdb.Del(ctx, groupActivityKey(msg.GroupID))
+
+		memberIDs, err := s.GetGroupMembers(msg.GroupID)
+		if err != nil {
+			return
+		}
+		for _, memberID := range memberIDs {
+			s.rdb.Del(ctx, recentChatsKey(memberID))
+		}
+		return
+	}
+
+	s.rdb.Del(ctx, recentChatsKey(msg.SenderID))
+	s.rdb.Del(ctx, recentChatsKey(msg.ReceiverID))
+}
+
+// PublishGroupEvent 向群组成员发布事件
+func (s *MessageService) PublishGroupEvent(groupID uint, eventType string, payload []byte) {
+	s.publishConversationEvent(eventType, payload, &models.Message{GroupID: groupID})
+}
+
+// publishConversationEvent 将会话事件通知给会话的所有参与者
+func (s *MessageService) publishConversationEvent(eventType string, payload []byte, msg *models.Message) {
+	if s.kafka.Available() {
+		var err error
+		if msg.GroupID > 0 {
+			err = s.kafka.PublishChatMessage(eventType, payload, msg.SenderID, 0, msg.GroupID)
+		} else {
+			// 私聊事件需要同时通知收发双方
+			err = s.kafka.PublishChatMessage(eventType, payload, msg.SenderID, msg.ReceiverID, 0)
+			if err == nil {
+				err = s.kafka.PublishChatMessage(eventType, payload, msg.ReceiverID, msg.SenderID, 0)
+			}
+		}
+		if err == nil {
+			return
+		}
+		log.Printf("发布%s事件到Kafka失败，回退到直接投递: %v", eventType, err)
+	}
+
+	if s.directDeliver == nil {
+		return
+	}
+
+	wsMsgJSON := newWSRawEvent(eventType, payload)
+
+	if msg.GroupID > 0 {
+		memberIDs, err := s.GetGroupMembers(msg.GroupID)
+		if err != nil {
+			log.Printf("获取群组成员失败，直接投递中止: %v", err)
+			return
+		}
+		for _, memberID := range memberIDs {
+			s.directDeliver(memberID, wsMsgJSON)
+		}
+		return
+	}
+
+	s.directDeliver(msg.SenderID, wsMsgJSON)
+	s.directDeliver(msg.ReceiverID, wsMsgJSON)
+}
+
+// clampHistoryLimit 将单次查询的历史消息条数限制在 MESSAGE_HISTORY_MAX_LIMIT 以内
+// 非正数同样按上限处理，避免 Limit(-1) 取消限制
+func clampHistoryLimit(limit int) int {
+	if limit <= 0 || limit > config.AppConfig.MessageHistoryMaxLimit {
+		return config.AppConfig.MessageHistoryMaxLimit
+	}
+	return limit
+}
+
+// GetMessagesByUser 获取两个用户之间的消息，ctx取消时中止查询
+func (s *MessageService) GetMessagesByUser(ctx context.Context, userID1, userID2 uint, limit, offset int) ([]models.MessageResponse, error) {
+	limit = clampHistoryLimit(limit)
+
 	var messages []models.Message
-	err := s.db.Preload("Sender").
-		Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)", userID1, userID2, userID2, userID1).
+	err := s.privateHistoryQuery(ctx, userID1, userID2).
 		Order("created_at DESC").
 		Limit(limit).
 		Offset(offset).
@@ -115,14 +558,56 @@ func (s *MessageService) GetMessagesByUser(userID1, userID2 uint, limit, offset
 		return nil, err
 	}
 
-	return s.convertMessagesToResponse(messages)
+	return s.convertMessagesToResponse(messages, userID1)
+}
+
+// GetMessagesByUserBefore 按游标获取两个用户之间ID小于beforeID的消息，
+// 返回的游标为本页最早一条消息的ID，没有更早的消息时为nil
+func (s *MessageService) GetMessagesByUserBefore(ctx context.Context, userID1, userID2, beforeID uint, limit int) ([]models.MessageResponse, *uint, error) {
+	limit = clampHistoryLimit(limit)
+
+	var messages []models.Message
+	err := s.privateHistoryQuery(ctx, userID1, userID2).
+		Where("id < ?", beforeID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&messages).Error
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	responses, err := s.convertMessagesToResponse(messages, userID1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return responses, nextHistoryCursor(responses, limit), nil
+}
+
+// privateHistoryQuery 构建两个用户之间未撤回、未被请求者清空的消息查询
+func (s *MessageService) privateHistoryQuery(ctx context.Context, userID1, userID2 uint) *gorm.DB {
+	query := s.db.WithContext(ctx).Preload("Sender").
+		Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)", userID1, userID2, userID2, userID1).
+		Where("group_id = 0 AND deleted_at IS NULL")
+
+	// 过滤掉请求者已清空的消息
+	if cleared := s.clearedBefore(ctx, userID1, userID2, false); !cleared.IsZero() {
+		query = query.Where("created_at > ?", cleared)
+	}
+	return query
 }
 
-// GetGroupMessages 获取群组消息
-func (s *MessageService) GetGroupMessages(groupID uint, limit, offset int) ([]models.MessageResponse, error) {
+// GetGroupMessages 获取群组消息，userID为请求者，用于标记其表情回应，ctx取消时中止查询
+func (s *MessageService) GetGroupMessages(ctx context.Context, userID, groupID uint, limit, offset int) ([]models.MessageResponse, error) {
+	limit = clampHistoryLimit(limit)
+
+	query, err := s.groupHistoryQuery(ctx, userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
 	var messages []models.Message
-	err := s.db.Preload("Sender").
-		Where("group_id = ?", groupID).
+	err = query.
 		Order("created_at DESC").
 		Limit(limit).
 		Offset(offset).
@@ -132,7 +617,89 @@ func (s *MessageService) GetGroupMessages(groupID uint, limit, offset int) ([]mo
 		return nil, err
 	}
 
-	return s.convertMessagesToResponse(messages)
+	return s.convertMessagesToResponse(messages, userID)
+}
+
+// GetGroupMessagesBefore 按游标获取群组中ID小于beforeID的消息，游标规则与 GetMessagesByUserBefore 相同
+func (s *MessageService) GetGroupMessagesBefore(ctx context.Context, userID, groupID, beforeID uint, limit int) ([]models.MessageResponse, *uint, error) {
+	limit = clampHistoryLimit(limit)
+
+	query, err := s.groupHistoryQuery(ctx, userID, groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var messages []models.Message
+	err = query.
+		Where("id < ?", beforeID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&messages).Error
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	responses, err := s.convertMessagesToResponse(messages, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return responses, nextHistoryCursor(responses, limit), nil
+}
+
+// groupHistoryQuery 构建群组中请求者可见的未撤回消息查询
+func (s *MessageService) groupHistoryQuery(ctx context.Context, userID, groupID uint) (*gorm.DB, error) {
+	query := s.db.WithContext(ctx).Preload("Sender").
+		Where("group_id = ? AND deleted_at IS NULL", groupID)
+
+	// 群组仅允许查看入群后的消息时，按成员的入群时间过滤
+	since, err := s.historyVisibleSince(ctx, userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if !since.IsZero() {
+		query = query.Where("created_at >= ?", since)
+	}
+	if cleared := s.clearedBefore(ctx, userID, groupID, true); !cleared.IsZero() {
+		query = query.Where("created_at > ?", cleared)
+	}
+	return query, nil
+}
+
+// nextHistoryCursor 返回下一页的游标，即本页最早一条消息的ID（消息已按时间升序排列），
+// 本页不足limit条说明没有更早的消息，返回nil
+func nextHistoryCursor(messages []models.MessageResponse, limit int) *uint {
+	if len(messages) == 0 || len(messages) < limit {
+		return nil
+	}
+	cursor := messages[0].ID
+	return &cursor
+}
+
+// historyVisibleSince 获取成员可见的最早消息时间，零值表示可查看全部历史
+func (s *MessageService) historyVisibleSince(ctx context.Context, userID, groupID uint) (time.Time, error) {
+	var group models.Group
+	if err := s.db.WithContext(ctx).Select("id", "history_visibility").First(&group, groupID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	if group.HistoryVisibility != models.HistorySinceJoin {
+		return time.Time{}, nil
+	}
+
+	var member models.GroupMember
+	if err := s.db.WithContext(ctx).Select("joined_at").
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 非成员看不到任何历史消息
+			return time.Now(), nil
+		}
+		return time.Time{}, err
+	}
+	return member.JoinedAt, nil
 }
 
 // GetGroupMembers 获取群组成员ID列表
@@ -141,7 +708,7 @@ func (s *MessageService) GetGroupMembers(groupID uint) ([]uint, error) {
 
 	// 先尝试从Redis缓存获取
 	ctx := context.Background()
-	groupKey := fmt.Sprintf("group:members:%d", groupID)
+	groupKey := groupMembersKey(groupID)
 
 	membersJSON, err := s.rdb.Get(ctx, groupKey).Result()
 	if err == nil {
@@ -171,14 +738,8 @@ func (s *MessageService) GetGroupMembers(groupID uint) ([]uint, error) {
 }
 
 // GetRecentMessages 获取最近的消息
-func (s *MessageService) GetRecentMessages(receiverID, groupID uint, limit int) ([]models.MessageResponse, error) {
-	var key string
-
-	if groupID > 0 {
-		key = fmt.Sprintf("recent:group:%d", groupID)
-	} else {
-		key = fmt.Sprintf("recent:private:%d", receiverID)
-	}
+func (s *MessageService) GetRecentMessages(userID, receiverID, groupID uint, limit int) ([]models.MessageResponse, error) {
+	key := recentMessagesKey(conversationKey(userID, receiverID, groupID))
 
 	ctx := context.Background()
 
@@ -199,13 +760,13 @@ func (s *MessageService) GetRecentMessages(receiverID, groupID uint, limit int)
 
 	// 缓存未命中，从数据库获取
 	var messages []models.Message
-	query := s.db.Preload("Sender")
+	query := s.db.Preload("Sender").Where("deleted_at IS NULL")
 
 	if groupID > 0 {
 		query = query.Where("group_id = ?", groupID)
 	} else {
 		query = query.Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)",
-			receiverID, receiverID, receiverID, receiverID)
+			userID, receiverID, receiverID, userID).Where("group_id = 0")
 	}
 
 	if err := query.Order("created_at DESC").Limit(limit).Find(&messages).Error; err != nil {
@@ -215,6 +776,7 @@ func (s *MessageService) GetRecentMessages(receiverID, groupID uint, limit int)
 	// 转换为响应格式
 	responses := make([]models.MessageResponse, len(messages))
 	for i, msg := range messages {
+		s.decryptContent(&msg)
 		responses[i] = models.MessageResponse{
 			ID:       msg.ID,
 			Content:  msg.Content,
@@ -223,7 +785,7 @@ func (s *MessageService) GetRecentMessages(receiverID, groupID uint, limit int)
 			Sender: models.UserResponse{
 				ID:       msg.Sender.ID,
 				Username: msg.Sender.Username,
-				Avatar:   msg.Sender.Avatar,
+				Avatar:   AssetURL(msg.Sender.Avatar),
 				Online:   s.userService.IsUserOnline(msg.Sender.ID),
 			},
 			ReceiverID: msg.ReceiverID,
@@ -247,71 +809,98 @@ func (s *MessageService) cacheRecentMessage(msgResp *models.MessageResponse) {
 	ctx := context.Background()
 	msgJSON, _ := json.Marshal(msgResp)
 
-	var key string
-	if msgResp.GroupID > 0 {
-		key = fmt.Sprintf("recent:group:%d", msgResp.GroupID)
-	} else {
-		// 私聊消息，需要给收发双方都缓存
-		key = fmt.Sprintf("recent:private:%d:%d", msgResp.SenderID, msgResp.ReceiverID)
-		key2 := fmt.Sprintf("recent:private:%d:%d", msgResp.ReceiverID, msgResp.SenderID)
-		s.rdb.LPush(ctx, key2, msgJSON)
-		s.rdb.LTrim(ctx, key2, 0, 99)
-	}
+	// 私聊收发双方共用同一个会话键
+	key := recentMessagesKey(conversationKey(msgResp.SenderID, msgResp.ReceiverID, msgResp.GroupID))
 
 	s.rdb.LPush(ctx, key, msgJSON)
 	s.rdb.LTrim(ctx, key, 0, 99) // 保留最近100条
 }
 
 // GetRecentChats 获取最近的聊天列表
-func (s *MessageService) GetRecentChats(userID uint) ([]models.RecentChat, error) {
-	ctx := context.Background()
-	key := fmt.Sprintf("recent:chats:%d", userID)
+// ctx取消或超时时中止剩余的查询并返回错误，不完整的结果不会写入缓存
+func (s *MessageService) GetRecentChats(ctx context.Context, userID uint) ([]models.RecentChat, error) {
+	s.markRecentChatsActive(userID)
 
 	// 尝试从缓存获取
-	cachedData, err := s.rdb.Get(ctx, key).Result()
+	cachedData, err := s.rdb.Get(ctx, recentChatsKey(userID)).Result()
 	if err == nil {
 		var chats []models.RecentChat
 		if json.Unmarshal([]byte(cachedData), &chats) == nil {
+			s.attachDrafts(userID, chats)
 			return chats, nil
 		}
 	}
 
 	// 缓存未命中，从数据库查询
+	chats, err := s.loadRecentChats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.attachDrafts(userID, chats)
+	return chats, nil
+}
+
+// loadRecentChats 从数据库计算最近聊天列表并写入缓存，不包含草稿
+func (s *MessageService) loadRecentChats(ctx context.Context, userID uint) ([]models.RecentChat, error) {
+	db := s.db.WithContext(ctx)
+
 	// 1. 获取用户加入的所有群组
 	var userGroups []models.GroupMember
-	s.db.Where("user_id = ?", userID).Find(&userGroups)
+	if err := db.Where("user_id = ?", userID).Find(&userGroups).Error; err != nil {
+		return nil, err
+	}
 
 	// 2. 获取与用户相关的私聊
 	var privateMessages []models.Message
-	s.db.Where("sender_id = ? OR receiver_id = ?", userID, userID).
+	if err := db.Where("sender_id = ? OR receiver_id = ?", userID, userID).
+		Where("group_id = 0 AND deleted_at IS NULL").
 		Order("created_at DESC").
 		Limit(1000). // 限制查询范围
-		Find(&privateMessages)
+		Find(&privateMessages).Error; err != nil {
+		return nil, err
+	}
 
 	chatMap := make(map[string]models.RecentChat)
 
 	// 处理群聊
 	for _, ug := range userGroups {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		var lastMsg models.Message
-		res := s.db.Where("group_id = ?", ug.GroupID).Order("created_at DESC").First(&lastMsg)
-		if res.Error == nil {
+		res := db.Where("group_id = ? AND deleted_at IS NULL", ug.GroupID).Order("created_at DESC").First(&lastMsg)
+		// 清空后没有新消息的会话不出现在列表中
+		if res.Error == nil && lastMsg.CreatedAt.After(s.clearedBefore(ctx, userID, ug.GroupID, true)) {
 			var group models.Group
-			s.db.First(&group, ug.GroupID)
-			chatKey := fmt.Sprintf("group-%d", ug.GroupID)
+			db.First(&group, ug.GroupID)
+			folder := ug.Folder
+			if folder == "" {
+				folder = group.Category
+			}
+			chatKey := models.GroupConversationID(ug.GroupID)
 			chatMap[chatKey] = models.RecentChat{
-				TargetID:      ug.GroupID,
-				Type:          "group",
-				Name:          group.Name,
-				Avatar:        group.Avatar,
-				LastMessage:   lastMsg.Content,
-				LastMessageAt: lastMsg.CreatedAt,
-				UnreadCount:   s.getUnreadCount(userID, ug.GroupID, true),
+				TargetID:            ug.GroupID,
+				Type:                "group",
+				Name:                group.Name,
+				Avatar:              AssetURL(group.Avatar),
+				LastMessage:         lastMsg.Content,
+				LastMessageAt:       lastMsg.CreatedAt,
+				LastMessageType:     lastMsg.Type,
+				LastMessageSenderID: lastMessageSender(&lastMsg),
+				UnreadCount:         s.getUnreadCount(userID, ug.GroupID, true),
+				MentionCount:        s.getMentionCount(userID, ug.GroupID),
+				LastReadID:          s.getLastReadID(userID, ug.GroupID, true),
+				Folder:              folder,
 			}
 		}
 	}
 
 	// 处理私聊
 	for _, msg := range privateMessages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		s.decryptContent(&msg)
 		otherUserID := msg.SenderID
 		if msg.SenderID == userID {
 			otherUserID = msg.ReceiverID
@@ -320,27 +909,33 @@ func (s *MessageService) GetRecentChats(userID uint) ([]models.RecentChat, error
 			continue
 		}
 
-		chatKey := fmt.Sprintf("private-%d", otherUserID)
+		chatKey := models.ConversationID(userID, otherUserID)
 		if existingChat, ok := chatMap[chatKey]; !ok || msg.CreatedAt.After(existingChat.LastMessageAt) {
 			user, err := s.userService.GetUserByID(otherUserID)
 			if err != nil {
 				continue
 			}
 			chatMap[chatKey] = models.RecentChat{
-				TargetID:      otherUserID,
-				Type:          "private",
-				Name:          user.Username,
-				Avatar:        user.Avatar,
-				LastMessage:   msg.Content,
-				LastMessageAt: msg.CreatedAt,
-				UnreadCount:   s.getUnreadCount(userID, otherUserID, false),
-				Online:        s.userService.IsUserOnline(otherUserID),
+				TargetID:            otherUserID,
+				Type:                "private",
+				Name:                user.Username,
+				Avatar:              AssetURL(user.Avatar),
+				LastMessage:         msg.Content,
+				LastMessageAt:       msg.CreatedAt,
+				LastMessageType:     msg.Type,
+				LastMessageSenderID: lastMessageSender(&msg),
+				UnreadCount:         s.getUnreadCount(userID, otherUserID, false),
+				LastReadID:          s.getLastReadID(userID, otherUserID, false),
+				Online:              s.userService.IsUserOnline(otherUserID),
 			}
 		}
 	}
 
 	var chats []models.RecentChat
 	for _, chat := range chatMap {
+		if chat.Type == "private" && !chat.LastMessageAt.After(s.clearedBefore(ctx, userID, chat.TargetID, false)) {
+			continue
+		}
 		chats = append(chats, chat)
 	}
 
@@ -349,23 +944,46 @@ func (s *MessageService) GetRecentChats(userID uint) ([]models.RecentChat, error
 		return chats[i].LastMessageAt.After(chats[j].LastMessageAt)
 	})
 
-	// 缓存结果
-	jsonData, _ := json.Marshal(chats)
-	s.rdb.Set(ctx, key, jsonData, 5*time.Minute)
+	if err := s.attachLastMessageSenders(chats); err != nil {
+		return nil, err
+	}
 
+	// 缓存结果，请求已取消时结果可能不完整，不写入缓存
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	jsonData, _ := json.Marshal(chats)
+	s.rdb.Set(ctx, recentChatsKey(userID), jsonData, recentChatsTTL)
 	return chats, nil
 }
 
-// MarkMessagesAsRead 标记消息为已读
-func (s *MessageService) MarkMessagesAsRead(userID, targetID uint, isGroup bool) error {
-	ctx := context.Background()
-	var unreadKey string
-	if isGroup {
-		unreadKey = fmt.Sprintf("unread:%d:group:%d", userID, targetID)
-	} else {
-		unreadKey = fmt.Sprintf("unread:%d:private:%d", userID, targetID)
+// lastMessageSender 返回会话列表中显示的最后一条消息的发送者，系统消息不显示发送者
+func lastMessageSender(msg *models.Message) uint {
+	if msg.Type == models.SystemMessage {
+		return 0
 	}
-	return s.rdb.Del(ctx, unreadKey).Err()
+	return msg.SenderID
+}
+
+// attachLastMessageSenders 批量查询最后一条消息的发送者并填充用户名
+func (s *MessageService) attachLastMessageSenders(chats []models.RecentChat) error {
+	senderIDs := make([]uint, 0, len(chats))
+	for _, chat := range chats {
+		if chat.LastMessageSenderID > 0 {
+			senderIDs = append(senderIDs, chat.LastMessageSenderID)
+		}
+	}
+
+	senders, err := s.userService.userResponses(senderIDs)
+	if err != nil {
+		return err
+	}
+	for i := range chats {
+		if sender, ok := senders[chats[i].LastMessageSenderID]; ok {
+			chats[i].LastMessageSenderName = sender.Username
+		}
+	}
+	return nil
 }
 
 // updateRecentChats 更新用户的最近聊天列表
@@ -378,45 +996,99 @@ func (s *MessageService) updateRecentChats(msg *models.Message) {
 			return
 		}
 		for _, memberID := range memberIDs {
-			s.rdb.Del(ctx, fmt.Sprintf("recent:chats:%d", memberID))
-			if memberID != msg.SenderID {
-				s.incrementUnreadCount(memberID, msg.GroupID, true)
-			}
+			s.rdb.Del(ctx, recentChatsKey(memberID))
 		}
 	} else {
 		// 私聊：更新收发双方的最近聊天列表
-		s.rdb.Del(ctx, fmt.Sprintf("recent:chats:%d", msg.SenderID))
-		s.rdb.Del(ctx, fmt.Sprintf("recent:chats:%d", msg.ReceiverID))
-		s.incrementUnreadCount(msg.ReceiverID, msg.SenderID, false)
+		s.rdb.Del(ctx, recentChatsKey(msg.SenderID))
+		s.rdb.Del(ctx, recentChatsKey(msg.ReceiverID))
 	}
+	s.markRecentChatsActive(msg.SenderID)
 }
 
-func (s *MessageService) incrementUnreadCount(userID, targetID uint, isGroup bool) {
-	ctx := context.Background()
-	var unreadKey string
+// conversationKey 获取消息所属会话的ID，groupID为0时表示私聊
+func conversationKey(senderID, receiverID, groupID uint) string {
+	if groupID > 0 {
+		return models.GroupConversationID(groupID)
+	}
+	return models.ConversationID(senderID, receiverID)
+}
+
+// targetConversationKey 从用户视角获取与目标（用户或群组）的会话ID
+func targetConversationKey(userID, targetID uint, isGroup bool) string {
 	if isGroup {
-		unreadKey = fmt.Sprintf("unread:%d:group:%d", userID, targetID)
-	} else {
-		unreadKey = fmt.Sprintf("unread:%d:private:%d", userID, targetID)
+		return models.GroupConversationID(targetID)
 	}
-	s.rdb.Incr(ctx, unreadKey)
+	return models.ConversationID(userID, targetID)
 }
 
-func (s *MessageService) getUnreadCount(userID, targetID uint, isGroup bool) int {
+// typingKey 获取会话输入状态的Redis键
+func typingKey(userID, targetID uint, isGroup bool) string {
+	return RedisKey("typing:%s", targetConversationKey(userID, targetID, isGroup))
+}
+
+// SetTyping 记录用户正在输入
+func (s *MessageService) SetTyping(senderID, targetID uint, isGroup bool) {
 	ctx := context.Background()
-	var unreadKey string
-	if isGroup {
-		unreadKey = fmt.Sprintf("unread:%d:group:%d", userID, targetID)
-	} else {
-		unreadKey = fmt.Sprintf("unread:%d:private:%d", userID, targetID)
+	key := typingKey(senderID, targetID, isGroup)
+	s.rdb.ZAdd(ctx, key, &redis.Z{Score: float64(time.Now().UnixMilli()), Member: senderID})
+	s.rdb.Expire(ctx, key, typingTTL)
+}
+
+// GetTypingUsers 获取会话中正在输入的用户（不包括自己）
+func (s *MessageService) GetTypingUsers(userID, targetID uint, isGroup bool) ([]models.TypingUser, error) {
+	ctx := context.Background()
+	key := typingKey(userID, targetID, isGroup)
+
+	// 清理已过期的输入状态
+	cutoff := time.Now().Add(-typingTTL).UnixMilli()
+	s.rdb.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(cutoff, 10))
+
+	ids, err := s.rdb.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	typingUsers := make([]models.TypingUser, 0, len(ids))
+	for _, idStr := range ids {
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil || uint(id) == userID {
+			continue
+		}
+
+		user, err := s.userService.GetUserByID(uint(id))
+		if err != nil {
+			continue
+		}
+
+		typingUsers = append(typingUsers, models.TypingUser{
+			UserID:   user.ID,
+			Username: user.Username,
+		})
 	}
-	count, _ := s.rdb.Get(ctx, unreadKey).Int()
-	return count
+
+	return typingUsers, nil
 }
 
-func (s *MessageService) convertMessagesToResponse(messages []models.Message) ([]models.MessageResponse, error) {
+// convertMessagesToResponse 将按时间倒序查询的消息转换为响应，并反转为按时间升序
+func (s *MessageService) convertMessagesToResponse(messages []models.Message, viewerID uint) ([]models.MessageResponse, error) {
+	responses, err := s.messagesToResponses(messages, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 反转消息顺序，使之按时间升序
+	for i, j := 0, len(responses)-1; i < j; i, j = i+1, j-1 {
+		responses[i], responses[j] = responses[j], responses[i]
+	}
+	return responses, nil
+}
+
+// messagesToResponses 按输入顺序将消息转换为响应，附加发送者、表情回应和已读人数
+func (s *MessageService) messagesToResponses(messages []models.Message, viewerID uint) ([]models.MessageResponse, error) {
 	responses := make([]models.MessageResponse, len(messages))
 	for i, msg := range messages {
+		s.decryptContent(&msg)
 		sender, err := s.userService.GetUserResponse(msg.SenderID)
 		if err != nil {
 			// 如果获取发送者失败，可以跳过或使用默认值
@@ -431,11 +1103,16 @@ func (s *MessageService) convertMessagesToResponse(messages []models.Message) ([
 			ReceiverID: msg.ReceiverID,
 			GroupID:    msg.GroupID,
 			CreatedAt:  msg.CreatedAt,
+			EditedAt:   msg.EditedAt,
+		}
+		if msg.SenderID == viewerID {
+			responses[i].SentFrom = msg.SentFrom
 		}
 	}
-	// 反转消息顺序，使之按时间升序
-	for i, j := 0, len(responses)-1; i < j; i, j = i+1, j-1 {
-		responses[i], responses[j] = responses[j], responses[i]
+	// 批量附加表情回应汇总
+	if err := s.attachReactions(responses, viewerID); err != nil {
+		return nil, err
 	}
+	s.attachSeenCounts(responses)
 	return responses, nil
 }
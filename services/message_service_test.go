@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// withMessageMaxRunes 在测试期间设置消息最大字符数
+func withMessageMaxRunes(t *testing.T, limit int) {
+	t.Helper()
+	old := config.AppConfig.MessageMaxRunes
+	config.AppConfig.MessageMaxRunes = limit
+	t.Cleanup(func() { config.AppConfig.MessageMaxRunes = old })
+}
+
+func TestValidateContentCountsRunes(t *testing.T) {
+	withMessageMaxRunes(t, 5)
+
+	tests := []struct {
+		name    string
+		content string
+		want    error
+	}{
+		{"ASCII在上限内", "hello", nil},
+		{"ASCII超出上限", "hello!", ErrContentTooLong},
+		{"emoji按字符计数", strings.Repeat("😀", 5), nil},
+		{"emoji超出上限", strings.Repeat("😀", 6), ErrContentTooLong},
+		{"中文在上限内", "你好世界！", nil},
+		{"中文超出上限", "你好，世界！", ErrContentTooLong},
+		{"非法UTF-8", "hi\xff", ErrInvalidContent},
+		{"截断的多字节字符", "😀"[:2], ErrInvalidContent},
+	}
+	for _, tt := range tests {
+		err := ValidateContent(tt.content)
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: ValidateContent(%q) = %v，期望 %v", tt.name, tt.content, err, tt.want)
+		}
+	}
+}
+
+func TestWSContentLimit(t *testing.T) {
+	withMessageMaxRunes(t, 5)
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	client := NewClient(alice.ID, alice.Username, newFakeConn())
+
+	req := models.MessageRequest{Content: strings.Repeat("😀", 6), Type: models.PrivateMessage, ReceiverID: bob.ID}
+	client.handleChatMessage(context.Background(), req, m, env.messages)
+
+	select {
+	case frame := <-client.Send:
+		var event struct {
+			Type    string  `json:"type"`
+			Content WSError `json:"content"`
+		}
+		if err := json.Unmarshal(frame, &event); err != nil {
+			t.Fatalf("解析事件失败: %v", err)
+		}
+		if event.Type != "error" || event.Content.Code != http.StatusBadRequest || !strings.Contains(event.Content.Message, ErrContentTooLong.Error()) {
+			t.Fatalf("错误事件 = %+v，期望 400 内容过长", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("未收到错误事件")
+	}
+}
+
+func TestSystemMessagesNotInteractive(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	group := env.createGroup(t, "g", alice, bob)
+
+	system := env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: group.ID, Type: models.SystemMessage, Content: "@bob 加入了群组"})
+	s.incrementMentionCounts(system)
+
+	// 不计未读和提及，但仍出现在历史记录中
+	if got := s.getUnreadCount(bob.ID, group.ID, true); got != 0 {
+		t.Fatalf("系统消息后未读数 = %d，期望 0", got)
+	}
+	if n, _ := env.rdb.Get(ctx, mentionUnreadKey(bob.ID, group.ID)).Int(); n != 0 {
+		t.Fatalf("系统消息后提及数 = %d，期望 0", n)
+	}
+	messages, err := s.GetGroupMessages(ctx, bob.ID, group.ID, 20, 0)
+	if err != nil || len(messages) != 1 || messages[0].ID != system.ID {
+		t.Fatalf("历史记录 = %+v, %v，期望包含系统消息", messages, err)
+	}
+
+	// 不能回应，客户端也不能发送系统消息
+	if _, err := s.AddReaction(system.ID, bob.ID, "👍"); !errors.Is(err, ErrSystemMessageAction) {
+		t.Fatalf("回应系统消息 = %v，期望 ErrSystemMessageAction", err)
+	}
+	forged := &models.Message{SenderID: bob.ID, GroupID: group.ID, Type: models.SystemMessage, Content: "伪造"}
+	if err := s.ProcessMessage(forged); !errors.Is(err, ErrSystemMessageSend) {
+		t.Fatalf("发送系统消息 = %v，期望 ErrSystemMessageSend", err)
+	}
+}
+
+func TestRecentChatsIncludeLastMessageSender(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	chat := env.createGroup(t, "chat", alice, bob)
+	quiet := env.createGroup(t, "quiet", alice, bob)
+	now := time.Now()
+	env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: chat.ID, Content: "first", CreatedAt: now.Add(-time.Minute)})
+	env.createMessage(t, models.Message{SenderID: bob.ID, GroupID: chat.ID, Content: "hi", CreatedAt: now})
+	env.createMessage(t, models.Message{SenderID: alice.ID, GroupID: quiet.ID, Type: models.SystemMessage, Content: "群名已修改"})
+	env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "dm"})
+	env.seedGroupActivity(t, chat.ID, quiet.ID)
+
+	chats, err := env.messages.GetRecentChats(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatalf("获取最近聊天失败: %v", err)
+	}
+	got := make(map[string]models.RecentChat)
+	for _, c := range chats {
+		got[c.Name] = c
+	}
+
+	tests := []struct {
+		chat       string
+		senderID   uint
+		senderName string
+		msgType    models.MessageType
+	}{
+		{"chat", bob.ID, "bob", models.GroupMessage},
+		{"quiet", 0, "", models.SystemMessage},
+		{"bob", alice.ID, "alice", models.PrivateMessage},
+	}
+	for _, tt := range tests {
+		c, ok := got[tt.chat]
+		if !ok {
+			t.Fatalf("最近聊天中缺少 %s: %+v", tt.chat, chats)
+		}
+		if c.LastMessageSenderID != tt.senderID || c.LastMessageSenderName != tt.senderName || c.LastMessageType != tt.msgType {
+			t.Errorf("%s 的最后一条消息 = (%d, %q, %s)，期望 (%d, %q, %s)", tt.chat,
+				c.LastMessageSenderID, c.LastMessageSenderName, c.LastMessageType, tt.senderID, tt.senderName, tt.msgType)
+		}
+	}
+}
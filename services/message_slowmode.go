@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// slowModeKey 慢速模式下成员在群组中最近一次发言的键，过期即表示可以再次发言
+func slowModeKey(groupID, userID uint) string {
+	return RedisKey("slowmode:%d:%d", groupID, userID)
+}
+
+// checkSlowMode 检查成员距上次发言是否已超过慢速模式间隔，检查通过时同时记录本次发言
+// 使用SETNX保证并发发送时同一间隔内只有一条消息通过，Redis出错时放行
+func (s *MessageService) checkSlowMode(groupID, userID uint, seconds int) error {
+	ctx := context.Background()
+	key := slowModeKey(groupID, userID)
+
+	ok, err := s.rdb.SetNX(ctx, key, time.Now().Unix(), time.Duration(seconds)*time.Second).Result()
+	if err != nil || ok {
+		return nil
+	}
+
+	wait := seconds
+	if ttl, err := s.rdb.TTL(ctx, key).Result(); err == nil && ttl > 0 {
+		wait = int((ttl + time.Second - 1) / time.Second)
+	}
+	return fmt.Errorf("%w，请%d秒后再发送", ErrSlowMode, wait)
+}
+
+// releaseSlowMode 撤销 checkSlowMode 记录的发言，用于检查通过后消息未能保存的情况，
+// 避免成员因一次失败的发送而在整个间隔内无法发言
+func (s *MessageService) releaseSlowMode(groupID, userID uint) {
+	s.rdb.Del(context.Background(), slowModeKey(groupID, userID))
+}
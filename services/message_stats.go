@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"chatroom/models"
+)
+
+const (
+	// statsWindowDays 统计窗口（天），计数键保留到窗口结束后一天
+	statsWindowDays = 7
+	statsKeyTTL     = (statsWindowDays + 1) * 24 * time.Hour
+	statsDayLayout  = "20060102"
+
+	// topSendersCacheTTL 多日排行合并结果的缓存时间
+	topSendersCacheTTL = time.Minute
+)
+
+// sentCountKey 用户某日发送消息数的键
+func sentCountKey(userID uint, day string) string {
+	return RedisKey("stats:sent:%d:%s", userID, day)
+}
+
+// activeConversationsKey 用户某日发送过消息的会话集合的键
+func activeConversationsKey(userID uint, day string) string {
+	return RedisKey("stats:convs:%d:%s", userID, day)
+}
+
+// topSendersKey 某日发送消息数排行的键
+func topSendersKey(day string) string {
+	return RedisKey("stats:top:%s", day)
+}
+
+// statsDays 返回从今天起往前的n个日期
+func statsDays(n int) []string {
+	now := time.Now()
+	days := make([]string, n)
+	for i := range days {
+		days[i] = now.AddDate(0, 0, -i).Format(statsDayLayout)
+	}
+	return days
+}
+
+// recordSent 累加发送者当日的消息计数，统计失败不影响消息发送
+func (s *MessageService) recordSent(msg *models.Message) {
+	if msg.Type == models.SystemMessage {
+		return
+	}
+
+	ctx := context.Background()
+	day := time.Now().Format(statsDayLayout)
+	countKey := sentCountKey(msg.SenderID, day)
+	convsKey := activeConversationsKey(msg.SenderID, day)
+	topKey := topSendersKey(day)
+
+	pipe := s.rdb.Pipeline()
+	pipe.Incr(ctx, countKey)
+	pipe.Expire(ctx, countKey, statsKeyTTL)
+	pipe.SAdd(ctx, convsKey, targetConversationKey(msg.SenderID, msg.ReceiverID, msg.GroupID > 0))
+	pipe.Expire(ctx, convsKey, statsKeyTTL)
+	pipe.ZIncrBy(ctx, topKey, 1, strconv.FormatUint(uint64(msg.SenderID), 10))
+	pipe.Expire(ctx, topKey, statsKeyTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("更新发送统计失败: %v", err)
+	}
+}
+
+// GetUserStats 获取用户今天和最近7天的发送统计
+func (s *MessageService) GetUserStats(userID uint) (*models.UserStats, error) {
+	ctx := context.Background()
+	days := statsDays(statsWindowDays)
+
+	countKeys := make([]string, len(days))
+	convsKeys := make([]string, len(days))
+	for i, day := range days {
+		countKeys[i] = sentCountKey(userID, day)
+		convsKeys[i] = activeConversationsKey(userID, day)
+	}
+
+	counts, err := s.rdb.MGet(ctx, countKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	convs, err := s.rdb.SUnion(ctx, convsKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.UserStats{ActiveConversations: int64(len(convs))}
+	for i, v := range counts {
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseInt(str, 10, 64)
+		if i == 0 {
+			stats.SentToday = n
+		}
+		stats.SentThisWeek += n
+	}
+	return stats, nil
+}
+
+// GetTopSenders 获取最近days天发送消息最多的用户
+func (s *MessageService) GetTopSenders(days, limit int) ([]models.TopSender, error) {
+	ctx := context.Background()
+	dayKeys := statsDays(days)
+
+	key := topSendersKey(dayKeys[0])
+	if days > 1 {
+		// 合并多日排行，结果短暂缓存避免每次请求都重新计算
+		key = RedisKey("stats:top:union:%d:%s", days, dayKeys[0])
+		exists, err := s.rdb.Exists(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			keys := make([]string, len(dayKeys))
+			for i, day := range dayKeys {
+				keys[i] = topSendersKey(day)
+			}
+			pipe := s.rdb.Pipeline()
+			pipe.ZUnionStore(ctx, key, &redis.ZStore{Keys: keys})
+			pipe.Expire(ctx, key, topSendersCacheTTL)
+			if _, err := pipe.Exec(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	entries, err := s.rdb.ZRevRangeWithScores(ctx, key, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	senders := make([]models.TopSender, 0, len(entries))
+	for _, entry := range entries {
+		id, err := strconv.ParseUint(entry.Member.(string), 10, 32)
+		if err != nil {
+			continue
+		}
+		user, err := s.userService.GetUserResponse(uint(id))
+		if err != nil {
+			continue
+		}
+		senders = append(senders, models.TopSender{User: *user, Count: int64(entry.Score)})
+	}
+	return senders, nil
+}
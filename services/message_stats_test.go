@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"chatroom/models"
+)
+
+func TestSentCountersAndStats(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := context.Background()
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", alice, bob)
+
+	send := func(msg *models.Message) {
+		t.Helper()
+		if err := s.ProcessMessage(msg); err != nil {
+			t.Fatalf("发送消息失败: %v", err)
+		}
+	}
+	send(&models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Type: models.PrivateMessage, Content: "1"})
+	send(&models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Type: models.PrivateMessage, Content: "2"})
+	send(&models.Message{SenderID: alice.ID, GroupID: group.ID, Type: models.GroupMessage, Content: "3"})
+	send(&models.Message{SenderID: bob.ID, ReceiverID: alice.ID, Type: models.PrivateMessage, Content: "4"})
+	// 系统消息不计入统计
+	s.recordSent(&models.Message{SenderID: alice.ID, GroupID: group.ID, Type: models.SystemMessage})
+
+	today := statsDays(1)[0]
+	if ttl := env.mr.TTL(sentCountKey(alice.ID, today)); ttl <= 0 || ttl > statsKeyTTL {
+		t.Fatalf("计数键过期时间 = %v，期望不超过 %v", ttl, statsKeyTTL)
+	}
+
+	// 前一天的计数只计入本周
+	yesterday := statsDays(2)[1]
+	env.rdb.Set(ctx, sentCountKey(alice.ID, yesterday), 4, 0)
+	env.rdb.SAdd(ctx, activeConversationsKey(alice.ID, yesterday), targetConversationKey(alice.ID, carol.ID, false))
+	env.rdb.ZIncrBy(ctx, topSendersKey(yesterday), 10, fmt.Sprint(carol.ID))
+
+	stats, err := s.GetUserStats(alice.ID)
+	if err != nil {
+		t.Fatalf("获取统计失败: %v", err)
+	}
+	want := models.UserStats{SentToday: 3, SentThisWeek: 7, ActiveConversations: 3}
+	if *stats != want {
+		t.Fatalf("alice 的统计 = %+v，期望 %+v", *stats, want)
+	}
+	if stats, _ := s.GetUserStats(carol.ID); stats.SentToday != 0 || stats.SentThisWeek != 0 {
+		t.Fatalf("carol 的统计 = %+v，期望为零", stats)
+	}
+
+	senders, err := s.GetTopSenders(1, 10)
+	if err != nil {
+		t.Fatalf("获取排行失败: %v", err)
+	}
+	if len(senders) != 2 || senders[0].User.ID != alice.ID || senders[0].Count != 3 || senders[1].User.ID != bob.ID {
+		t.Fatalf("今日排行 = %+v，期望 alice(3)、bob(1)", senders)
+	}
+
+	// 多日排行合并各日计数
+	senders, err = s.GetTopSenders(2, 1)
+	if err != nil {
+		t.Fatalf("获取排行失败: %v", err)
+	}
+	if len(senders) != 1 || senders[0].User.ID != carol.ID || senders[0].Count != 10 {
+		t.Fatalf("两日排行 = %+v，期望 carol(10)", senders)
+	}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestTypingUsersExpire(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	env.messages.SetTyping(alice.ID, bob.ID, false)
+
+	// 私聊双方看到的是同一个会话的输入状态，自己不出现在列表中
+	typing, err := env.messages.GetTypingUsers(bob.ID, alice.ID, false)
+	if err != nil {
+		t.Fatalf("获取输入状态失败: %v", err)
+	}
+	if len(typing) != 1 || typing[0].UserID != alice.ID || typing[0].Username != "alice" {
+		t.Fatalf("输入状态 = %+v，期望 alice", typing)
+	}
+	if own, _ := env.messages.GetTypingUsers(alice.ID, bob.ID, false); len(own) != 0 {
+		t.Fatalf("自己不应出现在输入列表中: %+v", own)
+	}
+
+	// 超过TTL后不再显示
+	key := typingKey(alice.ID, bob.ID, false)
+	env.rdb.ZAdd(t.Context(), key, &redis.Z{Score: float64(time.Now().Add(-typingTTL - time.Second).UnixMilli()), Member: alice.ID})
+	typing, err = env.messages.GetTypingUsers(bob.ID, alice.ID, false)
+	if err != nil {
+		t.Fatalf("获取输入状态失败: %v", err)
+	}
+	if len(typing) != 0 {
+		t.Fatalf("超过TTL后仍显示输入状态: %+v", typing)
+	}
+}
+
+func TestGroupTypingUsers(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", alice, bob, carol)
+
+	env.messages.SetTyping(alice.ID, group.ID, true)
+	env.messages.SetTyping(bob.ID, group.ID, true)
+
+	typing, err := env.messages.GetTypingUsers(carol.ID, group.ID, true)
+	if err != nil {
+		t.Fatalf("获取输入状态失败: %v", err)
+	}
+	if len(typing) != 2 {
+		t.Fatalf("输入状态 = %+v，期望 alice 和 bob", typing)
+	}
+	// 群聊输入状态不会出现在私聊中
+	if private, _ := env.messages.GetTypingUsers(carol.ID, alice.ID, false); len(private) != 0 {
+		t.Fatalf("私聊中出现了群聊输入状态: %+v", private)
+	}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// watchwordCacheTTL 群组关键词匹配器的本地缓存时间
+const watchwordCacheTTL = 30 * time.Second
+
+// webhookTimeout 关键词提醒webhook的请求超时
+const webhookTimeout = 5 * time.Second
+
+// watchwordMatcher 预编译的群组关键词匹配器
+type watchwordMatcher struct {
+	re       *regexp.Regexp // 为nil表示群组未设置关键词
+	loadedAt time.Time
+}
+
+// getWatchwordMatcher 获取群组的关键词匹配器，缓存过期后从数据库重新编译
+func (s *MessageService) getWatchwordMatcher(groupID uint) *watchwordMatcher {
+	if cached, ok := s.watchwords.Load(groupID); ok {
+		matcher := cached.(*watchwordMatcher)
+		if time.Since(matcher.loadedAt) < watchwordCacheTTL {
+			return matcher
+		}
+	}
+
+	var words []string
+	if err := s.db.Model(&models.GroupWatchword{}).
+		Where("group_id = ?", groupID).
+		Pluck("word", &words).Error; err != nil {
+		log.Printf("加载群组%d关键词失败: %v", groupID, err)
+		return &watchwordMatcher{}
+	}
+
+	matcher := &watchwordMatcher{loadedAt: time.Now()}
+	if len(words) > 0 {
+		patterns := make([]string, len(words))
+		for i, word := range words {
+			patterns[i] = regexp.QuoteMeta(word)
+		}
+		matcher.re = regexp.MustCompile("(?i)" + strings.Join(patterns, "|"))
+	}
+	s.watchwords.Store(groupID, matcher)
+	return matcher
+}
+
+// checkWatchwords 检查群消息是否命中关键词，命中时记录并提醒群管理员
+// 在消息发出后异步执行，不影响消息投递
+func (s *MessageService) checkWatchwords(msg *models.Message, content string) {
+	matcher := s.getWatchwordMatcher(msg.GroupID)
+	if matcher.re == nil {
+		return
+	}
+
+	matches := matcher.re.FindAllString(content, -1)
+	if len(matches) == 0 {
+		return
+	}
+
+	seen := make(map[string]bool, len(matches))
+	words := []string{}
+	for _, match := range matches {
+		word := strings.ToLower(match)
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+
+	alert := models.KeywordAlert{
+		GroupID:   msg.GroupID,
+		MessageID: msg.ID,
+		SenderID:  msg.SenderID,
+		Words:     strings.Join(words, ","),
+		CreatedAt: time.Now(),
+	}
+	if len(alert.Words) > 255 {
+		alert.Words = alert.Words[:255]
+	}
+	if err := s.db.Create(&alert).Error; err != nil {
+		log.Printf("保存关键词提醒失败: %v", err)
+		return
+	}
+
+	event := models.KeywordAlertEvent{
+		AlertID:   alert.ID,
+		GroupID:   alert.GroupID,
+		MessageID: alert.MessageID,
+		SenderID:  alert.SenderID,
+		Words:     words,
+		Content:   content,
+		CreatedAt: alert.CreatedAt,
+	}
+	eventJSON, _ := json.Marshal(event)
+
+	// 提醒群管理员（包括群主），发送者本人除外
+	var adminIDs []uint
+	if err := s.db.Model(&models.GroupMember{}).
+		Where("group_id = ? AND is_admin = ? AND user_id <> ?", msg.GroupID, true, msg.SenderID).
+		Pluck("user_id", &adminIDs).Error; err != nil {
+		log.Printf("获取群组管理员失败: %v", err)
+	}
+	for _, adminID := range adminIDs {
+		s.PublishUserEvent(adminID, "keyword_alert", eventJSON)
+	}
+
+	if config.AppConfig.KeywordAlertWebhook != "" {
+		go postKeywordAlertWebhook(config.AppConfig.KeywordAlertWebhook, eventJSON)
+	}
+}
+
+// PublishUserEvent 将事件通知给单个用户
+func (s *MessageService) PublishUserEvent(userID uint, eventType string, payload []byte) {
+	if s.kafka.Available() {
+		err := s.kafka.PublishChatMessage(eventType, payload, 0, userID, 0)
+		if err == nil {
+			return
+		}
+		log.Printf("发布%s事件到Kafka失败，回退到直接投递: %v", eventType, err)
+	}
+
+	if s.directDeliver == nil {
+		return
+	}
+	s.directDeliver(userID, newWSRawEvent(eventType, payload))
+}
+
+// postKeywordAlertWebhook 将关键词提醒发送到webhook，失败只记录日志
+func postKeywordAlertWebhook(url string, payload []byte) {
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("发送关键词提醒webhook失败: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("关键词提醒webhook返回状态码 %d", resp.StatusCode)
+	}
+}
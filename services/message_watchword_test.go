@@ -0,0 +1,104 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+func TestWatchwordTriggersAdminAlert(t *testing.T) {
+	env := newTestEnv(t)
+	delivered := recordDeliveries(env.messages)
+	owner := env.createUser(t, "owner")
+	admin := env.createUser(t, "admin")
+	member := env.createUser(t, "member")
+	group := env.createGroup(t, "g", owner, admin, member)
+	if err := env.groups.SetGroupAdmin(group.ID, owner.ID, admin.ID, true); err != nil {
+		t.Fatalf("设置管理员失败: %v", err)
+	}
+
+	webhook := make(chan models.KeywordAlertEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event models.KeywordAlertEvent
+		json.Unmarshal(body, &event)
+		webhook <- event
+	}))
+	t.Cleanup(server.Close)
+	old := config.AppConfig.KeywordAlertWebhook
+	config.AppConfig.KeywordAlertWebhook = server.URL
+	t.Cleanup(func() { config.AppConfig.KeywordAlertWebhook = old })
+
+	// 只有管理员可以设置关键词，统一小写并去重
+	if _, err := env.groups.SetWatchwords(group.ID, member.ID, []string{"spam"}); !errors.Is(err, ErrNoWatchwordPermission) {
+		t.Fatalf("普通成员设置关键词 = %v，期望 ErrNoWatchwordPermission", err)
+	}
+	words, err := env.groups.SetWatchwords(group.ID, admin.ID, []string{"Spam", "spam", " scam ", ""})
+	if err != nil {
+		t.Fatalf("设置关键词失败: %v", err)
+	}
+	if len(words) != 2 || words[0] != "spam" || words[1] != "scam" {
+		t.Fatalf("关键词 = %v，期望 [spam scam]", words)
+	}
+
+	// 未命中的消息不产生提醒
+	clean := env.createMessage(t, models.Message{SenderID: member.ID, GroupID: group.ID, Content: "hello"})
+	env.messages.checkWatchwords(clean, clean.Content)
+	if len(delivered()) != 0 {
+		t.Fatalf("未命中关键词不应提醒: %+v", delivered())
+	}
+
+	content := "Buy SPAM now, not a scam, spam!"
+	msg := env.createMessage(t, models.Message{SenderID: member.ID, GroupID: group.ID, Content: content})
+	env.messages.checkWatchwords(msg, msg.Content)
+
+	// 群主和管理员收到提醒，普通成员不会收到
+	got := make(map[uint]models.KeywordAlertEvent)
+	for _, d := range delivered() {
+		if d.event.Type != "keyword_alert" {
+			continue
+		}
+		var event models.KeywordAlertEvent
+		if err := json.Unmarshal(d.event.Content, &event); err != nil {
+			t.Fatalf("解析提醒事件失败: %v", err)
+		}
+		got[d.userID] = event
+	}
+	_, ownerAlerted := got[owner.ID]
+	event, adminAlerted := got[admin.ID]
+	if len(got) != 2 || !ownerAlerted || !adminAlerted {
+		t.Fatalf("提醒投递 = %v，期望群主和管理员", got)
+	}
+	if event.MessageID != msg.ID || event.SenderID != member.ID || event.Content != content ||
+		len(event.Words) != 2 || event.Words[0] != "spam" || event.Words[1] != "scam" {
+		t.Fatalf("提醒事件 = %+v", event)
+	}
+
+	// 记录提醒历史，仅管理员可查看
+	alerts, err := env.groups.GetKeywordAlerts(group.ID, owner.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("获取提醒记录失败: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].MessageID != msg.ID || alerts[0].Words != "spam,scam" {
+		t.Fatalf("提醒记录 = %+v", alerts)
+	}
+	if _, err := env.groups.GetKeywordAlerts(group.ID, member.ID, 10, 0); !errors.Is(err, ErrNoWatchwordPermission) {
+		t.Fatalf("普通成员查看提醒 = %v，期望 ErrNoWatchwordPermission", err)
+	}
+
+	select {
+	case hook := <-webhook:
+		if hook.AlertID != alerts[0].ID || hook.MessageID != msg.ID {
+			t.Fatalf("webhook 事件 = %+v", hook)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("未收到webhook提醒")
+	}
+}
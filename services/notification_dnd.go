@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// 全局勿扰相关错误
+var (
+	ErrInvalidDNDSchedule = errors.New("勿扰时段格式错误，开始和结束时间必须同时设置且格式为HH:MM")
+	ErrInvalidDNDUntil    = errors.New("勿扰失效时间必须晚于当前时间")
+)
+
+// dndKey 用户全局勿扰设置缓存的键
+func dndKey(userID uint) string {
+	return RedisKey("notify:dnd:%d", userID)
+}
+
+// GetDND 获取用户的全局勿扰设置
+func (s *NotificationService) GetDND(userID uint) (*models.DoNotDisturb, error) {
+	// 先尝试从缓存获取
+	ctx := context.Background()
+	key := dndKey(userID)
+
+	var dnd models.DoNotDisturb
+	if cached, err := s.rdb.Get(ctx, key).Bytes(); err == nil {
+		if err := json.Unmarshal(cached, &dnd); err == nil {
+			return &dnd, nil
+		}
+	}
+
+	// 从数据库获取
+	var user models.User
+	if err := s.db.Select("id", "dnd_enabled", "dnd_start", "dnd_end", "dnd_until").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	dnd = user.DoNotDisturb
+
+	// 更新缓存
+	dndBytes, _ := json.Marshal(dnd)
+	s.rdb.Set(ctx, key, dndBytes, time.Duration(config.AppConfig.CacheExpiration)*time.Second)
+
+	return &dnd, nil
+}
+
+// UpdateDND 更新用户的全局勿扰设置
+func (s *NotificationService) UpdateDND(userID uint, req models.DoNotDisturbRequest) (*models.DoNotDisturb, error) {
+	if (req.Start == "") != (req.End == "") {
+		return nil, ErrInvalidDNDSchedule
+	}
+	if req.Start != "" {
+		if _, err := time.Parse(quietHoursLayout, req.Start); err != nil {
+			return nil, ErrInvalidDNDSchedule
+		}
+		if _, err := time.Parse(quietHoursLayout, req.End); err != nil {
+			return nil, ErrInvalidDNDSchedule
+		}
+	}
+	if req.Enabled && req.Until != nil && !req.Until.After(time.Now()) {
+		return nil, ErrInvalidDNDUntil
+	}
+
+	dnd := models.DoNotDisturb{
+		Enabled: req.Enabled,
+		Start:   req.Start,
+		End:     req.End,
+		Until:   req.Until,
+	}
+	res := s.db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"dnd_enabled": dnd.Enabled,
+		"dnd_start":   dnd.Start,
+		"dnd_end":     dnd.End,
+		"dnd_until":   dnd.Until,
+	})
+	if res.Error != nil {
+		return nil, errors.New("更新勿扰设置失败")
+	}
+	if res.RowsAffected == 0 {
+		// 内容未变化时也可能没有影响行，确认用户是否存在
+		if err := s.db.Select("id").First(&models.User{}, userID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+	}
+
+	// 删除缓存
+	ctx := context.Background()
+	s.rdb.Del(ctx, dndKey(userID))
+
+	return &dnd, nil
+}
+
+// DNDActive 判断全局勿扰在指定时间是否生效
+func DNDActive(dnd *models.DoNotDisturb, at time.Time) bool {
+	if dnd == nil || !dnd.Enabled {
+		return false
+	}
+	if dnd.Until != nil && !at.Before(*dnd.Until) {
+		return false
+	}
+	if dnd.Start == "" {
+		return true
+	}
+	return inQuietHours(dnd.Start, dnd.End, at)
+}
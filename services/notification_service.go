@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// NotifyDecision 通知分发决策
+type NotifyDecision int
+
+const (
+	NotifySend     NotifyDecision = iota // 立即推送
+	NotifySuppress                       // 不推送
+	NotifyDefer                          // 免打扰时段内，延后推送
+)
+
+// quietHoursLayout 免打扰时间格式
+const quietHoursLayout = "15:04"
+
+// NotificationService 通知偏好服务
+type NotificationService struct {
+	db  *gorm.DB
+	rdb *redis.Client
+}
+
+// NewNotificationService 创建通知偏好服务
+func NewNotificationService(db *gorm.DB, rdb *redis.Client) *NotificationService {
+	return &NotificationService{
+		db:  db,
+		rdb: rdb,
+	}
+}
+
+// GetPrefs 获取用户通知偏好，未设置时返回默认值
+func (s *NotificationService) GetPrefs(userID uint) (*models.NotificationPrefs, error) {
+	var prefs models.NotificationPrefs
+
+	// 先尝试从缓存获取
+	ctx := context.Background()
+	key := RedisKey("notify:prefs:%d", userID)
+
+	prefsJSON, err := s.rdb.Get(ctx, key).Result()
+	if err == nil {
+		// 缓存命中
+		if err := json.Unmarshal([]byte(prefsJSON), &prefs); err == nil {
+			return &prefs, nil
+		}
+	}
+
+	// 从数据库获取
+	if err := s.db.First(&prefs, "user_id = ?", userID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		prefs = models.NotificationPrefs{UserID: userID, Level: models.NotifyAll}
+	}
+
+	// 更新缓存
+	prefsBytes, _ := json.Marshal(prefs)
+	s.rdb.Set(ctx, key, prefsBytes, time.Duration(config.AppConfig.CacheExpiration)*time.Second)
+
+	return &prefs, nil
+}
+
+// UpdatePrefs 更新用户通知偏好
+func (s *NotificationService) UpdatePrefs(userID uint, req models.NotificationPrefsRequest) (*models.NotificationPrefs, error) {
+	// 免打扰时间要么都设置，要么都为空
+	if (req.QuietHoursStart == "") != (req.QuietHoursEnd == "") {
+		return nil, errors.New("免打扰开始和结束时间必须同时设置")
+	}
+	if req.QuietHoursStart != "" {
+		if _, err := time.Parse(quietHoursLayout, req.QuietHoursStart); err != nil {
+			return nil, errors.New("免打扰开始时间格式错误，应为HH:MM")
+		}
+		if _, err := time.Parse(quietHoursLayout, req.QuietHoursEnd); err != nil {
+			return nil, errors.New("免打扰结束时间格式错误，应为HH:MM")
+		}
+	}
+
+	prefs := models.NotificationPrefs{
+		UserID:          userID,
+		Level:           req.Level,
+		QuietHoursStart: req.QuietHoursStart,
+		QuietHoursEnd:   req.QuietHoursEnd,
+		UpdatedAt:       time.Now(),
+	}
+
+	if err := s.db.Save(&prefs).Error; err != nil {
+		return nil, errors.New("更新通知偏好失败")
+	}
+
+	// 删除缓存
+	ctx := context.Background()
+	s.rdb.Del(ctx, RedisKey("notify:prefs:%d", userID))
+
+	return &prefs, nil
+}
+
+// Decide 根据接收者的全局勿扰和通知偏好决定是否推送，全局勿扰生效时一律不推送
+func (s *NotificationService) Decide(userID uint, mentioned bool, at time.Time) NotifyDecision {
+	if dnd, err := s.GetDND(userID); err == nil && DNDActive(dnd, at) {
+		return NotifySuppress
+	}
+
+	prefs, err := s.GetPrefs(userID)
+	if err != nil {
+		// 获取偏好失败时按默认策略推送
+		return NotifySend
+	}
+	return decideNotification(prefs, mentioned, at)
+}
+
+// decideNotification 根据通知偏好计算推送决策
+func decideNotification(prefs *models.NotificationPrefs, mentioned bool, at time.Time) NotifyDecision {
+	switch prefs.Level {
+	case models.NotifyNone:
+		return NotifySuppress
+	case models.NotifyMentions:
+		if !mentioned {
+			return NotifySuppress
+		}
+	}
+
+	if inQuietHours(prefs.QuietHoursStart, prefs.QuietHoursEnd, at) {
+		return NotifyDefer
+	}
+	return NotifySend
+}
+
+// inQuietHours 判断时间是否处于免打扰时段（支持跨午夜，如 22:00-08:00）
+func inQuietHours(start, end string, at time.Time) bool {
+	if start == "" || end == "" {
+		return false
+	}
+	startT, err := time.Parse(quietHoursLayout, start)
+	if err != nil {
+		return false
+	}
+	endT, err := time.Parse(quietHoursLayout, end)
+	if err != nil {
+		return false
+	}
+
+	now := at.Hour()*60 + at.Minute()
+	from := startT.Hour()*60 + startT.Minute()
+	to := endT.Hour()*60 + endT.Minute()
+
+	if from <= to {
+		return now >= from && now < to
+	}
+	return now >= from || now < to
+}
+
+// QuietHoursEnd 返回用户当前免打扰时段结束的时间，未设置免打扰或读取偏好失败时返回 at
+func (s *NotificationService) QuietHoursEnd(userID uint, at time.Time) time.Time {
+	prefs, err := s.GetPrefs(userID)
+	if err != nil {
+		return at
+	}
+	end, ok := nextQuietHoursEnd(prefs.QuietHoursEnd, at)
+	if !ok {
+		return at
+	}
+	return end
+}
+
+// nextQuietHoursEnd 返回 at 之后最近一次到达免打扰结束时间（HH:MM）的时刻
+func nextQuietHoursEnd(end string, at time.Time) (time.Time, bool) {
+	if end == "" {
+		return time.Time{}, false
+	}
+	endT, err := time.Parse(quietHoursLayout, end)
+	if err != nil {
+		return time.Time{}, false
+	}
+	next := time.Date(at.Year(), at.Month(), at.Day(), endT.Hour(), endT.Minute(), 0, 0, at.Location())
+	if !next.After(at) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, true
+}
+
+// IsMentioned 判断消息内容中是否@了指定用户
+func IsMentioned(content, username string) bool {
+	if username == "" {
+		return false
+	}
+	return strings.Contains(content, "@"+username)
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestDecideNotification(t *testing.T) {
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	night := time.Date(2024, 1, 1, 23, 30, 0, 0, time.Local)
+	quiet := func(level models.NotificationLevel) *models.NotificationPrefs {
+		return &models.NotificationPrefs{Level: level, QuietHoursStart: "22:00", QuietHoursEnd: "08:00"}
+	}
+
+	tests := []struct {
+		name      string
+		prefs     *models.NotificationPrefs
+		mentioned bool
+		at        time.Time
+		want      NotifyDecision
+	}{
+		{"全部消息", &models.NotificationPrefs{Level: models.NotifyAll}, false, noon, NotifySend},
+		{"关闭通知", &models.NotificationPrefs{Level: models.NotifyNone}, true, noon, NotifySuppress},
+		{"仅提及-未提及", &models.NotificationPrefs{Level: models.NotifyMentions}, false, noon, NotifySuppress},
+		{"仅提及-已提及", &models.NotificationPrefs{Level: models.NotifyMentions}, true, noon, NotifySend},
+		{"免打扰时段外", quiet(models.NotifyAll), false, noon, NotifySend},
+		{"免打扰时段内延后", quiet(models.NotifyAll), false, night, NotifyDefer},
+		{"跨午夜免打扰", quiet(models.NotifyAll), false, time.Date(2024, 1, 2, 7, 59, 0, 0, time.Local), NotifyDefer},
+		{"免打扰时段内未提及仍不推送", quiet(models.NotifyMentions), false, night, NotifySuppress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decideNotification(tt.prefs, tt.mentioned, tt.at); got != tt.want {
+				t.Fatalf("decideNotification = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextQuietHoursEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		end  string
+		at   time.Time
+		want time.Time
+		ok   bool
+	}{
+		{"当天结束", "08:00", time.Date(2024, 1, 2, 7, 30, 0, 0, time.Local), time.Date(2024, 1, 2, 8, 0, 0, 0, time.Local), true},
+		{"跨午夜次日结束", "08:00", time.Date(2024, 1, 1, 23, 30, 0, 0, time.Local), time.Date(2024, 1, 2, 8, 0, 0, 0, time.Local), true},
+		{"恰好在结束时刻取下一天", "08:00", time.Date(2024, 1, 2, 8, 0, 0, 0, time.Local), time.Date(2024, 1, 3, 8, 0, 0, 0, time.Local), true},
+		{"未设置", "", time.Date(2024, 1, 2, 7, 30, 0, 0, time.Local), time.Time{}, false},
+		{"格式错误", "8点", time.Date(2024, 1, 2, 7, 30, 0, 0, time.Local), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := nextQuietHoursEnd(tt.end, tt.at)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Fatalf("nextQuietHoursEnd = %v, %v，期望 %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDecideDNDOverridesPrefs(t *testing.T) {
+	env := newTestEnv(t)
+	notifications := NewNotificationService(env.db, env.rdb)
+	alice := env.createUser(t, "alice")
+
+	if got := notifications.Decide(alice.ID, true, time.Now()); got != NotifySend {
+		t.Fatalf("默认偏好应推送，得到 %v", got)
+	}
+	if _, err := notifications.UpdateDND(alice.ID, models.DoNotDisturbRequest{Enabled: true}); err != nil {
+		t.Fatalf("设置勿扰失败: %v", err)
+	}
+	if got := notifications.Decide(alice.ID, true, time.Now()); got != NotifySuppress {
+		t.Fatalf("全局勿扰期间被提及也不应推送，得到 %v", got)
+	}
+}
+
+func TestDNDActive(t *testing.T) {
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	night := time.Date(2024, 1, 1, 23, 30, 0, 0, time.Local)
+	later := noon.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		dnd  *models.DoNotDisturb
+		at   time.Time
+		want bool
+	}{
+		{"未设置", nil, noon, false},
+		{"未开启", &models.DoNotDisturb{Start: "22:00", End: "08:00"}, night, false},
+		{"全天勿扰", &models.DoNotDisturb{Enabled: true}, noon, true},
+		{"时段内", &models.DoNotDisturb{Enabled: true, Start: "22:00", End: "08:00"}, night, true},
+		{"时段外", &models.DoNotDisturb{Enabled: true, Start: "22:00", End: "08:00"}, noon, false},
+		{"失效前", &models.DoNotDisturb{Enabled: true, Until: &later}, noon, true},
+		{"到期后恢复", &models.DoNotDisturb{Enabled: true, Until: &later}, later, false},
+	}
+	for _, tt := range tests {
+		if got := DNDActive(tt.dnd, tt.at); got != tt.want {
+			t.Errorf("%s: DNDActive = %v，期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDNDSuppressesUntilExpiry(t *testing.T) {
+	env := newTestEnv(t)
+	notifications := NewNotificationService(env.db, env.rdb)
+	alice := env.createUser(t, "alice")
+	now := time.Now()
+	past, until := now.Add(-time.Minute), now.Add(time.Hour)
+
+	for _, req := range []models.DoNotDisturbRequest{
+		{Enabled: true, Start: "22:00"},
+		{Enabled: true, Start: "25:00", End: "08:00"},
+	} {
+		if _, err := notifications.UpdateDND(alice.ID, req); !errors.Is(err, ErrInvalidDNDSchedule) {
+			t.Errorf("勿扰时段 %q-%q = %v，期望 ErrInvalidDNDSchedule", req.Start, req.End, err)
+		}
+	}
+	if _, err := notifications.UpdateDND(alice.ID, models.DoNotDisturbRequest{Enabled: true, Until: &past}); !errors.Is(err, ErrInvalidDNDUntil) {
+		t.Fatalf("失效时间已过 = %v，期望 ErrInvalidDNDUntil", err)
+	}
+	if _, err := notifications.UpdateDND(9999, models.DoNotDisturbRequest{Enabled: true}); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("用户不存在 = %v，期望 ErrUserNotFound", err)
+	}
+
+	// 勿扰期间不推送，到期后恢复推送
+	if _, err := notifications.UpdateDND(alice.ID, models.DoNotDisturbRequest{Enabled: true, Until: &until}); err != nil {
+		t.Fatalf("设置勿扰失败: %v", err)
+	}
+	if got := notifications.Decide(alice.ID, false, now); got != NotifySuppress {
+		t.Fatalf("勿扰期间 Decide = %v，期望 NotifySuppress", got)
+	}
+	if got := notifications.Decide(alice.ID, false, until.Add(time.Second)); got != NotifySend {
+		t.Fatalf("勿扰到期后 Decide = %v，期望 NotifySend", got)
+	}
+
+	// 关闭后立即生效，不使用旧缓存
+	if _, err := notifications.UpdateDND(alice.ID, models.DoNotDisturbRequest{}); err != nil {
+		t.Fatalf("关闭勿扰失败: %v", err)
+	}
+	if got := notifications.Decide(alice.ID, false, now); got != NotifySend {
+		t.Fatalf("关闭勿扰后 Decide = %v，期望 NotifySend", got)
+	}
+}
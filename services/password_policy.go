@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"chatroom/config"
+)
+
+// maxPasswordBytes bcrypt只使用密码的前72个字节，更长的密码会被截断
+const maxPasswordBytes = 72
+
+// breachCheckTimeout 查询泄露密码接口的超时时间
+const breachCheckTimeout = 3 * time.Second
+
+// 密码规则相关错误
+var (
+	ErrPasswordTooShort    = errors.New("密码太短")
+	ErrPasswordTooLong     = errors.New("密码不能超过72个字节")
+	ErrPasswordTooSimple   = errors.New("密码过于简单")
+	ErrPasswordHasUsername = errors.New("密码不能包含用户名")
+	ErrPasswordBreached    = errors.New("该密码已出现在公开泄露的密码库中，请更换")
+)
+
+// BreachChecker 查询密码是否出现在已泄露的密码库中
+type BreachChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// rangeBreachChecker 通过k-匿名范围查询接口检查密码，只发送SHA-1摘要的前5位
+type rangeBreachChecker struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewBreachChecker 按 PASSWORD_BREACH_API 创建泄露密码检查，未配置时返回nil
+func NewBreachChecker() BreachChecker {
+	if config.AppConfig.PasswordBreachAPI == "" {
+		return nil
+	}
+	return &rangeBreachChecker{
+		baseURL: strings.TrimSuffix(config.AppConfig.PasswordBreachAPI, "/") + "/",
+		client:  &http.Client{Timeout: breachCheckTimeout},
+	}
+}
+
+// IsBreached 查询与密码摘要前缀相同的所有后缀，在本地比对
+func (c *rangeBreachChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:5], digest[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// 填充响应，避免从响应长度推断查询的前缀
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("泄露密码接口返回状态码 %d", resp.StatusCode)
+	}
+
+	// 每行格式为 后缀:出现次数，填充的行出现次数为0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		hashSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && strings.EqualFold(hashSuffix, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// SetBreachChecker 设置泄露密码检查，为nil时不检查
+func (s *UserService) SetBreachChecker(checker BreachChecker) {
+	s.breachChecker = checker
+}
+
+// ValidatePassword 按 PASSWORD_MIN_LENGTH、PASSWORD_MIN_CLASSES 校验密码强度，并在配置了泄露密码接口时检查是否已泄露
+// 泄露密码接口不可用时只记录日志，不阻止注册或修改密码
+func (s *UserService) ValidatePassword(ctx context.Context, password, username string) error {
+	if n := utf8.RuneCountInString(password); n < config.AppConfig.PasswordMinLength {
+		return fmt.Errorf("%w，至少需要%d个字符", ErrPasswordTooShort, config.AppConfig.PasswordMinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return ErrPasswordTooLong
+	}
+	if classes := passwordClasses(password); classes < config.AppConfig.PasswordMinClasses {
+		return fmt.Errorf("%w，需要包含小写字母、大写字母、数字、符号中的至少%d类", ErrPasswordTooSimple, config.AppConfig.PasswordMinClasses)
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return ErrPasswordHasUsername
+	}
+
+	if s.breachChecker == nil {
+		return nil
+	}
+	breached, err := s.breachChecker.IsBreached(ctx, password)
+	if err != nil {
+		log.Printf("查询泄露密码失败，跳过检查: %v", err)
+		return nil
+	}
+	if breached {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+// passwordClasses 统计密码包含的字符类别数：小写字母、大写字母、数字、其他符号
+func passwordClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
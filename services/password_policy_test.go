@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chatroom/config"
+)
+
+// stubBreachChecker 返回固定结果的泄露密码检查
+type stubBreachChecker struct {
+	breached bool
+	err      error
+	calls    int
+}
+
+func (c *stubBreachChecker) IsBreached(context.Context, string) (bool, error) {
+	c.calls++
+	return c.breached, c.err
+}
+
+func TestValidatePasswordBreachChecker(t *testing.T) {
+	users := NewUserService(nil, nil)
+	tests := []struct {
+		name    string
+		checker *stubBreachChecker
+		want    error
+	}{
+		{"已泄露的密码被拒绝", &stubBreachChecker{breached: true}, ErrPasswordBreached},
+		{"未泄露的密码通过", &stubBreachChecker{}, nil},
+		{"检查接口出错时放行", &stubBreachChecker{err: errors.New("timeout")}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users.SetBreachChecker(tt.checker)
+			if err := users.ValidatePassword(context.Background(), "Correct-Horse-9", "alice"); !errors.Is(err, tt.want) {
+				t.Fatalf("ValidatePassword = %v，期望 %v", err, tt.want)
+			}
+			if tt.checker.calls != 1 {
+				t.Fatalf("泄露检查调用了 %d 次", tt.checker.calls)
+			}
+		})
+	}
+}
+
+func TestValidatePasswordRules(t *testing.T) {
+	users := NewUserService(nil, nil)
+	checker := &stubBreachChecker{breached: true}
+	users.SetBreachChecker(checker)
+
+	tests := []struct {
+		password string
+		want     error
+	}{
+		{"Ab1", ErrPasswordTooShort},
+		{strings.Repeat("Ab1", 30), ErrPasswordTooLong},
+		{"abcdefghij", ErrPasswordTooSimple},
+		{"Alice-2024x", ErrPasswordHasUsername},
+	}
+	for _, tt := range tests {
+		if err := users.ValidatePassword(context.Background(), tt.password, "alice"); !errors.Is(err, tt.want) {
+			t.Errorf("ValidatePassword(%q) = %v，期望 %v", tt.password, err, tt.want)
+		}
+	}
+	if checker.calls != 0 {
+		t.Fatalf("不满足规则的密码不应查询泄露接口，调用了 %d 次", checker.calls)
+	}
+}
+
+func TestRangeBreachChecker(t *testing.T) {
+	sum := sha1.Sum([]byte("hunter2"))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		fmt.Fprintf(w, "0000000000000000000000000000000000A:3\r\n%s:42\r\n", digest[5:])
+	}))
+	defer server.Close()
+
+	old := config.AppConfig.PasswordBreachAPI
+	config.AppConfig.PasswordBreachAPI = server.URL + "/range/"
+	t.Cleanup(func() { config.AppConfig.PasswordBreachAPI = old })
+
+	checker := NewBreachChecker()
+	breached, err := checker.IsBreached(context.Background(), "hunter2")
+	if err != nil || !breached {
+		t.Fatalf("IsBreached = %v, %v，期望已泄露", breached, err)
+	}
+	if gotPath != "/range/"+digest[:5] {
+		t.Fatalf("请求路径 %q，应只包含摘要前5位", gotPath)
+	}
+
+	breached, err = checker.IsBreached(context.Background(), "not-in-list")
+	if err != nil || breached {
+		t.Fatalf("IsBreached = %v, %v，期望未泄露", breached, err)
+	}
+}
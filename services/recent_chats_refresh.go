@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"chatroom/config"
+)
+
+// recentChatsTTL 最近聊天列表缓存的有效期
+const recentChatsTTL = 5 * time.Minute
+
+// recentChatsActiveKey 最近活跃用户的有序集合，分值为最后活跃的Unix时间
+func recentChatsActiveKey() string {
+	return RedisKey("recent:chats:active")
+}
+
+// recentChatsRefreshLockKey 刷新任务的锁，多个节点同一轮只有一个执行刷新
+func recentChatsRefreshLockKey() string {
+	return RedisKey("recent:chats:refresh:lock")
+}
+
+// markRecentChatsActive 记录用户最近有消息活动或查看了聊天列表，未启用预刷新时不记录
+func (s *MessageService) markRecentChatsActive(userID uint) {
+	if config.AppConfig.RecentChatsRefreshSeconds <= 0 {
+		return
+	}
+	s.rdb.ZAdd(context.Background(), recentChatsActiveKey(), &redis.Z{
+		Score:  float64(time.Now().Unix()),
+		Member: strconv.FormatUint(uint64(userID), 10),
+	})
+}
+
+// RunRecentChatsRefresher 按 RECENT_CHATS_REFRESH_SECONDS 间隔为最近活跃的用户预先重建最近聊天列表缓存，
+// 避免缓存过期或失效后用户的第一次请求走慢查询，ctx取消后退出
+func (s *MessageService) RunRecentChatsRefresher(ctx context.Context) {
+	interval := time.Duration(config.AppConfig.RecentChatsRefreshSeconds) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.refreshRecentChats(ctx, interval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshRecentChats 执行一轮刷新：清理不再活跃的用户，为最多 RECENT_CHATS_REFRESH_MAX_USERS 个
+// 最近活跃的用户重建缺失或将在下一轮之前过期的缓存，单轮耗时不超过刷新间隔
+func (s *MessageService) refreshRecentChats(ctx context.Context, interval time.Duration) {
+	ok, err := s.rdb.SetNX(ctx, recentChatsRefreshLockKey(), 1, interval).Result()
+	if err != nil || !ok {
+		return
+	}
+
+	activeKey := recentChatsActiveKey()
+	cutoff := time.Now().Add(-time.Duration(config.AppConfig.RecentChatsActiveMinutes) * time.Minute)
+	s.rdb.ZRemRangeByScore(ctx, activeKey, "-inf", "("+strconv.FormatInt(cutoff.Unix(), 10))
+
+	members, err := s.rdb.ZRevRange(ctx, activeKey, 0, int64(config.AppConfig.RecentChatsRefreshMaxUsers)-1).Result()
+	if err != nil {
+		log.Printf("读取活跃用户失败: %v", err)
+		return
+	}
+
+	roundCtx, cancel := context.WithTimeout(ctx, interval)
+	defer cancel()
+
+	// 剩余有效期不足两个间隔的缓存在下一轮之前可能过期，本轮提前重建
+	refreshBefore := 2 * interval
+	refreshed := 0
+	for _, member := range members {
+		if roundCtx.Err() != nil {
+			break
+		}
+		id, err := strconv.ParseUint(member, 10, 32)
+		if err != nil {
+			continue
+		}
+		userID := uint(id)
+		ttl, err := s.rdb.TTL(roundCtx, recentChatsKey(userID)).Result()
+		if err != nil || (ttl > 0 && ttl >= refreshBefore) {
+			continue
+		}
+		if _, err := s.loadRecentChats(roundCtx, userID); err != nil {
+			if roundCtx.Err() == nil {
+				log.Printf("刷新用户%d的最近聊天列表失败: %v", userID, err)
+			}
+			continue
+		}
+		refreshed++
+	}
+	if roundCtx.Err() != nil {
+		log.Printf("最近聊天列表刷新超时，本轮已刷新%d个用户", refreshed)
+	}
+}
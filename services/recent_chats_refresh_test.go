@@ -0,0 +1,103 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// withRecentChatsRefresh 在测试期间开启最近聊天列表预刷新
+func withRecentChatsRefresh(t *testing.T, seconds int) {
+	t.Helper()
+	oldSeconds, oldActive, oldMax := config.AppConfig.RecentChatsRefreshSeconds, config.AppConfig.RecentChatsActiveMinutes, config.AppConfig.RecentChatsRefreshMaxUsers
+	config.AppConfig.RecentChatsRefreshSeconds = seconds
+	config.AppConfig.RecentChatsActiveMinutes = 30
+	config.AppConfig.RecentChatsRefreshMaxUsers = 500
+	t.Cleanup(func() {
+		config.AppConfig.RecentChatsRefreshSeconds = oldSeconds
+		config.AppConfig.RecentChatsActiveMinutes = oldActive
+		config.AppConfig.RecentChatsRefreshMaxUsers = oldMax
+	})
+}
+
+func TestRecentChatsRefreshedInBackground(t *testing.T) {
+	withRecentChatsRefresh(t, 60)
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := t.Context()
+	interval := time.Minute
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+
+	// 发送消息使发送者成为活跃用户并使其缓存失效
+	msg := &models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Type: models.PrivateMessage, Content: "hi"}
+	if err := s.ProcessMessage(msg); err != nil {
+		t.Fatalf("发送消息失败: %v", err)
+	}
+	if env.mr.Exists(recentChatsKey(alice.ID)) {
+		t.Fatal("发送后最近聊天缓存应已失效")
+	}
+	// 很久以前活跃过的用户不再刷新
+	env.rdb.ZAdd(ctx, recentChatsActiveKey(), &redis.Z{
+		Score:  float64(time.Now().Add(-time.Hour).Unix()),
+		Member: strconv.FormatUint(uint64(carol.ID), 10),
+	})
+
+	s.refreshRecentChats(ctx, interval)
+
+	cached, err := env.rdb.Get(ctx, recentChatsKey(alice.ID)).Result()
+	if err != nil {
+		t.Fatalf("未在后台重建缓存: %v", err)
+	}
+	var chats []models.RecentChat
+	if err := json.Unmarshal([]byte(cached), &chats); err != nil || len(chats) != 1 || chats[0].TargetID != bob.ID {
+		t.Fatalf("重建的最近聊天 = %+v, %v", chats, err)
+	}
+	if env.mr.Exists(recentChatsKey(carol.ID)) {
+		t.Fatal("不活跃的用户不应刷新")
+	}
+	if _, err := env.rdb.ZScore(ctx, recentChatsActiveKey(), strconv.FormatUint(uint64(carol.ID), 10)).Result(); !errors.Is(err, redis.Nil) {
+		t.Fatalf("不活跃的用户应从活跃集合中移除: %v", err)
+	}
+
+	// 同一轮内其他节点拿不到锁；剩余有效期充足的缓存不重建
+	env.rdb.Del(ctx, recentChatsKey(alice.ID))
+	s.refreshRecentChats(ctx, interval)
+	if env.mr.Exists(recentChatsKey(alice.ID)) {
+		t.Fatal("未拿到刷新锁时不应刷新")
+	}
+	env.rdb.Del(ctx, recentChatsRefreshLockKey())
+	env.rdb.Set(ctx, recentChatsKey(alice.ID), "fresh", recentChatsTTL)
+	s.refreshRecentChats(ctx, interval)
+	if got, _ := env.rdb.Get(ctx, recentChatsKey(alice.ID)).Result(); got != "fresh" {
+		t.Fatalf("有效期充足的缓存被重建: %q", got)
+	}
+
+	// 即将过期的缓存提前重建
+	env.rdb.Del(ctx, recentChatsRefreshLockKey())
+	env.rdb.Expire(ctx, recentChatsKey(alice.ID), interval)
+	s.refreshRecentChats(ctx, interval)
+	if got, _ := env.rdb.Get(ctx, recentChatsKey(alice.ID)).Result(); got == "fresh" {
+		t.Fatal("即将过期的缓存未提前重建")
+	}
+}
+
+func TestRecentChatsActivityNotTrackedWhenDisabled(t *testing.T) {
+	withRecentChatsRefresh(t, 0)
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	if _, err := env.messages.GetRecentChats(t.Context(), alice.ID); err != nil {
+		t.Fatalf("获取最近聊天失败: %v", err)
+	}
+	if env.mr.Exists(recentChatsActiveKey()) {
+		t.Fatal("未启用预刷新时不应记录活跃用户")
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+
+	"chatroom/config"
+)
+
+// RedisKey 构建带 REDIS_KEY_PREFIX 前缀的Redis键，所有Redis键都应经由此函数构建，
+// 以便多个环境或应用共用同一个Redis实例时互不冲突
+func RedisKey(format string, args ...interface{}) string {
+	return config.AppConfig.RedisKeyPrefix + fmt.Sprintf(format, args...)
+}
+
+// onlineUsersKey 在线用户集合的键
+func onlineUsersKey() string {
+	return RedisKey("online_users")
+}
+
+// onlineMember 在线用户集合中的成员值，统一为十进制用户ID字符串
+// 写入、移除和查询都应经由此函数格式化，避免依赖客户端库对整数的隐式转换
+func onlineMember(userID uint) string {
+	return strconv.FormatUint(uint64(userID), 10)
+}
+
+// parseOnlineMember 解析在线用户集合中的成员值，格式不合法时返回false
+func parseOnlineMember(member string) (uint, bool) {
+	id, err := strconv.ParseUint(member, 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// recentChatsKey 用户最近聊天列表缓存的键
+func recentChatsKey(userID uint) string {
+	return RedisKey("recent:chats:%d", userID)
+}
+
+// recentMessagesKey 会话最近消息缓存的键
+func recentMessagesKey(conversationID string) string {
+	return RedisKey("recent:%s", conversationID)
+}
+
+// groupMembersKey 群组成员列表缓存的键
+func groupMembersKey(groupID uint) string {
+	return RedisKey("group:members:%d", groupID)
+}
+
+// userCacheKey 用户信息缓存的键
+func userCacheKey(userID uint) string {
+	return RedisKey("user:%d", userID)
+}
+
+// connectBanKey 用户临时禁止建立WebSocket连接的键
+func connectBanKey(userID uint) string {
+	return RedisKey("ws:ban:%d", userID)
+}
+
+// maintenanceKey 维护模式状态的键
+func maintenanceKey() string {
+	return RedisKey("maintenance")
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// withRedisKeyPrefix 在测试期间设置Redis键前缀
+func withRedisKeyPrefix(t *testing.T, prefix string) {
+	t.Helper()
+	old := config.AppConfig.RedisKeyPrefix
+	config.AppConfig.RedisKeyPrefix = prefix
+	t.Cleanup(func() { config.AppConfig.RedisKeyPrefix = old })
+}
+
+func TestRedisKeyBuilders(t *testing.T) {
+	withRedisKeyPrefix(t, "staging:")
+
+	tests := []struct {
+		got  string
+		want string
+	}{
+		{onlineUsersKey(), "staging:online_users"},
+		{recentChatsKey(1), "staging:recent:chats:1"},
+		{recentMessagesKey("group:2"), "staging:recent:group:2"},
+		{groupMembersKey(3), "staging:group:members:3"},
+		{userCacheKey(4), "staging:user:4"},
+		{connectBanKey(5), "staging:ws:ban:5"},
+		{maintenanceKey(), "staging:maintenance"},
+		{deferredPushKey(6), "staging:push:deferred:6"},
+		{deferredPushDueKey(), "staging:push:deferred:due"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("键 = %q，期望 %q", tt.got, tt.want)
+		}
+	}
+
+	withRedisKeyPrefix(t, "")
+	if got := userCacheKey(4); got != "user:4" {
+		t.Fatalf("无前缀时键 = %q，期望 user:4", got)
+	}
+}
+
+func TestAllRedisKeysCarryPrefix(t *testing.T) {
+	const prefix = "staging:"
+	withRedisKeyPrefix(t, prefix)
+	env := newTestEnv(t)
+	s := env.messages
+	ctx := context.Background()
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	group := env.createGroup(t, "g", alice, bob)
+
+	// 覆盖在线状态、用户缓存、消息、未读、提及、草稿、会话等写入Redis的路径
+	_, _, done := connectClient(t, m, alice)
+	if _, err := env.users.GetUserResponse(alice.ID); err != nil {
+		t.Fatalf("获取用户失败: %v", err)
+	}
+	for _, msg := range []*models.Message{
+		{SenderID: alice.ID, ReceiverID: bob.ID, Type: models.PrivateMessage, Content: "hi"},
+		{SenderID: alice.ID, GroupID: group.ID, Type: models.GroupMessage, Content: "hi @bob"},
+	} {
+		if err := s.ProcessMessage(msg); err != nil {
+			t.Fatalf("发送消息失败: %v", err)
+		}
+	}
+	if _, err := s.GetRecentChats(ctx, bob.ID); err != nil {
+		t.Fatalf("获取最近聊天失败: %v", err)
+	}
+	if _, err := s.GetGroupMessages(ctx, bob.ID, group.ID, 20, 0); err != nil {
+		t.Fatalf("获取群消息失败: %v", err)
+	}
+	if err := s.MarkMessagesAsRead(bob.ID, group.ID, true, 0); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+	if _, err := s.SaveDraft(bob.ID, alice.ID, false, "draft"); err != nil {
+		t.Fatalf("保存草稿失败: %v", err)
+	}
+	sessions := NewSessionService(env.db, env.rdb)
+	session, err := sessions.CreateSession(bob.ID, "phone", "")
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	sessions.StoreRefreshToken(session.ID, "r1")
+	if err := sessions.RevokeSession(bob.ID, session.ID); err != nil {
+		t.Fatalf("注销会话失败: %v", err)
+	}
+	m.DisconnectUser(alice.ID, "")
+	waitClosed(t, done)
+
+	keys := env.mr.Keys()
+	if len(keys) == 0 {
+		t.Fatal("没有写入任何Redis键")
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			t.Errorf("Redis键 %q 缺少前缀 %q", key, prefix)
+		}
+	}
+}
+
+func TestOnlineMemberEncoding(t *testing.T) {
+	for _, id := range []uint{1, 42, 4294967295} {
+		got, ok := parseOnlineMember(onlineMember(id))
+		if !ok || got != id {
+			t.Errorf("parseOnlineMember(onlineMember(%d)) = %d, %v", id, got, ok)
+		}
+	}
+	for _, member := range []string{"", "0", "-1", "abc", `"7"`, "4294967296"} {
+		if _, ok := parseOnlineMember(member); ok {
+			t.Errorf("parseOnlineMember(%q) 应返回false", member)
+		}
+	}
+
+	// 上线写入、在线查询和在线列表使用同一种格式
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+	client := NewClient(alice.ID, alice.Username, newFakeConn())
+	if !m.RegisterClient(client) {
+		t.Fatal("注册客户端失败")
+	}
+	members, _ := env.rdb.SMembers(context.Background(), onlineUsersKey()).Result()
+	if len(members) != 1 || members[0] != onlineMember(alice.ID) {
+		t.Fatalf("在线集合 = %v，期望 [%s]", members, onlineMember(alice.ID))
+	}
+	online := func() (bool, bool, int) {
+		users, err := env.users.GetOnlineUsers()
+		if err != nil {
+			t.Fatalf("获取在线用户失败: %v", err)
+		}
+		return env.users.IsUserOnline(alice.ID), env.users.onlineStatuses([]uint{alice.ID})[alice.ID], len(users)
+	}
+	if single, batch, count := online(); !single || !batch || count != 1 {
+		t.Fatalf("上线后 IsUserOnline = %v，批量 = %v，在线列表 %d 人", single, batch, count)
+	}
+
+	m.UnregisterClient(client)
+	if single, batch, count := online(); single || batch || count != 0 {
+		t.Fatalf("下线后 IsUserOnline = %v，批量 = %v，在线列表 %d 人", single, batch, count)
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// 举报相关错误
+var (
+	ErrReportNotFound      = errors.New("举报不存在")
+	ErrReportSelf          = errors.New("不能举报自己")
+	ErrAlreadyReported     = errors.New("已举报过，请等待处理")
+	ErrReportResolved      = errors.New("举报已处理")
+	ErrInvalidReportAction = errors.New("无效的处理动作")
+)
+
+// defaultMuteMinutes 未指定时长时的禁言分钟数
+const defaultMuteMinutes = 60
+
+// ReportService 举报与处理队列服务
+type ReportService struct {
+	db             *gorm.DB
+	userService    *UserService
+	messageService *MessageService
+	sessionService *SessionService
+}
+
+// NewReportService 创建举报服务
+func NewReportService(db *gorm.DB, userService *UserService, messageService *MessageService, sessionService *SessionService) *ReportService {
+	return &ReportService{
+		db:             db,
+		userService:    userService,
+		messageService: messageService,
+		sessionService: sessionService,
+	}
+}
+
+// FileReport 提交举报，举报消息时要求举报者能看到该消息，提交后通知管理员
+func (s *ReportService) FileReport(reporterID uint, req models.ReportRequest) (*models.Report, error) {
+	targetUserID := req.TargetUserID
+	if req.MessageID > 0 {
+		var msg models.Message
+		if err := s.db.First(&msg, req.MessageID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrMessageNotFound
+			}
+			return nil, err
+		}
+		if msg.GroupID > 0 {
+			rank, err := s.messageService.groupRank(msg.GroupID, reporterID)
+			if err != nil {
+				return nil, err
+			}
+			if rank == rankNone {
+				return nil, ErrNotConversationUser
+			}
+		} else if msg.SenderID != reporterID && msg.ReceiverID != reporterID {
+			return nil, ErrNotConversationUser
+		}
+		targetUserID = msg.SenderID
+	} else if _, err := s.userService.GetUserByID(targetUserID); err != nil {
+		return nil, err
+	}
+
+	if targetUserID == reporterID {
+		return nil, ErrReportSelf
+	}
+
+	// 同一举报者对同一目标只保留一条待处理举报
+	var count int64
+	if err := s.db.Model(&models.Report{}).
+		Where("reporter_id = ? AND target_user_id = ? AND message_id = ? AND status = ?",
+			reporterID, targetUserID, req.MessageID, models.ReportPending).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrAlreadyReported
+	}
+
+	report := models.Report{
+		ReporterID:   reporterID,
+		TargetUserID: targetUserID,
+		MessageID:    req.MessageID,
+		Reason:       req.Reason,
+		Status:       models.ReportPending,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.db.Create(&report).Error; err != nil {
+		return nil, errors.New("提交举报失败")
+	}
+
+	reportJSON, _ := json.Marshal(report)
+	for _, adminID := range config.AppConfig.AdminUserIDs {
+		s.messageService.PublishUserEvent(adminID, "report_created", reportJSON)
+	}
+
+	return &report, nil
+}
+
+// ListReports 获取举报队列，status为空时返回全部
+func (s *ReportService) ListReports(status models.ReportStatus, limit, offset int) ([]models.Report, error) {
+	query := s.db.Model(&models.Report{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	reports := []models.Report{}
+	if err := query.Order("created_at ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// ResolveReport 处理举报并对被举报用户执行相应动作
+func (s *ReportService) ResolveReport(reportID, adminID uint, req models.ResolveReportRequest) (*models.Report, error) {
+	var report models.Report
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 锁定举报记录，避免多个管理员重复处理
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&report, reportID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrReportNotFound
+			}
+			return err
+		}
+		if report.Status != models.ReportPending {
+			return ErrReportResolved
+		}
+
+		now := time.Now()
+		report.Status = models.ReportResolved
+		report.Action = req.Action
+		report.Note = req.Note
+		report.ResolvedBy = adminID
+		report.ResolvedAt = &now
+		return tx.Save(&report).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyAction(&report, req); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// applyAction 对被举报用户执行处理动作
+func (s *ReportService) applyAction(report *models.Report, req models.ResolveReportRequest) error {
+	switch req.Action {
+	case models.ReportDismiss:
+		return nil
+	case models.ReportWarn:
+		event, _ := json.Marshal(models.ModerationWarningEvent{
+			ReportID:  report.ID,
+			MessageID: report.MessageID,
+			Note:      report.Note,
+		})
+		s.messageService.PublishUserEvent(report.TargetUserID, "moderation_warning", event)
+		return nil
+	case models.ReportMute:
+		minutes := req.MuteMinutes
+		if minutes == 0 {
+			minutes = defaultMuteMinutes
+		}
+		return s.userService.MuteUser(report.TargetUserID, time.Now().Add(time.Duration(minutes)*time.Minute))
+	case models.ReportBan:
+		if err := s.userService.BanUser(report.TargetUserID); err != nil {
+			return err
+		}
+		// 已签发的令牌立即失效，并断开在线连接
+		return s.sessionService.RevokeAllSessions(report.TargetUserID)
+	default:
+		return ErrInvalidReportAction
+	}
+}
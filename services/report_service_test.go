@@ -0,0 +1,165 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// newTestReportService 创建举报服务，admins 为接收举报通知的管理员
+func newTestReportService(t *testing.T, env *testEnv, admins ...uint) *ReportService {
+	t.Helper()
+	old := config.AppConfig.AdminUserIDs
+	config.AppConfig.AdminUserIDs = admins
+	t.Cleanup(func() { config.AppConfig.AdminUserIDs = old })
+	return NewReportService(env.db, env.users, env.messages, NewSessionService(env.db, env.rdb))
+}
+
+func TestFileReport(t *testing.T) {
+	env := newTestEnv(t)
+	delivered := recordDeliveries(env.messages)
+	admin := env.createUser(t, "admin")
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	reports := newTestReportService(t, env, admin.ID)
+
+	msg := env.createMessage(t, models.Message{SenderID: bob.ID, ReceiverID: alice.ID, Content: "rude"})
+
+	// 举报消息时被举报用户为消息发送者
+	report, err := reports.FileReport(alice.ID, models.ReportRequest{MessageID: msg.ID, Reason: "abuse"})
+	if err != nil {
+		t.Fatalf("举报失败: %v", err)
+	}
+	if report.TargetUserID != bob.ID || report.Status != models.ReportPending {
+		t.Fatalf("举报记录 = %+v", report)
+	}
+
+	// 管理员收到新举报通知
+	notified := false
+	for _, d := range delivered() {
+		if d.event.Type == "report_created" && d.userID == admin.ID {
+			var got models.Report
+			json.Unmarshal(d.event.Content, &got)
+			notified = got.ID == report.ID
+		}
+	}
+	if !notified {
+		t.Fatalf("管理员未收到举报通知: %+v", delivered())
+	}
+
+	tests := []struct {
+		name     string
+		reporter uint
+		req      models.ReportRequest
+		want     error
+	}{
+		{"重复举报", alice.ID, models.ReportRequest{MessageID: msg.ID, Reason: "again"}, ErrAlreadyReported},
+		{"举报看不到的消息", carol.ID, models.ReportRequest{MessageID: msg.ID, Reason: "x"}, ErrNotConversationUser},
+		{"举报自己", bob.ID, models.ReportRequest{MessageID: msg.ID, Reason: "x"}, ErrReportSelf},
+		{"消息不存在", alice.ID, models.ReportRequest{MessageID: 9999, Reason: "x"}, ErrMessageNotFound},
+		{"用户不存在", alice.ID, models.ReportRequest{TargetUserID: 9999, Reason: "x"}, ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := reports.FileReport(tt.reporter, tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("%s = %v，期望 %v", tt.name, err, tt.want)
+		}
+	}
+
+	// 直接举报用户
+	if _, err := reports.FileReport(carol.ID, models.ReportRequest{TargetUserID: bob.ID, Reason: "spam"}); err != nil {
+		t.Fatalf("举报用户失败: %v", err)
+	}
+	pending, err := reports.ListReports(models.ReportPending, 10, 0)
+	if err != nil {
+		t.Fatalf("获取举报队列失败: %v", err)
+	}
+	if len(pending) != 2 || pending[0].ID != report.ID {
+		t.Fatalf("举报队列 = %+v", pending)
+	}
+}
+
+func TestResolveReport(t *testing.T) {
+	env := newTestEnv(t)
+	delivered := recordDeliveries(env.messages)
+	admin := env.createUser(t, "admin")
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	reports := newTestReportService(t, env, admin.ID)
+
+	file := func(reason string) *models.Report {
+		t.Helper()
+		report, err := reports.FileReport(alice.ID, models.ReportRequest{TargetUserID: bob.ID, Reason: reason})
+		if err != nil {
+			t.Fatalf("举报失败: %v", err)
+		}
+		return report
+	}
+	resolve := func(report *models.Report, req models.ResolveReportRequest) *models.Report {
+		t.Helper()
+		resolved, err := reports.ResolveReport(report.ID, admin.ID, req)
+		if err != nil {
+			t.Fatalf("处理举报失败: %v", err)
+		}
+		return resolved
+	}
+
+	// 驳回
+	report := resolve(file("x"), models.ResolveReportRequest{Action: models.ReportDismiss})
+	if report.Status != models.ReportResolved || report.ResolvedBy != admin.ID || report.ResolvedAt == nil {
+		t.Fatalf("处理后的举报 = %+v", report)
+	}
+	if _, err := reports.ResolveReport(report.ID, admin.ID, models.ResolveReportRequest{Action: models.ReportBan}); !errors.Is(err, ErrReportResolved) {
+		t.Fatalf("重复处理 = %v，期望 ErrReportResolved", err)
+	}
+	if _, err := reports.ResolveReport(9999, admin.ID, models.ResolveReportRequest{Action: models.ReportDismiss}); !errors.Is(err, ErrReportNotFound) {
+		t.Fatalf("处理不存在的举报 = %v，期望 ErrReportNotFound", err)
+	}
+	if err := env.users.CheckCanPost(bob.ID); err != nil {
+		t.Fatalf("驳回后不应处罚: %v", err)
+	}
+
+	// 警告会通知被举报用户
+	resolve(file("x"), models.ResolveReportRequest{Action: models.ReportWarn, Note: "注意言行"})
+	warned := false
+	for _, d := range delivered() {
+		if d.event.Type == "moderation_warning" && d.userID == bob.ID {
+			var event models.ModerationWarningEvent
+			json.Unmarshal(d.event.Content, &event)
+			warned = event.Note == "注意言行"
+		}
+	}
+	if !warned {
+		t.Fatal("被举报用户未收到警告")
+	}
+
+	// 禁言后不能发言
+	resolve(file("x"), models.ResolveReportRequest{Action: models.ReportMute, MuteMinutes: 5})
+	if err := env.users.CheckCanPost(bob.ID); !errors.Is(err, ErrUserMuted) {
+		t.Fatalf("禁言后发言 = %v，期望 ErrUserMuted", err)
+	}
+
+	// 封禁后注销全部会话
+	sessions := NewSessionService(env.db, env.rdb)
+	session, err := sessions.CreateSession(bob.ID, "phone", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	resolve(file("x"), models.ResolveReportRequest{Action: models.ReportBan})
+	if err := env.users.CheckCanPost(bob.ID); !errors.Is(err, ErrUserBanned) {
+		t.Fatalf("封禁后发言 = %v，期望 ErrUserBanned", err)
+	}
+	if !sessions.IsRevoked(session.ID) {
+		t.Fatal("封禁后会话应被注销")
+	}
+
+	if pending, _ := reports.ListReports(models.ReportPending, 10, 0); len(pending) != 0 {
+		t.Fatalf("处理后待处理队列 = %+v，期望为空", pending)
+	}
+	if all, _ := reports.ListReports("", 10, 0); len(all) != 4 {
+		t.Fatalf("全部举报数 = %d，期望 4", len(all))
+	}
+}
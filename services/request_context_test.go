@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/models"
+)
+
+// slowQueries 让之后的查询等待至多1秒，模拟慢查询，请求上下文取消时提前返回
+func slowQueries(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	slow := func(tx *gorm.DB) {
+		select {
+		case <-tx.Statement.Context.Done():
+		case <-time.After(time.Second):
+		}
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("test:slow_query", slow); err != nil {
+		t.Fatalf("注册查询回调失败: %v", err)
+	}
+}
+
+func TestCanceledContextAbortsSlowQuery(t *testing.T) {
+	env := newTestEnv(t)
+	s := env.messages
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: bob.ID, Content: "hi"})
+	slowQueries(t, env.db)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := s.GetMessagesByUser(ctx, alice.ID, bob.ID, 20, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("超时后查询 = %v，期望 context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("查询耗时 %v，期望超时后立即返回", elapsed)
+	}
+
+	// 已取消的请求不返回也不缓存不完整的最近聊天
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.GetRecentChats(canceled, alice.ID); !errors.Is(err, context.Canceled) {
+		t.Fatalf("取消后获取最近聊天 = %v，期望 context.Canceled", err)
+	}
+	if exists, _ := env.rdb.Exists(context.Background(), recentChatsKey(alice.ID)).Result(); exists != 0 {
+		t.Fatal("取消的请求不应写入最近聊天缓存")
+	}
+}
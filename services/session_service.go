@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// AccessTokenLifetime 访问令牌的有效期，由 ACCESS_TOKEN_MINUTES 配置
+func AccessTokenLifetime() time.Duration {
+	return time.Duration(config.AppConfig.AccessTokenMinutes) * time.Minute
+}
+
+// RefreshTokenLifetime 刷新令牌及其会话的有效期，由 REFRESH_TOKEN_HOURS 配置
+func RefreshTokenLifetime() time.Duration {
+	return time.Duration(config.AppConfig.RefreshTokenHours) * time.Hour
+}
+
+// 会话相关错误
+var (
+	ErrSessionNotFound     = errors.New("会话不存在")
+	ErrInvalidRefreshToken = errors.New("刷新令牌无效或已失效，请重新登录")
+)
+
+// SessionService 登录会话服务
+type SessionService struct {
+	db       *gorm.DB
+	rdb      *redis.Client
+	onRevoke func(userID uint, sessionID string) // 会话注销后断开其WebSocket连接
+}
+
+// NewSessionService 创建会话服务
+func NewSessionService(db *gorm.DB, rdb *redis.Client) *SessionService {
+	return &SessionService{
+		db:  db,
+		rdb: rdb,
+	}
+}
+
+// SetRevokeHook 设置会话注销后的回调
+func (s *SessionService) SetRevokeHook(hook func(userID uint, sessionID string)) {
+	s.onRevoke = hook
+}
+
+// sessionRevokedKey 已注销会话的黑名单键
+func sessionRevokedKey(sessionID string) string {
+	return RedisKey("session:revoked:%s", sessionID)
+}
+
+// refreshTokenKey 会话当前有效的刷新令牌ID的键，每个会话只有一个有效的刷新令牌
+func refreshTokenKey(sessionID string) string {
+	return RedisKey("session:refresh:%s", sessionID)
+}
+
+// CreateSession 登录时创建会话，返回的ID用作访问令牌的jti
+func (s *SessionService) CreateSession(userID uint, device, ip string) (*models.Session, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	// User-Agent可能超出列宽
+	if len(device) > 255 {
+		device = device[:255]
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:           hex.EncodeToString(buf),
+		UserID:       userID,
+		Device:       device,
+		IP:           ip,
+		CreatedAt:    now,
+		LastActiveAt: now,
+		ExpiresAt:    now.Add(RefreshTokenLifetime()),
+	}
+	if err := s.db.Create(&session).Error; err != nil {
+		return nil, errors.New("创建会话失败")
+	}
+	return &session, nil
+}
+
+// StoreRefreshToken 记录会话签发的刷新令牌ID，有效期与会话一致
+func (s *SessionService) StoreRefreshToken(sessionID, tokenID string) error {
+	return s.rdb.Set(context.Background(), refreshTokenKey(sessionID), tokenID, RefreshTokenLifetime()).Err()
+}
+
+// ValidateRefreshToken 校验刷新令牌：令牌ID必须是会话记录的当前令牌，且会话未注销、未过期
+func (s *SessionService) ValidateRefreshToken(userID uint, sessionID, tokenID string) error {
+	if sessionID == "" || tokenID == "" {
+		return ErrInvalidRefreshToken
+	}
+
+	stored, err := s.rdb.Get(context.Background(), refreshTokenKey(sessionID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+	if stored != tokenID {
+		return ErrInvalidRefreshToken
+	}
+
+	var count int64
+	if err := s.db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, userID, time.Now()).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInvalidRefreshToken
+	}
+	return nil
+}
+
+// Touch 更新会话的最后活跃时间和IP（WebSocket连接时调用）
+func (s *SessionService) Touch(sessionID, ip string) {
+	if sessionID == "" {
+		return
+	}
+	s.db.Model(&models.Session{}).Where("id = ?", sessionID).
+		Updates(map[string]interface{}{"last_active_at": time.Now(), "ip": ip})
+}
+
+// ListSessions 获取用户未过期且未注销的会话，currentID标记发起请求的会话
+func (s *SessionService) ListSessions(userID uint, currentID string) ([]models.SessionResponse, error) {
+	var sessions []models.Session
+	if err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_active_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		responses = append(responses, models.SessionResponse{
+			ID:           session.ID,
+			Device:       session.Device,
+			IP:           session.IP,
+			CreatedAt:    session.CreatedAt,
+			LastActiveAt: session.LastActiveAt,
+			Current:      session.ID == currentID,
+		})
+	}
+	return responses, nil
+}
+
+// RevokeSession 注销用户的某个会话：令牌加入黑名单直至过期，并断开其WebSocket连接
+func (s *SessionService) RevokeSession(userID uint, sessionID string) error {
+	var session models.Session
+	if err := s.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&session).Update("revoked_at", now).Error; err != nil {
+		return errors.New("注销会话失败")
+	}
+
+	// 黑名单只需保留到会话过期，刷新令牌同时作废
+	ctx := context.Background()
+	if ttl := session.ExpiresAt.Sub(now); ttl > 0 {
+		s.rdb.Set(ctx, sessionRevokedKey(sessionID), 1, ttl)
+	}
+	s.rdb.Del(ctx, refreshTokenKey(sessionID))
+
+	if s.onRevoke != nil {
+		s.onRevoke(userID, sessionID)
+	}
+	return nil
+}
+
+// RevokeAllSessions 注销用户的全部会话（如账号被封禁时）
+func (s *SessionService) RevokeAllSessions(userID uint) error {
+	var sessionIDs []string
+	if err := s.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Pluck("id", &sessionIDs).Error; err != nil {
+		return err
+	}
+	for _, sessionID := range sessionIDs {
+		if err := s.RevokeSession(userID, sessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsRevoked 判断会话是否已注销，Redis不可用时回退到数据库
+func (s *SessionService) IsRevoked(sessionID string) bool {
+	// 旧版本签发的令牌没有会话ID，不受会话管理约束
+	if sessionID == "" {
+		return false
+	}
+
+	n, err := s.rdb.Exists(context.Background(), sessionRevokedKey(sessionID)).Result()
+	if err == nil {
+		return n > 0
+	}
+
+	var count int64
+	s.db.Model(&models.Session{}).Where("id = ? AND revoked_at IS NOT NULL", sessionID).Count(&count)
+	return count > 0
+}
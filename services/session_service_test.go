@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRevokeSessionClosesConnection(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	sessions := NewSessionService(env.db, env.rdb)
+	sessions.SetRevokeHook(m.DisconnectSession)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	phone, err := sessions.CreateSession(alice.ID, "phone", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	laptop, err := sessions.CreateSession(alice.ID, "laptop", "10.0.0.2")
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	if err := sessions.StoreRefreshToken(phone.ID, "r1"); err != nil {
+		t.Fatalf("记录刷新令牌失败: %v", err)
+	}
+
+	list, err := sessions.ListSessions(alice.ID, laptop.ID)
+	if err != nil {
+		t.Fatalf("获取会话列表失败: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("会话列表 = %+v，期望 2 个", list)
+	}
+	for _, s := range list {
+		if s.Current != (s.ID == laptop.ID) {
+			t.Fatalf("当前会话标记错误: %+v", s)
+		}
+	}
+
+	client, conn, done := connectClient(t, m, alice)
+	client.SessionID = phone.ID
+
+	// 不能注销其他用户的会话
+	if err := sessions.RevokeSession(bob.ID, phone.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("注销他人会话 = %v，期望 ErrSessionNotFound", err)
+	}
+
+	if err := sessions.RevokeSession(alice.ID, phone.ID); err != nil {
+		t.Fatalf("注销会话失败: %v", err)
+	}
+	// 注销后断开该会话的连接，令牌和刷新令牌都失效
+	waitClosed(t, done)
+	assertSingleClose(t, conn, CloseSessionRevoked)
+	if !sessions.IsRevoked(phone.ID) {
+		t.Fatal("注销的会话未加入黑名单")
+	}
+	if sessions.IsRevoked(laptop.ID) {
+		t.Fatal("其他会话不应被注销")
+	}
+	if err := sessions.ValidateRefreshToken(alice.ID, phone.ID, "r1"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("注销后刷新 = %v，期望 ErrInvalidRefreshToken", err)
+	}
+	if list, _ := sessions.ListSessions(alice.ID, ""); len(list) != 1 || list[0].ID != laptop.ID {
+		t.Fatalf("注销后会话列表 = %+v", list)
+	}
+	if err := sessions.RevokeSession(alice.ID, phone.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("重复注销 = %v，期望 ErrSessionNotFound", err)
+	}
+
+	// Redis不可用时回退到数据库判断
+	env.mr.FlushAll()
+	env.mr.Close()
+	if !sessions.IsRevoked(phone.ID) {
+		t.Fatal("Redis不可用时应从数据库判断会话已注销")
+	}
+}
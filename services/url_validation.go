@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// maxAvatarURLLength 头像地址的最大长度
+const maxAvatarURLLength = 512
+
+// ErrInvalidAvatarURL 头像地址不是合法的http/https地址或资源路径
+var ErrInvalidAvatarURL = errors.New("无效的头像地址，只允许http/https地址或资源路径")
+
+// ValidateAvatarURL 校验头像地址，空值表示不修改
+// 允许完整的http/https地址和不带协议的相对资源路径（由 AssetURL 拼接CDN地址），
+// 拒绝 javascript:、data: 等其他协议、带用户信息的地址以及指向本机或内网IP的地址
+func ValidateAvatarURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if len(raw) > maxAvatarURLLength || strings.ContainsAny(raw, " \t\r\n\\") {
+		return ErrInvalidAvatarURL
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ErrInvalidAvatarURL
+	}
+
+	// 相对资源路径：不能带协议或主机，也不能跳出资源目录
+	if u.Scheme == "" {
+		if strings.HasPrefix(raw, "//") || u.Host != "" {
+			return ErrInvalidAvatarURL
+		}
+		for _, segment := range strings.Split(u.Path, "/") {
+			if segment == ".." {
+				return ErrInvalidAvatarURL
+			}
+		}
+		return nil
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrInvalidAvatarURL
+	}
+	if u.User != nil || u.Hostname() == "" {
+		return ErrInvalidAvatarURL
+	}
+	if isInternalHost(u.Hostname()) {
+		return ErrInvalidAvatarURL
+	}
+	return nil
+}
+
+// isInternalHost 判断主机是否为本机名或回环、内网、链路本地等非公网IP字面量
+// 只检查字面量不做DNS解析，服务端主动抓取地址时仍需在连接时校验解析结果
+func isInternalHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast()
+}
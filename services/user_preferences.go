@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// 偏好设置相关错误
+var (
+	ErrPreferencesTooLarge = errors.New("偏好设置过大")
+	ErrInvalidPreferences  = errors.New("偏好设置不是有效的JSON")
+)
+
+// emptyPreferences 未设置偏好时返回的空对象
+var emptyPreferences = json.RawMessage("{}")
+
+// preferencesKey 用户偏好设置缓存的键
+func preferencesKey(userID uint) string {
+	return RedisKey("user:prefs:%d", userID)
+}
+
+// GetPreferences 获取用户的偏好设置，未设置时返回空对象
+func (s *UserService) GetPreferences(userID uint) (json.RawMessage, error) {
+	// 先尝试从缓存获取
+	ctx := context.Background()
+	key := preferencesKey(userID)
+
+	if cached, err := s.rdb.Get(ctx, key).Bytes(); err == nil {
+		return json.RawMessage(cached), nil
+	}
+
+	// 从数据库获取
+	var user models.User
+	if err := s.db.Select("id", "preferences").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	prefs := user.Preferences
+	if len(prefs) == 0 {
+		prefs = emptyPreferences
+	}
+
+	// 更新缓存
+	s.rdb.Set(ctx, key, []byte(prefs), time.Duration(config.AppConfig.CacheExpiration)*time.Second)
+
+	return prefs, nil
+}
+
+// UpdatePreferences 整体替换用户的偏好设置，只校验JSON格式和大小
+func (s *UserService) UpdatePreferences(userID uint, prefs []byte) (json.RawMessage, error) {
+	if limit := config.AppConfig.PreferencesMaxBytes; len(prefs) > limit {
+		return nil, fmt.Errorf("%w，最多%d字节", ErrPreferencesTooLarge, limit)
+	}
+	if !json.Valid(prefs) {
+		return nil, ErrInvalidPreferences
+	}
+
+	res := s.db.Model(&models.User{}).Where("id = ?", userID).Update("preferences", json.RawMessage(prefs))
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		// 内容未变化时也可能没有影响行，确认用户是否存在
+		if _, err := s.GetUserByID(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 删除缓存
+	ctx := context.Background()
+	s.rdb.Del(ctx, preferencesKey(userID))
+
+	return json.RawMessage(prefs), nil
+}
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
+	"sort"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -16,17 +16,31 @@ import (
 	"chatroom/models"
 )
 
+// ErrUserNotFound 用户不存在
+var ErrUserNotFound = errors.New("用户不存在")
+
+// 账号处罚相关错误
+var (
+	ErrUserBanned = errors.New("账号已被封禁")
+	ErrUserMuted  = errors.New("账号已被禁言")
+)
+
+// ErrMessagingNotAllowed 接收者的隐私设置不允许发送者发起私聊
+var ErrMessagingNotAllowed = errors.New("对方的隐私设置不允许你发送私聊消息")
+
 // UserService 用户服务
 type UserService struct {
-	db  *gorm.DB
-	rdb *redis.Client
+	db            *gorm.DB
+	rdb           *redis.Client
+	breachChecker BreachChecker // 泄露密码检查，为nil时不检查
 }
 
 // NewUserService 创建用户服务
 func NewUserService(db *gorm.DB, rdb *redis.Client) *UserService {
 	return &UserService{
-		db:  db,
-		rdb: rdb,
+		db:            db,
+		rdb:           rdb,
+		breachChecker: NewBreachChecker(),
 	}
 }
 
@@ -38,6 +52,11 @@ func (s *UserService) Register(username, password, email string) (*models.User,
 		return nil, errors.New("用户名或邮箱已存在")
 	}
 
+	// 校验密码强度
+	if err := s.ValidatePassword(context.Background(), password, username); err != nil {
+		return nil, err
+	}
+
 	// 哈希密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -64,7 +83,7 @@ func (s *UserService) Login(username, password string) (*models.User, error) {
 	var user models.User
 	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("用户不存在")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -74,6 +93,10 @@ func (s *UserService) Login(username, password string) (*models.User, error) {
 		return nil, errors.New("密码错误")
 	}
 
+	if user.BannedAt != nil {
+		return nil, ErrUserBanned
+	}
+
 	return &user, nil
 }
 
@@ -90,7 +113,7 @@ func (s *UserService) GetAllUsers() ([]models.UserResponse, error) {
 			ID:       user.ID,
 			Username: user.Username,
 			Email:    user.Email,
-			Avatar:   user.Avatar,
+			Avatar:   AssetURL(user.Avatar),
 			Online:   s.IsUserOnline(user.ID), // Check online status
 		})
 	}
@@ -108,7 +131,7 @@ func (s *UserService) GetUserResponse(id uint) (*models.UserResponse, error) {
 		ID:       user.ID,
 		Username: user.Username,
 		Email:    user.Email,
-		Avatar:   user.Avatar,
+		Avatar:   AssetURL(user.Avatar),
 		Online:   s.IsUserOnline(id),
 	}, nil
 }
@@ -116,19 +139,65 @@ func (s *UserService) GetUserResponse(id uint) (*models.UserResponse, error) {
 // IsUserOnline 检查用户是否在线
 func (s *UserService) IsUserOnline(userID uint) bool {
 	ctx := context.Background()
-	isMember, err := s.rdb.SIsMember(ctx, keyOnlineUsers, fmt.Sprintf("%d", userID)).Result()
+	isMember, err := s.rdb.SIsMember(ctx, onlineUsersKey(), onlineMember(userID)).Result()
 	if err != nil {
 		return false
 	}
 	return isMember
 }
 
+// onlineStatuses 批量检查用户是否在线，使用一次管道往返
+func (s *UserService) onlineStatuses(userIDs []uint) map[uint]bool {
+	ctx := context.Background()
+	pipe := s.rdb.Pipeline()
+	cmds := make(map[uint]*redis.BoolCmd, len(userIDs))
+	for _, userID := range userIDs {
+		cmds[userID] = pipe.SIsMember(ctx, onlineUsersKey(), onlineMember(userID))
+	}
+	pipe.Exec(ctx)
+
+	statuses := make(map[uint]bool, len(cmds))
+	for userID, cmd := range cmds {
+		statuses[userID] = cmd.Val()
+	}
+	return statuses
+}
+
+// userResponses 批量获取用户响应信息，不存在的用户不出现在结果中
+func (s *UserService) userResponses(userIDs []uint) (map[uint]models.UserResponse, error) {
+	responses := make(map[uint]models.UserResponse, len(userIDs))
+	if len(userIDs) == 0 {
+		return responses, nil
+	}
+
+	var users []models.User
+	for _, chunk := range chunkIDs(userIDs) {
+		var batch []models.User
+		if err := s.db.Where("id IN ?", chunk).Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		users = append(users, batch...)
+	}
+
+	online := s.onlineStatuses(userIDs)
+	for _, user := range users {
+		responses[user.ID] = models.UserResponse{
+			ID:       user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			Avatar:   AssetURL(user.Avatar),
+			Online:   online[user.ID],
+		}
+	}
+	return responses, nil
+}
+
 // UpdateUser 更新用户信息
 func (s *UserService) UpdateUser(id uint, username, email, avatar string) (*models.User, error) {
 	var user models.User
 	if err := s.db.First(&user, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("用户不存在")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -140,6 +209,9 @@ func (s *UserService) UpdateUser(id uint, username, email, avatar string) (*mode
 		user.Email = email
 	}
 	if avatar != "" {
+		if err := ValidateAvatarURL(avatar); err != nil {
+			return nil, err
+		}
 		user.Avatar = avatar
 	}
 
@@ -149,7 +221,7 @@ func (s *UserService) UpdateUser(id uint, username, email, avatar string) (*mode
 
 	// 删除缓存
 	ctx := context.Background()
-	key := fmt.Sprintf("user:%d", id)
+	key := userCacheKey(id)
 	s.rdb.Del(ctx, key)
 
 	return &user, nil
@@ -160,7 +232,7 @@ func (s *UserService) ChangePassword(id uint, oldPassword, newPassword string) e
 	var user models.User
 	if err := s.db.First(&user, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("用户不存在")
+			return ErrUserNotFound
 		}
 		return err
 	}
@@ -170,6 +242,11 @@ func (s *UserService) ChangePassword(id uint, oldPassword, newPassword string) e
 		return errors.New("旧密码错误")
 	}
 
+	// 校验新密码强度
+	if err := s.ValidatePassword(context.Background(), newPassword, user.Username); err != nil {
+		return err
+	}
+
 	// 哈希新密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -198,7 +275,7 @@ func (s *UserService) SearchUsers(query string) ([]models.UserResponse, error) {
 			ID:       user.ID,
 			Username: user.Username,
 			Email:    user.Email,
-			Avatar:   user.Avatar,
+			Avatar:   AssetURL(user.Avatar),
 			Online:   s.IsUserOnline(user.ID),
 		})
 	}
@@ -211,7 +288,7 @@ func (s *UserService) GetUserByID(id uint) (*models.User, error) {
 
 	// 先尝试从缓存获取
 	ctx := context.Background()
-	key := fmt.Sprintf("user:%d", id)
+	key := userCacheKey(id)
 
 	userJSON, err := s.rdb.Get(ctx, key).Result()
 	if err == nil {
@@ -224,7 +301,7 @@ func (s *UserService) GetUserByID(id uint) (*models.User, error) {
 	// 从数据库获取
 	if err := s.db.First(&user, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("用户不存在")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -236,13 +313,135 @@ func (s *UserService) GetUserByID(id uint) (*models.User, error) {
 	return &user, nil
 }
 
+// CheckCanPost 检查用户当前是否可以发送消息（未被禁言或封禁）
+func (s *UserService) CheckCanPost(userID uint) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.BannedAt != nil {
+		return ErrUserBanned
+	}
+	if user.MutedUntil != nil && user.MutedUntil.After(time.Now()) {
+		return ErrUserMuted
+	}
+	return nil
+}
+
+// CheckCanMessage 按接收者的隐私设置检查发送者能否向其发送私聊消息
+// 接收者曾私聊过发送者时总是允许，避免设置隐私后无法继续已有的会话
+func (s *UserService) CheckCanMessage(senderID, receiverID uint) error {
+	receiver, err := s.GetUserByID(receiverID)
+	if err != nil {
+		return err
+	}
+
+	switch receiver.MessagePrivacy {
+	case models.PrivacyContacts:
+		ok, err := s.isContact(receiverID, senderID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrMessagingNotAllowed
+		}
+	case models.PrivacyNobody:
+		ok, err := s.hasMessaged(receiverID, senderID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrMessagingNotAllowed
+		}
+	}
+	return nil
+}
+
+// isContact 判断 otherID 是否为 userID 的联系人：同在一个群组，或 userID 私聊过对方
+func (s *UserService) isContact(userID, otherID uint) (bool, error) {
+	var shared int64
+	if err := s.db.Table("group_members AS a").
+		Joins("JOIN group_members AS b ON a.group_id = b.group_id").
+		Where("a.user_id = ? AND b.user_id = ? AND a.deleted_at IS NULL AND b.deleted_at IS NULL", userID, otherID).
+		Count(&shared).Error; err != nil {
+		return false, err
+	}
+	if shared > 0 {
+		return true, nil
+	}
+	return s.hasMessaged(userID, otherID)
+}
+
+// hasMessaged 判断 userID 是否向 otherID 发送过私聊消息
+func (s *UserService) hasMessaged(userID, otherID uint) (bool, error) {
+	var ids []uint
+	if err := s.db.Model(&models.Message{}).
+		Where("sender_id = ? AND receiver_id = ? AND group_id = 0", userID, otherID).
+		Limit(1).Pluck("id", &ids).Error; err != nil {
+		return false, err
+	}
+	return len(ids) > 0, nil
+}
+
+// SetMessagePrivacy 更新用户的私聊隐私设置并清除缓存
+func (s *UserService) SetMessagePrivacy(userID uint, privacy models.MessagePrivacy) error {
+	res := s.db.Model(&models.User{}).Where("id = ?", userID).Update("message_privacy", privacy)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	ctx := context.Background()
+	s.rdb.Del(ctx, userCacheKey(userID))
+	return nil
+}
+
+// MuteUser 禁言用户至指定时间
+func (s *UserService) MuteUser(userID uint, until time.Time) error {
+	return s.updateModeration(userID, map[string]interface{}{"muted_until": until})
+}
+
+// BanUser 封禁用户，封禁后无法登录和发送消息
+func (s *UserService) BanUser(userID uint) error {
+	return s.updateModeration(userID, map[string]interface{}{"banned_at": time.Now()})
+}
+
+// updateModeration 更新用户处罚状态并清除缓存
+func (s *UserService) updateModeration(userID uint, updates map[string]interface{}) error {
+	res := s.db.Model(&models.User{}).Where("id = ?", userID).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	ctx := context.Background()
+	s.rdb.Del(ctx, userCacheKey(userID))
+	return nil
+}
+
+// GetUserByUsername 根据用户名获取用户
+func (s *UserService) GetUserByUsername(username string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
 // GetUserGroups 获取用户所在的群组
 func (s *UserService) GetUserGroups(userID uint) ([]models.Group, error) {
 	var groups []models.Group
 
 	// 先尝试从缓存获取
 	ctx := context.Background()
-	key := fmt.Sprintf("user:groups:%d", userID)
+	key := RedisKey("user:groups:%d", userID)
 
 	groupsJSON, err := s.rdb.Get(ctx, key).Result()
 	if err == nil {
@@ -253,8 +452,8 @@ func (s *UserService) GetUserGroups(userID uint) ([]models.Group, error) {
 	}
 
 	// 从数据库获取
-	if err := s.db.Table("groups").
-		Joins("JOIN group_members ON groups.id = group_members.group_id").
+	if err := s.db.Model(&models.Group{}).
+		Joins("JOIN group_members ON groups.id = group_members.group_id AND group_members.deleted_at IS NULL").
 		Where("group_members.user_id = ?", userID).
 		Find(&groups).Error; err != nil {
 		return nil, err
@@ -267,36 +466,38 @@ func (s *UserService) GetUserGroups(userID uint) ([]models.Group, error) {
 	return groups, nil
 }
 
-// GetOnlineUsers 获取在线用户列表
+// GetOnlineUsers 获取在线用户列表，按用户ID排序
+// 无法解析的成员或已不存在的用户跳过
 func (s *UserService) GetOnlineUsers() ([]models.UserResponse, error) {
 	ctx := context.Background()
 
 	// 从Redis获取在线用户ID列表
-	userIDs, err := s.rdb.SMembers(ctx, keyOnlineUsers).Result()
+	members, err := s.rdb.SMembers(ctx, onlineUsersKey()).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	onlineUsers := make([]models.UserResponse, 0, len(userIDs))
-
-	for _, idStr := range userIDs {
-		id, err := strconv.ParseUint(idStr, 10, 64)
-		if err != nil {
-			continue
+	userIDs := make([]uint, 0, len(members))
+	for _, member := range members {
+		if id, ok := parseOnlineMember(member); ok {
+			userIDs = append(userIDs, id)
 		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
 
-		user, err := s.GetUserByID(uint(id))
-		if err != nil {
+	responses, err := s.userResponses(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	onlineUsers := make([]models.UserResponse, 0, len(responses))
+	for _, id := range userIDs {
+		user, ok := responses[id]
+		if !ok {
 			continue
 		}
-
-		onlineUsers = append(onlineUsers, models.UserResponse{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Avatar:   user.Avatar,
-			Online:   true,
-		})
+		user.Online = true
+		onlineUsers = append(onlineUsers, user)
 	}
 
 	return onlineUsers, nil
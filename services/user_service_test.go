@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+func TestMessagePrivacyPolicies(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	groupmate := env.createUser(t, "groupmate")
+	replied := env.createUser(t, "replied")
+	stranger := env.createUser(t, "stranger")
+	env.createGroup(t, "g", alice, groupmate)
+	// alice 私聊过 replied
+	env.createMessage(t, models.Message{SenderID: alice.ID, ReceiverID: replied.ID, Content: "hi"})
+
+	send := func(sender *models.User) error {
+		return env.messages.ProcessMessage(&models.Message{
+			SenderID: sender.ID, ReceiverID: alice.ID, Type: models.PrivateMessage, Content: "hello",
+		})
+	}
+
+	tests := []struct {
+		privacy models.MessagePrivacy
+		allowed map[uint]bool
+	}{
+		{models.PrivacyEveryone, map[uint]bool{groupmate.ID: true, replied.ID: true, stranger.ID: true}},
+		{models.PrivacyContacts, map[uint]bool{groupmate.ID: true, replied.ID: true, stranger.ID: false}},
+		{models.PrivacyNobody, map[uint]bool{groupmate.ID: false, replied.ID: true, stranger.ID: false}},
+	}
+	for _, tt := range tests {
+		if err := env.users.SetMessagePrivacy(alice.ID, tt.privacy); err != nil {
+			t.Fatalf("设置隐私失败: %v", err)
+		}
+		for _, sender := range []*models.User{groupmate, replied, stranger} {
+			err := send(sender)
+			if tt.allowed[sender.ID] && err != nil {
+				t.Errorf("%s: %s 发送失败: %v", tt.privacy, sender.Username, err)
+			}
+			if !tt.allowed[sender.ID] && !errors.Is(err, ErrMessagingNotAllowed) {
+				t.Errorf("%s: %s 发送 = %v，期望 ErrMessagingNotAllowed", tt.privacy, sender.Username, err)
+			}
+		}
+	}
+
+	// 隐私设置不影响 alice 主动发起私聊
+	err := env.messages.ProcessMessage(&models.Message{
+		SenderID: alice.ID, ReceiverID: stranger.ID, Type: models.PrivateMessage, Content: "hi",
+	})
+	if err != nil {
+		t.Fatalf("alice 主动私聊失败: %v", err)
+	}
+	if err := env.users.SetMessagePrivacy(9999, models.PrivacyNobody); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("设置不存在的用户 = %v，期望 ErrUserNotFound", err)
+	}
+}
+
+func TestUserPreferences(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+	old := config.AppConfig.PreferencesMaxBytes
+	config.AppConfig.PreferencesMaxBytes = 64
+	t.Cleanup(func() { config.AppConfig.PreferencesMaxBytes = old })
+
+	prefs, err := env.users.GetPreferences(alice.ID)
+	if err != nil || string(prefs) != "{}" {
+		t.Fatalf("未设置时偏好 = %s, %v，期望 {}", prefs, err)
+	}
+
+	saved := `{"theme":"dark","lang":"zh"}`
+	if _, err := env.users.UpdatePreferences(alice.ID, []byte(saved)); err != nil {
+		t.Fatalf("保存偏好失败: %v", err)
+	}
+	// 保存后缓存失效，其他设备读取到新值；缓存清空后从数据库读取
+	for i := 0; i < 2; i++ {
+		prefs, err := env.users.GetPreferences(alice.ID)
+		if err != nil || string(prefs) != saved {
+			t.Fatalf("第%d次读取偏好 = %s, %v，期望 %s", i+1, prefs, err, saved)
+		}
+		env.mr.FlushAll()
+	}
+
+	invalid := []struct {
+		name  string
+		prefs string
+		want  error
+	}{
+		{"超出大小", `{"theme":"` + strings.Repeat("x", 64) + `"}`, ErrPreferencesTooLarge},
+		{"非法JSON", `{"theme":`, ErrInvalidPreferences},
+	}
+	for _, tt := range invalid {
+		if _, err := env.users.UpdatePreferences(alice.ID, []byte(tt.prefs)); !errors.Is(err, tt.want) {
+			t.Errorf("%s = %v，期望 %v", tt.name, err, tt.want)
+		}
+	}
+	if prefs, _ := env.users.GetPreferences(alice.ID); string(prefs) != saved {
+		t.Fatalf("拒绝后偏好 = %s，期望保持 %s", prefs, saved)
+	}
+	if _, err := env.users.UpdatePreferences(9999, []byte(saved)); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("不存在的用户 = %v，期望 ErrUserNotFound", err)
+	}
+}
+
+func TestGetOnlineUsers(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	env.createUser(t, "dave")
+
+	// 通过连接上线，与直接写入集合的成员一起返回；格式不合法或已不存在的用户跳过
+	for _, user := range []*models.User{carol, alice} {
+		if !m.RegisterClient(NewClient(user.ID, user.Username, newFakeConn())) {
+			t.Fatal("注册客户端失败")
+		}
+	}
+	env.rdb.SAdd(context.Background(), onlineUsersKey(), fmt.Sprint(bob.ID), "abc", "0", "9999")
+
+	users, err := env.users.GetOnlineUsers()
+	if err != nil {
+		t.Fatalf("获取在线用户失败: %v", err)
+	}
+	want := []uint{alice.ID, bob.ID, carol.ID}
+	if len(users) != len(want) {
+		t.Fatalf("在线用户 = %+v，期望 %v", users, want)
+	}
+	for i, user := range users {
+		if user.ID != want[i] || !user.Online {
+			t.Fatalf("在线用户 = %+v，期望 %v 且均在线", users, want)
+		}
+	}
+}
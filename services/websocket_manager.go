@@ -12,12 +12,6 @@ import (
 	"github.com/gorilla/websocket"
 
 	"chatroom/config"
-	"chatroom/models"
-)
-
-const (
-	// Redis键名
-	keyOnlineUsers = "online_users"
 )
 
 // WebSocketManager 管理WebSocket连接和消息分发
@@ -28,6 +22,9 @@ type WebSocketManager struct {
 	// 互斥锁保护clients map
 	mu sync.RWMutex
 
+	// 群组频道的本地订阅者 groupID -> clients，受mu保护
+	groupSubscribers map[uint]map[*Client]struct{}
+
 	// Redis客户端（用于缓存）
 	rdb *redis.Client
 
@@ -46,6 +43,17 @@ type WebSocketManager struct {
 	// 最大连接数
 	maxConnections int32
 
+	// 定向投递时发送缓冲已满的最长等待时间，超时后视为慢客户端断开
+	sendTimeout time.Duration
+
+	// 慢客户端指标：写超时断开次数、发送缓冲已满断开次数、当前慢连接数
+	writeTimeouts   int64
+	slowDisconnects int64
+	slowConnections int32
+
+	// 最近一次推送的负载信号 BackpressureEvent
+	backpressure atomic.Value
+
 	// 停止信号
 	stopCh chan struct{}
 }
@@ -60,14 +68,16 @@ func NewWebSocketManager(rdb *redis.Client, messageService *MessageService, user
 	}
 
 	return &WebSocketManager{
-		clients:        make(map[uint]*Client),
-		mu:             sync.RWMutex{},
-		rdb:            rdb,
-		kafka:          kafka,
-		messageService: messageService,
-		UserService:    userService,
-		maxConnections: int32(config.AppConfig.MaxConnections),
-		stopCh:         make(chan struct{}),
+		clients:          make(map[uint]*Client),
+		mu:               sync.RWMutex{},
+		groupSubscribers: make(map[uint]map[*Client]struct{}),
+		rdb:              rdb,
+		kafka:            kafka,
+		messageService:   messageService,
+		UserService:      userService,
+		maxConnections:   int32(config.AppConfig.MaxConnections),
+		sendTimeout:      time.Duration(config.AppConfig.WSSendTimeoutMs) * time.Millisecond,
+		stopCh:           make(chan struct{}),
 	}
 }
 
@@ -95,8 +105,8 @@ func (m *WebSocketManager) Run() {
 		log.Println("Kafka服务不可用，跳过消息主题订阅")
 	}
 
-	// 定期清理过期的连接
-	ticker := time.NewTicker(5 * time.Minute)
+	// 定期清理过期的连接（兜底，在线状态主要由读协程的pong超时维护）
+	ticker := time.NewTicker(cleanupInterval)
 	defer ticker.Stop()
 
 	for {
@@ -112,11 +122,22 @@ func (m *WebSocketManager) Run() {
 // Stop 停止WebSocket管理器
 func (m *WebSocketManager) Stop() {
 	close(m.stopCh)
+	m.closeAllClients(CloseServerShutdown, "服务器正在重启")
 	if m.kafka != nil {
 		m.kafka.Close()
 	}
 }
 
+// closeAllClients 以指定关闭码注销本节点上的所有连接，写协程发完缓冲中的消息后发送关闭帧
+func (m *WebSocketManager) closeAllClients(code int, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, client := range m.clients {
+		m.closeClientLocked(client, code, reason)
+	}
+}
+
 // RegisterClient 注册一个新的客户端
 func (m *WebSocketManager) RegisterClient(client *Client) bool {
 	// 检查连接数是否超过限制
@@ -128,18 +149,19 @@ func (m *WebSocketManager) RegisterClient(client *Client) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// 如果已存在相同用户ID的连接，先关闭旧连接
+	// 如果已存在相同用户ID的连接，先关闭旧连接（新连接接替其计数和在线状态）
 	if oldClient, exists := m.clients[client.ID]; exists {
-		close(oldClient.Send)
-		oldClient.Conn.Close()
+		m.dropGroupSubscriptionsLocked(oldClient)
+		oldClient.closeSendWith(CloseReplaced, "账号已在其他位置连接")
+	} else {
+		atomic.AddInt32(&m.connectionCount, 1)
 	}
 
 	m.clients[client.ID] = client
-	atomic.AddInt32(&m.connectionCount, 1)
 
 	// 将用户添加到在线用户集合
 	ctx := context.Background()
-	m.rdb.SAdd(ctx, keyOnlineUsers, client.ID)
+	m.rdb.SAdd(ctx, onlineUsersKey(), onlineMember(client.ID))
 
 	// 发布用户上线消息
 	m.publishUserStatus(client.ID, client.Username, true)
@@ -149,24 +171,82 @@ func (m *WebSocketManager) RegisterClient(client *Client) bool {
 }
 
 // UnregisterClient 注销一个客户端
+// 读协程在pong超时或连接断开时调用，立即清除在线状态
 func (m *WebSocketManager) UnregisterClient(client *Client) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.clients[client.ID]; ok {
-		delete(m.clients, client.ID)
-		close(client.Send)
-		atomic.AddInt32(&m.connectionCount, -1)
+	m.removeClientLocked(client)
+}
+
+// removeClientLocked 移除客户端并清除其在线状态，写协程以正常关闭码结束连接，调用方需持有写锁
+// 只有当前登记的连接才会被移除，避免旧连接注销时误删同一用户的新连接
+func (m *WebSocketManager) removeClientLocked(client *Client) bool {
+	return m.closeClientLocked(client, websocket.CloseNormalClosure, "")
+}
+
+// closeClientLocked 以指定关闭码移除客户端，关闭帧统一由写协程在发完缓冲中的消息后发出，调用方需持有写锁
+func (m *WebSocketManager) closeClientLocked(client *Client, code int, reason string) bool {
+	current, ok := m.clients[client.ID]
+	if !ok || current != client {
+		return false
+	}
+
+	delete(m.clients, client.ID)
+	m.dropGroupSubscriptionsLocked(client)
+	client.closeSendWith(code, reason)
+	atomic.AddInt32(&m.connectionCount, -1)
+
+	// 将用户从在线用户集合中移除，并记录离线时间（邮件摘要据此判断离线时长）
+	ctx := context.Background()
+	m.rdb.SRem(ctx, onlineUsersKey(), onlineMember(client.ID))
+	go m.UserService.UpdateUserLastSeen(client.ID)
 
-		// 将用户从在线用户集合中移除
-		ctx := context.Background()
-		m.rdb.SRem(ctx, keyOnlineUsers, client.ID)
+	// 发布用户下线消息
+	m.publishUserStatus(client.ID, client.Username, false)
 
-		// 发布用户下线消息
-		m.publishUserStatus(client.ID, client.Username, false)
+	log.Printf("客户端已断开连接: %s (ID: %d), 当前连接数: %d", client.Username, client.ID, atomic.LoadInt32(&m.connectionCount))
+	return true
+}
 
-		log.Printf("客户端已断开连接: %s (ID: %d), 当前连接数: %d", client.Username, client.ID, atomic.LoadInt32(&m.connectionCount))
+// DisconnectSession 断开属于指定会话的本地连接
+// 其他节点上的连接在令牌被拒绝后无法重连，心跳超时后自然断开
+func (m *WebSocketManager) DisconnectSession(userID uint, sessionID string) {
+	m.mu.Lock()
+	client, ok := m.clients[userID]
+	if ok && client.SessionID == sessionID {
+		m.closeClientLocked(client, CloseSessionRevoked, "会话已注销")
+	}
+	m.mu.Unlock()
+}
+
+// DisconnectUser 强制断开用户在本节点上的连接并清除其在线状态，返回是否断开了连接
+// 用户不在本节点时同样从在线集合中移除
+func (m *WebSocketManager) DisconnectUser(userID uint, reason string) bool {
+	if reason == "" {
+		reason = "已被管理员断开连接"
+	}
+
+	m.mu.Lock()
+	client, ok := m.clients[userID]
+	removed := ok && m.closeClientLocked(client, CloseForcedDisconnect, reason)
+	m.mu.Unlock()
+
+	if !removed {
+		m.rdb.SRem(context.Background(), onlineUsersKey(), onlineMember(userID))
 	}
+	return removed
+}
+
+// BanConnections 在指定时长内禁止用户建立WebSocket连接
+func (m *WebSocketManager) BanConnections(userID uint, duration time.Duration) error {
+	return m.rdb.Set(context.Background(), connectBanKey(userID), 1, duration).Err()
+}
+
+// IsConnectBanned 判断用户当前是否被禁止建立连接，Redis出错时放行
+func (m *WebSocketManager) IsConnectBanned(userID uint) bool {
+	n, err := m.rdb.Exists(context.Background(), connectBanKey(userID)).Result()
+	return err == nil && n > 0
 }
 
 // SendToUser 发送消息给特定用户
@@ -175,27 +255,22 @@ func (m *WebSocketManager) SendToUser(userID uint, message []byte) bool {
 	client, exists := m.clients[userID]
 	m.mu.RUnlock()
 
-	if exists {
-		select {
-		case client.Send <- message:
-			return true
-		default:
-			// 如果客户端的发送缓冲区已满，关闭连接
-			m.mu.Lock()
-			delete(m.clients, userID)
-			close(client.Send)
-			atomic.AddInt32(&m.connectionCount, -1)
-			m.mu.Unlock()
-			return false
-		}
+	if !exists {
+		return false
 	}
-	return false
+	if !client.sendWithin(message, m.sendTimeout) {
+		// 发送缓冲区在等待后仍然已满，关闭连接（已注销的客户端不受影响）
+		m.dropSlowClient(client)
+		return false
+	}
+	m.notifyDelivered(userID, message)
+	return true
 }
 
 // PublishMessage 发布消息到Kafka
-func (m *WebSocketManager) PublishMessage(ctx context.Context, msgType string, message []byte, receiverID, groupID uint) {
+func (m *WebSocketManager) PublishMessage(ctx context.Context, msgType string, message []byte, senderID, receiverID, groupID uint) {
 	if m.kafka != nil {
-		err := m.kafka.PublishChatMessage(msgType, message, receiverID, groupID)
+		err := m.kafka.PublishChatMessage(msgType, message, senderID, receiverID, groupID)
 		if err != nil {
 			log.Printf("发布消息失败: %v", err)
 		}
@@ -219,18 +294,15 @@ func (m *WebSocketManager) SubscribeToUserChannel(userID uint) {
 		client, exists := m.clients[userID]
 		m.mu.RUnlock()
 
-		if exists {
-			select {
-			case client.Send <- message:
-			default:
-				// 如果发送缓冲区已满，关闭连接
-				m.mu.Lock()
-				delete(m.clients, userID)
-				close(client.Send)
-				atomic.AddInt32(&m.connectionCount, -1)
-				m.mu.Unlock()
-			}
+		if !exists {
+			return
+		}
+		if !client.sendWithin(message, m.sendTimeout) {
+			// 发送缓冲区在等待后仍然已满，关闭连接
+			m.dropSlowClient(client)
+			return
 		}
+		m.notifyDelivered(userID, message)
 	})
 
 	if err != nil {
@@ -238,48 +310,43 @@ func (m *WebSocketManager) SubscribeToUserChannel(userID uint) {
 	}
 }
 
-// SubscribeToGroupChannel 订阅群组频道
-func (m *WebSocketManager) SubscribeToGroupChannel(userID, groupID uint) {
+// UnsubscribeFromGroupChannel 取消订阅群组频道
+func (m *WebSocketManager) UnsubscribeFromGroupChannel(groupID uint) {
 	if m.kafka == nil {
-		log.Printf("Kafka不可用，跳过群组频道订阅: 用户%d, 群组%d", userID, groupID)
 		return
 	}
+	m.kafka.UnsubscribeTopic(m.kafka.BuildTopicName("group", groupID))
+}
 
-	topic := m.kafka.BuildTopicName("group", groupID)
-
-	err := m.kafka.SubscribeTopic(topic, func(message []byte) {
-		// 查找用户的客户端连接
-		m.mu.RLock()
-		client, exists := m.clients[userID]
-		m.mu.RUnlock()
+// HandleGroupDisbanded 群组解散后取消订阅，并通知本节点上的在线成员
+func (m *WebSocketManager) HandleGroupDisbanded(groupID uint, memberIDs []uint) {
+	m.mu.Lock()
+	for client := range m.groupSubscribers[groupID] {
+		delete(client.groups, groupID)
+	}
+	delete(m.groupSubscribers, groupID)
+	m.mu.Unlock()
+	m.UnsubscribeFromGroupChannel(groupID)
 
-		if exists {
-			select {
-			case client.Send <- message:
-			default:
-				// 如果发送缓冲区已满，跳过
-			}
-		}
-	})
+	wsMsgJSON := newWSEvent("group_disbanded", struct {
+		GroupID uint `json:"group_id"`
+	}{GroupID: groupID})
 
-	if err != nil {
-		log.Printf("订阅群组主题失败: %v", err)
+	for _, memberID := range memberIDs {
+		m.SendToUser(memberID, wsMsgJSON)
 	}
 }
 
-// broadcastToAll 广播消息给所有连接的客户端
+// broadcastToAll 广播消息给所有连接的客户端，发送缓冲区已满的客户端跳过
 func (m *WebSocketManager) broadcastToAll(message []byte) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
-
+	clients := make([]*Client, 0, len(m.clients))
 	for _, client := range m.clients {
-		select {
-		case client.Send <- message:
-		default:
-			// 如果客户端的发送缓冲区已满，跳过
-			continue
-		}
+		clients = append(clients, client)
 	}
+	m.mu.RUnlock()
+
+	m.fanOut(clients, message)
 }
 
 // publishUserStatus 发布用户状态变更消息
@@ -300,14 +367,7 @@ func (m *WebSocketManager) publishUserStatus(userID uint, username string, onlin
 	}
 
 	statusJSON, _ := json.Marshal(statusMsg)
-
-	wsMsg := WebSocketMessage{
-		Type:      "user_status",
-		Content:   statusJSON,
-		Timestamp: time.Now(),
-	}
-
-	msgJSON, _ := json.Marshal(wsMsg)
+	msgJSON, _ := NewEnvelope("user_status", statusJSON)
 
 	// 发布到Kafka
 	if m.kafka != nil {
@@ -323,56 +383,62 @@ func (m *WebSocketManager) handleUserStatusUpdate(message []byte) {
 	m.broadcastToAll(message)
 }
 
-// GetOnlineUsers 获取在线用户列表
-func (m *WebSocketManager) GetOnlineUsers() []models.UserResponse {
-	ctx := context.Background()
-	userIDs, err := m.rdb.SMembers(ctx, keyOnlineUsers).Result()
-	if err != nil {
-		log.Printf("获取在线用户失败: %v", err)
-		return []models.UserResponse{}
-	}
-
-	onlineUsers := make([]models.UserResponse, 0, len(userIDs))
-	for _, idStr := range userIDs {
-		var id uint
-		json.Unmarshal([]byte(idStr), &id)
-
-		// 从数据库获取用户信息
-		user, err := m.UserService.GetUserByID(id)
-		if err != nil {
-			continue
-		}
-
-		onlineUsers = append(onlineUsers, models.UserResponse{
-			ID:       user.ID,
-			Username: user.Username,
-			Online:   true,
-		})
-	}
-
-	return onlineUsers
-}
-
 // cleanupExpiredConnections 清理过期的连接
+// 正常情况下读协程会在pong超时后注销连接，这里仅作为兜底
 func (m *WebSocketManager) cleanupExpiredConnections() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	for userID, client := range m.clients {
 		// 检查连接是否已关闭
-		if err := client.Conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(time.Second)); err != nil {
+		if err := client.Conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(writeWait)); err != nil {
 			log.Printf("检测到过期连接: %d, 错误: %v", userID, err)
-			delete(m.clients, userID)
-			close(client.Send)
-			atomic.AddInt32(&m.connectionCount, -1)
-
-			// 将用户从在线用户集合中移除
-			ctx := context.Background()
-			m.rdb.SRem(ctx, keyOnlineUsers, userID)
+			m.removeClientLocked(client)
 		}
 	}
 }
 
+// dropSlowClient 断开发送缓冲已满的客户端，并在关闭帧中说明原因
+func (m *WebSocketManager) dropSlowClient(client *Client) {
+	m.mu.Lock()
+	removed := m.closeClientLocked(client, CloseSlowClient, "发送缓冲已满")
+	m.mu.Unlock()
+	if !removed {
+		return
+	}
+
+	atomic.AddInt64(&m.slowDisconnects, 1)
+	log.Printf("客户端发送缓冲已满，断开连接: %s (ID: %d)", client.Username, client.ID)
+}
+
+// recordWriteTimeout 记录一次写超时断开
+func (m *WebSocketManager) recordWriteTimeout() {
+	atomic.AddInt64(&m.writeTimeouts, 1)
+}
+
+// setClientSlow 更新客户端的慢连接状态，仅由该客户端的写协程调用
+func (m *WebSocketManager) setClientSlow(client *Client, slow bool) {
+	if client.slow == slow {
+		return
+	}
+	client.slow = slow
+	if slow {
+		atomic.AddInt32(&m.slowConnections, 1)
+		log.Printf("检测到慢连接: %s (ID: %d)", client.Username, client.ID)
+	} else {
+		atomic.AddInt32(&m.slowConnections, -1)
+	}
+}
+
+// GetSlowClientMetrics 获取慢客户端指标
+func (m *WebSocketManager) GetSlowClientMetrics() map[string]int64 {
+	return map[string]int64{
+		"write_timeouts":   atomic.LoadInt64(&m.writeTimeouts),
+		"slow_disconnects": atomic.LoadInt64(&m.slowDisconnects),
+		"slow_connections": int64(atomic.LoadInt32(&m.slowConnections)),
+	}
+}
+
 // GetConnectionCount 获取当前连接数
 func (m *WebSocketManager) GetConnectionCount() int32 {
 	return atomic.LoadInt32(&m.connectionCount)
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+// assertSingleClose 检查连接上只写出了一个关闭帧且关闭码符合预期
+func assertSingleClose(t *testing.T, conn *fakeConn, want int) {
+	t.Helper()
+	codes := conn.closeCodes()
+	if len(codes) != 1 || codes[0] != want {
+		t.Fatalf("关闭帧 %v，期望只有一个 %d", codes, want)
+	}
+}
+
+func TestDisconnectSessionCloseCode(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+
+	client, conn, done := connectClient(t, m, alice)
+	client.SessionID = "s1"
+	m.DisconnectSession(alice.ID, "s2")
+	if m.GetConnectionCount() != 1 {
+		t.Fatal("其他会话的注销不应断开连接")
+	}
+
+	m.DisconnectSession(alice.ID, "s1")
+	waitClosed(t, done)
+	assertSingleClose(t, conn, CloseSessionRevoked)
+}
+
+func TestDisconnectUserCloseCode(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+
+	_, conn, done := connectClient(t, m, alice)
+	if !m.DisconnectUser(alice.ID, "") {
+		t.Fatal("应断开本节点上的连接")
+	}
+	waitClosed(t, done)
+	assertSingleClose(t, conn, CloseForcedDisconnect)
+}
+
+func TestDisconnectUserClearsPresence(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	_, conn, done := connectClient(t, m, alice)
+	if !env.users.IsUserOnline(alice.ID) {
+		t.Fatal("连接后应在线")
+	}
+
+	if err := m.BanConnections(alice.ID, time.Minute); err != nil {
+		t.Fatalf("设置连接禁止失败: %v", err)
+	}
+	if !m.DisconnectUser(alice.ID, "违规刷屏") {
+		t.Fatal("应断开本节点上的连接")
+	}
+	waitClosed(t, done)
+
+	// 关闭帧携带原因，在线状态清除，禁止期内不能重连
+	assertSingleClose(t, conn, CloseForcedDisconnect)
+	if frame := conn.lastFrame(); !strings.Contains(string(frame.data), "违规刷屏") {
+		t.Fatalf("关闭帧 %q 未包含断开原因", frame.data)
+	}
+	if env.users.IsUserOnline(alice.ID) {
+		t.Fatal("断开后仍在线")
+	}
+	if m.GetConnectionCount() != 0 {
+		t.Fatalf("连接数 = %d，期望 0", m.GetConnectionCount())
+	}
+	if !m.IsConnectBanned(alice.ID) || m.IsConnectBanned(bob.ID) {
+		t.Fatal("只有被断开的用户应被禁止重连")
+	}
+	env.mr.FastForward(time.Minute)
+	if m.IsConnectBanned(alice.ID) {
+		t.Fatal("禁止期结束后应允许重连")
+	}
+
+	// 用户不在本节点时同样清除在线状态
+	env.rdb.SAdd(context.Background(), onlineUsersKey(), onlineMember(bob.ID))
+	if m.DisconnectUser(bob.ID, "") {
+		t.Fatal("不在本节点的用户不应报告已断开")
+	}
+	if env.users.IsUserOnline(bob.ID) {
+		t.Fatal("不在本节点的用户在线状态未清除")
+	}
+}
+
+func TestDropSlowClientCloseCode(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+
+	client, conn, done := connectClient(t, m, alice)
+	m.dropSlowClient(client)
+	waitClosed(t, done)
+	assertSingleClose(t, conn, CloseSlowClient)
+}
+
+func TestReplacedConnectionCloseCode(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+
+	_, oldConn, oldDone := connectClient(t, m, alice)
+	_, newConn, _ := connectClient(t, m, alice)
+	waitClosed(t, oldDone)
+	assertSingleClose(t, oldConn, CloseReplaced)
+	if codes := newConn.closeCodes(); len(codes) != 0 {
+		t.Fatalf("新连接不应被关闭: %v", codes)
+	}
+}
+
+func TestUnregisterClientNormalClose(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+
+	client, conn, done := connectClient(t, m, alice)
+	m.UnregisterClient(client)
+	waitClosed(t, done)
+	assertSingleClose(t, conn, websocket.CloseNormalClosure)
+}
+
+func TestDroppedConnectionClearsPresence(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+
+	client, conn, done := connectClient(t, m, alice)
+	readDone := make(chan struct{})
+	go func() {
+		client.ReadPump(m, env.messages)
+		close(readDone)
+	}()
+	if !env.users.IsUserOnline(alice.ID) {
+		t.Fatal("连接后应为在线状态")
+	}
+
+	// 读超时不超过一个pong等待周期，收到pong后顺延
+	var deadline time.Time
+	for i := 0; i < 100 && deadline.IsZero(); i++ {
+		time.Sleep(time.Millisecond)
+		deadline = conn.getReadDeadline()
+	}
+	if deadline.IsZero() || time.Until(deadline) > pongWait {
+		t.Fatalf("读超时 %v 超过 pongWait", time.Until(deadline))
+	}
+	time.Sleep(5 * time.Millisecond)
+	conn.pong()
+	if !conn.getReadDeadline().After(deadline) {
+		t.Fatal("收到pong后读超时未顺延")
+	}
+
+	// 对端失联：读超时到期后读协程立即注销连接并清除在线状态
+	conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	select {
+	case <-readDone:
+	case <-time.After(time.Second):
+		t.Fatal("读超时后读协程未退出")
+	}
+	waitClosed(t, done)
+	if env.users.IsUserOnline(alice.ID) {
+		t.Fatal("连接断开后仍为在线状态")
+	}
+	if m.GetConnectionCount() != 0 {
+		t.Fatalf("连接数 = %d，期望 0", m.GetConnectionCount())
+	}
+}
+
+func TestWriteTimeoutCounted(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+
+	client, conn, done := connectClient(t, m, alice)
+	conn.stall()
+	client.Send <- []byte(`{"type":"chat_message"}`)
+
+	// 写超时断开连接，关闭帧说明原因并计入指标
+	waitClosed(t, done)
+	assertSingleClose(t, conn, CloseSlowClient)
+	if got := m.GetSlowClientMetrics()["write_timeouts"]; got != 1 {
+		t.Fatalf("write_timeouts = %d，期望 1", got)
+	}
+	if got := m.GetSlowClientMetrics()["slow_connections"]; got != 0 {
+		t.Fatalf("断开后 slow_connections = %d，期望 0", got)
+	}
+}
+
+func TestSlowClientMetrics(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	slow := NewClient(alice.ID, alice.Username, newFakeConn())
+	m.setClientSlow(slow, true)
+	m.setClientSlow(slow, true)
+	if got := m.GetSlowClientMetrics()["slow_connections"]; got != 1 {
+		t.Fatalf("slow_connections = %d，期望 1", got)
+	}
+	m.setClientSlow(slow, false)
+	if got := m.GetSlowClientMetrics()["slow_connections"]; got != 0 {
+		t.Fatalf("恢复后 slow_connections = %d，期望 0", got)
+	}
+
+	// 发送缓冲已满断开计入 slow_disconnects，重复断开只计一次
+	client, _, done := connectClient(t, m, bob)
+	m.dropSlowClient(client)
+	m.dropSlowClient(client)
+	waitClosed(t, done)
+	if got := m.GetSlowClientMetrics()["slow_disconnects"]; got != 1 {
+		t.Fatalf("slow_disconnects = %d，期望 1", got)
+	}
+}
+
+func TestSendToUserWaitsForBriefBursts(t *testing.T) {
+	oldBuffer := config.AppConfig.WSSendBufferSize
+	config.AppConfig.WSSendBufferSize = 1
+	t.Cleanup(func() { config.AppConfig.WSSendBufferSize = oldBuffer })
+
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	m.sendTimeout = 200 * time.Millisecond
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+
+	register := func(user *models.User) *Client {
+		t.Helper()
+		client := NewClient(user.ID, user.Username, newFakeConn())
+		if !m.RegisterClient(client) {
+			t.Fatal("注册客户端失败")
+		}
+		client.Send <- []byte("burst")
+		return client
+	}
+	connected := func(userID uint) bool {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		_, ok := m.clients[userID]
+		return ok
+	}
+
+	// 缓冲短暂写满，等待期间写协程腾出空间即可送达
+	brief := register(alice)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-brief.Send
+	}()
+	if !m.SendToUser(alice.ID, []byte("hello")) {
+		t.Fatal("短暂写满的客户端应在等待后送达")
+	}
+	if !connected(alice.ID) {
+		t.Fatal("短暂写满的客户端不应被断开")
+	}
+
+	// 缓冲一直写满，等待超时后断开
+	register(bob)
+	start := time.Now()
+	if m.SendToUser(bob.ID, []byte("hello")) {
+		t.Fatal("卡住的客户端不应送达")
+	}
+	if elapsed := time.Since(start); elapsed < m.sendTimeout {
+		t.Fatalf("等待 %v 后放弃，期望至少等待 %v", elapsed, m.sendTimeout)
+	}
+	if connected(bob.ID) {
+		t.Fatal("卡住的客户端应被断开")
+	}
+	if got := atomic.LoadInt64(&m.slowDisconnects); got != 1 {
+		t.Fatalf("慢客户端断开次数 = %d，期望 1", got)
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrWorkersShutdownTimeout 后台任务未能在关闭超时内退出
+var ErrWorkersShutdownTimeout = errors.New("后台任务未能在超时时间内退出")
+
+// Workers 管理后台任务（如发件箱中继）的生命周期
+// 所有任务共享同一个context，关闭时统一取消并等待全部任务退出
+type Workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWorkers 创建后台任务管理器
+func NewWorkers() *Workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Workers{ctx: ctx, cancel: cancel}
+}
+
+// Go 启动一个后台任务，任务需在ctx取消后尽快返回
+func (w *Workers) Go(name string, run func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		run(w.ctx)
+		log.Printf("后台任务已退出: %s", name)
+	}()
+}
+
+// Shutdown 取消所有后台任务并等待其退出，超过timeout仍未退出时返回错误
+func (w *Workers) Shutdown(timeout time.Duration) error {
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return ErrWorkersShutdownTimeout
+	}
+}
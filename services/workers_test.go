@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkersStopWithinTimeout(t *testing.T) {
+	env := newTestEnv(t)
+	workers := NewWorkers()
+
+	var stopped int32
+	for i := 0; i < 3; i++ {
+		workers.Go("ticker", func(ctx context.Context) {
+			ticker := time.NewTicker(time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					atomic.AddInt32(&stopped, 1)
+					return
+				case <-ticker.C:
+				}
+			}
+		})
+	}
+	// 真实的后台任务同样响应取消
+	workers.Go("outbox-relay", env.messages.RunOutboxRelay)
+
+	start := time.Now()
+	if err := workers.Shutdown(time.Second); err != nil {
+		t.Fatalf("关闭后台任务失败: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("关闭耗时 %v，超过超时时间", elapsed)
+	}
+	if got := atomic.LoadInt32(&stopped); got != 3 {
+		t.Fatalf("已退出任务数 = %d，期望 3", got)
+	}
+}
+
+func TestWorkersShutdownTimeout(t *testing.T) {
+	workers := NewWorkers()
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	// 不响应取消的任务导致关闭超时
+	workers.Go("stuck", func(ctx context.Context) { <-release })
+	if err := workers.Shutdown(20 * time.Millisecond); !errors.Is(err, ErrWorkersShutdownTimeout) {
+		t.Fatalf("关闭 = %v，期望 ErrWorkersShutdownTimeout", err)
+	}
+}
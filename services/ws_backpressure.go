@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"chatroom/config"
+)
+
+// 负载等级，通过 backpressure 事件推送给客户端
+const (
+	BackpressureNormal   = "normal"   // 正常
+	BackpressureElevated = "elevated" // 负载偏高，客户端应降低输入状态等非必要事件的频率
+	BackpressureHigh     = "high"     // 接近过载，客户端应合并发送并暂停非必要事件
+)
+
+const (
+	// 负载达到该比例时升级为 elevated / high
+	backpressureElevatedLoad = 0.7
+	backpressureHighLoad     = 0.9
+
+	// backpressureHysteresis 负载降到阈值以下这么多才降级，避免在阈值附近反复推送
+	backpressureHysteresis = 0.1
+)
+
+// BackpressureEvent 本节点的负载信号
+// load 为连接数占比、发送缓冲平均占用率、Kafka消费积压占比中的最大值（0~1），reason 为取到最大值的指标
+type BackpressureEvent struct {
+	Level  string  `json:"level"`
+	Load   float64 `json:"load"`
+	Reason string  `json:"reason,omitempty"` // connections、send_buffers 或 kafka_lag
+}
+
+// RunBackpressureMonitor 按 BACKPRESSURE_INTERVAL_SECONDS 间隔计算本节点负载，
+// 负载等级变化时向本节点的所有连接推送 backpressure 事件，ctx取消后退出
+func (m *WebSocketManager) RunBackpressureMonitor(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(config.AppConfig.BackpressureIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.updateBackpressure(m.measureLoad())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// updateBackpressure 根据最新负载更新负载等级，等级变化时广播给本节点的连接
+func (m *WebSocketManager) updateBackpressure(event BackpressureEvent) {
+	current := m.currentBackpressure()
+	event.Level = nextBackpressureLevel(current.Level, event.Load)
+	if event.Level == current.Level {
+		return
+	}
+
+	m.backpressure.Store(event)
+	log.Printf("负载等级变化: %s -> %s (load=%.2f, reason=%s)", current.Level, event.Level, event.Load, event.Reason)
+	m.broadcastToAll(newWSEvent("backpressure", event))
+}
+
+// SendBackpressureState 向新连接推送当前的负载信号，负载正常时不发送
+func (m *WebSocketManager) SendBackpressureState(client *Client) {
+	if event := m.currentBackpressure(); event.Level != BackpressureNormal {
+		client.trySend(newWSEvent("backpressure", event))
+	}
+}
+
+// currentBackpressure 返回最近一次推送的负载信号
+func (m *WebSocketManager) currentBackpressure() BackpressureEvent {
+	if event, ok := m.backpressure.Load().(BackpressureEvent); ok {
+		return event
+	}
+	return BackpressureEvent{Level: BackpressureNormal}
+}
+
+// measureLoad 计算本节点当前的负载
+func (m *WebSocketManager) measureLoad() BackpressureEvent {
+	var event BackpressureEvent
+	consider := func(load float64, reason string) {
+		if load > event.Load {
+			event.Load, event.Reason = load, reason
+		}
+	}
+
+	if m.maxConnections > 0 {
+		consider(float64(atomic.LoadInt32(&m.connectionCount))/float64(m.maxConnections), "connections")
+	}
+	consider(m.sendBufferFill(), "send_buffers")
+	if m.kafka != nil {
+		consider(float64(m.kafka.ConsumerLag())/float64(config.AppConfig.BackpressureKafkaLag), "kafka_lag")
+	}
+
+	event.Load = math.Round(math.Min(event.Load, 1)*100) / 100
+	return event
+}
+
+// sendBufferFill 返回本节点所有连接发送缓冲的平均占用率
+func (m *WebSocketManager) sendBufferFill() float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var total float64
+	n := 0
+	for _, client := range m.clients {
+		if capacity := cap(client.Send); capacity > 0 {
+			total += float64(len(client.Send)) / float64(capacity)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / float64(n)
+}
+
+// nextBackpressureLevel 根据当前等级和负载计算新的等级，降级需要负载低于阈值 backpressureHysteresis
+func nextBackpressureLevel(current string, load float64) string {
+	switch {
+	case load >= backpressureHighLoad,
+		current == BackpressureHigh && load > backpressureHighLoad-backpressureHysteresis:
+		return BackpressureHigh
+	case load >= backpressureElevatedLoad,
+		current != BackpressureNormal && load > backpressureElevatedLoad-backpressureHysteresis:
+		return BackpressureElevated
+	default:
+		return BackpressureNormal
+	}
+}
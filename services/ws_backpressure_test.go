@@ -0,0 +1,142 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// backpressureEvents 取出客户端发送缓冲中排队的 backpressure 事件
+func backpressureEvents(t *testing.T, client *Client) []BackpressureEvent {
+	t.Helper()
+	var events []BackpressureEvent
+	for {
+		select {
+		case frame := <-client.Send:
+			var msg WebSocketMessage
+			if json.Unmarshal(frame, &msg) != nil || msg.Type != "backpressure" {
+				continue
+			}
+			var event BackpressureEvent
+			if err := json.Unmarshal(msg.Content, &event); err != nil {
+				t.Fatalf("解析负载信号失败: %v", err)
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestNextBackpressureLevel(t *testing.T) {
+	tests := []struct {
+		current string
+		load    float64
+		want    string
+	}{
+		{BackpressureNormal, 0.5, BackpressureNormal},
+		{BackpressureNormal, 0.7, BackpressureElevated},
+		{BackpressureNormal, 0.95, BackpressureHigh},
+		{BackpressureElevated, 0.65, BackpressureElevated},
+		{BackpressureElevated, 0.6, BackpressureNormal},
+		{BackpressureHigh, 0.85, BackpressureHigh},
+		{BackpressureHigh, 0.8, BackpressureElevated},
+		{BackpressureHigh, 0.3, BackpressureNormal},
+	}
+	for _, tt := range tests {
+		if got := nextBackpressureLevel(tt.current, tt.load); got != tt.want {
+			t.Errorf("nextBackpressureLevel(%s, %.2f) = %s，期望 %s", tt.current, tt.load, got, tt.want)
+		}
+	}
+}
+
+func TestBackpressureBroadcastOnLevelChange(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	clients := []*Client{NewClient(alice.ID, alice.Username, newFakeConn()), NewClient(bob.ID, bob.Username, newFakeConn())}
+	for _, client := range clients {
+		if !m.RegisterClient(client) {
+			t.Fatal("注册客户端失败")
+		}
+		backpressureEvents(t, client)
+	}
+	expect := func(step string, want ...string) {
+		t.Helper()
+		for _, client := range clients {
+			events := backpressureEvents(t, client)
+			if len(events) != len(want) {
+				t.Fatalf("%s: 用户%d收到负载信号 %+v，期望 %v", step, client.ID, events, want)
+			}
+			for i, event := range events {
+				if event.Level != want[i] {
+					t.Fatalf("%s: 用户%d收到负载信号 %+v，期望 %v", step, client.ID, events, want)
+				}
+			}
+		}
+	}
+
+	m.updateBackpressure(BackpressureEvent{Load: 0.5, Reason: "connections"})
+	expect("负载正常")
+
+	// 越过阈值时推送，等级不变时不重复推送
+	m.updateBackpressure(BackpressureEvent{Load: 0.75, Reason: "send_buffers"})
+	expect("越过 elevated 阈值", BackpressureElevated)
+	m.updateBackpressure(BackpressureEvent{Load: 0.65, Reason: "send_buffers"})
+	expect("阈值附近波动")
+	m.updateBackpressure(BackpressureEvent{Load: 0.95, Reason: "kafka_lag"})
+	expect("越过 high 阈值", BackpressureHigh)
+
+	// 新连接立即收到当前的负载信号
+	carol := env.createUser(t, "carol")
+	late := NewClient(carol.ID, carol.Username, newFakeConn())
+	m.SendBackpressureState(late)
+	if events := backpressureEvents(t, late); len(events) != 1 || events[0].Level != BackpressureHigh || events[0].Reason != "kafka_lag" {
+		t.Fatalf("新连接收到负载信号 %+v，期望 high", events)
+	}
+
+	m.updateBackpressure(BackpressureEvent{Load: 0.2})
+	expect("负载恢复", BackpressureNormal)
+	m.SendBackpressureState(late)
+	if events := backpressureEvents(t, late); len(events) != 0 {
+		t.Fatalf("负载正常时新连接收到 %+v", events)
+	}
+}
+
+func TestMeasureLoad(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice")
+
+	// 连接数占比
+	m := newTestManager(env)
+	m.maxConnections = 4
+	client := NewClient(alice.ID, alice.Username, newFakeConn())
+	if !m.RegisterClient(client) {
+		t.Fatal("注册客户端失败")
+	}
+	for len(client.Send) > 0 {
+		<-client.Send
+	}
+	if event := m.measureLoad(); event.Load != 0.25 || event.Reason != "connections" {
+		t.Fatalf("负载 = %+v，期望 connections 0.25", event)
+	}
+
+	// 发送缓冲占用率
+	for len(client.Send) < cap(client.Send)*3/4 {
+		client.Send <- []byte("x")
+	}
+	if event := m.measureLoad(); event.Load != 0.75 || event.Reason != "send_buffers" {
+		t.Fatalf("负载 = %+v，期望 send_buffers 0.75", event)
+	}
+
+	// Kafka消费积压，超过满负载积压时按1计算
+	m.kafka = newTestKafka(nil)
+	m.kafka.recordLag("t", 0, 9001, 0)
+	if event := m.measureLoad(); event.Load != 0.9 || event.Reason != "kafka_lag" {
+		t.Fatalf("负载 = %+v，期望 kafka_lag 0.9", event)
+	}
+	m.kafka.recordLag("t", 1, 50000, 0)
+	if event := m.measureLoad(); event.Load != 1 || event.Reason != "kafka_lag" {
+		t.Fatalf("负载 = %+v，期望 kafka_lag 1", event)
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// WebSocket子协议，客户端通过 Sec-WebSocket-Protocol 请求头协商消息编码，未协商时使用JSON
+const (
+	WSProtocolJSON    = "json"
+	WSProtocolMsgpack = "msgpack"
+)
+
+// WSCodec WebSocket消息编码
+// 服务端内部统一以JSON构建消息，扇出时同一份数据共享给所有连接，由每个连接的编码在写出前转换，
+// 读取时再转换回JSON交给 parseWSMessage
+type WSCodec interface {
+	// Protocol 返回编码对应的子协议名
+	Protocol() string
+	// FrameType 返回写出消息使用的帧类型
+	FrameType() int
+	// Batchable 返回多条消息能否以换行分隔合并到同一帧
+	Batchable() bool
+	// Encode 将JSON消息转换为写出的帧内容
+	Encode(message []byte) ([]byte, error)
+	// Decode 将客户端发来的帧转换为JSON消息
+	Decode(frameType int, data []byte) ([]byte, error)
+}
+
+// jsonCodec 默认编码，内容原样收发
+type jsonCodec struct{}
+
+func (jsonCodec) Protocol() string { return WSProtocolJSON }
+func (jsonCodec) FrameType() int   { return websocket.TextMessage }
+func (jsonCodec) Batchable() bool  { return true }
+
+func (jsonCodec) Encode(message []byte) ([]byte, error) { return message, nil }
+
+func (jsonCodec) Decode(frameType int, data []byte) ([]byte, error) { return data, nil }
+
+// msgpackCodec MessagePack编码，每条消息单独一个二进制帧
+type msgpackCodec struct{}
+
+var (
+	// wsJSONHandle 解析JSON时整数保留为整数而不是float64
+	wsJSONHandle = &codec.JsonHandle{}
+
+	// wsMsgpackHandle 字符串按str类型收发，对象解析为 map[string]interface{} 以便转换为JSON
+	wsMsgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+)
+
+func init() {
+	mapType := reflect.TypeOf(map[string]interface{}(nil))
+	wsJSONHandle.MapType = mapType
+	wsMsgpackHandle.MapType = mapType
+	wsMsgpackHandle.RawToString = true
+}
+
+func (msgpackCodec) Protocol() string { return WSProtocolMsgpack }
+func (msgpackCodec) FrameType() int   { return websocket.BinaryMessage }
+func (msgpackCodec) Batchable() bool  { return false }
+
+func (msgpackCodec) Encode(message []byte) ([]byte, error) {
+	var v interface{}
+	if err := codec.NewDecoderBytes(message, wsJSONHandle).Decode(&v); err != nil {
+		return nil, err
+	}
+	var out []byte
+	if err := codec.NewEncoderBytes(&out, wsMsgpackHandle).Encode(v); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Decode 二进制帧按MessagePack解析，仍兼容客户端发来的JSON文本帧
+func (msgpackCodec) Decode(frameType int, data []byte) ([]byte, error) {
+	if frameType == websocket.TextMessage {
+		return data, nil
+	}
+	var v interface{}
+	if err := codec.NewDecoderBytes(data, wsMsgpackHandle).Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// wsCodecs 支持的编码，按协商优先级排列
+var wsCodecs = []WSCodec{msgpackCodec{}, jsonCodec{}}
+
+// wsSubprotocols 升级时声明支持的子协议
+func wsSubprotocols() []string {
+	protocols := make([]string, 0, len(wsCodecs))
+	for _, c := range wsCodecs {
+		protocols = append(protocols, c.Protocol())
+	}
+	return protocols
+}
+
+// CodecFor 返回协商出的子协议对应的编码，未协商或不支持时使用JSON
+func CodecFor(protocol string) WSCodec {
+	for _, c := range wsCodecs {
+		if c.Protocol() == protocol {
+			return c
+		}
+	}
+	return jsonCodec{}
+}
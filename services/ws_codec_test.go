@@ -0,0 +1,97 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+func TestWSCodecRoundTrip(t *testing.T) {
+	content, _ := json.Marshal(map[string]interface{}{
+		"id":          uint(1<<40 + 7),
+		"content":     "你好 msgpack",
+		"receiver_id": 2,
+		"mentions":    []string{"alice", "bob"},
+		"edited":      false,
+		"score":       1.5,
+	})
+	original := WebSocketMessage{
+		Type:      "message",
+		Content:   content,
+		Timestamp: time.Date(2024, 5, 1, 12, 30, 0, 123000000, time.UTC),
+	}
+	message, _ := json.Marshal(original)
+
+	for _, c := range []WSCodec{jsonCodec{}, msgpackCodec{}} {
+		t.Run(c.Protocol(), func(t *testing.T) {
+			frame, err := c.Encode(message)
+			if err != nil {
+				t.Fatalf("编码失败: %v", err)
+			}
+			decoded, err := c.Decode(c.FrameType(), frame)
+			if err != nil {
+				t.Fatalf("解码失败: %v", err)
+			}
+
+			var got WebSocketMessage
+			if err := json.Unmarshal(decoded, &got); err != nil {
+				t.Fatalf("解码结果不是合法的WebSocketMessage: %v", err)
+			}
+			if got.Type != original.Type || !got.Timestamp.Equal(original.Timestamp) {
+				t.Fatalf("往返后消息不一致: %+v", got)
+			}
+			var want, gotContent interface{}
+			json.Unmarshal(original.Content, &want)
+			json.Unmarshal(got.Content, &gotContent)
+			wantJSON, _ := json.Marshal(want)
+			gotJSON, _ := json.Marshal(gotContent)
+			if string(wantJSON) != string(gotJSON) {
+				t.Fatalf("往返后内容不一致:\n%s\n%s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestMsgpackCodecFrames(t *testing.T) {
+	c := msgpackCodec{}
+	if c.FrameType() != websocket.BinaryMessage || c.Batchable() {
+		t.Fatal("msgpack应逐条以二进制帧写出")
+	}
+
+	frame, err := c.Encode([]byte(`{"type":"typing","content":{"group_id":3}}`))
+	if err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+	// 写出的帧应为MessagePack而不是JSON
+	var v map[string]interface{}
+	if err := codec.NewDecoderBytes(frame, wsMsgpackHandle).Decode(&v); err != nil || v["type"] != "typing" {
+		t.Fatalf("帧不是合法的MessagePack: %v %v", v, err)
+	}
+	if json.Valid(frame) {
+		t.Fatal("msgpack帧不应是JSON")
+	}
+
+	// 客户端发来的JSON文本帧原样接受
+	text := []byte(`{"type":"ping"}`)
+	decoded, err := c.Decode(websocket.TextMessage, text)
+	if err != nil || string(decoded) != string(text) {
+		t.Fatalf("文本帧解码 = %s, %v", decoded, err)
+	}
+	if _, err := c.Decode(websocket.BinaryMessage, []byte{0xc1}); err == nil {
+		t.Fatal("非法的MessagePack应返回错误")
+	}
+}
+
+func TestCodecFor(t *testing.T) {
+	if CodecFor(WSProtocolMsgpack).Protocol() != WSProtocolMsgpack {
+		t.Fatal("应协商出msgpack")
+	}
+	for _, p := range []string{"", WSProtocolJSON, "protobuf"} {
+		if CodecFor(p).Protocol() != WSProtocolJSON {
+			t.Fatalf("子协议 %q 应回退到JSON", p)
+		}
+	}
+}
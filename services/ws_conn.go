@@ -0,0 +1,24 @@
+package services
+
+import (
+	"io"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WSConn Client 读写协程使用的WebSocket连接接口，*websocket.Conn 实现了该接口
+// 投递逻辑只依赖该接口，可以替换为内存中的连接来验证写出的内容
+type WSConn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	NextWriter(messageType int) (io.WriteCloser, error)
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadLimit(limit int64)
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
+var _ WSConn = (*websocket.Conn)(nil)
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWritePumpWritesQueuedMessagesToConn(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+
+	conn := newFakeConn()
+	client := NewClient(alice.ID, alice.Username, conn)
+	if !m.RegisterClient(client) {
+		t.Fatal("注册客户端失败")
+	}
+	if m.SendToUser(alice.ID+1, []byte(`{"type":"x"}`)) {
+		t.Fatal("发送给未连接的用户应返回false")
+	}
+
+	// 写协程启动前积压的消息合并为一帧，以换行分隔
+	first, second := []byte(`{"type":"a"}`), []byte(`{"type":"b"}`)
+	if !m.SendToUser(alice.ID, first) || !m.SendToUser(alice.ID, second) {
+		t.Fatal("发送消息失败")
+	}
+	done := make(chan struct{})
+	go func() {
+		client.WritePump(m)
+		close(done)
+	}()
+
+	m.UnregisterClient(client)
+	waitClosed(t, done)
+
+	frames := conn.textFrames()
+	want := bytes.Join([][]byte{first, second}, []byte{'\n'})
+	if len(frames) != 1 || !bytes.Equal(frames[0], want) {
+		t.Fatalf("写出的数据帧 = %q，期望 [%q]", frames, want)
+	}
+	if codes := conn.closeCodes(); len(codes) != 1 || codes[0] != websocket.CloseNormalClosure {
+		t.Fatalf("关闭码 = %v，期望 [%d]", codes, websocket.CloseNormalClosure)
+	}
+}
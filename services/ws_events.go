@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"chatroom/models"
+)
+
+// WebSocket自定义关闭码（4000-4999为应用保留区间）
+const (
+	CloseUnauthorized       = 4401 // 认证失败
+	CloseSessionRevoked     = 4403 // 会话已被用户注销
+	CloseSlowClient         = 4408 // 写入超时或发送缓冲已满
+	CloseReplaced           = 4409 // 同一用户建立了新连接，旧连接不应自动重连
+	CloseForcedDisconnect   = 4410 // 被管理员强制断开
+	CloseTooManyConnections = 4429 // 服务器连接数已满
+	CloseServerShutdown     = 4503 // 服务器重启或关闭，客户端应退避后重连
+)
+
+// WSError WebSocket错误事件内容，也用作关闭帧的原因
+type WSError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// HeartbeatConfig 心跳配置，供客户端校准超时
+type HeartbeatConfig struct {
+	PingInterval int `json:"ping_interval"` // 服务端发送ping的间隔（秒）
+	PongTimeout  int `json:"pong_timeout"`  // 未收到pong视为断线的超时时间（秒）
+}
+
+// ConnectedEvent 连接建立后发送的握手事件
+type ConnectedEvent struct {
+	UserID       uint            `json:"user_id"`
+	ServerTime   time.Time       `json:"server_time"`
+	LastAckedSeq uint            `json:"last_acked_seq"` // 用户已确认（已读）的最大消息ID
+	Heartbeat    HeartbeatConfig `json:"heartbeat"`
+}
+
+// SendConnected 将握手事件放入发送队列，需在注册客户端之前调用以保证它是第一条消息
+func (c *Client) SendConnected(lastAckedSeq uint) {
+	c.trySend(newWSEvent("connected", ConnectedEvent{
+		UserID:       c.ID,
+		ServerTime:   time.Now(),
+		LastAckedSeq: lastAckedSeq,
+		Heartbeat: HeartbeatConfig{
+			PingInterval: int(pingPeriod / time.Second),
+			PongTimeout:  int(pongWait / time.Second),
+		},
+	}))
+}
+
+// SendBackfill 发送最近会话的消息回填，发送缓冲已满时最多等待 wait，仍未放入则丢弃并返回false
+func (c *Client) SendBackfill(backfill *models.Backfill, wait time.Duration) bool {
+	return c.sendWithin(newWSEvent("backfill", backfill), wait)
+}
+
+// SendBackfill 向新连接发送消息回填，需在写协程启动后调用：
+// 发送缓冲被同时到达的实时消息占满时按发送超时等待写协程腾出空间，而不是直接丢弃
+func (m *WebSocketManager) SendBackfill(client *Client, backfill *models.Backfill) {
+	if !client.SendBackfill(backfill, m.sendTimeout) {
+		log.Printf("用户 %d 的发送缓冲已满，消息回填未发送", client.ID)
+	}
+}
+
+// SendUnreadSync 向客户端发送各会话的未读数，未列出的会话即为已读完
+// 连接时在写协程启动后调用一次，客户端也可随时发送 unread_sync 请求重新同步；
+// 发送缓冲已满时按发送超时等待写协程腾出空间，仍未放入则记录丢弃
+func (m *WebSocketManager) SendUnreadSync(client *Client, messageService *MessageService) {
+	summary, err := messageService.GetUnreadSummary(context.Background(), client.ID)
+	if err != nil {
+		log.Printf("获取未读汇总失败: %v", err)
+		return
+	}
+
+	// 请求是异步处理的，连接可能已经注销，sendWithin 在发送通道关闭后直接丢弃
+	if !client.sendWithin(newWSEvent("unread_sync", summary), m.sendTimeout) {
+		log.Printf("用户 %d 的发送缓冲已满，未读同步未发送", client.ID)
+	}
+}
+
+// SendError 向客户端发送错误事件，发送缓冲已满或连接已注销时丢弃
+func (c *Client) SendError(code int, message string) {
+	c.trySend(newWSEvent("error", WSError{Code: code, Message: message}))
+}
+
+// CloseWithError 发送带错误信息的关闭帧并关闭连接（仅在写协程启动前使用）
+func (c *Client) CloseWithError(code int, message string) {
+	closeWithError(c.Conn, code, message)
+}
+
+// RejectWebSocket 升级连接后立即以错误关闭帧拒绝，使WebSocket客户端能读到结构化的失败原因
+func RejectWebSocket(w http.ResponseWriter, r *http.Request, code int, message string) {
+	conn, err := Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	closeWithError(conn, code, message)
+}
+
+// closeWithError 写入关闭帧并关闭连接
+func closeWithError(conn WSConn, code int, message string) {
+	reason, _ := json.Marshal(WSError{Code: code, Message: message})
+	// 关闭帧的原因最多123字节
+	if len(reason) > 123 {
+		reason, _ = json.Marshal(WSError{Code: code})
+	}
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, string(reason)),
+		time.Now().Add(writeWait))
+	conn.Close()
+}
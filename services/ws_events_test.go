@@ -0,0 +1,215 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"chatroom/config"
+	"chatroom/models"
+)
+
+func TestClientSendAfterClose(t *testing.T) {
+	client := NewClient(1, "alice", newFakeConn())
+	client.closeSendWith(CloseSessionRevoked, "会话已注销")
+
+	// 连接注销后异步到达的事件直接丢弃，不应panic
+	client.SendConnected(0)
+	client.SendError(400, "bad request")
+	client.SendBackfill(nil, 0)
+}
+
+func TestClientSendDropsWhenFull(t *testing.T) {
+	client := NewClient(1, "alice", newFakeConn())
+	for i := 0; i < cap(client.Send); i++ {
+		client.Send <- []byte("{}")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		client.SendError(400, "bad request")
+		client.SendConnected(0)
+		close(done)
+	}()
+	<-done
+	if len(client.Send) != cap(client.Send) {
+		t.Fatalf("发送缓冲长度 %d", len(client.Send))
+	}
+}
+
+func TestSendConnectedIsFirstEvent(t *testing.T) {
+	client := NewClient(7, "alice", newFakeConn())
+	client.SendConnected(42)
+
+	var event struct {
+		Type    string         `json:"type"`
+		Content ConnectedEvent `json:"content"`
+	}
+	if err := json.Unmarshal(<-client.Send, &event); err != nil {
+		t.Fatalf("解析握手事件失败: %v", err)
+	}
+	if event.Type != "connected" || event.Content.UserID != 7 || event.Content.LastAckedSeq != 42 {
+		t.Fatalf("握手事件内容错误: %+v", event)
+	}
+}
+
+func TestUnreadSyncOnReconnect(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	group := env.createGroup(t, "g", bob, alice)
+	env.seedGroupActivity(t, group.ID)
+
+	receiveSync := func(client *Client) models.UnreadSummary {
+		t.Helper()
+		var event struct {
+			Type    string               `json:"type"`
+			Content models.UnreadSummary `json:"content"`
+		}
+		select {
+		case frame := <-client.Send:
+			if err := json.Unmarshal(frame, &event); err != nil {
+				t.Fatalf("解析事件失败: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("未收到未读同步事件")
+		}
+		if event.Type != "unread_sync" {
+			t.Fatalf("事件类型 = %q，期望 unread_sync", event.Type)
+		}
+		return event.Content
+	}
+
+	// 离线期间累积未读：bob 私聊 2 条、群里 1 条，carol 的私聊已读
+	env.createMessage(t, models.Message{SenderID: bob.ID, ReceiverID: alice.ID, Content: "hi"})
+	env.createMessage(t, models.Message{SenderID: bob.ID, ReceiverID: alice.ID, Content: "hi"})
+	env.createMessage(t, models.Message{SenderID: bob.ID, GroupID: group.ID, Content: "hi"})
+	env.createMessage(t, models.Message{SenderID: carol.ID, ReceiverID: alice.ID, Content: "hi"})
+	if err := env.messages.MarkMessagesAsRead(alice.ID, carol.ID, false, 0); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+
+	client := NewClient(alice.ID, alice.Username, newFakeConn())
+	m.SendUnreadSync(client, env.messages)
+	summary := receiveSync(client)
+	if summary.TotalUnread != 3 || len(summary.Conversations) != 2 {
+		t.Fatalf("未读汇总 = %+v，期望 2 个会话共 3 条", summary)
+	}
+	for _, chat := range summary.Conversations {
+		want := 2
+		if chat.Type == "group" {
+			want = 1
+		}
+		if chat.TargetID == carol.ID || chat.UnreadCount != want {
+			t.Fatalf("会话未读 = %+v", chat)
+		}
+	}
+
+	// 客户端主动请求时重新同步，已读完的会话不再列出
+	if err := env.messages.MarkMessagesAsRead(alice.ID, bob.ID, false, 0); err != nil {
+		t.Fatalf("标记已读失败: %v", err)
+	}
+	client.handleReceivedMessage([]byte(`{"type":"unread_sync"}`), m, env.messages)
+	summary = receiveSync(client)
+	if summary.TotalUnread != 1 || len(summary.Conversations) != 1 || summary.Conversations[0].TargetID != group.ID {
+		t.Fatalf("重新同步的未读汇总 = %+v，期望只剩群聊 1 条", summary)
+	}
+}
+
+func TestSendBackfillWaitsBehindLiveTraffic(t *testing.T) {
+	original := config.AppConfig.WSSendBufferSize
+	t.Cleanup(func() { config.AppConfig.WSSendBufferSize = original })
+	config.AppConfig.WSSendBufferSize = 2
+
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	m.sendTimeout = time.Second
+	alice := env.createUser(t, "alice")
+
+	// 注册后写协程启动前到达的实时消息占满发送缓冲
+	conn := newFakeConn()
+	client := NewClient(alice.ID, alice.Username, conn)
+	if !m.RegisterClient(client) {
+		t.Fatal("注册客户端失败")
+	}
+	live := []byte(`{"type":"message"}`)
+	for i := 0; i < cap(client.Send); i++ {
+		if !m.SendToUser(alice.ID, live) {
+			t.Fatal("发送实时消息失败")
+		}
+	}
+
+	// 回填期间实时消息持续到达
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			m.SendToUser(alice.ID, live)
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		client.WritePump(m)
+		close(done)
+	}()
+	m.SendBackfill(client, &models.Backfill{})
+	wg.Wait()
+
+	deadline := time.Now().Add(time.Second)
+	for !bytes.Contains(bytes.Join(conn.textFrames(), nil), []byte(`"type":"backfill"`)) {
+		if time.Now().After(deadline) {
+			t.Fatal("缓冲被实时消息占满时回填被丢弃")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if codes := conn.closeCodes(); len(codes) != 0 {
+		t.Fatalf("新连接被关闭: %v", codes)
+	}
+
+	m.DisconnectUser(alice.ID, "")
+	waitClosed(t, done)
+}
+
+func TestSendUnreadSyncWaitsForBufferSpace(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	m.sendTimeout = time.Second
+	alice := env.createUser(t, "alice")
+	client := NewClient(alice.ID, alice.Username, newFakeConn())
+	for i := 0; i < cap(client.Send); i++ {
+		client.Send <- []byte(`{"type":"message"}`)
+	}
+
+	// 写协程稍后腾出空间，未读同步应等待而不是直接丢弃
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-client.Send
+	}()
+	m.SendUnreadSync(client, env.messages)
+
+	found := false
+	for len(client.Send) > 0 {
+		if bytes.Contains(<-client.Send, []byte(`"type":"unread_sync"`)) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("发送缓冲暂时已满时未读同步被丢弃")
+	}
+
+	// 缓冲一直未腾出时等待发送超时后放弃，不阻塞调用方
+	m.sendTimeout = 10 * time.Millisecond
+	for i := 0; i < cap(client.Send); i++ {
+		client.Send <- []byte(`{"type":"message"}`)
+	}
+	start := time.Now()
+	m.SendUnreadSync(client, env.messages)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("缓冲已满时等待了 %v", elapsed)
+	}
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"sync"
+
+	"chatroom/config"
+)
+
+// fanoutBatchSize 每个投递协程至少负责的客户端数，接收者较少时直接在当前协程投递
+const fanoutBatchSize = 64
+
+// fanOut 将消息投递给一组客户端，发送缓冲区已满或已注销的客户端跳过
+// 客户端列表由调用方在持锁期间复制，投递在锁外进行，最多使用 WS_FANOUT_WORKERS 个协程
+func (m *WebSocketManager) fanOut(clients []*Client, message []byte) {
+	workers := (len(clients) + fanoutBatchSize - 1) / fanoutBatchSize
+	if workers > config.AppConfig.WSFanoutWorkers {
+		workers = config.AppConfig.WSFanoutWorkers
+	}
+	if workers <= 1 {
+		for _, client := range clients {
+			client.trySend(message)
+		}
+		return
+	}
+
+	// 按步长切分，各协程负责互不重叠的客户端
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(start int) {
+			defer wg.Done()
+			for i := start; i < len(clients); i += workers {
+				clients[i].trySend(message)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrMissingMessageType WebSocket消息缺少type字段
+var ErrMissingMessageType = errors.New("消息缺少类型")
+
+// WebSocketMessage WebSocket消息封装，客户端与服务端往来的所有消息都使用该格式
+type WebSocketMessage struct {
+	Type      string          `json:"type"`
+	Content   json.RawMessage `json:"content"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// newWSEvent 构建WebSocket事件消息，payload 会被序列化为 content
+func newWSEvent(eventType string, payload interface{}) []byte {
+	content, _ := json.Marshal(payload)
+	return newWSRawEvent(eventType, content)
+}
+
+// newWSRawEvent 使用已序列化的 content 构建WebSocket事件消息
+func newWSRawEvent(eventType string, content []byte) []byte {
+	wsMsgJSON, _ := json.Marshal(WebSocketMessage{
+		Type:      eventType,
+		Content:   content,
+		Timestamp: time.Now(),
+	})
+	return wsMsgJSON
+}
+
+// parseWSMessage 解析客户端发来的WebSocket消息
+func parseWSMessage(data []byte) (*WebSocketMessage, error) {
+	var wsMsg WebSocketMessage
+	if err := json.Unmarshal(data, &wsMsg); err != nil {
+		return nil, err
+	}
+	if wsMsg.Type == "" {
+		return nil, ErrMissingMessageType
+	}
+	return &wsMsg, nil
+}
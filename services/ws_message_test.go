@@ -0,0 +1,58 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"chatroom/models"
+)
+
+func TestWSEventRoundTrip(t *testing.T) {
+	tests := []struct {
+		eventType string
+		payload   interface{}
+		decoded   interface{} // 解析 content 使用的类型
+	}{
+		{"chat_message", models.MessageRequest{Content: "hi", ReceiverID: 2, Type: models.PrivateMessage}, &models.MessageRequest{}},
+		{"typing", map[string]uint{"receiver_id": 2}, &map[string]uint{}},
+		{"error", WSError{Code: 403, Message: "禁止"}, &WSError{}},
+		{"subscribe_groups", GroupSubscriptionRequest{GroupIDs: []uint{1, 2}}, &GroupSubscriptionRequest{}},
+		{"reaction_update", models.ReactionUpdateEvent{MessageID: 1, Emoji: "👍", Reactions: []models.ReactionSummary{}}, &models.ReactionUpdateEvent{}},
+		{"unread_sync", struct{}{}, &struct{}{}},
+	}
+	for _, tt := range tests {
+		before := time.Now()
+		wsMsg, err := parseWSMessage(newWSEvent(tt.eventType, tt.payload))
+		if err != nil {
+			t.Fatalf("%s: 解析失败: %v", tt.eventType, err)
+		}
+		if wsMsg.Type != tt.eventType || wsMsg.Timestamp.Before(before) {
+			t.Errorf("%s: 消息 = %+v", tt.eventType, wsMsg)
+		}
+		if err := json.Unmarshal(wsMsg.Content, tt.decoded); err != nil {
+			t.Fatalf("%s: 解析内容失败: %v", tt.eventType, err)
+		}
+		if got := reflect.ValueOf(tt.decoded).Elem().Interface(); !reflect.DeepEqual(got, tt.payload) {
+			t.Errorf("%s: 内容 = %+v，期望 %+v", tt.eventType, got, tt.payload)
+		}
+	}
+
+	// 已序列化的内容原样保留
+	raw := []byte(`{"message_id":7}`)
+	wsMsg, err := parseWSMessage(newWSRawEvent("message_deleted", raw))
+	if err != nil || string(wsMsg.Content) != string(raw) {
+		t.Fatalf("原始内容 = %s, %v，期望 %s", wsMsg.Content, err, raw)
+	}
+}
+
+func TestParseWSMessageRejectsInvalid(t *testing.T) {
+	if _, err := parseWSMessage([]byte(`{"content":{}}`)); !errors.Is(err, ErrMissingMessageType) {
+		t.Fatalf("缺少类型 = %v，期望 ErrMissingMessageType", err)
+	}
+	if _, err := parseWSMessage([]byte(`not json`)); err == nil {
+		t.Fatal("非法JSON应返回错误")
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+
+	"chatroom/models"
+)
+
+// GroupSubscriptionRequest subscribe_groups / unsubscribe_groups 控制消息内容
+type GroupSubscriptionRequest struct {
+	GroupIDs []uint `json:"group_ids"`
+}
+
+// SubscriptionsEvent 订阅变更后返回的当前群组订阅列表
+type SubscriptionsEvent struct {
+	GroupIDs []uint `json:"group_ids"`
+	Rejected []uint `json:"rejected,omitempty"` // 非成员等原因未能订阅的群组
+}
+
+// ActiveConversationRequest active_conversation 控制消息内容，两者都为空表示没有打开的会话
+type ActiveConversationRequest struct {
+	ReceiverID uint `json:"receiver_id,omitempty"`
+	GroupID    uint `json:"group_id,omitempty"`
+}
+
+// conversationID 返回请求对应的会话ID
+func (r ActiveConversationRequest) conversationID(userID uint) string {
+	switch {
+	case r.GroupID > 0:
+		return models.GroupConversationID(r.GroupID)
+	case r.ReceiverID > 0:
+		return models.ConversationID(userID, r.ReceiverID)
+	default:
+		return ""
+	}
+}
+
+// SubscribeToGroupChannel 将客户端加入群组频道的本地订阅者
+// 同一群组在本节点只订阅一次Kafka主题，消息分发给所有本地订阅者
+func (m *WebSocketManager) SubscribeToGroupChannel(client *Client, groupID uint) {
+	if m.kafka == nil {
+		log.Printf("Kafka不可用，跳过群组频道订阅: 用户%d, 群组%d", client.ID, groupID)
+		return
+	}
+
+	m.mu.Lock()
+	// 已注销的客户端发送通道已关闭，不能再加入订阅者
+	if m.clients[client.ID] != client {
+		m.mu.Unlock()
+		return
+	}
+	subscribers, exists := m.groupSubscribers[groupID]
+	if !exists {
+		subscribers = make(map[*Client]struct{})
+		m.groupSubscribers[groupID] = subscribers
+	}
+	subscribers[client] = struct{}{}
+	client.groups[groupID] = struct{}{}
+	m.mu.Unlock()
+
+	if exists {
+		return
+	}
+
+	topic := m.kafka.BuildTopicName("group", groupID)
+	err := m.kafka.SubscribeTopic(topic, func(message []byte) {
+		m.deliverToGroupSubscribers(groupID, message)
+	})
+	if err != nil {
+		log.Printf("订阅群组主题失败: %v", err)
+	}
+}
+
+// UnsubscribeClientFromGroup 将客户端移出群组频道，本节点无订阅者时取消订阅Kafka主题
+func (m *WebSocketManager) UnsubscribeClientFromGroup(client *Client, groupID uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeGroupSubscriberLocked(client, groupID)
+}
+
+// HandleMemberRemoved 成员被移除或退出后取消其在本节点上的群组频道订阅
+func (m *WebSocketManager) HandleMemberRemoved(groupID, userID uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if client, ok := m.clients[userID]; ok {
+		m.removeGroupSubscriberLocked(client, groupID)
+	}
+}
+
+// GroupSubscriptions 返回客户端当前订阅的群组ID
+func (m *WebSocketManager) GroupSubscriptions(client *Client) []uint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	groupIDs := make([]uint, 0, len(client.groups))
+	for groupID := range client.groups {
+		groupIDs = append(groupIDs, groupID)
+	}
+	return groupIDs
+}
+
+// SetActiveConversation 记录客户端当前打开的会话，群组输入状态只推送给打开了该群组的成员
+func (m *WebSocketManager) SetActiveConversation(client *Client, conversationID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client.activeConversation = conversationID
+}
+
+// deliverToGroupSubscribers 将群组消息投递给本节点上订阅了该群组的客户端，发送缓冲区已满的跳过
+// 输入状态只投递给当前打开了该群组的客户端，避免大群中的无效推送
+func (m *WebSocketManager) deliverToGroupSubscribers(groupID uint, message []byte) {
+	typing := envelopeType(message) == "typing"
+	conversationID := models.GroupConversationID(groupID)
+
+	m.mu.RLock()
+	subscribers := m.groupSubscribers[groupID]
+	clients := make([]*Client, 0, len(subscribers))
+	for client := range subscribers {
+		if typing && client.activeConversation != conversationID {
+			continue
+		}
+		clients = append(clients, client)
+	}
+	m.mu.RUnlock()
+
+	m.fanOut(clients, message)
+}
+
+// envelopeType 返回消息队列封装中的消息类型，解析失败时返回空
+func envelopeType(message []byte) string {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &header); err != nil {
+		return ""
+	}
+	return header.Type
+}
+
+// removeGroupSubscriberLocked 移除单个群组订阅，调用方需持有写锁
+func (m *WebSocketManager) removeGroupSubscriberLocked(client *Client, groupID uint) {
+	delete(client.groups, groupID)
+
+	subscribers, ok := m.groupSubscribers[groupID]
+	if !ok {
+		return
+	}
+	delete(subscribers, client)
+	if len(subscribers) == 0 {
+		delete(m.groupSubscribers, groupID)
+		m.UnsubscribeFromGroupChannel(groupID)
+	}
+}
+
+// dropGroupSubscriptionsLocked 移除客户端的全部群组订阅，调用方需持有写锁
+func (m *WebSocketManager) dropGroupSubscriptionsLocked(client *Client) {
+	for groupID := range client.groups {
+		m.removeGroupSubscriberLocked(client, groupID)
+	}
+}
+
+// handleGroupSubscription 处理客户端的群组订阅变更，只允许订阅自己所在的群组
+func (c *Client) handleGroupSubscription(subscribe bool, groupIDs []uint, wsManager *WebSocketManager, messageService *MessageService) {
+	var rejected []uint
+	for _, groupID := range groupIDs {
+		if !subscribe {
+			wsManager.UnsubscribeClientFromGroup(c, groupID)
+			continue
+		}
+
+		rank, err := messageService.groupRank(groupID, c.ID)
+		if err != nil || rank == rankNone {
+			rejected = append(rejected, groupID)
+			continue
+		}
+		wsManager.SubscribeToGroupChannel(c, groupID)
+	}
+
+	c.trySend(newWSEvent("subscriptions", SubscriptionsEvent{
+		GroupIDs: wsManager.GroupSubscriptions(c),
+		Rejected: rejected,
+	}))
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"chatroom/models"
+)
+
+func TestClientReceivesOnlySubscribedGroups(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	work := env.createGroup(t, "work", bob, alice)
+	games := env.createGroup(t, "games", bob, alice)
+	other := env.createGroup(t, "other", bob)
+
+	client := NewClient(alice.ID, alice.Username, newFakeConn())
+	if !m.RegisterClient(client) {
+		t.Fatal("注册客户端失败")
+	}
+	// 注册后再接入Kafka，避免上线状态发布到不存在的主题
+	m.kafka = newTestKafka(nil)
+	for _, group := range []uint{work.ID, games.ID, other.ID} {
+		m.kafka.topics[m.kafka.BuildTopicName("group", group)] = true
+	}
+
+	// next 读取下一个事件，没有事件时返回空
+	next := func() *WebSocketMessage {
+		select {
+		case frame := <-client.Send:
+			var event WebSocketMessage
+			if err := json.Unmarshal(frame, &event); err != nil {
+				t.Fatalf("解析事件失败: %v", err)
+			}
+			return &event
+		default:
+			return nil
+		}
+	}
+	control := func(eventType string, groupIDs ...uint) SubscriptionsEvent {
+		t.Helper()
+		req, _ := json.Marshal(GroupSubscriptionRequest{GroupIDs: groupIDs})
+		client.handleReceivedMessage(newWSRawEvent(eventType, req), m, env.messages)
+		event := next()
+		if event == nil || event.Type != "subscriptions" {
+			t.Fatalf("%s 响应 = %+v，期望 subscriptions 事件", eventType, event)
+		}
+		var subs SubscriptionsEvent
+		json.Unmarshal(event.Content, &subs)
+		return subs
+	}
+
+	// 只能订阅自己所在的群组
+	subs := control("subscribe_groups", work.ID, other.ID)
+	if len(subs.GroupIDs) != 1 || subs.GroupIDs[0] != work.ID || len(subs.Rejected) != 1 || subs.Rejected[0] != other.ID {
+		t.Fatalf("订阅结果 = %+v，期望订阅 work、拒绝 other", subs)
+	}
+
+	deliver := func(groupID uint) {
+		m.deliverToGroupSubscribers(groupID, []byte(fmt.Sprintf(`{"type":"chat_message","group_id":%d}`, groupID)))
+	}
+	deliver(work.ID)
+	if event := next(); event == nil || event.Type != "chat_message" {
+		t.Fatalf("已订阅群组的消息 = %+v，期望收到", event)
+	}
+	// 未订阅的群组即使是成员也不推送
+	deliver(games.ID)
+	deliver(other.ID)
+	if event := next(); event != nil {
+		t.Fatalf("收到未订阅群组的消息: %+v", event)
+	}
+
+	subs = control("unsubscribe_groups", work.ID)
+	if len(subs.GroupIDs) != 0 {
+		t.Fatalf("取消订阅后列表 = %v，期望为空", subs.GroupIDs)
+	}
+	deliver(work.ID)
+	if event := next(); event != nil {
+		t.Fatalf("取消订阅后仍收到消息: %+v", event)
+	}
+}
+
+func TestGroupTypingOnlyToActiveMembers(t *testing.T) {
+	env := newTestEnv(t)
+	m := newTestManager(env)
+	alice := env.createUser(t, "alice")
+	bob := env.createUser(t, "bob")
+	carol := env.createUser(t, "carol")
+	dave := env.createUser(t, "dave")
+	group := env.createGroup(t, "g", alice, bob, carol, dave)
+
+	clients := make(map[uint]*Client)
+	for _, user := range []*models.User{bob, carol, dave} {
+		client := NewClient(user.ID, user.Username, newFakeConn())
+		if !m.RegisterClient(client) {
+			t.Fatal("注册客户端失败")
+		}
+		clients[user.ID] = client
+	}
+	// 注册后再接入Kafka，避免上线状态发布到不存在的主题
+	m.kafka = newTestKafka(nil)
+	m.kafka.topics[m.kafka.BuildTopicName("group", group.ID)] = true
+
+	control := func(client *Client, eventType string, payload interface{}) {
+		t.Helper()
+		content, _ := json.Marshal(payload)
+		client.handleReceivedMessage(newWSRawEvent(eventType, content), m, env.messages)
+	}
+	drain := func() {
+		for _, client := range clients {
+			for len(client.Send) > 0 {
+				<-client.Send
+			}
+		}
+	}
+	received := func(eventType string) map[uint]bool {
+		t.Helper()
+		event, _ := NewEnvelope(eventType, []byte(`{}`))
+		m.deliverToGroupSubscribers(group.ID, event)
+		got := make(map[uint]bool)
+		for userID, client := range clients {
+			select {
+			case <-client.Send:
+				got[userID] = true
+			default:
+			}
+		}
+		return got
+	}
+
+	for _, client := range clients {
+		control(client, "subscribe_groups", GroupSubscriptionRequest{GroupIDs: []uint{group.ID}})
+	}
+	// bob 打开了群组，carol 打开了与 alice 的私聊，dave 没有打开会话
+	control(clients[bob.ID], "active_conversation", ActiveConversationRequest{GroupID: group.ID})
+	control(clients[carol.ID], "active_conversation", ActiveConversationRequest{ReceiverID: alice.ID})
+	drain()
+
+	if got := received("typing"); len(got) != 1 || !got[bob.ID] {
+		t.Fatalf("输入状态投递给 %v，期望只有 bob", got)
+	}
+	// 其他群消息仍投递给所有订阅者
+	if got := received("chat_message"); len(got) != 3 {
+		t.Fatalf("群消息投递给 %v，期望全部订阅者", got)
+	}
+
+	// 关闭会话后不再收到输入状态
+	control(clients[bob.ID], "active_conversation", ActiveConversationRequest{})
+	if got := received("typing"); len(got) != 0 {
+		t.Fatalf("关闭会话后输入状态投递给 %v，期望无人", got)
+	}
+}